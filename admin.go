@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/middleware"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/rest"
+)
+
+// initializeAdminRoutes mounts the operator's endpoints on AdminRouter, which
+// is served apart from the public API and only to APP_ADMIN_TOKEN
+func (a *App) initializeAdminRoutes() {
+	a.AdminRouter.HandleFunc("/admin/tenants", a.getTenants).Methods("GET").Name(rest.RouteTenants)
+	a.AdminRouter.HandleFunc("/admin/tenants", a.createTenant).Methods("POST")
+	a.AdminRouter.HandleFunc("/admin/tenants/{tenantId}", a.deleteTenant).Methods("DELETE")
+	a.AdminRouter.HandleFunc("/admin/tenants/{tenantId}/key", a.issueTenantKey).Methods("POST")
+
+	a.AdminRouter.HandleFunc("/admin/exchange-rates", a.getExchangeRates).Methods("GET")
+	a.AdminRouter.HandleFunc("/admin/exchange-rates", a.setExchangeRates).Methods("PUT")
+
+	a.AdminRouter.HandleFunc("/admin/maintenance/expire-reservations", a.expireReservationsNow).Methods("POST")
+	a.AdminRouter.HandleFunc("/admin/maintenance/apply-prices", a.applyPricesNow).Methods("POST")
+
+	a.AdminRouter.Handle("/debug/vars", expvar.Handler())
+	a.AdminRouter.HandleFunc("/debug/pprof/", pprof.Index)
+	a.AdminRouter.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	a.AdminRouter.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	a.AdminRouter.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	a.AdminRouter.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	// Manually add support for paths linked to by index page at /debug/pprof/
+	a.AdminRouter.Handle("/debug/pprof/goroutine", pprof.Handler("goroutine"))
+	a.AdminRouter.Handle("/debug/pprof/heap", pprof.Handler("heap"))
+	a.AdminRouter.Handle("/debug/pprof/threadcreate", pprof.Handler("threadcreate"))
+	a.AdminRouter.Handle("/debug/pprof/block", pprof.Handler("block"))
+	a.AdminRouter.Handle("/debug/pprof/mutex", pprof.Handler("mutex"))
+	a.AdminRouter.Handle("/debug/pprof/allocs", pprof.Handler("allocs"))
+
+	cors := middleware.CORS{Router: a.AdminRouter, Policy: a.adminCORSPolicy}
+	a.AdminRouter.MethodNotAllowedHandler = cors.Preflight(nil)
+	a.AdminRouter.Use(cors.Middleware, a.requireAdmin)
+}
+
+// requireAdmin only lets through requests bearing APP_ADMIN_TOKEN. With no
+// token configured the admin listener is closed.
+func (a *App) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if a.AdminToken == "" ||
+			subtle.ConstantTimeCompare([]byte(token), []byte(a.AdminToken)) != 1 {
+			rest.RespondWithError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// expireReservationsNow runs the reservation sweep without waiting for it
+func (a *App) expireReservationsNow(w http.ResponseWriter, r *http.Request) {
+	n, err := repositories.ExpireReservations(a.DB.WithContext(r.Context()), time.Now())
+	if err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	rest.RespondWithJSON(w, http.StatusOK, map[string]int{"expired": n})
+}
+
+// applyPricesNow runs the price scheduler without waiting for it
+func (a *App) applyPricesNow(w http.ResponseWriter, r *http.Request) {
+	n, err := a.applyPricesDueAt(r.Context(), time.Now())
+	if err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	rest.RespondWithJSON(w, http.StatusOK, map[string]int{"applied": n})
+}
+
+// listenAdmin listens on addr, a host:port or unix:/path/to/socket. A socket
+// left behind by an earlier run is replaced, and the new one is only
+// reachable by its owner.
+func listenAdmin(addr string) (net.Listener, error) {
+	path := strings.TrimPrefix(addr, "unix:")
+	if path == addr {
+		return net.Listen("tcp", addr)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		lis.Close()
+		return nil, err
+	}
+	return lis, nil
+}
+
+// serveAdmin serves AdminRouter on addr. It takes no part in the public
+// API's client limit, so a long profile cannot starve product requests and
+// a busy API cannot lock the operator out.
+func (a *App) serveAdmin(addr string) *http.Server {
+	srv := &http.Server{
+		ReadTimeout: time.Second * 15,
+		IdleTimeout: time.Second * 60,
+		// No WriteTimeout: /debug/pprof/profile streams for as long as asked
+		Handler: a.AdminRouter,
+	}
+	lis, err := listenAdmin(addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("admin listening on %s", addr)
+	go func() {
+		if err := srv.Serve(lis); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	return srv
+}
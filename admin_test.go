@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/tenants"
+)
+
+func TestDiagnosticsAreNotPublic(t *testing.T) {
+	for _, url := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/vars", "/admin/tenants"} {
+		req, _ := http.NewRequest("GET", url, nil)
+		checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+	}
+}
+
+func TestDiagnosticsRequireAdminToken(t *testing.T) {
+	a.AdminToken = testAdminToken
+	defer func() { a.AdminToken = "" }()
+
+	for _, url := range []string{"/debug/pprof/", "/debug/vars"} {
+		req, _ := http.NewRequest("GET", url, nil)
+		checkResponseCode(t, http.StatusForbidden, executeAdminRequest(req).Code)
+		checkResponseCode(t, http.StatusOK, executeAdminRequest(adminRequest("GET", url, "")).Code)
+	}
+}
+
+func TestMaintenanceRunsSweeps(t *testing.T) {
+	clearTable()
+	a.AdminToken = testAdminToken
+	defer func() { a.AdminToken = "" }()
+
+	p := data.CreateProduct("Anvil", 10)
+	if err := repositories.CreateProduct(a.DB, tenants.Default, p); err != nil {
+		t.Fatal(err)
+	}
+	if err := repositories.SetStock(a.DB, tenants.Default, p.GetID(), 5); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repositories.Reserve(a.DB, tenants.Default, p.GetID(), 2, time.Minute, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	response := executeAdminRequest(adminRequest("POST", "/admin/maintenance/expire-reservations", ""))
+	checkResponseCode(t, http.StatusOK, response.Code)
+	if body := strings.TrimSpace(response.Body.String()); body != `{"expired":1}` {
+		t.Errorf("Expected one reservation expired. Got %s", body)
+	}
+
+	response = executeAdminRequest(adminRequest("POST", "/admin/maintenance/apply-prices", ""))
+	checkResponseCode(t, http.StatusOK, response.Code)
+	if body := strings.TrimSpace(response.Body.String()); body != `{"applied":0}` {
+		t.Errorf("Expected no prices due. Got %s", body)
+	}
+}
+
+func TestListenAdminOnUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin.sock")
+	stale, err := listenAdmin("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stale.Close()
+
+	// A socket left behind by an earlier run is replaced
+	lis, err := listenAdmin("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	if lis.Addr().Network() != "unix" {
+		t.Errorf("Expected a unix socket. Got %s", lis.Addr().Network())
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected a socket only its owner can reach. Got %v %v", info, err)
+	}
+}
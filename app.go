@@ -4,53 +4,155 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
-	"net/http/pprof"
 	"net/url"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/text/language"
+	"google.golang.org/grpc"
 
+	"github.com/Lewiscowles1986/go-gorilla-api/blob"
 	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/events"
+	"github.com/Lewiscowles1986/go-gorilla-api/graph"
+	"github.com/Lewiscowles1986/go-gorilla-api/imaging"
+	"github.com/Lewiscowles1986/go-gorilla-api/middleware"
+	"github.com/Lewiscowles1986/go-gorilla-api/outbox"
 	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
 	"github.com/Lewiscowles1986/go-gorilla-api/rest"
+	"github.com/Lewiscowles1986/go-gorilla-api/rpc"
+	"github.com/Lewiscowles1986/go-gorilla-api/settings"
+	"github.com/Lewiscowles1986/go-gorilla-api/telemetry"
+	"github.com/Lewiscowles1986/go-gorilla-api/tenants"
 )
 
 // App - Structure for Global State
 type App struct {
 	Router *mux.Router
-	DB     *sql.DB
+	// Handler serves the public API: Router, behind what must see requests
+	// before Router matches them to a tenant
+	Handler http.Handler
+	DB      *repositories.DB
+	// Replicas routes product reads away from DB, the primary
+	Replicas *repositories.Cluster
+	Events   *events.Broker
+	// ReservationTTL is how long stock is held when a client names no TTL
+	ReservationTTL time.Duration
+	// Tenants decides which storefront each request belongs to
+	Tenants tenants.Resolver
+	// AdminRouter holds /admin and /debug, served apart from Router
+	AdminRouter *mux.Router
+	// AdminToken guards AdminRouter; empty closes it
+	AdminToken string
+	// AbsoluteURLs makes links absolute, as seen through any proxy
+	AbsoluteURLs bool
+	// Body reads the JSON every write endpoint takes
+	Body rest.Decoder
+	// CORS is the cross-origin policy of the public API, and AdminCORS of
+	// /admin; no allowed origins turns CORS off for those routes
+	CORS      middleware.CORSPolicy
+	AdminCORS middleware.CORSPolicy
+	// Images keeps product images and their thumbnails
+	Images      blob.Store
+	ImageLimits ImageLimits
+	// DefaultLocale is what products' own names and descriptions are
+	// written in, and what is served when no translation suits
+	DefaultLocale language.Tag
+	// BaseCurrency is what products are priced in, and what exchange
+	// rates convert from
+	BaseCurrency string
 }
 
 // Initialize - Setup App resources
 func (a *App) Initialize(connType, connectionString string) {
 	var err error
-	a.DB, err = sql.Open(connType, connectionString)
+	a.DB, err = repositories.Open(connType, connectionString)
 	if err != nil {
 		log.Fatal(err)
 	}
+	replicas, err := openReplicas(connType, settings.Getenv("APP_DB_REPLICAS", ""))
+	if err != nil {
+		log.Fatal(err)
+	}
+	a.Replicas = repositories.NewCluster(a.DB, replicas...)
+	a.Replicas.PinFor = time.Duration(
+		settings.GetenvInt("APP_DB_PIN_SECONDS", 2)) * time.Second
+	a.logReplicas(len(replicas))
 
 	a.Router = mux.NewRouter()
+	a.AdminRouter = mux.NewRouter()
+	a.Events = events.NewBroker()
+	a.ReservationTTL = time.Duration(
+		settings.GetenvInt("APP_RESERVATION_TTL_SECONDS", 900)) * time.Second
+	a.Tenants = tenants.Resolver{
+		Domain:   settings.Getenv("APP_TENANT_DOMAIN", ""),
+		Required: settings.Getenv("APP_TENANT_REQUIRED", "") == "true",
+		Exists: func(id string) (bool, error) {
+			return repositories.TenantExists(a.DB, id)
+		},
+		KeyHash: func(id string) (string, error) {
+			return repositories.TenantKeyHash(a.DB, id)
+		},
+	}
+	a.AdminToken = settings.Getenv("APP_ADMIN_TOKEN", "")
+	a.AbsoluteURLs = settings.Getenv("APP_ABSOLUTE_URLS", "") == "true"
+	a.Body = rest.Decoder{
+		MaxBytes: int64(settings.GetenvInt("APP_MAX_BODY_BYTES", rest.DefaultMaxBodyBytes)),
+		Strict:   settings.Getenv("APP_STRICT_JSON", "") == "true",
+	}
+	a.CORS = corsPolicy("APP_CORS")
+	a.AdminCORS = a.CORS
+	if origins := settings.Getenv("APP_CORS_ADMIN_ORIGINS", ""); origins != "" {
+		a.AdminCORS.AllowedOrigins = splitList(origins)
+	}
+	a.Images, err = blobStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+	a.ImageLimits = imageLimits()
+	a.DefaultLocale, err = defaultLocale()
+	if err != nil {
+		log.Fatal(err)
+	}
+	a.BaseCurrency, err = baseCurrency()
+	if err != nil {
+		log.Fatal(err)
+	}
 	a.initializeDB()
+	if path := settings.Getenv("APP_EXCHANGE_RATES_FILE", ""); path != "" {
+		if err := a.loadExchangeRates(path); err != nil {
+			log.Fatal(err)
+		}
+	}
 	a.initializeRoutes()
+	a.initializeAdminRoutes()
 }
 
 // Run - Main Loop
-func (a *App) Run(addr string, wait time.Duration) {
+func (a *App) Run(addr, grpcAddr, adminAddr string, wait time.Duration) {
+	stopTracing, err := telemetry.Setup(context.Background(), traceConfig())
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	srv := &http.Server{
 		Addr: addr,
 		// Good practice to set timeouts to avoid Slowloris attacks.
 		WriteTimeout: time.Second * 15,
 		ReadTimeout:  time.Second * 15,
 		IdleTimeout:  time.Second * 60,
-		Handler:      maxClientsMiddleware(a.Router, 5), // Pass our instance of gorilla/mux in.
+		Handler:      telemetry.Middleware(maxClientsMiddleware(a.Handler, 5)), // Pass our instance of gorilla/mux in.
 	}
 
 	// Run our server in a goroutine so that it doesn't block.
@@ -58,6 +160,31 @@ func (a *App) Run(addr string, wait time.Duration) {
 		log.Fatal(srv.ListenAndServe())
 	}()
 
+	adminSrv := a.serveAdmin(adminAddr)
+
+	grpcSrv := rpc.NewGRPCServer(a.DB, a.Events, a.Images, a.Tenants)
+	lis, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go func() {
+		log.Fatal(grpcSrv.Serve(lis))
+	}()
+
+	sweepCtx, stopSweeping := context.WithCancel(context.Background())
+	go a.expireReservations(sweepCtx, time.Duration(
+		settings.GetenvInt("APP_RESERVATION_SWEEP_SECONDS", 30))*time.Second)
+	go a.applyScheduledPrices(sweepCtx, time.Duration(
+		settings.GetenvInt("APP_PRICE_SCHEDULER_SECONDS", 30))*time.Second)
+	go a.checkReplicas(sweepCtx, time.Duration(
+		settings.GetenvInt("APP_DB_REPLICA_CHECK_SECONDS", 5))*time.Second)
+	sinks, err := outboxSinks()
+	if err != nil {
+		log.Fatal(err)
+	}
+	go outbox.NewRelay(a.DB, outboxConfig(), sinks...).Run(sweepCtx, time.Duration(
+		settings.GetenvInt("APP_OUTBOX_RELAY_SECONDS", 1))*time.Second)
+
 	c := make(chan os.Signal, 1)
 	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C)
 	// SIGKILL, SIGQUIT or SIGTERM (Ctrl+/) will not be caught.
@@ -73,8 +200,21 @@ func (a *App) Run(addr string, wait time.Duration) {
 	// Doesn't block if no connections, but will otherwise wait
 	// until the timeout deadline.
 
-	srv.Shutdown(ctx)
-	a.DB.Close()
+	var stopping sync.WaitGroup
+	for _, s := range []*http.Server{srv, adminSrv} {
+		stopping.Add(1)
+		go func(s *http.Server) {
+			defer stopping.Done()
+			s.Shutdown(ctx)
+		}(s)
+	}
+	stopGRPC(ctx, grpcSrv)
+	stopping.Wait()
+	stopSweeping()
+	a.Replicas.Close()
+	if err := stopTracing(ctx); err != nil {
+		log.Printf("flushing traces: %v", err)
+	}
 
 	log.Println("shutting down")
 	os.Exit(0)
@@ -83,79 +223,267 @@ func (a *App) Run(addr string, wait time.Duration) {
 func (a *App) initializeRoutes() {
 	uuid4Regex := "[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-4[a-fA-F0-9]{3}-[89abAB][a-fA-F0-9]{3}-[a-fA-F0-9]{12}"
 
+	// Everything below belongs to the tenant the request resolves to
+	scoped := a.Router.NewRoute().MatcherFunc(a.Tenants.Matcher()).Subrouter()
+	scoped.Use(a.authenticateTenant, tenants.Middleware, a.pinWrites, a.chooseReader)
+
 	productSpecificRoute := fmt.Sprintf("/product/{id:%s}", uuid4Regex)
-	a.Router.HandleFunc("/products", a.getProducts).Methods("GET")
-	a.Router.HandleFunc("/product", a.createProduct).Methods("POST")
-	a.Router.HandleFunc(productSpecificRoute, a.getProduct).Methods("GET")
-	a.Router.HandleFunc(productSpecificRoute, a.updateProduct).Methods("PUT")
-	a.Router.HandleFunc(productSpecificRoute, a.deleteProduct).Methods("DELETE")
-
-	a.Router.HandleFunc("/debug/pprof/", pprof.Index)
-	a.Router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
-	a.Router.HandleFunc("/debug/pprof/profile", pprof.Profile)
-	a.Router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
-
-	// Manually add support for paths linked to by index page at /debug/pprof/
-	a.Router.Handle("/debug/pprof/goroutine", pprof.Handler("goroutine"))
-	a.Router.Handle("/debug/pprof/heap", pprof.Handler("heap"))
-	a.Router.Handle("/debug/pprof/threadcreate", pprof.Handler("threadcreate"))
-	a.Router.Handle("/debug/pprof/block", pprof.Handler("block"))
+	scoped.HandleFunc("/products", a.getProducts).Methods("GET").Name(rest.RouteProducts)
+	scoped.HandleFunc("/products/search", a.searchProducts).Methods("GET").Name(rest.RouteProductSearch)
+	scoped.HandleFunc("/product", a.createProduct).Methods("POST")
+	scoped.HandleFunc(productSpecificRoute, a.getProduct).Methods("GET").Name(rest.RouteProduct)
+	scoped.HandleFunc(productSpecificRoute, a.updateProduct).Methods("PUT")
+	scoped.HandleFunc(productSpecificRoute, a.deleteProduct).Methods("DELETE")
+
+	scoped.HandleFunc(productSpecificRoute+"/prices", a.getPriceHistory).Methods("GET").Name(rest.RouteProductPrices)
+	scoped.HandleFunc(productSpecificRoute+"/prices", a.schedulePrice).Methods("POST")
+
+	imageRoute := fmt.Sprintf("%s/images/{imageId:%s}", productSpecificRoute, uuid4Regex)
+	scoped.HandleFunc(productSpecificRoute+"/images", a.getImages).Methods("GET").Name(rest.RouteProductImages)
+	scoped.HandleFunc(productSpecificRoute+"/images", a.uploadImage).Methods("POST")
+	scoped.HandleFunc(imageRoute, a.getImage).Methods("GET", "HEAD").Name(rest.RouteProductImage)
+	scoped.HandleFunc(imageRoute, a.deleteImage).Methods("DELETE")
+	scoped.HandleFunc(imageRoute+"/thumbnail", a.getThumbnail).Methods("GET", "HEAD").Name(rest.RouteImageThumbnail)
+
+	variantRoute := fmt.Sprintf("%s/variants/{variantId:%s}", productSpecificRoute, uuid4Regex)
+	scoped.HandleFunc(productSpecificRoute+"/variants", a.getVariants).Methods("GET").Name(rest.RouteProductVariants)
+	scoped.HandleFunc(productSpecificRoute+"/variants", a.createVariant).Methods("POST")
+	scoped.HandleFunc(variantRoute, a.getVariant).Methods("GET").Name(rest.RouteProductVariant)
+	scoped.HandleFunc(variantRoute, a.updateVariant).Methods("PUT")
+	scoped.HandleFunc(variantRoute, a.deleteVariant).Methods("DELETE")
+	scoped.HandleFunc("/sku/{sku:[A-Za-z0-9._-]+}", a.getVariantBySKU).Methods("GET").Name(rest.RouteSKU)
+
+	translationRoute := productSpecificRoute + "/translations/{locale:[A-Za-z0-9-]+}"
+	scoped.HandleFunc(productSpecificRoute+"/translations", a.getTranslations).Methods("GET").Name(rest.RouteProductTranslations)
+	scoped.HandleFunc(translationRoute, a.getTranslation).Methods("GET").Name(rest.RouteProductTranslation)
+	scoped.HandleFunc(translationRoute, a.setTranslation).Methods("PUT")
+	scoped.HandleFunc(translationRoute, a.deleteTranslation).Methods("DELETE")
+
+	currencyPriceRoute := productSpecificRoute + "/currency-prices/{currency:[A-Za-z]{3}}"
+	scoped.HandleFunc(productSpecificRoute+"/currency-prices", a.getCurrencyPrices).Methods("GET").Name(rest.RouteProductCurrencyPrices)
+	scoped.HandleFunc(currencyPriceRoute, a.setCurrencyPrice).Methods("PUT").Name(rest.RouteProductCurrencyPrice)
+	scoped.HandleFunc(currencyPriceRoute, a.deleteCurrencyPrice).Methods("DELETE")
+
+	reservationRoute := fmt.Sprintf("%s/reservations/{reservationId:%s}", productSpecificRoute, uuid4Regex)
+	scoped.HandleFunc(productSpecificRoute+"/inventory", a.getInventory).Methods("GET")
+	scoped.HandleFunc(productSpecificRoute+"/inventory", a.setInventory).Methods("PUT")
+	scoped.HandleFunc(productSpecificRoute+"/reservations", a.createReservation).Methods("POST")
+	scoped.HandleFunc(reservationRoute, a.getReservation).Methods("GET")
+	scoped.HandleFunc(reservationRoute+"/commit", a.commitReservation).Methods("POST")
+	scoped.HandleFunc(reservationRoute+"/release", a.releaseReservation).Methods("POST")
+
+	categorySpecificRoute := fmt.Sprintf("/categories/{id:%s}", uuid4Regex)
+	categoryProductRoute := fmt.Sprintf("%s/products/{productId:%s}", categorySpecificRoute, uuid4Regex)
+	scoped.HandleFunc("/categories", a.getCategories).Methods("GET").Name(rest.RouteCategories)
+	scoped.HandleFunc("/categories", a.createCategory).Methods("POST")
+	scoped.HandleFunc(categorySpecificRoute, a.getCategory).Methods("GET").Name(rest.RouteCategory)
+	scoped.HandleFunc(categorySpecificRoute, a.updateCategory).Methods("PUT")
+	scoped.HandleFunc(categorySpecificRoute, a.deleteCategory).Methods("DELETE")
+	scoped.HandleFunc(categorySpecificRoute+"/products", a.getCategoryProducts).Methods("GET").Name(rest.RouteCategoryProducts)
+	scoped.HandleFunc(categoryProductRoute, a.assignProductToCategory).Methods("PUT")
+	scoped.HandleFunc(categoryProductRoute, a.unassignProductFromCategory).Methods("DELETE")
+
+	schema, err := graph.NewSchema(a.DB, a.Events, a.Images)
+	if err != nil {
+		log.Fatal(err)
+	}
+	limits := graph.DefaultLimits()
+	limits.MaxDepth = settings.GetenvInt("APP_GRAPHQL_MAX_DEPTH", limits.MaxDepth)
+	limits.MaxComplexity = settings.GetenvInt("APP_GRAPHQL_MAX_COMPLEXITY", limits.MaxComplexity)
+	scoped.Handle("/graphql", a.readGraphs(graph.Handler(schema, limits, a.Body))).Methods("GET", "POST")
+
+	a.Router.Use(telemetry.NameRoute)
+
+	// Preflights cannot carry X-Tenant-ID, so they are answered before the
+	// router looks for a tenant
+	cors := middleware.CORS{Router: a.Router, Policy: a.corsPolicy}
+	a.Router.Use(cors.Middleware)
+	a.Handler = cors.Preflight(a.Router)
+
+	compression := middleware.DefaultCompressionConfig()
+	compression.MinSize = settings.GetenvInt("APP_COMPRESSION_MIN_SIZE", compression.MinSize)
+	a.Router.Use(middleware.Compression(compression))
+}
+
+// traceConfig reads where traces go from APP_TRACE_EXPORTER (none, stdout,
+// file or otlp), APP_TRACE_FILE, APP_OTLP_ENDPOINT and
+// APP_TRACE_SAMPLE_PERCENT
+func traceConfig() telemetry.Config {
+	c := telemetry.DefaultConfig()
+	c.Exporter = settings.Getenv("APP_TRACE_EXPORTER", c.Exporter)
+	c.File = settings.Getenv("APP_TRACE_FILE", c.File)
+	c.Endpoint = settings.Getenv("APP_OTLP_ENDPOINT", c.Endpoint)
+	c.SampleRatio = float64(settings.GetenvInt("APP_TRACE_SAMPLE_PERCENT", 100)) / 100
+	return c
 }
 
 func (a *App) initializeDB() {
-	_, err := a.DB.Exec(`CREATE TABLE IF NOT EXISTS products (
-        id VARCHAR(36) NOT NULL,
-        name TEXT NOT NULL,
-        price NUMERIC(10,2) NOT NULL DEFAULT 0.00,
-        CONSTRAINT products_pkey PRIMARY KEY (id)
-    )`)
+	_, err := repositories.MigrateUp(a.DB, 0)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if a.DB.Dialect().Name() != "sqlite3" {
+		return
+	}
+	if indexed, err := repositories.SearchIndexed(a.DB); err == nil && !indexed {
+		log.Print("search: no FTS5 index, so searches use substring matching; " +
+			"build with -tags sqlite_fts5 and rebuild the index to rank them")
+	}
 }
 
 func (a *App) getProducts(w http.ResponseWriter, r *http.Request) {
+	fields, ok := productFieldsFromRequest(w, r)
+	if !ok {
+		return
+	}
+	locales, ok := requestedLocalesOrRespond(w, r)
+	if !ok {
+		return
+	}
+	currency, ok := requestedCurrency(w, r)
+	if !ok {
+		return
+	}
 	count, page := getPagingFromRequest(r)
 
-	products, err := repositories.GetProducts(a.DB, page, count)
+	var entries []rest.Entry
+	var ids []string
+	var err error
+	if fields == nil {
+		var products []data.Product
+		if products, err = repositories.GetProducts(a.reader(r), tenantOf(r), page, count); err == nil {
+			entries, err = a.productEntries(r, products)
+		}
+		for _, p := range products {
+			ids = append(ids, p.GetID())
+		}
+	} else {
+		var products []data.PartialProduct
+		if products, err = repositories.FindProductFields(a.reader(r), tenantOf(r),
+			repositories.ProductFilter{}, fields, page, count); err == nil {
+			entries, err = a.partialProductEntries(r, products)
+		}
+		for _, p := range products {
+			ids = append(ids, p.ID)
+		}
+	}
+	var served []string
+	if err == nil {
+		served, err = a.localizeProducts(r, locales, entries, ids)
+	}
+	if err == nil {
+		err = a.priceProducts(r, currency, entries, ids)
+	}
 	if err != nil {
-		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithPricingError(w, err)
 		return
 	}
 
-	total := repositories.GetProductCount(a.DB)
-	l := rest.ListingJSONResponse("/products", page, total, count,
-		rest.ProductsToEntries(products))
-	rest.RespondWithJSON(w, http.StatusOK, l)
+	params := []string{}
+	if fields != nil {
+		params = append(params, "fields="+strings.Join(fields, ","))
+	}
+	if currency != "" {
+		params = append(params, "currency="+currency)
+	}
+	if locale := r.URL.Query().Get("locale"); locale != "" {
+		params = append(params, "locale="+url.QueryEscape(locale))
+	}
+	basePath := a.linker(r).ListingPath(rest.RouteProducts, strings.Join(params, "&"))
+	total := repositories.GetProductCount(a.reader(r), tenantOf(r))
+	l := rest.ListingJSONResponse(basePath, page, total, count, entries)
+	setContentLanguage(w, served)
+	rest.RespondWithListing(w, r, http.StatusOK, l)
 }
 
-func (a *App) createProduct(w http.ResponseWriter, r *http.Request) {
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		rest.RespondWithError(w, http.StatusBadRequest, "Unable to read request body")
+func (a *App) searchProducts(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		rest.RespondWithError(w, http.StatusBadRequest, "Missing search query")
+		return
 	}
-	defer r.Body.Close()
+	count, page := getPagingFromRequest(r)
 
-	p, err := data.ParseProductDataJSON(body)
+	results, total, err := repositories.SearchProducts(a.reader(r), tenantOf(r), q, page, count)
 	if err != nil {
-		rest.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	err = repositories.CreateProduct(a.DB, p)
-	if err != nil {
+	entries := rest.SearchResultsToEntries(a.linker(r), results)
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.Product.GetID()
+	}
+	if err := a.linkProducts(r, entries, ids); err != nil {
 		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	rest.RespondWithJSON(w, http.StatusCreated, p)
+	l := rest.ListingJSONResponse(a.linker(r).ListingPath(rest.RouteProductSearch, "q="+url.QueryEscape(q)), page, total, count,
+		entries)
+	rest.RespondWithListing(w, r, http.StatusOK, l)
+}
+
+func (a *App) createProduct(w http.ResponseWriter, r *http.Request) {
+	requested := data.NewProduct("", "", 0)
+	if !a.Body.DecodeJSON(w, r, requested) {
+		return
+	}
+	if err := data.ValidateProduct(requested); err != nil {
+		rest.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// The server names products; an id in the body is ignored.
+	p := data.CreateProduct(requested.GetName(), requested.GetPrice())
+
+	err := a.DB.WithTx(r.Context(), func(tx *repositories.Tx) error {
+		if err := repositories.CreateProduct(tx, tenantOf(r), p); err != nil {
+			return err
+		}
+		return repositories.EnqueueEvent(tx, tenantOf(r), events.ProductCreated, p)
+	})
+	if err == repositories.ErrProductExists {
+		rest.RespondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		telemetry.Printf(r.Context(), "creating product: %v", err)
+		rest.RespondWithError(w, http.StatusInternalServerError, "Could not create product")
+		return
+	}
+	a.Events.Publish(tenantOf(r), events.ProductCreated, p)
+
+	rest.RespondWithObject(w, r, http.StatusCreated, rest.ProductToEntry(a.linker(r), p))
 }
 
 func (a *App) getProduct(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := data.ParseUUID(vars["id"])
+	fields, ok := productFieldsFromRequest(w, r)
+	if !ok {
+		return
+	}
+	locales, ok := requestedLocalesOrRespond(w, r)
+	if !ok {
+		return
+	}
+	currency, ok := requestedCurrency(w, r)
+	if !ok {
+		return
+	}
 
-	p, err := repositories.GetProduct(a.DB, id.String())
+	var e rest.Entry
+	var err error
+	if fields == nil {
+		var p data.Product
+		p, err = repositories.GetProduct(a.reader(r), tenantOf(r), id.String())
+		e = rest.ProductToEntry(a.linker(r), p)
+	} else {
+		var p data.PartialProduct
+		p, err = repositories.GetProductFields(a.reader(r), tenantOf(r), id.String(), fields)
+		e = rest.PartialProductsToEntries(a.linker(r), []data.PartialProduct{p})[0]
+	}
 	if err != nil {
 		switch err {
 		case sql.ErrNoRows:
@@ -165,65 +493,111 @@ func (a *App) getProduct(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	entries := []rest.Entry{e}
+	if err := a.linkProducts(r, entries, []string{id.String()}); err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	served, err := a.localizeProducts(r, locales, entries, []string{id.String()})
+	if err == nil {
+		err = a.priceProducts(r, currency, entries, []string{id.String()})
+	}
+	if err != nil {
+		respondWithPricingError(w, err)
+		return
+	}
 
-	rest.RespondWithJSON(w, http.StatusOK, p)
+	setContentLanguage(w, served)
+	rest.RespondWithObject(w, r, http.StatusOK, entries[0])
 }
 
 func (a *App) updateProduct(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := data.ParseUUID(vars["id"])
 
-	_, getErr := repositories.GetProduct(a.DB, id.String())
-	if getErr != nil {
-		rest.RespondWithError(w, http.StatusNotFound, fmt.Sprintf(
-			"Product '%s' not found", id.String()))
+	p := data.NewProduct("", "", 0)
+	if !a.Body.DecodeJSON(w, r, p) {
 		return
 	}
-
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		rest.RespondWithError(w, http.StatusBadRequest, "Unable to read request body")
+	if err := data.ValidateProduct(p); err != nil {
+		rest.RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	defer r.Body.Close()
 
-	p, err := data.ParseProductDataJSON(body)
-	if err != nil {
-		rest.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+	var m data.Product
+	err := a.DB.WithTx(r.Context(), func(tx *repositories.Tx) (err error) {
+		if m, err = repositories.UpdateProduct(tx, tenantOf(r), id.String(), p); err != nil {
+			return err
+		}
+		return repositories.EnqueueEvent(tx, tenantOf(r), events.ProductUpdated, m)
+	})
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		rest.RespondWithError(w, http.StatusNotFound, fmt.Sprintf(
+			"Product '%s' not found", id.String()))
 		return
-	}
-
-	err = repositories.UpdateProduct(a.DB, id.String(), p)
-	if err != nil {
+	default:
 		rest.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf(
 			"Unable to save product '%s' with data %+v", id.String(), p))
 		return
 	}
-	m, _ := repositories.GetProduct(a.DB, id.String())
+	a.Events.Publish(tenantOf(r), events.ProductUpdated, m)
 
-	rest.RespondWithJSON(w, http.StatusOK, m)
+	entries, err := a.productEntries(r, []data.Product{m})
+	if err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	rest.RespondWithObject(w, r, http.StatusOK, entries[0])
 }
 
 func (a *App) deleteProduct(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := data.ParseUUID(vars["id"])
 
-	_, err := repositories.GetProduct(a.DB, id.String())
-	if err != nil {
+	var p data.Product
+	var images []string
+	err := a.DB.WithTx(r.Context(), func(tx *repositories.Tx) (err error) {
+		if images, err = repositories.GetProductImageIDs(tx, tenantOf(r), id.String()); err != nil {
+			return err
+		}
+		if p, err = repositories.DeleteProduct(tx, tenantOf(r), id.String()); err != nil {
+			return err
+		}
+		return repositories.EnqueueEvent(tx, tenantOf(r), events.ProductDeleted, p)
+	})
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
 		rest.RespondWithError(w, http.StatusNotFound, fmt.Sprintf(
 			"Product '%s' not found", id.String()))
 		return
-	}
-
-	err = repositories.DeleteProduct(a.DB, id.String())
-	if err != nil {
+	default:
 		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	a.Events.Publish(tenantOf(r), events.ProductDeleted, p)
+	imaging.DeleteBlobs(r.Context(), a.Images, tenantOf(r), images...)
 
 	rest.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
 }
 
+// stopGRPC drains in-flight RPCs, cutting long-lived streams such as
+// WatchProducts when the deadline passes
+func stopGRPC(ctx context.Context, s *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.Stop()
+	}
+}
+
 func maxClientsMiddleware(handler http.Handler, maxClients uint16) http.Handler {
 	log.Printf("Max Clients Middleware %d", maxClients)
 	sema := make(chan struct{}, int(maxClients))
@@ -234,6 +608,7 @@ func maxClientsMiddleware(handler http.Handler, maxClients uint16) http.Handler
 			handler.ServeHTTP(w, r)
 			defer func() { <-sema }()
 		case <-timeOut.C:
+			w.Header().Set("Retry-After", "1")
 			rest.RespondWithError(w, http.StatusServiceUnavailable, "Too many requests")
 		}
 	})
@@ -243,6 +618,25 @@ func getURLQueryParam(r *http.Request, key string) string {
 	return url.QueryEscape(r.URL.Query().Get(key))
 }
 
+// linker builds the links in responses to r
+func (a *App) linker(r *http.Request) rest.Linker {
+	return rest.NewLinker(a.Router, r, a.AbsoluteURLs)
+}
+
+// productFieldsFromRequest reads ?fields=, answering 400 with the fields
+// that are allowed when it names any other. No fields means all of them.
+func productFieldsFromRequest(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	fields, err := data.ParseFields(r.URL.Query().Get("fields"), data.ProductFields)
+	if e, ok := err.(data.UnknownFieldError); ok {
+		rest.RespondWithJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error":          e.Error(),
+			"allowed_fields": e.Allowed,
+		})
+		return nil, false
+	}
+	return fields, true
+}
+
 func getPagingFromRequest(r *http.Request) (uint8, uint64) {
 	count, _ := strconv.ParseUint(getURLQueryParam(r, "count"), 10, 8)
 	page, _ := strconv.ParseUint(getURLQueryParam(r, "page"), 10, 64)
@@ -2,11 +2,13 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	uuid "github.com/satori/go.uuid"
@@ -15,12 +17,27 @@ import (
 	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
 	"github.com/Lewiscowles1986/go-gorilla-api/rest"
 	"github.com/Lewiscowles1986/go-gorilla-api/settings"
+	"github.com/Lewiscowles1986/go-gorilla-api/telemetry"
+	"github.com/Lewiscowles1986/go-gorilla-api/tenants"
 )
 
 var a App
 
 func clearTable() {
+	a.DB.Exec("DELETE FROM product_categories")
+	a.DB.Exec("DELETE FROM categories")
+	a.DB.Exec("DELETE FROM reservations")
+	a.DB.Exec("DELETE FROM inventory")
+	a.DB.Exec("DELETE FROM product_prices")
+	a.DB.Exec("DELETE FROM product_variants")
+	a.DB.Exec("DELETE FROM product_translations")
+	a.DB.Exec("DELETE FROM product_currency_prices")
+	a.DB.Exec("DELETE FROM exchange_rates")
 	a.DB.Exec("DELETE FROM products")
+	a.DB.Exec("DELETE FROM product_images")
+	a.DB.Exec("DELETE FROM outbox")
+	a.DB.Exec("DELETE FROM tenants WHERE id <> 'default'")
+	a.DB.Exec("UPDATE tenants SET key_hash = NULL")
 	a.DB.Exec("ALTER SEQUENCE products_id_seq RESTART WITH 1")
 }
 
@@ -34,6 +51,10 @@ func TestMain(m *testing.M) {
 		os.Getenv("TEST_DB_PASSWORD"),
 		settings.Getenv("TEST_DB_NAME", ":memory:"))
 	a.Initialize(dbType, dbConnStr)
+	if dbConnStr == ":memory:" {
+		// Every new connection would get its own empty in-memory database.
+		a.DB.SetMaxOpenConns(1)
+	}
 
 	fmt.Printf("Testing with settings\n%s: %s\n\n", dbType, dbConnStr)
 
@@ -50,10 +71,10 @@ func TestEmptyTable(t *testing.T) {
 	req, _ := http.NewRequest("GET", "/products", nil)
 	response := executeRequest(req)
 
-	total := repositories.GetProductCount(a.DB)
+	total := repositories.GetProductCount(a.DB, tenants.Default)
 	products := make([]data.Product, 0)
 	blankListing := rest.ListingJSONResponse("/products", 0, total, 10,
-		rest.ProductsToEntries(products))
+		rest.ProductsToEntries(rest.Linker{}, products))
 
 	expected, _ := data.JSONMarshal(blankListing)
 
@@ -70,10 +91,10 @@ func TestEmptyTableLargeCount(t *testing.T) {
 	req, _ := http.NewRequest("GET", "/products?count=255", nil)
 	response := executeRequest(req)
 
-	total := repositories.GetProductCount(a.DB)
+	total := repositories.GetProductCount(a.DB, tenants.Default)
 	products := make([]data.Product, 0)
 	blankListing := rest.ListingJSONResponse("/products", 0, total, 250,
-		rest.ProductsToEntries(products))
+		rest.ProductsToEntries(rest.Linker{}, products))
 
 	expected, _ := data.JSONMarshal(blankListing)
 
@@ -117,11 +138,92 @@ func TestCreateProductFailsWithGarbage(t *testing.T) {
 	checkResponseCode(t, http.StatusBadRequest, response.Code)
 }
 
+func TestCreateProductFailsValidation(t *testing.T) {
+	clearTable()
+
+	payload := []byte(`{"name":"","price":-1}`)
+
+	req, _ := http.NewRequest("POST", "/product", bytes.NewBuffer(payload))
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+
+	var m map[string]string
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if m["error"] != data.ErrProductNameRequired.Error() {
+		t.Errorf("Expected '%s'. Got '%s'", data.ErrProductNameRequired, m["error"])
+	}
+}
+
+func TestWriteBodiesAreStrictAndBounded(t *testing.T) {
+	clearTable()
+	saved := a.Body
+	a.Body = rest.Decoder{MaxBytes: 64, Strict: true}
+	defer func() { a.Body = saved }()
+
+	for _, c := range []struct {
+		method, url, contentType, payload string
+		status                            int
+	}{
+		{"POST", "/product", "application/json", `{"name":"` + strings.Repeat("a", 64) + `","price":1}`,
+			http.StatusRequestEntityTooLarge},
+		{"POST", "/product", "text/plain", `{"name":"widget","price":1}`, http.StatusUnsupportedMediaType},
+		{"POST", "/product", "application/json", `{"name":"widget","price":1}{}`, http.StatusBadRequest},
+		{"POST", "/categories", "application/json", `{"name":"tools","colour":"red"}`, http.StatusBadRequest},
+		{"POST", "/graphql", "text/plain", `{"query":"{ products { total } }"}`, http.StatusUnsupportedMediaType},
+	} {
+		req, _ := http.NewRequest(c.method, c.url, bytes.NewBufferString(c.payload))
+		req.Header.Set("Content-Type", c.contentType)
+		if response := executeRequest(req); response.Code != c.status {
+			t.Errorf("%s %s %s: Expected %d. Got %d %s",
+				c.method, c.url, c.payload, c.status, response.Code, response.Body)
+		}
+	}
+	if n := repositories.GetProductCount(a.DB, tenants.Default); n != 0 {
+		t.Errorf("Expected no products saved. Got %d", n)
+	}
+}
+
+func TestCreateProductWithGzipBody(t *testing.T) {
+	clearTable()
+
+	var payload bytes.Buffer
+	gw := gzip.NewWriter(&payload)
+	gw.Write([]byte(`{"name":"compressed product","price":3.5}`))
+	gw.Close()
+
+	req, _ := http.NewRequest("POST", "/product", &payload)
+	req.Header.Set("Content-Encoding", "gzip")
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+
+	if m["name"] != "compressed product" {
+		t.Errorf("Expected product name to be 'compressed product'. Got '%v'", m["name"])
+	}
+}
+
+func TestListingVariesOnAcceptEncoding(t *testing.T) {
+	clearTable()
+
+	req, _ := http.NewRequest("GET", "/products?count=250", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusOK, response.Code)
+	if vary := strings.Join(response.Header().Values("Vary"), ", "); vary != "Accept-Language, Accept, Accept-Encoding" {
+		t.Errorf("Expected Vary: Accept-Language, Accept, Accept-Encoding. Got '%s'", vary)
+	}
+}
+
 func TestGetProduct(t *testing.T) {
 	clearTable()
 
 	p := data.CreateProduct("test", 9.99)
-	repositories.CreateProduct(a.DB, p)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
 
 	req, _ := http.NewRequest("GET", fmt.Sprintf("/product/%s", p.GetID()), nil)
 	response := executeRequest(req)
@@ -149,7 +251,7 @@ func TestUpdateProduct(t *testing.T) {
 	clearTable()
 
 	p := data.CreateProduct("cheap trash", .99)
-	err := repositories.CreateProduct(a.DB, p)
+	err := repositories.CreateProduct(a.DB, tenants.Default, p)
 	if err != nil {
 		t.Errorf("Unable to save initial model to database")
 	}
@@ -191,7 +293,7 @@ func TestUpdateProductWithGarbageFails(t *testing.T) {
 	clearTable()
 
 	p := data.CreateProduct("cheap trash", .99)
-	err := repositories.CreateProduct(a.DB, p)
+	err := repositories.CreateProduct(a.DB, tenants.Default, p)
 	if err != nil {
 		t.Errorf("Unable to save initial model to database")
 	}
@@ -219,7 +321,7 @@ func TestDeleteProductExist(t *testing.T) {
 	clearTable()
 
 	p := data.CreateProduct("something we're ashamed of", 500000.00)
-	err := repositories.CreateProduct(a.DB, p)
+	err := repositories.CreateProduct(a.DB, tenants.Default, p)
 	if err != nil {
 		t.Errorf("Unable to save initial model to database")
 	}
@@ -238,9 +340,23 @@ func TestDeleteProductExist(t *testing.T) {
 	checkResponseCode(t, http.StatusNotFound, response.Code)
 }
 
+func createProductFromJSON(t *testing.T, payload string) {
+	req, _ := http.NewRequest("POST", "/product", bytes.NewBufferString(payload))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+}
+
 func executeRequest(req *http.Request) *httptest.ResponseRecorder {
 	rr := httptest.NewRecorder()
-	a.Router.ServeHTTP(rr, req)
+	telemetry.Middleware(a.Handler).ServeHTTP(rr, req)
+
+	return rr
+}
+
+// executeAdminRequest serves req as the admin listener would
+func executeAdminRequest(req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	a.AdminRouter.ServeHTTP(rr, req)
 
 	return rr
 }
@@ -250,3 +366,341 @@ func checkResponseCode(t *testing.T, expected, actual int) {
 		t.Errorf("Expected response code %d. Got %d\n", expected, actual)
 	}
 }
+
+func executeGraphQL(t *testing.T, query string, variables map[string]interface{}) map[string]interface{} {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"query": query, "variables": variables})
+	req, _ := http.NewRequest("POST", "/graphql", bytes.NewBuffer(payload))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if errs, ok := m["errors"]; ok {
+		t.Fatalf("Unexpected GraphQL errors %v", errs)
+	}
+	return m["data"].(map[string]interface{})
+}
+
+func TestGraphQLProductsMirrorsListing(t *testing.T) {
+	clearTable()
+
+	for i := 0; i < 3; i++ {
+		repositories.CreateProduct(a.DB, tenants.Default, data.CreateProduct(fmt.Sprintf("item %d", i), 1.5))
+	}
+	repositories.CreateProduct(a.DB, tenants.Default, data.CreateProduct("other", 50))
+
+	result := executeGraphQL(t, `query($f: ProductFilter) {
+		products(filter: $f, page: 1, count: 2) {
+			total count page limit
+			data { id name price }
+			links { rel href }
+		}
+	}`, map[string]interface{}{"f": map[string]interface{}{"name": "ITEM", "maxPrice": 10}})
+
+	products := result["products"].(map[string]interface{})
+	if products["total"] != float64(3) {
+		t.Errorf("Expected total of 3. Got %v", products["total"])
+	}
+	if products["count"] != float64(2) {
+		t.Errorf("Expected count of 2. Got %v", products["count"])
+	}
+	// REST listings take no filter, so no link could page these products
+	if links := products["links"].([]interface{}); len(links) != 0 {
+		t.Errorf("Expected no links. Got %v", links)
+	}
+}
+
+func TestGraphQLProductLookup(t *testing.T) {
+	clearTable()
+
+	p := data.CreateProduct("looked up", 2.25)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+
+	result := executeGraphQL(t, `query($id: ID!) { product(id: $id) { id name price } }`,
+		map[string]interface{}{"id": p.GetID()})
+	product := result["product"].(map[string]interface{})
+	if product["name"] != "looked up" {
+		t.Errorf("Expected 'looked up'. Got '%v'", product["name"])
+	}
+
+	result = executeGraphQL(t, `query($id: ID!) { product(id: $id) { id } }`,
+		map[string]interface{}{"id": uuid.Must(uuid.NewV4(), nil).String()})
+	if result["product"] != nil {
+		t.Errorf("Expected null for a missing product. Got %v", result["product"])
+	}
+}
+
+func TestGraphQLMutations(t *testing.T) {
+	clearTable()
+
+	result := executeGraphQL(t, `mutation {
+		createProduct(input: {name: "created", price: 4.5}) { id name }
+	}`, nil)
+	id := result["createProduct"].(map[string]interface{})["id"].(string)
+
+	result = executeGraphQL(t, `mutation($id: ID!) {
+		updateProduct(id: $id, input: {name: "updated", price: 5.5}) { name price }
+	}`, map[string]interface{}{"id": id})
+	updated := result["updateProduct"].(map[string]interface{})
+	if updated["name"] != "updated" || updated["price"] != 5.5 {
+		t.Errorf("Expected updated product. Got %v", updated)
+	}
+
+	result = executeGraphQL(t, `mutation($id: ID!) { deleteProduct(id: $id) }`,
+		map[string]interface{}{"id": id})
+	if result["deleteProduct"] != true {
+		t.Errorf("Expected deleteProduct to return true. Got %v", result["deleteProduct"])
+	}
+
+	if total := repositories.GetProductCount(a.DB, tenants.Default); total != 0 {
+		t.Errorf("Expected no products to remain. Got %d", total)
+	}
+}
+
+func TestGraphQLRejectsMutationOverGet(t *testing.T) {
+	req, _ := http.NewRequest("GET",
+		`/graphql?query=mutation{deleteProduct(id:"x")}`, nil)
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusMethodNotAllowed, response.Code)
+}
+
+func TestGraphQLRejectsExpensiveQuery(t *testing.T) {
+	payload := []byte(`{"query":"{ a: products(count: 250) { data { id name price } } b: products(count: 250) { data { id name price } } }"}`)
+	req, _ := http.NewRequest("POST", "/graphql", bytes.NewBuffer(payload))
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+}
+
+type searchListing struct {
+	Data []struct {
+		Object struct {
+			ID      string  `json:"id"`
+			Name    string  `json:"name"`
+			Snippet string  `json:"snippet"`
+			Rank    float64 `json:"rank"`
+		} `json:"object"`
+	} `json:"data"`
+	Total uint64      `json:"total"`
+	Links []rest.Link `json:"links"`
+}
+
+func searchFor(t *testing.T, query string) searchListing {
+	req, _ := http.NewRequest("GET", "/products/search?"+query, nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var l searchListing
+	if err := json.Unmarshal(response.Body.Bytes(), &l); err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestSearchRequiresQuery(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/products/search?q=%20", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+}
+
+func TestSearchPrefixMatchingAndSnippets(t *testing.T) {
+	clearTable()
+	createProductFromJSON(t, `{"name":"Green Tea","price":3.5}`)
+	createProductFromJSON(t, `{"name":"Teapot","price":20}`)
+	createProductFromJSON(t, `{"name":"Coffee","price":4}`)
+
+	l := searchFor(t, "q=tea")
+	if l.Total != 2 || len(l.Data) != 2 {
+		t.Fatalf("Expected 2 results. Got %+v", l)
+	}
+	for _, e := range l.Data {
+		if !strings.Contains(e.Object.Snippet, "<mark>") {
+			t.Errorf("Expected highlighted snippet. Got %q", e.Object.Snippet)
+		}
+	}
+
+	l = searchFor(t, "q=green+te")
+	if l.Total != 1 || l.Data[0].Object.Name != "Green Tea" {
+		t.Errorf("Expected only 'Green Tea'. Got %+v", l.Data)
+	}
+}
+
+func TestSearchFollowsUpdatesAndDeletes(t *testing.T) {
+	clearTable()
+	p := data.CreateProduct("Espresso", 2)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+
+	if l := searchFor(t, "q=espresso"); l.Total != 1 {
+		t.Fatalf("Expected created product to be found. Got %d", l.Total)
+	}
+
+	payload := []byte(`{"name":"Latte","price":3}`)
+	req, _ := http.NewRequest("PUT", "/product/"+p.GetID(), bytes.NewBuffer(payload))
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	if l := searchFor(t, "q=espresso"); l.Total != 0 {
+		t.Errorf("Expected old name to be gone. Got %d", l.Total)
+	}
+	if l := searchFor(t, "q=latte"); l.Total != 1 || l.Data[0].Object.ID != p.GetID() {
+		t.Errorf("Expected renamed product. Got %+v", l.Data)
+	}
+
+	req, _ = http.NewRequest("DELETE", "/product/"+p.GetID(), nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	if l := searchFor(t, "q=latte"); l.Total != 0 {
+		t.Errorf("Expected deleted product to be gone. Got %d", l.Total)
+	}
+}
+
+func TestSearchLinksKeepQuery(t *testing.T) {
+	clearTable()
+	for i := 0; i < 3; i++ {
+		createProductFromJSON(t, `{"name":"Black Tea","price":1}`)
+	}
+
+	l := searchFor(t, "q=black+tea&count=2")
+	if len(l.Data) != 2 || l.Total != 3 {
+		t.Fatalf("Expected 2 of 3 results. Got %d of %d", len(l.Data), l.Total)
+	}
+	for _, link := range l.Links {
+		if link.Rel == "next" {
+			if link.Href != "/products/search?q=black+tea&page=2&count=2" {
+				t.Errorf("Unexpected next link %s", link.Href)
+			}
+			if next := searchFor(t, strings.TrimPrefix(link.Href, "/products/search?")); len(next.Data) != 1 {
+				t.Errorf("Expected 1 result on the next page. Got %d", len(next.Data))
+			}
+			return
+		}
+	}
+	t.Error("Expected a next link")
+}
+
+func TestListingRepresentations(t *testing.T) {
+	clearTable()
+	p := data.CreateProduct("Green Tea", 3.5)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+
+	req, _ := http.NewRequest("GET", "/products", nil)
+	req.Header.Set("Accept", rest.MediaTypeHAL)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	if ct := response.Header().Get("Content-Type"); ct != rest.MediaTypeHAL {
+		t.Errorf("Expected HAL. Got %s", ct)
+	}
+	var hal struct {
+		Embedded struct {
+			Items []map[string]interface{}
+		} `json:"_embedded"`
+	}
+	json.Unmarshal(response.Body.Bytes(), &hal)
+	if len(hal.Embedded.Items) != 1 || hal.Embedded.Items[0]["id"] != p.GetID() {
+		t.Errorf("Expected product embedded. Got %s", response.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/product/"+p.GetID(), nil)
+	req.Header.Set("Accept", rest.MediaTypeJSONAPI)
+	response = executeRequest(req)
+	var doc struct {
+		Data rest.JSONAPIResource
+	}
+	json.Unmarshal(response.Body.Bytes(), &doc)
+	if response.Header().Get("Content-Type") != rest.MediaTypeJSONAPI ||
+		doc.Data.Type != "products" || doc.Data.ID != p.GetID() {
+		t.Errorf("Expected JSON:API product. Got %s", response.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/products", nil)
+	response = executeRequest(req)
+	if ct := response.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Expected the default format. Got %s", ct)
+	}
+	if vary := response.Header().Values("Vary"); !strings.Contains(strings.Join(vary, ","), "Accept") {
+		t.Errorf("Expected Vary: Accept. Got %v", vary)
+	}
+}
+
+func TestSparseFieldsets(t *testing.T) {
+	clearTable()
+	p := data.CreateProduct("Green Tea", 3.5)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+
+	req, _ := http.NewRequest("GET", "/products?fields=id,name", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var l struct {
+		Data  []struct{ Object map[string]interface{} }
+		Links []rest.Link
+	}
+	json.Unmarshal(response.Body.Bytes(), &l)
+	if len(l.Data) != 1 || len(l.Data[0].Object) != 2 || l.Data[0].Object["name"] != "Green Tea" {
+		t.Errorf("Expected id and name only. Got %s", response.Body.String())
+	}
+	if l.Links[0].Href != "/products?fields=id,name&page=1&count=10" {
+		t.Errorf("Expected paging links to keep fields. Got %+v", l.Links[0])
+	}
+
+	req, _ = http.NewRequest("GET", "/product/"+p.GetID()+"?fields=price", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	if body := strings.TrimSpace(response.Body.String()); body != `{"price":3.5}` {
+		t.Errorf("Expected price only. Got %s", body)
+	}
+
+	req, _ = http.NewRequest("GET", "/product/"+uuid.Must(uuid.NewV4(), nil).String()+"?fields=name", nil)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+}
+
+func TestSparseFieldsetsRejectUnknownFields(t *testing.T) {
+	clearTable()
+
+	req, _ := http.NewRequest("GET", "/products?fields=id,cost", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+	var m struct {
+		Allowed []string `json:"allowed_fields"`
+	}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if strings.Join(m.Allowed, ",") != "id,name,price" {
+		t.Errorf("Expected the allowed fields. Got %s", response.Body.String())
+	}
+}
+
+func TestEntryLinksFollowRoutes(t *testing.T) {
+	clearTable()
+	p := data.CreateProduct("Green Tea", 3.5)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+
+	req, _ := http.NewRequest("GET", "/products?actions=true", nil)
+	response := executeRequest(req)
+	var l rest.Listing
+	json.Unmarshal(response.Body.Bytes(), &l)
+	if len(l.Data) != 1 {
+		t.Fatalf("Expected one product. Got %s", response.Body.String())
+	}
+	self := l.Data[0].Links[0]
+	if self.Rel != "self" || self.Href != "/product/"+p.GetID() {
+		t.Fatalf("Unexpected self link %+v", self)
+	}
+	req, _ = http.NewRequest(self.Type, self.Href, nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	if len(l.Data[0].Actions) != 2 {
+		t.Errorf("Expected update and delete actions. Got %+v", l.Data[0].Actions)
+	}
+
+	a.AbsoluteURLs = true
+	defer func() { a.AbsoluteURLs = false }()
+	req, _ = http.NewRequest("GET", "/products", nil)
+	req.Host = "internal:8080"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "shop.example.com")
+	response = executeRequest(req)
+	json.Unmarshal(response.Body.Bytes(), &l)
+	if href := l.Data[0].Links[0].Href; href != "https://shop.example.com/product/"+p.GetID() {
+		t.Errorf("Expected an absolute self link. Got %s", href)
+	}
+	if href := l.Links[0].Href; href != "https://shop.example.com/products?page=1&count=10" {
+		t.Errorf("Expected absolute paging links. Got %s", href)
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/Lewiscowles1986/go-gorilla-api/data"
 	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/tenants"
 )
 
 var response *http.Response
@@ -29,7 +30,7 @@ func BenchmarkCreateRequests(b *testing.B) {
 func BenchmarkGetRecordRequests(b *testing.B) {
 
 	p := data.CreateProduct("something", 99.99)
-	repositories.CreateProduct(a.DB, p)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
 
 	request, _ := http.NewRequest("GET", fmt.Sprintf("/product/%s", p.GetID()), nil)
 	b.ResetTimer()
@@ -0,0 +1,49 @@
+// Package blob - Keeps opaque objects by key, on the local filesystem or in
+// an S3-compatible bucket
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("blob key must be a relative slash separated path")
+)
+
+// Store - Where objects are kept. Keys are slash separated relative paths,
+// such as images/default/1234/original.
+type Store interface {
+	// Put writes body under key, replacing anything there
+	Put(ctx context.Context, key string, body []byte, contentType string) error
+	// Get opens the object under key; ErrNotFound when there is none
+	Get(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	// Delete removes the object under key, if there is one
+	Delete(ctx context.Context, key string) error
+}
+
+// checkKey refuses keys that could reach outside a store's root
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
+
+// memoryObject is an object read whole into memory
+type memoryObject struct {
+	*bytes.Reader
+}
+
+func (memoryObject) Close() error {
+	return nil
+}
@@ -0,0 +1,208 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3 - Keeps objects in a bucket of any service speaking the S3 API, such
+// as AWS or MinIO, addressed path-style as Endpoint/Bucket/key and signed
+// with AWS Signature Version 4. Objects are read whole into memory, so it
+// suits objects of a few megabytes.
+type S3 struct {
+	// Endpoint is the service's base URL, such as
+	// https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+	Endpoint        string
+	Bucket          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Client          *http.Client
+
+	now func() time.Time
+}
+
+// NewS3 - An S3 store, giving up on a request after thirty seconds
+func NewS3(endpoint, bucket, region, accessKeyID, secretAccessKey string) *S3 {
+	return &S3{
+		Endpoint:        strings.TrimSuffix(endpoint, "/"),
+		Bucket:          bucket,
+		Region:          region,
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		Client:          &http.Client{Timeout: 30 * time.Second},
+		now:             time.Now,
+	}
+}
+
+func (s *S3) Put(ctx context.Context, key string, body []byte, contentType string) error {
+	res, err := s.do(ctx, http.MethodPut, key, body, func(req *http.Request) {
+		req.Header.Set("Content-Type", contentType)
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return s.check(res, key)
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	res, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if err := s.check(res, key); err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return memoryObject{bytes.NewReader(body)}, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	res, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return s.check(res, key)
+}
+
+// do sends a signed request for key, letting prepare set headers first
+func (s *S3) do(ctx context.Context, method, key string, body []byte, prepare func(*http.Request)) (*http.Response, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	u := s.Endpoint + "/" + uriEncode(s.Bucket, true) + "/" + uriEncode(key, false)
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if prepare != nil {
+		prepare(req)
+	}
+	s.sign(req, body, s.now())
+	return s.Client.Do(req)
+}
+
+// check turns anything but a 2xx into an error carrying S3's own message
+func (s *S3) check(res *http.Response, key string) error {
+	if res.StatusCode >= 200 && res.StatusCode <= 299 {
+		return nil
+	}
+	detail, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	return fmt.Errorf("s3 %s %s: %s %s", res.Request.Method, key, res.Status, bytes.TrimSpace(detail))
+}
+
+// sign adds AWS Signature Version 4 headers to req, covering its host, any
+// Content-Type, Range and x-amz-* headers, and the hash of body
+func (s *S3) sign(req *http.Request, body []byte, at time.Time) {
+	at = at.UTC()
+	amzDate := at.Format("20060102T150405Z")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "content-type" || name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := at.Format("20060102") + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + s.SecretAccessKey)
+	for _, part := range []string{at.Format("20060102"), s.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func canonicalQuery(req *http.Request) string {
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := []string{}
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode escapes everything but RFC 3986's unreserved characters, and
+// slashes unless told to, as Signature Version 4 expects
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
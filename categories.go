@@ -0,0 +1,248 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/rest"
+)
+
+func (a *App) getCategories(w http.ResponseWriter, r *http.Request) {
+	count, page := getPagingFromRequest(r)
+
+	categories, err := repositories.GetCategories(a.db(r), tenantOf(r), page, count)
+	if err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	total := repositories.GetCategoryCount(a.db(r), tenantOf(r))
+	l := rest.ListingJSONResponse(a.linker(r).Href(rest.RouteCategories), page, total, count,
+		rest.CategoriesToEntries(a.linker(r), categories))
+	rest.RespondWithListing(w, r, http.StatusOK, l)
+}
+
+func (a *App) createCategory(w http.ResponseWriter, r *http.Request) {
+	c, ok := a.readCategory(w, r)
+	if !ok {
+		return
+	}
+	if !a.checkCategoryParent(w, r, c.GetID(), c.GetParentID()) {
+		return
+	}
+
+	if err := repositories.CreateCategory(a.db(r), tenantOf(r), c); err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rest.RespondWithEntry(w, r, http.StatusCreated, rest.CategoryToEntry(a.linker(r), c))
+}
+
+func (a *App) getCategory(w http.ResponseWriter, r *http.Request) {
+	c, ok := a.loadCategory(w, r)
+	if !ok {
+		return
+	}
+
+	rest.RespondWithEntry(w, r, http.StatusOK, rest.CategoryToEntry(a.linker(r), c))
+}
+
+func (a *App) updateCategory(w http.ResponseWriter, r *http.Request) {
+	existing, ok := a.loadCategory(w, r)
+	if !ok {
+		return
+	}
+	c, ok := a.readCategory(w, r)
+	if !ok {
+		return
+	}
+	id := existing.GetID()
+	if !a.checkCategoryParent(w, r, id, c.GetParentID()) {
+		return
+	}
+
+	if err := repositories.UpdateCategory(a.db(r), tenantOf(r), id, c); err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf(
+			"Unable to save category '%s'", id))
+		return
+	}
+	m, _ := repositories.GetCategory(a.db(r), tenantOf(r), id)
+
+	rest.RespondWithEntry(w, r, http.StatusOK, rest.CategoryToEntry(a.linker(r), m))
+}
+
+func (a *App) deleteCategory(w http.ResponseWriter, r *http.Request) {
+	c, ok := a.loadCategory(w, r)
+	if !ok {
+		return
+	}
+
+	children, err := repositories.CountCategoryChildren(a.db(r), tenantOf(r), c.GetID())
+	if err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if children > 0 {
+		rest.RespondWithError(w, http.StatusConflict, fmt.Sprintf(
+			"Category '%s' has %d subcategories", c.GetID(), children))
+		return
+	}
+
+	if err := repositories.DeleteCategory(a.db(r), tenantOf(r), c.GetID()); err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rest.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+func (a *App) getCategoryProducts(w http.ResponseWriter, r *http.Request) {
+	c, ok := a.loadCategory(w, r)
+	if !ok {
+		return
+	}
+	count, page := getPagingFromRequest(r)
+
+	products, err := repositories.GetCategoryProducts(a.db(r), tenantOf(r), c.GetID(), page, count)
+	if err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	entries, err := a.productEntries(r, products)
+	if err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	total := repositories.CountCategoryProducts(a.db(r), tenantOf(r), c.GetID())
+	l := rest.ListingJSONResponse(a.linker(r).Href(rest.RouteCategoryProducts, "id", c.GetID()), page, total, count,
+		entries)
+	rest.RespondWithListing(w, r, http.StatusOK, l)
+}
+
+func (a *App) assignProductToCategory(w http.ResponseWriter, r *http.Request) {
+	c, p, ok := a.loadCategoryAndProduct(w, r)
+	if !ok {
+		return
+	}
+
+	if err := repositories.AssignProductToCategory(a.db(r), tenantOf(r), p.GetID(), c.GetID()); err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rest.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+func (a *App) unassignProductFromCategory(w http.ResponseWriter, r *http.Request) {
+	c, p, ok := a.loadCategoryAndProduct(w, r)
+	if !ok {
+		return
+	}
+
+	if err := repositories.UnassignProductFromCategory(a.db(r), tenantOf(r), p.GetID(), c.GetID()); err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rest.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// productEntries wraps products for a listing, linking each to its categories
+func (a *App) productEntries(r *http.Request, products []data.Product) ([]rest.Entry, error) {
+	ids := make([]string, len(products))
+	for i, p := range products {
+		ids[i] = p.GetID()
+	}
+	entries := rest.ProductsToEntries(a.linker(r), products)
+	return entries, a.linkProducts(r, entries, ids)
+}
+
+// partialProductEntries is productEntries for products narrowed by ?fields=
+func (a *App) partialProductEntries(r *http.Request, products []data.PartialProduct) ([]rest.Entry, error) {
+	ids := make([]string, len(products))
+	for i, p := range products {
+		ids[i] = p.ID
+	}
+	entries := rest.PartialProductsToEntries(a.linker(r), products)
+	return entries, a.linkProducts(r, entries, ids)
+}
+
+// linkProducts links each product's entry to its categories and images
+func (a *App) linkProducts(r *http.Request, entries []rest.Entry, productIDs []string) error {
+	if err := a.linkCategories(r, entries, productIDs); err != nil {
+		return err
+	}
+	return a.linkImages(r, entries, productIDs)
+}
+
+func (a *App) linkCategories(r *http.Request, entries []rest.Entry, productIDs []string) error {
+	assigned, err := repositories.GetProductCategoryIDs(a.reader(r), tenantOf(r), productIDs...)
+	if err != nil {
+		return err
+	}
+	for i, id := range productIDs {
+		if categoryIDs, ok := assigned[id]; ok {
+			entries[i].Links = append(entries[i].Links, rest.CategoryLinks(a.linker(r), categoryIDs)...)
+		}
+	}
+	return nil
+}
+
+func (a *App) readCategory(w http.ResponseWriter, r *http.Request) (data.Category, bool) {
+	c := data.CreateCategory("", nil)
+	if !a.Body.DecodeJSON(w, r, c) {
+		return nil, false
+	}
+	if err := data.ValidateCategory(c); err != nil {
+		rest.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return c, true
+}
+
+func (a *App) checkCategoryParent(w http.ResponseWriter, r *http.Request, id string, parentID *string) bool {
+	switch err := repositories.CheckCategoryParent(a.db(r), tenantOf(r), id, parentID); err {
+	case nil:
+		return true
+	case repositories.ErrCategoryParentNotFound, repositories.ErrCategoryCycle:
+		rest.RespondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+	return false
+}
+
+func (a *App) loadCategory(w http.ResponseWriter, r *http.Request) (data.Category, bool) {
+	id := data.ParseUUID(mux.Vars(r)["id"])
+
+	c, err := repositories.GetCategory(a.db(r), tenantOf(r), id.String())
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			rest.RespondWithError(w, http.StatusNotFound, "Category not found")
+		default:
+			rest.RespondWithError(w, http.StatusInternalServerError, "Error loading")
+		}
+		return nil, false
+	}
+	return c, true
+}
+
+func (a *App) loadCategoryAndProduct(w http.ResponseWriter, r *http.Request) (data.Category, data.Product, bool) {
+	c, ok := a.loadCategory(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+	p, ok := a.loadProductVar(w, r, "productId")
+	if !ok {
+		return nil, nil, false
+	}
+	return c, p, true
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/rest"
+	"github.com/Lewiscowles1986/go-gorilla-api/tenants"
+)
+
+type categoryEntry struct {
+	Object struct {
+		ID       string  `json:"id"`
+		Name     string  `json:"name"`
+		ParentID *string `json:"parent_id"`
+	} `json:"object"`
+	Links []rest.Link `json:"links"`
+}
+
+func createCategoryFromJSON(t *testing.T, payload string) categoryEntry {
+	req, _ := http.NewRequest("POST", "/categories", bytes.NewBufferString(payload))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	var e categoryEntry
+	if err := json.Unmarshal(response.Body.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestCreateCategoryHierarchy(t *testing.T) {
+	clearTable()
+
+	root := createCategoryFromJSON(t, `{"name":"Drinks"}`)
+	child := createCategoryFromJSON(t, `{"name":"Tea","parent_id":"`+root.Object.ID+`"}`)
+	if child.Object.ParentID == nil || *child.Object.ParentID != root.Object.ID {
+		t.Fatalf("Expected parent %s. Got %v", root.Object.ID, child.Object.ParentID)
+	}
+	if last := child.Links[len(child.Links)-1]; last.Rel != "parent" {
+		t.Errorf("Expected a parent link. Got %+v", child.Links)
+	}
+
+	req, _ := http.NewRequest("GET", "/categories/"+child.Object.ID, nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+}
+
+func TestCreateCategoryUnknownParent(t *testing.T) {
+	clearTable()
+
+	payload := `{"name":"Tea","parent_id":"` + data.CreateCategory("x", nil).GetID() + `"}`
+	req, _ := http.NewRequest("POST", "/categories", bytes.NewBufferString(payload))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+}
+
+func TestUpdateCategoryRejectsCycle(t *testing.T) {
+	clearTable()
+
+	root := createCategoryFromJSON(t, `{"name":"Drinks"}`)
+	child := createCategoryFromJSON(t, `{"name":"Tea","parent_id":"`+root.Object.ID+`"}`)
+
+	payload := `{"name":"Drinks","parent_id":"` + child.Object.ID + `"}`
+	req, _ := http.NewRequest("PUT", "/categories/"+root.Object.ID, bytes.NewBufferString(payload))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+}
+
+func TestDeleteCategoryWithChildrenConflicts(t *testing.T) {
+	clearTable()
+
+	root := createCategoryFromJSON(t, `{"name":"Drinks"}`)
+	child := createCategoryFromJSON(t, `{"name":"Tea","parent_id":"`+root.Object.ID+`"}`)
+
+	req, _ := http.NewRequest("DELETE", "/categories/"+root.Object.ID, nil)
+	checkResponseCode(t, http.StatusConflict, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("DELETE", "/categories/"+child.Object.ID, nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	req, _ = http.NewRequest("DELETE", "/categories/"+root.Object.ID, nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	req, _ = http.NewRequest("GET", "/categories/"+root.Object.ID, nil)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+}
+
+func TestCategoryProductAssignment(t *testing.T) {
+	clearTable()
+
+	tea := createCategoryFromJSON(t, `{"name":"Tea"}`)
+	green := data.CreateProduct("Green Tea", 3.5)
+	coffee := data.CreateProduct("Coffee", 4)
+	repositories.CreateProduct(a.DB, tenants.Default, green)
+	repositories.CreateProduct(a.DB, tenants.Default, coffee)
+
+	assignment := "/categories/" + tea.Object.ID + "/products/" + green.GetID()
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("PUT", assignment, nil)
+		checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	}
+
+	req, _ := http.NewRequest("GET", "/categories/"+tea.Object.ID+"/products", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var l rest.Listing
+	json.Unmarshal(response.Body.Bytes(), &l)
+	if l.Total != 1 || len(l.Data) != 1 {
+		t.Fatalf("Expected one product in category. Got %+v", l)
+	}
+	if l.Links[0].Href != "/categories/"+tea.Object.ID+"/products?page=1&count=10" {
+		t.Errorf("Unexpected link %+v", l.Links[0])
+	}
+
+	req, _ = http.NewRequest("GET", "/products", nil)
+	response = executeRequest(req)
+	json.Unmarshal(response.Body.Bytes(), &l)
+	for _, e := range l.Data {
+		object := e.Object.(map[string]interface{})
+		categories := []rest.Link{}
+		for _, link := range e.Links {
+			if link.Rel == "category" {
+				categories = append(categories, link)
+			}
+		}
+		switch object["id"] {
+		case green.GetID():
+			expected := rest.Link{Href: "/categories/" + tea.Object.ID, Rel: "category", Type: "GET"}
+			if len(categories) != 1 || categories[0] != expected {
+				t.Errorf("Expected category link. Got %+v", e.Links)
+			}
+		case coffee.GetID():
+			if len(categories) != 0 {
+				t.Errorf("Expected no category links. Got %+v", e.Links)
+			}
+		}
+	}
+
+	req, _ = http.NewRequest("GET", "/product/"+green.GetID(), nil)
+	if header := executeRequest(req).Header().Values("Link"); !slices.Contains(header,
+		`</categories/`+tea.Object.ID+`>; rel="category"`) {
+		t.Errorf("Expected the product's Link header to name its category. Got %v", header)
+	}
+
+	req, _ = http.NewRequest("DELETE", assignment, nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	if total := repositories.CountCategoryProducts(a.DB, tenants.Default, tea.Object.ID); total != 0 {
+		t.Errorf("Expected empty category. Got %d", total)
+	}
+}
+
+func TestDeleteProductRemovesAssignments(t *testing.T) {
+	clearTable()
+
+	tea := createCategoryFromJSON(t, `{"name":"Tea"}`)
+	p := data.CreateProduct("Green Tea", 3.5)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+	repositories.AssignProductToCategory(a.DB, tenants.Default, p.GetID(), tea.Object.ID)
+
+	req, _ := http.NewRequest("DELETE", "/product/"+p.GetID(), nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	if total := repositories.CountCategoryProducts(a.DB, tenants.Default, tea.Object.ID); total != 0 {
+		t.Errorf("Expected empty category. Got %d", total)
+	}
+}
@@ -0,0 +1,271 @@
+// Package client is the Go SDK for the product API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy - How hard to try before giving up on a request
+type RetryPolicy struct {
+	// MaxAttempts includes the first attempt; 1 disables retries.
+	MaxAttempts int
+	// InitialBackoff is doubled after each failed attempt, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// MaxRetryAfter caps how long a server's Retry-After may make us wait.
+	MaxRetryAfter time.Duration
+}
+
+// DefaultRetryPolicy - A few quick retries, suitable for interactive use
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+		MaxRetryAfter:  30 * time.Second,
+	}
+}
+
+// Client - Typed access to the product API
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	retry      RetryPolicy
+	userAgent  string
+	sleep      func(ctx context.Context, d time.Duration) error
+}
+
+// Option - Configures a Client
+type Option func(*Client)
+
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) { c.retry = p }
+}
+
+func WithUserAgent(ua string) Option {
+	return func(c *Client) { c.userAgent = ua }
+}
+
+// New - A Client for the API rooted at baseURL, e.g. http://localhost:8080
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("base URL %q must be absolute", baseURL)
+	}
+	c := &Client{
+		baseURL:    u,
+		httpClient: http.DefaultClient,
+		retry:      DefaultRetryPolicy(),
+		userAgent:  "go-gorilla-api-client",
+		sleep:      sleepContext,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.retry.MaxAttempts < 1 {
+		c.retry.MaxAttempts = 1
+	}
+	return c, nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// resolve turns an API path, or a hypermedia href, into an absolute URL
+func (c *Client) resolve(ref string) (string, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return c.baseURL.ResolveReference(u).String(), nil
+}
+
+// do sends a request, retrying where it is safe to, and decodes a 2xx JSON
+// body into out
+func (c *Client) do(ctx context.Context, method, ref string, in, out interface{}) error {
+	target, err := c.resolve(ref)
+	if err != nil {
+		return err
+	}
+	var body []byte
+	if in != nil {
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(ctx, method, target, body)
+		if err == nil {
+			// Only error statuses are worth another attempt; a 2xx that
+			// fails to decode would fail the same way again.
+			if err = c.decode(resp, out); !isStatusError(err) {
+				return err
+			}
+		}
+		lastErr = err
+
+		wait, retry := c.shouldRetry(method, attempt, err)
+		if !retry {
+			return lastErr
+		}
+		if err := c.sleep(ctx, wait); err != nil {
+			return lastErr
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, target string, body []byte) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.httpClient.Do(req)
+}
+
+func (c *Client) decode(resp *http.Response, out interface{}) error {
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if out == nil || len(raw) == 0 {
+			return nil
+		}
+		return json.Unmarshal(raw, out)
+	}
+
+	var apiErr struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(raw, &apiErr) != nil || apiErr.Error == "" {
+		apiErr.Error = strings.TrimSpace(string(raw))
+	}
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return &NotFoundError{Message: apiErr.Error}
+	case http.StatusBadRequest:
+		return &BadRequestError{Message: apiErr.Error}
+	case http.StatusServiceUnavailable:
+		return &UnavailableError{
+			Message:    apiErr.Error,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+	return &APIError{StatusCode: resp.StatusCode, Message: apiErr.Error}
+}
+
+// shouldRetry decides whether another attempt is safe and how long to wait.
+// A 503 means the server turned the request away before handling it, so
+// even a POST may be retried; other failures only retry idempotent methods.
+func (c *Client) shouldRetry(method string, attempt int, err error) (time.Duration, bool) {
+	if attempt >= c.retry.MaxAttempts {
+		return 0, false
+	}
+	backoff := c.backoff(attempt)
+
+	switch e := err.(type) {
+	case *UnavailableError:
+		if e.RetryAfter > 0 {
+			if c.retry.MaxRetryAfter > 0 && e.RetryAfter > c.retry.MaxRetryAfter {
+				return 0, false
+			}
+			return e.RetryAfter, true
+		}
+		return backoff, true
+	case *APIError:
+		if e.StatusCode == http.StatusBadGateway || e.StatusCode == http.StatusGatewayTimeout {
+			return backoff, isIdempotent(method)
+		}
+		return 0, false
+	case *NotFoundError, *BadRequestError:
+		return 0, false
+	}
+	// Transport errors: the request may or may not have been handled.
+	return backoff, isIdempotent(method)
+}
+
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.retry.InitialBackoff << uint(attempt-1)
+	if d <= 0 || (c.retry.MaxBackoff > 0 && d > c.retry.MaxBackoff) {
+		d = c.retry.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	// Full jitter keeps a fleet of clients from retrying in lockstep.
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+func isStatusError(err error) bool {
+	switch err.(type) {
+	case *NotFoundError, *BadRequestError, *UnavailableError, *APIError:
+		return true
+	}
+	return false
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter understands both delay-seconds and HTTP-date forms
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := at.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,193 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) (*Client, *[]time.Duration) {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	c, err := New(srv.URL, WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     50 * time.Millisecond,
+		MaxRetryAfter:  5 * time.Second,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waits := &[]time.Duration{}
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		*waits = append(*waits, d)
+		return nil
+	}
+	return c, waits
+}
+
+func TestNewRequiresAbsoluteURL(t *testing.T) {
+	if _, err := New("/products"); err == nil {
+		t.Errorf("Expected an error for a relative base URL")
+	}
+}
+
+func TestNotFoundIsTyped(t *testing.T) {
+	c, waits := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"Product not found"}`))
+	})
+
+	_, err := c.GetProduct(context.Background(), "x")
+	var nf *NotFoundError
+	if !errors.As(err, &nf) || nf.Message != "Product not found" {
+		t.Fatalf("Expected NotFoundError. Got %v", err)
+	}
+	if len(*waits) != 0 {
+		t.Errorf("Expected no retries for a 404. Got %d", len(*waits))
+	}
+}
+
+func TestBadRequestIsTyped(t *testing.T) {
+	c, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"Invalid request payload"}`))
+	})
+
+	_, err := c.CreateProduct(context.Background(), ProductInput{Name: "x"})
+	var br *BadRequestError
+	if !errors.As(err, &br) || br.Message != "Invalid request payload" {
+		t.Fatalf("Expected BadRequestError. Got %v", err)
+	}
+}
+
+func TestUnavailableRetriesHonourRetryAfter(t *testing.T) {
+	var calls int32
+	c, waits := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":"Too many requests"}`))
+			return
+		}
+		w.Write([]byte(`{"id":"abc","name":"ok","price":1}`))
+	})
+
+	p, err := c.GetProduct(context.Background(), "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "ok" {
+		t.Errorf("Unexpected product %+v", p)
+	}
+	if len(*waits) != 2 || (*waits)[0] != 2*time.Second || (*waits)[1] != 2*time.Second {
+		t.Errorf("Expected two waits of 2s. Got %v", *waits)
+	}
+}
+
+func TestUnavailableGivesUpWithTypedError(t *testing.T) {
+	c, waits := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error":"Too many requests"}`))
+	})
+
+	_, err := c.CreateProduct(context.Background(), ProductInput{Name: "x", Price: 1})
+	var un *UnavailableError
+	if !errors.As(err, &un) || un.Message != "Too many requests" {
+		t.Fatalf("Expected UnavailableError. Got %v", err)
+	}
+	if len(*waits) != 2 {
+		t.Errorf("Expected a POST to be retried on 503. Got %d waits", len(*waits))
+	}
+	for _, w := range *waits {
+		if w <= 0 || w > 50*time.Millisecond {
+			t.Errorf("Expected backoff within (0, 50ms]. Got %v", w)
+		}
+	}
+}
+
+func TestRetryAfterBeyondCapIsNotWaited(t *testing.T) {
+	c, waits := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	_, err := c.GetProduct(context.Background(), "x")
+	var un *UnavailableError
+	if !errors.As(err, &un) || un.RetryAfter != time.Hour {
+		t.Fatalf("Expected UnavailableError with RetryAfter of 1h. Got %v", err)
+	}
+	if len(*waits) != 0 {
+		t.Errorf("Expected no waits. Got %v", *waits)
+	}
+}
+
+func TestBadGatewayOnlyRetriesIdempotentMethods(t *testing.T) {
+	var calls int32
+	c, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	c.CreateProduct(context.Background(), ProductInput{Name: "x", Price: 1})
+	if calls != 1 {
+		t.Errorf("Expected POST not to be retried on 502. Got %d calls", calls)
+	}
+
+	calls = 0
+	_, err := c.GetProduct(context.Background(), "x")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("Expected APIError 502. Got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected GET to be attempted 3 times. Got %d", calls)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2022, 11, 21, 12, 0, 0, 0, time.UTC)
+	cases := map[string]time.Duration{
+		"":                              0,
+		"5":                             5 * time.Second,
+		"-1":                            0,
+		"soon":                          0,
+		"Mon, 21 Nov 2022 12:00:30 GMT": 30 * time.Second,
+		"Mon, 21 Nov 2022 11:00:00 GMT": 0,
+	}
+	for value, expected := range cases {
+		if result := parseRetryAfter(value, now); result != expected {
+			t.Errorf("Retry-After %q: expected %v got %v", value, expected, result)
+		}
+	}
+}
+
+func TestIteratorStopsOnError(t *testing.T) {
+	c, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"data":[{"object":{"id":"a","name":"a","price":1},"links":null}],
+			"total":2,"count":1,"page":1,"limit":1,
+			"links":[{"href":"/products?page=2&count=1","rel":"next","type":"GET"}]}`))
+	})
+
+	it := c.ListProducts(context.Background(), 1)
+	seen := 0
+	for it.Next() {
+		seen++
+	}
+	if seen != 1 {
+		t.Errorf("Expected 1 product before the error. Got %d", seen)
+	}
+	var apiErr *APIError
+	if !errors.As(it.Err(), &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected APIError 500. Got %v", it.Err())
+	}
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// NotFoundError - The API answered 404, e.g. "Product not found"
+type NotFoundError struct {
+	Message string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("not found: %s", e.Message)
+}
+
+// BadRequestError - The API answered 400, e.g. "Invalid request payload"
+type BadRequestError struct {
+	Message string
+}
+
+func (e *BadRequestError) Error() string {
+	return fmt.Sprintf("bad request: %s", e.Message)
+}
+
+// UnavailableError - The API answered 503 on every attempt, e.g. "Too many
+// requests" from the server's concurrency limit
+type UnavailableError struct {
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("service unavailable: %s", e.Message)
+}
+
+// APIError - Any other non-2xx response
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Message)
+}
@@ -0,0 +1,181 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Product - A product as the API represents it
+type Product struct {
+	ID    string  `json:"id"`
+	Name  string  `json:"name"`
+	Price float64 `json:"price"`
+}
+
+// ProductInput - The writable fields of a product
+type ProductInput struct {
+	Name  string  `json:"name"`
+	Price float64 `json:"price"`
+}
+
+// Link - A hypermedia link from a listing or entry
+type Link struct {
+	Href string `json:"href"`
+	Rel  string `json:"rel"`
+	Type string `json:"type"`
+}
+
+// ProductEntry - A product wrapped with its own links, as listings return it
+type ProductEntry struct {
+	Object Product `json:"object"`
+	Links  []Link  `json:"links"`
+}
+
+// ProductPage - One page of /products, with typed entries
+type ProductPage struct {
+	Data  []ProductEntry `json:"data"`
+	Total uint64         `json:"total"`
+	Count uint8          `json:"count"`
+	Page  uint64         `json:"page"`
+	Limit uint8          `json:"limit"`
+	Links []Link         `json:"links"`
+}
+
+// Link - The href of the link with the given rel, if present
+func (p *ProductPage) Link(rel string) (string, bool) {
+	for _, l := range p.Links {
+		if l.Rel == rel {
+			return l.Href, true
+		}
+	}
+	return "", false
+}
+
+func productPath(id string) string {
+	return "/product/" + url.PathEscape(id)
+}
+
+func (c *Client) GetProduct(ctx context.Context, id string) (*Product, error) {
+	p := &Product{}
+	if err := c.do(ctx, http.MethodGet, productPath(id), nil, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (c *Client) CreateProduct(ctx context.Context, in ProductInput) (*Product, error) {
+	p := &Product{}
+	if err := c.do(ctx, http.MethodPost, "/product", in, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (c *Client) UpdateProduct(ctx context.Context, id string, in ProductInput) (*Product, error) {
+	p := &Product{}
+	if err := c.do(ctx, http.MethodPut, productPath(id), in, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (c *Client) DeleteProduct(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, productPath(id), nil, nil)
+}
+
+// ListProductsPage - Fetches a single page; page and count follow the
+// server's defaults when zero
+func (c *Client) ListProductsPage(ctx context.Context, page uint64, count uint8) (*ProductPage, error) {
+	q := url.Values{}
+	if page > 0 {
+		q.Set("page", strconv.FormatUint(page, 10))
+	}
+	if count > 0 {
+		q.Set("count", strconv.FormatUint(uint64(count), 10))
+	}
+	ref := "/products"
+	if len(q) > 0 {
+		ref += "?" + q.Encode()
+	}
+	return c.listPage(ctx, ref)
+}
+
+func (c *Client) listPage(ctx context.Context, ref string) (*ProductPage, error) {
+	page := &ProductPage{}
+	if err := c.do(ctx, http.MethodGet, ref, nil, page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// ListProducts - Iterates every product, following each page's next link
+//
+//	it := c.ListProducts(ctx, 100)
+//	for it.Next() {
+//		p := it.Product()
+//	}
+//	if err := it.Err(); err != nil { ... }
+func (c *Client) ListProducts(ctx context.Context, count uint8) *ProductIterator {
+	first := "/products"
+	if count > 0 {
+		first = fmt.Sprintf("/products?page=1&count=%d", count)
+	}
+	return &ProductIterator{ctx: ctx, client: c, next: first}
+}
+
+// ProductIterator - Lazily walks a product listing page by page
+type ProductIterator struct {
+	ctx    context.Context
+	client *Client
+	next   string
+	page   *ProductPage
+	index  int
+	err    error
+}
+
+// Next - Advances to the next product, fetching pages as needed
+func (it *ProductIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	for it.page == nil || it.index+1 >= len(it.page.Data) {
+		if it.next == "" {
+			return false
+		}
+		page, err := it.client.listPage(it.ctx, it.next)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page = page
+		it.index = -1
+		it.next, _ = page.Link("next")
+	}
+	it.index++
+	return true
+}
+
+// Product - The product Next advanced to
+func (it *ProductIterator) Product() Product {
+	return it.page.Data[it.index].Object
+}
+
+// Entry - The current product with its links
+func (it *ProductIterator) Entry() ProductEntry {
+	return it.page.Data[it.index]
+}
+
+// Total - The listing's total as of the most recently fetched page
+func (it *ProductIterator) Total() uint64 {
+	if it.page == nil {
+		return 0
+	}
+	return it.page.Total
+}
+
+func (it *ProductIterator) Err() error {
+	return it.err
+}
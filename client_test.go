@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/client"
+)
+
+func newAPIClient(t *testing.T) *client.Client {
+	srv := httptest.NewServer(a.Router)
+	t.Cleanup(srv.Close)
+
+	c, err := client.New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestClientProductLifecycle(t *testing.T) {
+	clearTable()
+	c := newAPIClient(t)
+	ctx := context.Background()
+
+	created, err := c.CreateProduct(ctx, client.ProductInput{Name: "sdk product", Price: 12.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetched, err := c.GetProduct(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *fetched != *created {
+		t.Errorf("Expected %+v. Got %+v", created, fetched)
+	}
+
+	updated, err := c.UpdateProduct(ctx, created.ID, client.ProductInput{Name: "renamed", Price: 13})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Name != "renamed" || updated.Price != 13 {
+		t.Errorf("Unexpected product %+v", updated)
+	}
+
+	if err := c.DeleteProduct(ctx, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetProduct(ctx, created.ID)
+	var nf *client.NotFoundError
+	if !errors.As(err, &nf) || nf.Message != "Product not found" {
+		t.Errorf("Expected NotFoundError. Got %v", err)
+	}
+}
+
+func TestClientTypedBadRequest(t *testing.T) {
+	clearTable()
+	c := newAPIClient(t)
+
+	_, err := c.CreateProduct(context.Background(), client.ProductInput{Name: "", Price: 1})
+	var br *client.BadRequestError
+	if !errors.As(err, &br) {
+		t.Errorf("Expected BadRequestError. Got %v", err)
+	}
+
+	_, err = c.UpdateProduct(context.Background(),
+		uuid.Must(uuid.NewV4(), nil).String(), client.ProductInput{Name: "x", Price: 1})
+	var nf *client.NotFoundError
+	if !errors.As(err, &nf) {
+		t.Errorf("Expected NotFoundError. Got %v", err)
+	}
+}
+
+func TestClientIteratorFollowsNextLinks(t *testing.T) {
+	clearTable()
+	for i := 0; i < 23; i++ {
+		p := fmt.Sprintf(`{"name":"item %d","price":1}`, i)
+		createProductFromJSON(t, p)
+	}
+	c := newAPIClient(t)
+
+	it := c.ListProducts(context.Background(), 5)
+	seen := map[string]bool{}
+	for it.Next() {
+		seen[it.Product().ID] = true
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 23 || it.Total() != 23 {
+		t.Errorf("Expected 23 distinct products. Got %d (total %d)", len(seen), it.Total())
+	}
+}
+
+func TestClientSurfacesServerConcurrencyLimit(t *testing.T) {
+	// With no slots every request times out in the middleware with a 503.
+	srv := httptest.NewServer(maxClientsMiddleware(a.Router, 0))
+	t.Cleanup(srv.Close)
+
+	c, _ := client.New(srv.URL, client.WithRetryPolicy(client.RetryPolicy{MaxAttempts: 1}))
+	_, err := c.GetProduct(context.Background(), uuid.Must(uuid.NewV4(), nil).String())
+
+	var un *client.UnavailableError
+	if !errors.As(err, &un) {
+		t.Fatalf("Expected UnavailableError. Got %v", err)
+	}
+	if un.Message != "Too many requests" || un.RetryAfter != time.Second {
+		t.Errorf("Unexpected error %+v", un)
+	}
+}
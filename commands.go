@@ -0,0 +1,572 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/events"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/settings"
+	"github.com/Lewiscowles1986/go-gorilla-api/tenants"
+)
+
+const programName = "go-gorilla-api"
+
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdout, stderr io.Writer) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"serve", "run the REST and gRPC servers (default)", serveCommand},
+		{"migrate", "apply, revert or list schema migrations", migrateCommand},
+		{"seed", "insert randomly generated products", seedCommand},
+		{"export", "write every product to stdout or a file", exportCommand},
+		{"import", "create or update products from a CSV file", importCommand},
+		{"check", "verify database connectivity and schema", checkCommand},
+		{"help", "show help for a command", helpCommand},
+	}
+}
+
+func runCLI(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") && !isHelpFlag(args[0]) {
+		return serveCommand(args, stdout, stderr)
+	}
+	if isHelpFlag(args[0]) {
+		return helpCommand(nil, stdout, stderr)
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:], stdout, stderr)
+		}
+	}
+	fmt.Fprintf(stderr, "unknown command %q\n\n", args[0])
+	printUsage(stderr)
+	return exitUsage
+}
+
+func isHelpFlag(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\nCommands:\n", programName)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(w, "\nThe database is configured with APP_DB_TYPE, APP_DB_USERNAME,\n"+
+		"APP_DB_PASSWORD and APP_DB_NAME. Exit codes: %d success, %d failure,\n"+
+		"%d usage error.\n", exitOK, exitFailure, exitUsage)
+}
+
+func helpCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		printUsage(stdout)
+		return exitOK
+	}
+	for _, c := range commands {
+		if c.name == args[0] && c.name != "help" {
+			return c.run([]string{"-h"}, stdout, stderr)
+		}
+	}
+	fmt.Fprintf(stderr, "unknown command %q\n", args[0])
+	return exitUsage
+}
+
+// newFlagSet gives every command consistent help output on stderr
+func newFlagSet(name, usage string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s %s\n", programName, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags maps flag parsing failures to exit codes; -h is not an error
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		return exitOK, false
+	}
+	if err != nil {
+		return exitUsage, false
+	}
+	return exitOK, true
+}
+
+// tenantFlag adds -tenant, naming the storefront a command works on
+func tenantFlag(fs *flag.FlagSet) *string {
+	return fs.String("tenant", tenants.Default, "tenant whose products to use")
+}
+
+// checkTenant reports whether the tenant a command names has been
+// provisioned, so rows are never written for a tenant that does not exist
+func checkTenant(db *repositories.DB, tenantID string, stderr io.Writer) bool {
+	exists, err := repositories.TenantExists(db, tenantID)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return false
+	}
+	if !exists {
+		fmt.Fprintf(stderr, "unknown tenant %q\n", tenantID)
+	}
+	return exists
+}
+
+func dbSettings() (string, string) {
+	dbType := settings.Getenv("APP_DB_TYPE", "sqlite3")
+	return dbType, settings.GetDBConnStr(
+		dbType,
+		os.Getenv("APP_DB_USERNAME"),
+		os.Getenv("APP_DB_PASSWORD"),
+		settings.Getenv("APP_DB_NAME", "database"))
+}
+
+func openDB() (*repositories.DB, string, error) {
+	dbType, connStr := dbSettings()
+	db, err := repositories.Open(dbType, connStr)
+	if err != nil {
+		return nil, dbType, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, dbType, err
+	}
+	return db, dbType, nil
+}
+
+func serveCommand(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("serve", "serve [flags]", stderr)
+	var wait time.Duration
+	fs.DurationVar(&wait, "graceful-timeout", time.Minute*1, "the duration for which the server gracefully wait for existing connections to finish - e.g. 15s or 1m")
+	addr := fs.String("addr", settings.Getenv("APP_ADDR", ":8080"), "address for the REST API")
+	grpcAddr := fs.String("grpc-addr", settings.Getenv("APP_GRPC_ADDR", ":9090"), "address for the gRPC API")
+	adminAddr := fs.String("admin-addr", settings.Getenv("APP_ADMIN_ADDR", "localhost:8081"),
+		"address for the admin API and diagnostics, host:port or unix:/path/to/socket")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	a := App{}
+	a.Initialize(dbSettings())
+	a.Run(*addr, *grpcAddr, *adminAddr, wait)
+	return exitOK
+}
+
+func migrateCommand(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("migrate", "migrate up [-to VERSION] | down [-steps N | -to VERSION] | status", stderr)
+	to := fs.Int("to", 0, "with up, stop after this version (0 applies everything); with down, revert everything after it")
+	steps := fs.Int("steps", 1, "with down, how many migrations to revert")
+	if len(args) == 0 || isHelpFlag(args[0]) {
+		fs.Usage()
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+
+	action := args[0]
+	if code, ok := parseFlags(fs, args[1:]); !ok {
+		return code
+	}
+
+	db, _, err := openDB()
+	if err != nil {
+		fmt.Fprintf(stderr, "unable to connect to database: %v\n", err)
+		return exitFailure
+	}
+	defer db.Close()
+
+	switch action {
+	case "up":
+		done, err := repositories.MigrateUp(db, *to)
+		for _, m := range done {
+			fmt.Fprintf(stdout, "applied %d %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailure
+		}
+		if len(done) == 0 {
+			fmt.Fprintln(stdout, "no pending migrations")
+		}
+	case "down":
+		toVersion := false
+		fs.Visit(func(f *flag.Flag) { toVersion = toVersion || f.Name == "to" })
+		var done []repositories.Migration
+		if toVersion {
+			done, err = repositories.MigrateDownTo(db, *to)
+		} else {
+			done, err = repositories.MigrateDown(db, *steps)
+		}
+		for _, m := range done {
+			fmt.Fprintf(stdout, "reverted %d %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailure
+		}
+	case "status":
+		states, err := repositories.MigrationStatus(db)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailure
+		}
+		for _, s := range states {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(stdout, "%4d  %-30s %s\n", s.Version, s.Name, applied)
+		}
+	default:
+		fmt.Fprintf(stderr, "unknown migrate action %q\n", action)
+		fs.Usage()
+		return exitUsage
+	}
+	return exitOK
+}
+
+var seedAdjectives = []string{"Small", "Large", "Shiny", "Rustic", "Sleek", "Ergonomic", "Handmade", "Vintage"}
+var seedNouns = []string{"Chair", "Table", "Lamp", "Mug", "Clock", "Shelf", "Bottle", "Notebook"}
+
+func seedCommand(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("seed", "seed [-count N] [-tenant ID]", stderr)
+	count := fs.Int("count", 100, "number of products to create")
+	tenantID := tenantFlag(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if *count < 1 {
+		fmt.Fprintln(stderr, "-count must be at least 1")
+		return exitUsage
+	}
+
+	db, _, err := openDB()
+	if err != nil {
+		fmt.Fprintf(stderr, "unable to connect to database: %v\n", err)
+		return exitFailure
+	}
+	defer db.Close()
+	if !checkTenant(db, *tenantID, stderr) {
+		return exitFailure
+	}
+
+	products := make([]data.Product, *count)
+	for i := range products {
+		name := fmt.Sprintf("%s %s",
+			seedAdjectives[rand.Intn(len(seedAdjectives))],
+			seedNouns[rand.Intn(len(seedNouns))])
+		products[i] = data.CreateProduct(name, float64(rand.Intn(100000))/100)
+	}
+	err = db.WithTx(context.Background(), func(tx *repositories.Tx) error {
+		for _, p := range products {
+			if err := repositories.CreateProduct(tx, *tenantID, p); err != nil {
+				return err
+			}
+			if err := repositories.EnqueueEvent(tx, *tenantID, events.ProductCreated, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+
+	fmt.Fprintf(stdout, "created %d products\n", *count)
+	return exitOK
+}
+
+func exportCommand(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("export", "export [-format csv|json] [-output FILE] [-tenant ID]", stderr)
+	format := fs.String("format", "csv", "output format: csv or json")
+	output := fs.String("output", "-", "file to write, - for stdout")
+	tenantID := tenantFlag(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if *format != "csv" && *format != "json" {
+		fmt.Fprintf(stderr, "unsupported format %q\n", *format)
+		return exitUsage
+	}
+
+	db, _, err := openDB()
+	if err != nil {
+		fmt.Fprintf(stderr, "unable to connect to database: %v\n", err)
+		return exitFailure
+	}
+	defer db.Close()
+	if !checkTenant(db, *tenantID, stderr) {
+		return exitFailure
+	}
+
+	var w io.Writer = stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailure
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := exportProducts(db, *tenantID, *format, w); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+func exportProducts(db repositories.DBTX, tenantID, format string, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	cw := csv.NewWriter(bw)
+	if format == "csv" {
+		cw.Write([]string{"id", "name", "price"})
+	} else {
+		bw.WriteString("[")
+	}
+
+	written := 0
+	for page := uint64(1); ; page++ {
+		products, err := repositories.GetProducts(db, tenantID, page, 250)
+		if err != nil {
+			return err
+		}
+		for _, p := range products {
+			if format == "csv" {
+				cw.Write([]string{p.GetID(), p.GetName(),
+					strconv.FormatFloat(p.GetPrice(), 'f', 2, 64)})
+				continue
+			}
+			if written > 0 {
+				bw.WriteString(",")
+			}
+			encoded, err := json.Marshal(p)
+			if err != nil {
+				return err
+			}
+			bw.WriteString("\n  ")
+			bw.Write(encoded)
+			written++
+		}
+		if len(products) < 250 {
+			break
+		}
+	}
+
+	if format == "csv" {
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+	} else {
+		bw.WriteString("\n]\n")
+	}
+	return bw.Flush()
+}
+
+func importCommand(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("import", "import [-tenant ID] FILE\n\nFILE is a CSV with a header row naming name and price columns, and\n"+
+		"optionally id. Existing ids are updated. Gzipped files are accepted;\n"+
+		"use - to read from stdin.", stderr)
+	tenantID := tenantFlag(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	var in io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailure
+		}
+		defer f.Close()
+		in = f
+	}
+
+	db, _, err := openDB()
+	if err != nil {
+		fmt.Fprintf(stderr, "unable to connect to database: %v\n", err)
+		return exitFailure
+	}
+	defer db.Close()
+	if !checkTenant(db, *tenantID, stderr) {
+		return exitFailure
+	}
+
+	created, updated, err := importProducts(db, *tenantID, in)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	fmt.Fprintf(stdout, "imported %d products (%d created, %d updated)\n",
+		created+updated, created, updated)
+	return exitOK
+}
+
+// importProducts loads every row, and queues its event, in one transaction
+// so a bad row leaves the database untouched
+func importProducts(db *repositories.DB, tenantID string, in io.Reader) (int, int, error) {
+	br := bufio.NewReader(in)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return 0, 0, err
+		}
+		defer gr.Close()
+		in = gr
+	} else {
+		in = br
+	}
+
+	r := csv.NewReader(in)
+	header, err := r.Read()
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to read header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"name", "price"} {
+		if _, ok := columns[required]; !ok {
+			return 0, 0, fmt.Errorf("missing %q column", required)
+		}
+	}
+
+	// Every row is read before the transaction starts, so a retried
+	// transaction sees them all again.
+	var records [][]string
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		records = append(records, record)
+	}
+
+	created, updated := 0, 0
+	err = db.WithTx(context.Background(), func(tx *repositories.Tx) error {
+		created, updated = 0, 0
+		for i, record := range records {
+			isNew, err := importRecord(tx, tenantID, columns, record)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", i+2, err)
+			}
+			if isNew {
+				created++
+			} else {
+				updated++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return created, updated, nil
+}
+
+func importRecord(tx *repositories.Tx, tenantID string, columns map[string]int, record []string) (bool, error) {
+	price, err := strconv.ParseFloat(strings.TrimSpace(record[columns["price"]]), 64)
+	if err != nil {
+		return false, errors.New("invalid price")
+	}
+	p := data.CreateProduct(record[columns["name"]], price)
+	if i, ok := columns["id"]; ok && strings.TrimSpace(record[i]) != "" {
+		id := data.ParseUUID(strings.TrimSpace(record[i]))
+		if id.String() != strings.TrimSpace(record[i]) {
+			return false, fmt.Errorf("invalid id %q", record[i])
+		}
+		p = data.NewProduct(id.String(), p.GetName(), price)
+	}
+	if err := data.ValidateProduct(p); err != nil {
+		return false, err
+	}
+
+	m, err := repositories.UpdateProduct(tx, tenantID, p.GetID(), p)
+	switch err {
+	case nil:
+		return false, repositories.EnqueueEvent(tx, tenantID, events.ProductUpdated, m)
+	case sql.ErrNoRows:
+		if err := repositories.CreateProduct(tx, tenantID, p); err != nil {
+			return true, err
+		}
+		return true, repositories.EnqueueEvent(tx, tenantID, events.ProductCreated, p)
+	default:
+		return false, err
+	}
+}
+
+func checkCommand(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("check", "check", stderr)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	db, dbType, err := openDB()
+	if err != nil {
+		fmt.Fprintf(stderr, "FAIL connectivity: %v\n", err)
+		return exitFailure
+	}
+	defer db.Close()
+	fmt.Fprintf(stdout, "ok   connectivity (%s)\n", dbType)
+
+	pending, err := repositories.PendingMigrations(db)
+	if err != nil {
+		fmt.Fprintf(stderr, "FAIL schema: %v\n", err)
+		return exitFailure
+	}
+	if len(pending) > 0 {
+		fmt.Fprintf(stderr, "FAIL schema: %d pending migrations, run migrate up\n", len(pending))
+		return exitFailure
+	}
+	fmt.Fprintln(stdout, "ok   schema up to date")
+
+	var total uint64
+	if err := db.QueryRow("SELECT COUNT(id) FROM products").Scan(&total); err != nil {
+		fmt.Fprintf(stderr, "FAIL products table: %v\n", err)
+		return exitFailure
+	}
+	fmt.Fprintf(stdout, "ok   products table (%d rows)\n", total)
+	return exitOK
+}
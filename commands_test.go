@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/events"
+)
+
+func useTempDB(t *testing.T) {
+	t.Setenv("APP_DB_TYPE", "sqlite3")
+	t.Setenv("APP_DB_NAME", filepath.Join(t.TempDir(), "cli"))
+}
+
+func runCommand(t *testing.T, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := runCLI(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func expectExit(t *testing.T, expected, actual int, stderr string) {
+	t.Helper()
+	if expected != actual {
+		t.Fatalf("Expected exit code %d. Got %d\n%s", expected, actual, stderr)
+	}
+}
+
+func TestCLIUnknownCommand(t *testing.T) {
+	code, _, stderr := runCommand(t, "frobnicate")
+	expectExit(t, exitUsage, code, stderr)
+	if !strings.Contains(stderr, "Commands:") {
+		t.Errorf("Expected usage on stderr. Got %q", stderr)
+	}
+}
+
+func TestCLIHelp(t *testing.T) {
+	code, stdout, stderr := runCommand(t, "help")
+	expectExit(t, exitOK, code, stderr)
+	for _, c := range commands {
+		if !strings.Contains(stdout, c.name) {
+			t.Errorf("Expected %q in help output", c.name)
+		}
+	}
+
+	code, _, stderr = runCommand(t, "help", "seed")
+	expectExit(t, exitOK, code, stderr)
+	if !strings.Contains(stderr, "-count") {
+		t.Errorf("Expected seed flags in help. Got %q", stderr)
+	}
+}
+
+func TestCLIBadFlag(t *testing.T) {
+	code, _, stderr := runCommand(t, "seed", "-bogus")
+	expectExit(t, exitUsage, code, stderr)
+}
+
+func TestCLIMigrateLifecycle(t *testing.T) {
+	useTempDB(t)
+
+	code, _, stderr := runCommand(t, "check")
+	expectExit(t, exitFailure, code, stderr)
+	if !strings.Contains(stderr, "pending migrations") {
+		t.Errorf("Expected check to report pending migrations. Got %q", stderr)
+	}
+
+	code, stdout, stderr := runCommand(t, "migrate", "up")
+	expectExit(t, exitOK, code, stderr)
+	if !strings.Contains(stdout, "applied 1 create products") {
+		t.Errorf("Unexpected output %q", stdout)
+	}
+
+	code, stdout, stderr = runCommand(t, "migrate", "status")
+	expectExit(t, exitOK, code, stderr)
+	if strings.Contains(stdout, "pending") {
+		t.Errorf("Expected every migration to be applied. Got %q", stdout)
+	}
+
+	code, _, stderr = runCommand(t, "check")
+	expectExit(t, exitOK, code, stderr)
+
+	code, stdout, stderr = runCommand(t, "migrate", "down", "-to", "2")
+	expectExit(t, exitOK, code, stderr)
+	if !strings.Contains(stdout, "reverted 3 create categories") || strings.Contains(stdout, "reverted 2 ") {
+		t.Errorf("Expected everything after 2 reverted. Got %q", stdout)
+	}
+
+	code, stdout, stderr = runCommand(t, "migrate", "down", "-steps", "100")
+	expectExit(t, exitOK, code, stderr)
+	if !strings.Contains(stdout, "reverted 1 create products") {
+		t.Errorf("Unexpected output %q", stdout)
+	}
+
+	code, _, stderr = runCommand(t, "migrate", "sideways")
+	expectExit(t, exitUsage, code, stderr)
+}
+
+func TestCLISeedExportImport(t *testing.T) {
+	useTempDB(t)
+	code, _, stderr := runCommand(t, "migrate", "up")
+	expectExit(t, exitOK, code, stderr)
+
+	code, stdout, stderr := runCommand(t, "seed", "--count", "260")
+	expectExit(t, exitOK, code, stderr)
+	if stdout != "created 260 products\n" {
+		t.Errorf("Unexpected output %q", stdout)
+	}
+	expectOutboxEvents(t, string(events.ProductCreated), 260)
+
+	code, stdout, stderr = runCommand(t, "export", "--format", "csv")
+	expectExit(t, exitOK, code, stderr)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 261 || lines[0] != "id,name,price" {
+		t.Fatalf("Expected header and 260 rows. Got %d lines", len(lines))
+	}
+
+	// Re-importing the export updates every row and creates nothing.
+	exported := filepath.Join(t.TempDir(), "products.csv.gz")
+	f, _ := os.Create(exported)
+	gw := gzip.NewWriter(f)
+	gw.Write([]byte(stdout + ",new product,1.25\n"))
+	gw.Close()
+	f.Close()
+
+	code, stdout, stderr = runCommand(t, "import", exported)
+	expectExit(t, exitOK, code, stderr)
+	if stdout != "imported 261 products (1 created, 260 updated)\n" {
+		t.Errorf("Unexpected output %q", stdout)
+	}
+	expectOutboxEvents(t, string(events.ProductCreated), 261)
+	expectOutboxEvents(t, string(events.ProductUpdated), 260)
+
+	code, stdout, stderr = runCommand(t, "export", "--format", "json")
+	expectExit(t, exitOK, code, stderr)
+	if !strings.Contains(stdout, `"name":"new product"`) {
+		t.Errorf("Expected imported product in JSON export")
+	}
+}
+
+// expectOutboxEvents checks the CLI queued as many events of eventType as
+// the products it wrote
+func expectOutboxEvents(t *testing.T, eventType string, expected int) {
+	t.Helper()
+	db, _, err := openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	db.QueryRow("SELECT COUNT(*) FROM outbox WHERE event_type = $1", eventType).Scan(&n)
+	if n != expected {
+		t.Errorf("Expected %d %s events. Got %d", expected, eventType, n)
+	}
+}
+
+func TestCLIImportRejectsInvalidRows(t *testing.T) {
+	useTempDB(t)
+	code, _, stderr := runCommand(t, "migrate", "up")
+	expectExit(t, exitOK, code, stderr)
+
+	path := filepath.Join(t.TempDir(), "bad.csv")
+	os.WriteFile(path, []byte("name,price\ngood,1.00\nbad,-5\n"), 0o644)
+
+	code, _, stderr = runCommand(t, "import", path)
+	expectExit(t, exitFailure, code, stderr)
+	if !strings.Contains(stderr, "line 3") {
+		t.Errorf("Expected error to name line 3. Got %q", stderr)
+	}
+
+	code, stdout, stderr := runCommand(t, "check")
+	expectExit(t, exitOK, code, stderr)
+	if !strings.Contains(stdout, "(0 rows)") {
+		t.Errorf("Expected the failed import to be rolled back. Got %q", stdout)
+	}
+}
+
+func TestCLIImportRequiresFile(t *testing.T) {
+	code, _, stderr := runCommand(t, "import")
+	expectExit(t, exitUsage, code, stderr)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/middleware"
+	"github.com/Lewiscowles1986/go-gorilla-api/settings"
+	"github.com/Lewiscowles1986/go-gorilla-api/tenants"
+)
+
+// corsPolicy reads a CORS policy from the environment variables named
+// prefix_ORIGINS, _METHODS, _HEADERS, _EXPOSE_HEADERS, _CREDENTIALS and
+// _MAX_AGE_SECONDS
+func corsPolicy(prefix string) middleware.CORSPolicy {
+	return middleware.CORSPolicy{
+		AllowedOrigins: splitList(settings.Getenv(prefix+"_ORIGINS", "")),
+		AllowedMethods: splitList(settings.Getenv(prefix+"_METHODS", "")),
+		AllowedHeaders: splitList(settings.Getenv(prefix+"_HEADERS",
+			"Content-Type, Authorization, "+tenants.HeaderName+", "+ReadYourWritesHeader)),
+		ExposedHeaders:   splitList(settings.Getenv(prefix+"_EXPOSE_HEADERS", "")),
+		AllowCredentials: settings.Getenv(prefix+"_CREDENTIALS", "") == "true",
+		MaxAge:           time.Duration(settings.GetenvInt(prefix+"_MAX_AGE_SECONDS", 600)) * time.Second,
+	}
+}
+
+// corsPolicy - The policy for the public API's routes
+func (a *App) corsPolicy(route *mux.Route) (middleware.CORSPolicy, bool) {
+	return a.CORS, len(a.CORS.AllowedOrigins) > 0
+}
+
+// adminCORSPolicy - AdminCORS for /admin; /debug is for tools, not browsers
+func (a *App) adminCORSPolicy(route *mux.Route) (middleware.CORSPolicy, bool) {
+	path, _ := route.GetPathTemplate()
+	if strings.HasPrefix(path, "/debug/") {
+		return middleware.CORSPolicy{}, false
+	}
+	return a.AdminCORS, len(a.AdminCORS.AllowedOrigins) > 0
+}
+
+// splitList splits a comma separated list, dropping empty entries
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
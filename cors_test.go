@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/middleware"
+)
+
+func TestPreflightsFollowRoutePolicies(t *testing.T) {
+	savedCORS, savedAdmin := a.CORS, a.AdminCORS
+	a.CORS = corsPolicy("APP_CORS")
+	a.CORS.AllowedOrigins = []string{"https://*.shop.test"}
+	a.AdminCORS = a.CORS
+	a.AdminCORS.AllowedOrigins = []string{"https://admin.test"}
+	a.AdminCORS.AllowCredentials = true
+	defer func() { a.CORS, a.AdminCORS = savedCORS, savedAdmin }()
+
+	for _, c := range []struct {
+		path, origin, method string
+		status               int
+		methods              string
+		admin                bool
+	}{
+		{"/products", "https://www.shop.test", "GET", http.StatusNoContent, "GET", false},
+		{"/product/" + uuid.Must(uuid.NewV4(), nil).String(), "https://www.shop.test", "PUT", http.StatusNoContent, "GET, PUT, DELETE", false},
+		{"/graphql", "https://www.shop.test", "POST", http.StatusNoContent, "GET, POST", false},
+		{"/admin/tenants", "https://admin.test", "POST", http.StatusNoContent, "GET, POST", true},
+		{"/admin/tenants", "https://www.shop.test", "POST", http.StatusForbidden, "", true},
+		{"/admin/tenants", "https://admin.test", "POST", http.StatusNotFound, "", false},
+	} {
+		req, _ := http.NewRequest("OPTIONS", c.path, nil)
+		req.Header.Set("Origin", c.origin)
+		req.Header.Set("Access-Control-Request-Method", c.method)
+		req.Header.Set("Access-Control-Request-Headers", "Content-Type, Authorization")
+		execute := executeRequest
+		if c.admin {
+			execute = executeAdminRequest
+		}
+		response := execute(req)
+		if response.Code != c.status || response.Header().Get("Access-Control-Allow-Methods") != c.methods {
+			t.Errorf("%s from %s: Expected %d allowing %q. Got %d %v",
+				c.path, c.origin, c.status, c.methods, response.Code, response.Header())
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/admin/tenants", nil)
+	req.Header.Set("Origin", "https://admin.test")
+	response := executeAdminRequest(req)
+	if response.Header().Get("Access-Control-Allow-Origin") != "https://admin.test" ||
+		response.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("Expected the admin origin allowed with credentials. Got %v", response.Header())
+	}
+}
+
+func TestCORSIsOffWithoutOrigins(t *testing.T) {
+	saved := a.CORS
+	a.CORS = middleware.CORSPolicy{}
+	defer func() { a.CORS = saved }()
+
+	req, _ := http.NewRequest("OPTIONS", "/products", nil)
+	req.Header.Set("Origin", "https://www.shop.test")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	if response := executeRequest(req); response.Code != http.StatusForbidden ||
+		response.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected a bare %d. Got %d %v", http.StatusForbidden, response.Code, response.Header())
+	}
+}
+
+func TestPreflightsNeedNoTenant(t *testing.T) {
+	t.Setenv("APP_TENANT_REQUIRED", "true")
+	t.Setenv("APP_CORS_ORIGINS", "https://www.shop.test")
+	required := App{}
+	required.Initialize("sqlite3", ":memory:")
+	required.DB.SetMaxOpenConns(1)
+	defer required.DB.Close()
+
+	req, _ := http.NewRequest("OPTIONS", "/products", nil)
+	req.Header.Set("Origin", "https://www.shop.test")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	req.Header.Set("Access-Control-Request-Headers", "X-Tenant-ID")
+	response := httptest.NewRecorder()
+	required.Handler.ServeHTTP(response, req)
+	if response.Code != http.StatusNoContent || response.Header().Get("Access-Control-Allow-Methods") != "GET" ||
+		response.Header().Get("Access-Control-Allow-Headers") != "X-Tenant-ID" {
+		t.Errorf("Expected the preflight allowed. Got %d %v", response.Code, response.Header())
+	}
+
+	// The request itself must still name its tenant
+	req, _ = http.NewRequest("GET", "/products", nil)
+	req.Header.Set("Origin", "https://www.shop.test")
+	response = httptest.NewRecorder()
+	required.Handler.ServeHTTP(response, req)
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/rest"
+	"github.com/Lewiscowles1986/go-gorilla-api/settings"
+)
+
+// baseCurrency reads APP_BASE_CURRENCY, the currency products are priced in
+func baseCurrency() (string, error) {
+	return data.ParseCurrency(settings.Getenv("APP_BASE_CURRENCY", "USD"))
+}
+
+// loadExchangeRates replaces the exchange rates with those in a rates
+// file, as APP_EXCHANGE_RATES_FILE names at startup
+func (a *App) loadExchangeRates(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var rates data.ExchangeRates
+	if err := json.Unmarshal(b, &rates); err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	valid, err := data.ValidateExchangeRates(rates, a.BaseCurrency)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	return a.DB.WithTx(context.Background(), func(tx *repositories.Tx) error {
+		return repositories.SetExchangeRates(tx, valid)
+	})
+}
+
+// exchangeRatesResponse - The table of rates as the admin endpoint shows it
+type exchangeRatesResponse struct {
+	Base  string              `json:"base"`
+	Rates []data.ExchangeRate `json:"rates"`
+}
+
+func (a *App) getExchangeRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := repositories.GetExchangeRates(a.DB.WithContext(r.Context()))
+	if err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	rest.RespondWithJSON(w, http.StatusOK, exchangeRatesResponse{Base: a.BaseCurrency, Rates: rates})
+}
+
+// setExchangeRates - PUT /admin/exchange-rates, replacing the whole table
+func (a *App) setExchangeRates(w http.ResponseWriter, r *http.Request) {
+	var rates data.ExchangeRates
+	if !a.Body.DecodeJSON(w, r, &rates) {
+		return
+	}
+	valid, err := data.ValidateExchangeRates(rates, a.BaseCurrency)
+	if err != nil {
+		rest.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := a.DB.WithTx(r.Context(), func(tx *repositories.Tx) error {
+		return repositories.SetExchangeRates(tx, valid)
+	}); err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	rest.RespondWithJSON(w, http.StatusOK, exchangeRatesResponse{Base: a.BaseCurrency, Rates: valid})
+}
+
+// requestedCurrency - The currency ?currency= asks prices in, or "" for the
+// base currency, answering the client itself when it is not a currency
+func requestedCurrency(w http.ResponseWriter, r *http.Request) (string, bool) {
+	raw := r.URL.Query().Get("currency")
+	if raw == "" {
+		return "", true
+	}
+	code, err := data.ParseCurrency(raw)
+	if err != nil {
+		rest.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+	return code, true
+}
+
+// noExchangeRateError - A product had to be converted into a currency
+// there is no rate to
+type noExchangeRateError string
+
+func (e noExchangeRateError) Error() string {
+	return fmt.Sprintf("No exchange rate to %s", string(e))
+}
+
+// priceProducts restates the price of each product's entry in code: the
+// price set for it by hand there, or else its base price converted at the
+// current rate. Each says which it was, and the rate and its time.
+func (a *App) priceProducts(r *http.Request, code string, entries []rest.Entry, productIDs []string) error {
+	if code == "" {
+		return nil
+	}
+	overrides, err := repositories.GetCurrencyPrices(a.reader(r), tenantOf(r), productIDs...)
+	if err != nil {
+		return err
+	}
+	var rate *data.ExchangeRate
+	if code != a.BaseCurrency {
+		switch found, err := repositories.GetExchangeRate(a.reader(r), code); err {
+		case nil:
+			rate = &found
+		case sql.ErrNoRows:
+		default:
+			return err
+		}
+	}
+
+	for i, id := range productIDs {
+		var p data.PartialProduct
+		switch object := entries[i].Object.(type) {
+		case data.PartialProduct:
+			p = data.PartialProduct{ID: object.ID, Fields: maps.Clone(object.Fields)}
+		case data.Product:
+			if p, err = data.PartialOf(object); err != nil {
+				return err
+			}
+		default:
+			continue
+		}
+		base, ok := p.Fields["price"].(float64)
+		if !ok {
+			continue
+		}
+		p.Fields["currency"], p.Fields["base_currency"], p.Fields["base_price"] = code, a.BaseCurrency, base
+
+		switch override := overrideIn(overrides[id], code); {
+		case override != nil:
+			p.Fields["price"], p.Fields["price_source"] = override.Price, "override"
+		case code == a.BaseCurrency:
+			p.Fields["price_source"] = "base"
+		case rate != nil:
+			p.Fields["price"], p.Fields["price_source"] = data.ConvertPrice(base, rate.Rate, code), "exchange_rate"
+			p.Fields["exchange_rate"], p.Fields["exchange_rate_as_of"] = rate.Rate, rate.AsOf
+		default:
+			return noExchangeRateError(code)
+		}
+		entries[i].Object = p
+	}
+	return nil
+}
+
+func overrideIn(prices []data.CurrencyPrice, code string) *data.CurrencyPrice {
+	for _, p := range prices {
+		if p.Currency == code {
+			return &p
+		}
+	}
+	return nil
+}
+
+// respondWithPricingError answers a failure of priceProducts
+func respondWithPricingError(w http.ResponseWriter, err error) {
+	if _, ok := err.(noExchangeRateError); ok {
+		rest.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+}
+
+func (a *App) getCurrencyPrices(w http.ResponseWriter, r *http.Request) {
+	p, ok := a.loadProduct(w, r)
+	if !ok {
+		return
+	}
+	prices, err := repositories.GetCurrencyPrices(a.db(r), tenantOf(r), p.GetID())
+	if err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	count, page := getPagingFromRequest(r)
+	all := prices[p.GetID()]
+	start := min(uint64(len(all)), (page-1)*uint64(count))
+	end := min(uint64(len(all)), start+uint64(count))
+
+	entries := []rest.Entry{}
+	for _, c := range all[start:end] {
+		entries = append(entries, rest.CurrencyPriceToEntry(a.linker(r), c))
+	}
+	l := rest.ListingJSONResponse(a.linker(r).Href(rest.RouteProductCurrencyPrices, "id", p.GetID()), page,
+		uint64(len(all)), count, entries)
+	rest.RespondWithListing(w, r, http.StatusOK, l)
+}
+
+// routeCurrency - The currency the route names, answering the client itself
+// when it is not one
+func routeCurrency(w http.ResponseWriter, r *http.Request) (string, bool) {
+	code, err := data.ParseCurrency(mux.Vars(r)["currency"])
+	if err != nil {
+		rest.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+	return code, true
+}
+
+// setCurrencyPrice - PUT /product/{id}/currency-prices/{currency}, pricing
+// the product by hand in that currency, to its minor unit
+func (a *App) setCurrencyPrice(w http.ResponseWriter, r *http.Request) {
+	p, ok := a.loadProduct(w, r)
+	if !ok {
+		return
+	}
+	code, ok := routeCurrency(w, r)
+	if !ok {
+		return
+	}
+	var payload struct {
+		Price *float64 `json:"price"`
+	}
+	if !a.Body.DecodeJSON(w, r, &payload) {
+		return
+	}
+	if payload.Price == nil || data.ValidatePrice(*payload.Price) != nil {
+		rest.RespondWithError(w, http.StatusBadRequest, data.ErrProductPriceInvalid.Error())
+		return
+	}
+	c := data.CurrencyPrice{ProductID: p.GetID(), Currency: code, Price: data.RoundPrice(*payload.Price, code)}
+
+	if err := repositories.SetCurrencyPrice(a.db(r), tenantOf(r), c); err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	rest.RespondWithObject(w, r, http.StatusOK, rest.CurrencyPriceToEntry(a.linker(r), c))
+}
+
+func (a *App) deleteCurrencyPrice(w http.ResponseWriter, r *http.Request) {
+	code, ok := routeCurrency(w, r)
+	if !ok {
+		return
+	}
+	productID := data.ParseUUID(mux.Vars(r)["id"]).String()
+
+	switch err := repositories.DeleteCurrencyPrice(a.db(r), tenantOf(r), productID, code); err {
+	case nil:
+	case sql.ErrNoRows:
+		rest.RespondWithError(w, http.StatusNotFound, fmt.Sprintf("No %s price set", code))
+		return
+	default:
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	rest.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/tenants"
+)
+
+const testRates = `{"base":"USD","as_of":"2026-10-19T12:00:00Z","rates":{"EUR":0.92,"JPY":150.456,"USD":1}}`
+
+func setRates(t *testing.T, body string) {
+	t.Helper()
+	a.AdminToken = testAdminToken
+	t.Cleanup(func() { a.AdminToken = "" })
+	response := executeAdminRequest(adminRequest("PUT", "/admin/exchange-rates", body))
+	checkResponseCode(t, http.StatusOK, response.Code)
+}
+
+func pricedProduct(t *testing.T, path string) map[string]interface{} {
+	t.Helper()
+	req, _ := http.NewRequest("GET", path, nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	return m
+}
+
+func TestProductPricedInRequestedCurrency(t *testing.T) {
+	clearTable()
+	setRates(t, testRates)
+	p := data.CreateProduct("Jumper", 19.99)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+	path := "/product/" + p.GetID()
+
+	m := pricedProduct(t, path+"?currency=eur")
+	if m["price"] != 18.39 || m["currency"] != "EUR" || m["base_price"] != 19.99 || m["base_currency"] != "USD" ||
+		m["price_source"] != "exchange_rate" || m["exchange_rate"] != 0.92 ||
+		m["exchange_rate_as_of"] != "2026-10-19T12:00:00Z" || m["name"] != "Jumper" {
+		t.Errorf("Unexpected EUR product %v", m)
+	}
+	if m := pricedProduct(t, path+"?currency=JPY"); m["price"] != 3008.0 {
+		t.Errorf("Expected whole yen. Got %v", m)
+	}
+	if m := pricedProduct(t, path+"?currency=USD"); m["price"] != 19.99 || m["price_source"] != "base" {
+		t.Errorf("Expected the base price. Got %v", m)
+	}
+	if m := pricedProduct(t, path); m["currency"] != nil || m["price"] != 19.99 {
+		t.Errorf("Expected the product as it was. Got %v", m)
+	}
+
+	translate(t, p.GetID(), "fr", `{"name":"Pull","description":"Un pull"}`)
+	if m := pricedProduct(t, path+"?locale=fr&currency=EUR"); m["name"] != "Pull" || m["description"] != "Un pull" ||
+		m["price"] != 18.39 {
+		t.Errorf("Expected the translation priced in EUR. Got %v", m)
+	}
+
+	for _, query := range []string{"?currency=EURO", "?currency=GBP"} {
+		req, _ := http.NewRequest("GET", path+query, nil)
+		checkResponseCode(t, http.StatusBadRequest, executeRequest(req).Code)
+	}
+}
+
+func TestCurrencyPriceOverridesConversion(t *testing.T) {
+	clearTable()
+	setRates(t, testRates)
+	p := data.CreateProduct("Jumper", 19.99)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+	base := "/product/" + p.GetID() + "/currency-prices"
+
+	for _, currency := range []string{"eur", "GBP"} {
+		req, _ := http.NewRequest("PUT", base+"/"+currency, bytes.NewBufferString(`{"price":17.499}`))
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		var c data.CurrencyPrice
+		json.Unmarshal(response.Body.Bytes(), &c)
+		if c.Price != 17.5 {
+			t.Errorf("Expected the price in whole cents or pence. Got %+v", c)
+		}
+	}
+	m := pricedProduct(t, "/product/"+p.GetID()+"?currency=EUR")
+	if m["price"] != 17.5 || m["price_source"] != "override" || m["exchange_rate"] != nil {
+		t.Errorf("Expected the override. Got %v", m)
+	}
+	if m := pricedProduct(t, "/product/"+p.GetID()+"?currency=GBP"); m["price"] != 17.5 {
+		t.Errorf("Expected an override to need no rate. Got %v", m)
+	}
+
+	req, _ := http.NewRequest("GET", base, nil)
+	var l struct{ Total int }
+	json.Unmarshal(executeRequest(req).Body.Bytes(), &l)
+	if l.Total != 2 {
+		t.Errorf("Expected two overrides. Got %d", l.Total)
+	}
+
+	req, _ = http.NewRequest("DELETE", base+"/EUR", nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	req, _ = http.NewRequest("DELETE", base+"/EUR", nil)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+	if m := pricedProduct(t, "/product/"+p.GetID()+"?currency=EUR"); m["price"] != 18.39 {
+		t.Errorf("Expected conversion again. Got %v", m)
+	}
+
+	for _, body := range []string{`{}`, `{"price":-1}`} {
+		req, _ := http.NewRequest("PUT", base+"/EUR", bytes.NewBufferString(body))
+		checkResponseCode(t, http.StatusBadRequest, executeRequest(req).Code)
+	}
+	req, _ = http.NewRequest("PUT", base+"/XYZ", bytes.NewBufferString(`{"price":1}`))
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req).Code)
+}
+
+func TestProductListingInCurrency(t *testing.T) {
+	clearTable()
+	setRates(t, testRates)
+	repositories.CreateProduct(a.DB, tenants.Default, data.CreateProduct("Jumper", 19.99))
+
+	for _, query := range []string{"?currency=EUR", "?currency=EUR&fields=name,price"} {
+		req, _ := http.NewRequest("GET", "/products"+query, nil)
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		var l struct {
+			Data []struct {
+				Object map[string]interface{}
+			}
+			Links []struct{ Href, Rel string }
+		}
+		json.Unmarshal(response.Body.Bytes(), &l)
+		if len(l.Data) != 1 || l.Data[0].Object["price"] != 18.39 || l.Data[0].Object["exchange_rate"] != 0.92 {
+			t.Errorf("%s: expected the converted price. Got %+v", query, l.Data)
+		}
+		if !bytes.Contains([]byte(l.Links[0].Href), []byte("currency=EUR")) {
+			t.Errorf("%s: expected paging links to keep the currency. Got %v", query, l.Links[0])
+		}
+	}
+	req, _ := http.NewRequest("GET", "/products?currency=EUR&fields=name", nil)
+	response := executeRequest(req)
+	if bytes.Contains(response.Body.Bytes(), []byte("exchange_rate")) {
+		t.Errorf("Expected nothing priced without a price. Got %s", response.Body)
+	}
+}
+
+func TestExchangeRates(t *testing.T) {
+	clearTable()
+	setRates(t, testRates)
+
+	response := executeAdminRequest(adminRequest("GET", "/admin/exchange-rates", ""))
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var table exchangeRatesResponse
+	json.Unmarshal(response.Body.Bytes(), &table)
+	if table.Base != "USD" || len(table.Rates) != 2 || table.Rates[0].Currency != "EUR" {
+		t.Errorf("Expected EUR and JPY from USD. Got %+v", table)
+	}
+
+	for _, body := range []string{
+		`{"base":"GBP","as_of":"2026-10-19T12:00:00Z","rates":{"EUR":1.15}}`,
+		`{"rates":{"EUR":0.92}}`,
+		`{"as_of":"2026-10-19T12:00:00Z","rates":{"EUR":-0.92}}`,
+	} {
+		response := executeAdminRequest(adminRequest("PUT", "/admin/exchange-rates", body))
+		checkResponseCode(t, http.StatusBadRequest, response.Code)
+	}
+
+	path := filepath.Join(t.TempDir(), "rates.json")
+	os.WriteFile(path, []byte(`{"base":"USD","as_of":"2026-10-20T08:00:00Z","rates":{"GBP":0.79}}`), 0o600)
+	if err := a.loadExchangeRates(path); err != nil {
+		t.Fatal(err)
+	}
+	rates, _ := repositories.GetExchangeRates(a.DB)
+	if len(rates) != 1 || rates[0].Currency != "GBP" || rates[0].Rate != 0.79 {
+		t.Errorf("Expected the file to replace the table. Got %v", rates)
+	}
+	os.WriteFile(path, []byte(`{"base":"EUR","as_of":"2026-10-20T08:00:00Z","rates":{"GBP":0.86}}`), 0o600)
+	if err := a.loadExchangeRates(path); err == nil {
+		t.Error("Expected rates from another base refused")
+	}
+}
@@ -0,0 +1,82 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/satori/go.uuid"
+)
+
+type category struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	ParentID *string `json:"parent_id"`
+}
+
+// Category - A named group of products; categories nest through ParentID
+type Category interface {
+	GetID() string
+	GetName() string
+	GetParentID() *string
+	ChangeName(newName string)
+	SetParentID(parentID *string)
+}
+
+func (c *category) GetID() string {
+	if len(c.ID) != 36 {
+		c.ID = uuid.Must(uuid.NewV4(), nil).String()
+	}
+	return c.ID
+}
+
+func (c *category) GetName() string {
+	return c.Name
+}
+
+func (c *category) GetParentID() *string {
+	return c.ParentID
+}
+
+func (c *category) ChangeName(newName string) {
+	c.Name = newName
+}
+
+func (c *category) SetParentID(parentID *string) {
+	c.ParentID = parentID
+}
+
+func CreateCategory(name string, parentID *string) Category {
+	c := &category{}
+	c.ID = uuid.Must(uuid.NewV4(), nil).String()
+	c.Name = name
+	c.ParentID = parentID
+	return c
+}
+
+func ParseCategoryDataJSON(data []byte) (Category, error) {
+	c := &category{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func ParseCategoryListData(rs *sql.Rows) ([]Category, error) {
+	categories := []Category{}
+
+	for rs.Next() {
+		c := &category{}
+		if err := rs.Scan(&c.ID, &c.Name, &c.ParentID); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+
+	return categories, rs.Err()
+}
+
+func ParseCategoryData(r *sql.Row) (Category, error) {
+	c := &category{}
+	err := r.Scan(&c.ID, &c.Name, &c.ParentID)
+	return c, err
+}
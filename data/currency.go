@@ -0,0 +1,80 @@
+package data
+
+import (
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"time"
+
+	"golang.org/x/text/currency"
+)
+
+// ExchangeRate - How many units of Currency one unit of the base currency
+// bought at AsOf
+type ExchangeRate struct {
+	Currency string    `json:"currency"`
+	Rate     float64   `json:"rate"`
+	AsOf     time.Time `json:"as_of"`
+}
+
+// ExchangeRates - A table of rates from one base currency, all as of one
+// time, as kept in a rates file or sent to the admin endpoint
+type ExchangeRates struct {
+	Base  string             `json:"base"`
+	AsOf  time.Time          `json:"as_of"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// CurrencyPrice - A price set by hand for a product in one currency, taking
+// the place of its converted price
+type CurrencyPrice struct {
+	ProductID string  `json:"product_id"`
+	Currency  string  `json:"currency"`
+	Price     float64 `json:"price"`
+}
+
+// ParseCurrency - The ISO 4217 code for raw, in upper case
+func ParseCurrency(raw string) (string, error) {
+	unit, err := currency.ParseISO(raw)
+	if err != nil {
+		return "", ErrCurrencyInvalid
+	}
+	return unit.String(), nil
+}
+
+// decimal is f exactly as it reads, rather than as the nearest binary
+// fraction, so 0.1 is a tenth
+func decimal(f float64) *big.Rat {
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(f, 'f', -1, 64))
+	return r
+}
+
+// roundTo rounds r to the minor unit of code, halves away from zero
+func roundTo(r *big.Rat, code string) float64 {
+	scale, _ := currency.Standard.Rounding(currency.MustParseISO(code))
+	f, _ := strconv.ParseFloat(r.FloatString(scale), 64)
+	return f
+}
+
+// RoundPrice - price in whole minor units of code: cents for EUR, yen for
+// JPY, fils for KWD
+func RoundPrice(price float64, code string) float64 {
+	return roundTo(decimal(price), code)
+}
+
+// ConvertPrice - price in the base currency times rate, worked out in
+// decimal and only then rounded to the minor unit of code
+func ConvertPrice(price, rate float64, code string) float64 {
+	return roundTo(new(big.Rat).Mul(decimal(price), decimal(rate)), code)
+}
+
+// PartialOf - Every field of p, for representations that add fields of
+// their own
+func PartialOf(p Product) (PartialProduct, error) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return PartialProduct{}, err
+	}
+	fields := map[string]interface{}{}
+	return PartialProduct{ID: p.GetID(), Fields: fields}, json.Unmarshal(b, &fields)
+}
@@ -0,0 +1,64 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConvertPriceRoundsToMinorUnits(t *testing.T) {
+	for _, c := range []struct {
+		price, rate float64
+		code        string
+		expected    float64
+	}{
+		{19.99, 0.92, "EUR", 18.39},
+		{1.005, 1, "EUR", 1.01},
+		{19.99, 150.456, "JPY", 3008},
+		{0.5, 1, "JPY", 1},
+		{19.99, 0.3071, "KWD", 6.139},
+		{0, 0.92, "EUR", 0},
+	} {
+		if price := ConvertPrice(c.price, c.rate, c.code); price != c.expected {
+			t.Errorf("%v at %v in %s: expected %v. Got %v", c.price, c.rate, c.code, c.expected, price)
+		}
+	}
+	if price := RoundPrice(12.345, "GBP"); price != 12.35 {
+		t.Errorf("Expected 12.35. Got %v", price)
+	}
+}
+
+func TestParseCurrency(t *testing.T) {
+	if code, err := ParseCurrency("eur"); code != "EUR" || err != nil {
+		t.Errorf("Expected EUR. Got %q %v", code, err)
+	}
+	for _, raw := range []string{"", "EURO", "ABC"} {
+		if _, err := ParseCurrency(raw); err != ErrCurrencyInvalid {
+			t.Errorf("%q: expected %v. Got %v", raw, ErrCurrencyInvalid, err)
+		}
+	}
+}
+
+func TestValidateExchangeRates(t *testing.T) {
+	asOf := time.Date(2026, 10, 19, 16, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	rates, err := ValidateExchangeRates(ExchangeRates{Base: "usd", AsOf: asOf,
+		Rates: map[string]float64{"jpy": 150.4, "EUR": 0.92, "USD": 1}}, "USD")
+	if err != nil || len(rates) != 2 || rates[0] != (ExchangeRate{"EUR", 0.92, asOf.UTC()}) || rates[1].Currency != "JPY" {
+		t.Errorf("Expected EUR and JPY in order. Got %v %v", rates, err)
+	}
+
+	for _, c := range []struct {
+		rates ExchangeRates
+		err   error
+	}{
+		{ExchangeRates{Base: "GBP", AsOf: asOf}, ErrExchangeRateBase},
+		{ExchangeRates{Rates: map[string]float64{"EUR": 0.92}}, ErrExchangeRateTimeless},
+		{ExchangeRates{AsOf: asOf, Rates: map[string]float64{"EURO": 0.92}}, ErrCurrencyInvalid},
+		{ExchangeRates{AsOf: asOf, Rates: map[string]float64{"EUR": 0}}, ErrExchangeRateInvalid},
+		{ExchangeRates{AsOf: asOf, Rates: map[string]float64{"EUR": 1e10}}, ErrExchangeRateInvalid},
+		{ExchangeRates{AsOf: asOf, Rates: map[string]float64{"EUR": 0.92, "eur": 0.93}}, ErrExchangeRateTwice},
+	} {
+		if _, err := ValidateExchangeRates(c.rates, "USD"); err != c.err {
+			t.Errorf("%+v: expected %v. Got %v", c.rates, c.err, err)
+		}
+	}
+}
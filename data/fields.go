@@ -0,0 +1,63 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ProductFields - The fields a product read can be narrowed to, in the
+// order a full product lists them
+var ProductFields = []string{"id", "name", "price"}
+
+// UnknownFieldError - A requested field the resource does not have
+type UnknownFieldError struct {
+	Field   string
+	Allowed []string
+}
+
+func (e UnknownFieldError) Error() string {
+	return fmt.Sprintf("Unknown field '%s', expected one of %s",
+		e.Field, strings.Join(e.Allowed, ", "))
+}
+
+// ParseFields - The distinct fields named in a comma separated list, each
+// of which must be allowed. An empty list means every field.
+func ParseFields(raw string, allowed []string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	known := map[string]bool{}
+	for _, f := range allowed {
+		known[f] = true
+	}
+	fields := []string{}
+	seen := map[string]bool{}
+	for _, f := range strings.Split(raw, ",") {
+		f = strings.TrimSpace(f)
+		if !known[f] {
+			return nil, UnknownFieldError{Field: f, Allowed: allowed}
+		}
+		if !seen[f] {
+			seen[f] = true
+			fields = append(fields, f)
+		}
+	}
+	return fields, nil
+}
+
+// PartialProduct - The fields of a product a client asked for. ID is
+// always loaded, so the product can still be linked to, but is only
+// written out when asked for.
+type PartialProduct struct {
+	ID     string
+	Fields map[string]interface{}
+}
+
+func (p PartialProduct) GetID() string {
+	return p.ID
+}
+
+func (p PartialProduct) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.Fields)
+}
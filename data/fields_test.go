@@ -0,0 +1,32 @@
+package data
+
+import (
+	"testing"
+)
+
+func TestParseFields(t *testing.T) {
+	fields, err := ParseFields(" name,id,name ", ProductFields)
+	if err != nil || len(fields) != 2 || fields[0] != "name" || fields[1] != "id" {
+		t.Errorf("Expected name and id once each. Got %v, %v", fields, err)
+	}
+
+	if fields, err := ParseFields("", ProductFields); fields != nil || err != nil {
+		t.Errorf("Expected every field. Got %v, %v", fields, err)
+	}
+
+	_, err = ParseFields("id,cost", ProductFields)
+	if e, ok := err.(UnknownFieldError); !ok || e.Field != "cost" || len(e.Allowed) != 3 {
+		t.Errorf("Expected cost to be unknown. Got %v", err)
+	}
+	if _, err := ParseFields("id,", ProductFields); err == nil {
+		t.Error("Expected an empty field name to be rejected")
+	}
+}
+
+func TestPartialProductJSON(t *testing.T) {
+	p := PartialProduct{ID: "x", Fields: map[string]interface{}{"name": "tea"}}
+	encoded, _ := JSONMarshal(p)
+	if string(encoded) != "{\"name\":\"tea\"}\n" {
+		t.Errorf("Expected only the asked for fields. Got %s", encoded)
+	}
+}
@@ -0,0 +1,19 @@
+package data
+
+import (
+	"time"
+)
+
+// Image - A picture of a product. Its bytes, and a thumbnail made from
+// them, are kept in blob storage; Checksum is the SHA-256 of the original.
+type Image struct {
+	ID                   string    `json:"id"`
+	ProductID            string    `json:"product_id"`
+	ContentType          string    `json:"content_type"`
+	Size                 int64     `json:"size"`
+	Width                int       `json:"width"`
+	Height               int       `json:"height"`
+	Checksum             string    `json:"checksum"`
+	ThumbnailContentType string    `json:"thumbnail_content_type"`
+	CreatedAt            time.Time `json:"created_at"`
+}
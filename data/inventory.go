@@ -0,0 +1,48 @@
+package data
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Inventory - Stock held for a product. Reserved units are still on hand
+// but promised to a pending reservation.
+type Inventory struct {
+	ProductID string `json:"product_id"`
+	OnHand    int64  `json:"on_hand"`
+	Reserved  int64  `json:"reserved"`
+}
+
+func (i Inventory) Available() int64 {
+	return i.OnHand - i.Reserved
+}
+
+func (i Inventory) MarshalJSON() ([]byte, error) {
+	type inventory Inventory
+	return json.Marshal(struct {
+		inventory
+		Available int64 `json:"available"`
+	}{inventory(i), i.Available()})
+}
+
+// ReservationStatus - Where a reservation is in its lifecycle; only pending
+// reservations hold stock
+type ReservationStatus string
+
+const (
+	ReservationPending   ReservationStatus = "pending"
+	ReservationCommitted ReservationStatus = "committed"
+	ReservationReleased  ReservationStatus = "released"
+	ReservationExpired   ReservationStatus = "expired"
+)
+
+// Reservation - Units of a product held for a buyer until committed,
+// released or expired
+type Reservation struct {
+	ID        string            `json:"id"`
+	ProductID string            `json:"product_id"`
+	Quantity  int64             `json:"quantity"`
+	Status    ReservationStatus `json:"status"`
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
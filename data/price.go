@@ -0,0 +1,17 @@
+package data
+
+import (
+	"time"
+)
+
+// PriceChange - A product's price from EffectiveAt until the next change.
+// AppliedAt is when the change was written to the product itself, and is
+// nil while a scheduled change is still waiting.
+type PriceChange struct {
+	ID          string     `json:"id"`
+	ProductID   string     `json:"product_id"`
+	Price       float64    `json:"price"`
+	EffectiveAt time.Time  `json:"effective_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	AppliedAt   *time.Time `json:"applied_at"`
+}
@@ -53,6 +53,10 @@ func CreateProduct(name string, price float64) Product {
 	return p
 }
 
+func NewProduct(id, name string, price float64) Product {
+	return &product{ID: id, Name: name, Price: price}
+}
+
 func ParseProductDataJSON(data []byte) (Product, error) {
 	product := &product{}
 	if err := json.Unmarshal(data, product); err != nil {
@@ -0,0 +1,23 @@
+package data
+
+import (
+	"encoding/json"
+)
+
+// SearchResult - A product matched by a full-text search, with the matched
+// terms of its name wrapped in <mark> tags
+type SearchResult struct {
+	Product Product
+	Snippet string
+	Rank    float64
+}
+
+func (r SearchResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID      string  `json:"id"`
+		Name    string  `json:"name"`
+		Price   float64 `json:"price"`
+		Snippet string  `json:"snippet"`
+		Rank    float64 `json:"rank"`
+	}{r.Product.GetID(), r.Product.GetName(), r.Product.GetPrice(), r.Snippet, r.Rank})
+}
@@ -0,0 +1,14 @@
+package data
+
+import (
+	"time"
+)
+
+// Tenant - A storefront; every product and category belongs to exactly one
+type Tenant struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	// Key is only filled in as a key is issued; just its hash is stored
+	Key string `json:"key,omitempty"`
+}
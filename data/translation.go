@@ -0,0 +1,35 @@
+package data
+
+import (
+	"encoding/json"
+)
+
+// Translation - A product's name and description in one locale, a BCP 47
+// tag such as "fr" or "en-GB"
+type Translation struct {
+	ProductID   string `json:"product_id"`
+	Locale      string `json:"locale"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// LocalizedProduct - A product as read in one of its translations, whose
+// name stands in for the product's own
+type LocalizedProduct struct {
+	Product
+	Description string
+}
+
+// Localize - p in t's words
+func Localize(p Product, t Translation) LocalizedProduct {
+	return LocalizedProduct{Product: NewProduct(p.GetID(), t.Name, p.GetPrice()), Description: t.Description}
+}
+
+func (p LocalizedProduct) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID          string  `json:"id"`
+		Name        string  `json:"name"`
+		Price       float64 `json:"price"`
+		Description string  `json:"description"`
+	}{p.GetID(), p.GetName(), p.GetPrice(), p.Description})
+}
@@ -0,0 +1,126 @@
+package data
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// maxPrice is the largest value the products.price NUMERIC(10,2) column holds
+const maxPrice = 99999999.99
+
+var (
+	ErrProductNameRequired = errors.New("Product name must not be empty")
+	ErrProductPriceInvalid = errors.New("Product price must be between 0 and 99999999.99")
+
+	ErrCategoryNameRequired  = errors.New("Category name must not be empty")
+	ErrCategoryParentInvalid = errors.New("Category parent must be a category id")
+
+	ErrVariantSKUInvalid    = errors.New("SKU must be 1 to 64 letters, digits, '.', '_' or '-', starting with a letter or digit")
+	ErrVariantOptionInvalid = errors.New("Variant options must have non-empty names and values")
+
+	ErrTranslationNameRequired = errors.New("Translated name must not be empty")
+
+	ErrCurrencyInvalid      = errors.New("Currency must be an ISO 4217 code such as EUR")
+	ErrExchangeRateInvalid  = errors.New("Exchange rates must be greater than 0 and less than 10000000000")
+	ErrExchangeRateBase     = errors.New("Exchange rates are from a different base currency")
+	ErrExchangeRateTimeless = errors.New("Exchange rates must have an as_of time")
+	ErrExchangeRateTwice    = errors.New("Exchange rates name a currency twice")
+)
+
+// skuPattern - What a SKU may be: short, and safe in a URL path
+var skuPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// ValidateProduct - Rules shared by every API that writes products
+func ValidateProduct(p Product) error {
+	if strings.TrimSpace(p.GetName()) == "" {
+		return ErrProductNameRequired
+	}
+	return ValidatePrice(p.GetPrice())
+}
+
+// ValidatePrice - The range the products.price column can hold
+func ValidatePrice(price float64) error {
+	if math.IsNaN(price) || price < 0 || price > maxPrice {
+		return ErrProductPriceInvalid
+	}
+	return nil
+}
+
+// ValidateCategory - Checks a category's own fields; whether its parent
+// exists is left to the repository
+func ValidateCategory(c Category) error {
+	if strings.TrimSpace(c.GetName()) == "" {
+		return ErrCategoryNameRequired
+	}
+	if parent := c.GetParentID(); parent != nil && ParseUUID(*parent) == uuid.Nil {
+		return ErrCategoryParentInvalid
+	}
+	return nil
+}
+
+// ValidateVariant - Checks a variant's SKU, options and any price of its
+// own; whether its SKU is free is left to the repository
+func ValidateVariant(v Variant) error {
+	if !skuPattern.MatchString(v.SKU) {
+		return ErrVariantSKUInvalid
+	}
+	for name, value := range v.Options {
+		if strings.TrimSpace(name) == "" || strings.TrimSpace(value) == "" {
+			return ErrVariantOptionInvalid
+		}
+	}
+	if v.PriceOverride != nil {
+		return ValidatePrice(*v.PriceOverride)
+	}
+	return nil
+}
+
+// ValidateTranslation - A translation needs a name; its locale is checked
+// where it is parsed
+func ValidateTranslation(t Translation) error {
+	if strings.TrimSpace(t.Name) == "" {
+		return ErrTranslationNameRequired
+	}
+	return nil
+}
+
+// maxRate is the largest value the exchange_rates.rate NUMERIC(18,8)
+// column holds
+const maxRate = 1e10
+
+// ValidateExchangeRates - Checks a table of rates is from base and may be
+// stored, returning its rates in code order. A rate for the base itself
+// is left out.
+func ValidateExchangeRates(rates ExchangeRates, base string) ([]ExchangeRate, error) {
+	if rates.Base != "" {
+		if code, err := ParseCurrency(rates.Base); err != nil || code != base {
+			return nil, ErrExchangeRateBase
+		}
+	}
+	if rates.AsOf.IsZero() {
+		return nil, ErrExchangeRateTimeless
+	}
+	valid := []ExchangeRate{}
+	for raw, rate := range rates.Rates {
+		code, err := ParseCurrency(raw)
+		if err != nil {
+			return nil, err
+		}
+		if math.IsNaN(rate) || rate <= 0 || rate >= maxRate {
+			return nil, ErrExchangeRateInvalid
+		}
+		if slices.ContainsFunc(valid, func(r ExchangeRate) bool { return r.Currency == code }) {
+			return nil, ErrExchangeRateTwice
+		}
+		if code != base {
+			valid = append(valid, ExchangeRate{Currency: code, Rate: rate, AsOf: rates.AsOf.UTC()})
+		}
+	}
+	slices.SortFunc(valid, func(a, b ExchangeRate) int { return strings.Compare(a.Currency, b.Currency) })
+	return valid, nil
+}
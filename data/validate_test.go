@@ -0,0 +1,68 @@
+package data
+
+import (
+	"math"
+	"testing"
+)
+
+func TestValidProduct(t *testing.T) {
+	if err := ValidateProduct(CreateProduct("test", 9.99)); err != nil {
+		t.Errorf("Expected no error. Got %v", err)
+	}
+}
+
+func TestProductNameRequired(t *testing.T) {
+	if err := ValidateProduct(CreateProduct("   ", 9.99)); err != ErrProductNameRequired {
+		t.Errorf("Expected %v. Got %v", ErrProductNameRequired, err)
+	}
+}
+
+func TestProductPriceBounds(t *testing.T) {
+	for _, price := range []float64{-0.01, 100000000, math.NaN(), math.Inf(1)} {
+		if err := ValidateProduct(CreateProduct("test", price)); err != ErrProductPriceInvalid {
+			t.Errorf("Expected %v for %v. Got %v", ErrProductPriceInvalid, price, err)
+		}
+	}
+}
+
+func TestValidCategory(t *testing.T) {
+	parent := CreateCategory("drinks", nil).GetID()
+	if err := ValidateCategory(CreateCategory("tea", &parent)); err != nil {
+		t.Errorf("Expected no error. Got %v", err)
+	}
+}
+
+func TestCategoryNameRequired(t *testing.T) {
+	if err := ValidateCategory(CreateCategory(" ", nil)); err != ErrCategoryNameRequired {
+		t.Errorf("Expected %v. Got %v", ErrCategoryNameRequired, err)
+	}
+}
+
+func TestCategoryParentMustBeUUID(t *testing.T) {
+	parent := "drinks"
+	if err := ValidateCategory(CreateCategory("tea", &parent)); err != ErrCategoryParentInvalid {
+		t.Errorf("Expected %v. Got %v", ErrCategoryParentInvalid, err)
+	}
+}
+
+func TestValidateVariant(t *testing.T) {
+	negative := -1.0
+	cases := []struct {
+		v   Variant
+		err error
+	}{
+		{Variant{SKU: "TEE-M.red_1", Options: map[string]string{"size": "M"}}, nil},
+		{Variant{SKU: ""}, ErrVariantSKUInvalid},
+		{Variant{SKU: "-TEE"}, ErrVariantSKUInvalid},
+		{Variant{SKU: "TEE/M"}, ErrVariantSKUInvalid},
+		{Variant{SKU: string(make([]byte, 65))}, ErrVariantSKUInvalid},
+		{Variant{SKU: "TEE", Options: map[string]string{" ": "M"}}, ErrVariantOptionInvalid},
+		{Variant{SKU: "TEE", Options: map[string]string{"size": ""}}, ErrVariantOptionInvalid},
+		{Variant{SKU: "TEE", PriceOverride: &negative}, ErrProductPriceInvalid},
+	}
+	for _, c := range cases {
+		if err := ValidateVariant(c.v); err != c.err {
+			t.Errorf("%+v: expected %v. Got %v", c.v, c.err, err)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package data
+
+import (
+	"time"
+)
+
+// Variant - One purchasable form of a product, such as its size M in red.
+// PriceOverride is nil when the variant sells at its product's price, and
+// Price is what it sells at either way.
+type Variant struct {
+	ID            string            `json:"id"`
+	ProductID     string            `json:"product_id"`
+	SKU           string            `json:"sku"`
+	Options       map[string]string `json:"options"`
+	PriceOverride *float64          `json:"price_override"`
+	Price         float64           `json:"price"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
@@ -0,0 +1,73 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+type Type string
+
+const (
+	ProductCreated Type = "product.created"
+	ProductUpdated Type = "product.updated"
+	ProductDeleted Type = "product.deleted"
+)
+
+// Event - A change to a tenant's product, as seen after it was committed.
+// ID is the change's place in the outbox, and zero for events published
+// straight to a Broker.
+type Event struct {
+	ID         int64        `json:"id,omitempty"`
+	Type       Type         `json:"type"`
+	TenantID   string       `json:"tenant_id"`
+	Product    data.Product `json:"product"`
+	OccurredAt time.Time    `json:"occurred_at"`
+}
+
+// Broker - Fans product changes out to in-process subscribers
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: map[chan Event]struct{}{}}
+}
+
+// Publish - Delivers without blocking; a subscriber whose buffer is full is
+// disconnected rather than silently missing events
+func (b *Broker) Publish(tenantID string, eventType Type, p data.Product) {
+	e := Event{Type: eventType, TenantID: tenantID, Product: p, OccurredAt: time.Now().UTC()}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe - Returns a channel of future events and a func to stop them.
+// The channel is closed when cancelled or when the subscriber falls behind.
+func (b *Broker) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
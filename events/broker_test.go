@@ -0,0 +1,46 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+func TestSubscriberReceivesEvents(t *testing.T) {
+	b := NewBroker()
+	ch, cancel := b.Subscribe(1)
+	defer cancel()
+
+	p := data.CreateProduct("test", 9.99)
+	b.Publish("default", ProductCreated, p)
+
+	e := <-ch
+	if e.Type != ProductCreated || e.TenantID != "default" || e.Product.GetID() != p.GetID() {
+		t.Errorf("Unexpected event %+v", e)
+	}
+}
+
+func TestCancelClosesChannel(t *testing.T) {
+	b := NewBroker()
+	ch, cancel := b.Subscribe(1)
+	cancel()
+	cancel()
+
+	if _, ok := <-ch; ok {
+		t.Errorf("Expected channel to be closed")
+	}
+}
+
+func TestSlowSubscriberIsDisconnected(t *testing.T) {
+	b := NewBroker()
+	ch, cancel := b.Subscribe(1)
+	defer cancel()
+
+	b.Publish("default", ProductCreated, data.CreateProduct("one", 1))
+	b.Publish("default", ProductCreated, data.CreateProduct("two", 2))
+
+	<-ch
+	if _, ok := <-ch; ok {
+		t.Errorf("Expected slow subscriber's channel to be closed")
+	}
+}
@@ -0,0 +1,81 @@
+package graph
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/rest"
+)
+
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Handler - Serves GraphQL queries over GET and queries or mutations over
+// POST, whose bodies body reads
+func Handler(schema graphql.Schema, limits Limits, body rest.Decoder) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{}
+		if r.Method != http.MethodGet {
+			if !body.DecodeJSON(w, r, &req) {
+				return
+			}
+		} else if err := parseQuery(r, &req); err != nil {
+			rest.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		if req.Query == "" {
+			rest.RespondWithError(w, http.StatusBadRequest, "Missing query")
+			return
+		}
+
+		doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+		if err != nil {
+			respondWithErrors(w, http.StatusBadRequest, gqlerrors.FormatErrors(err))
+			return
+		}
+
+		op, _ := splitDocument(doc, req.OperationName)
+		if r.Method == http.MethodGet && op != nil && op.Operation != "query" {
+			w.Header().Set("Allow", "POST")
+			rest.RespondWithError(w, http.StatusMethodNotAllowed,
+				"Mutations must be sent using POST")
+			return
+		}
+
+		if err := limits.Check(doc, req.OperationName, req.Variables); err != nil {
+			respondWithErrors(w, http.StatusBadRequest, gqlerrors.FormatErrors(err))
+			return
+		}
+
+		result := graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  req.Query,
+			VariableValues: req.Variables,
+			OperationName:  req.OperationName,
+			Context:        r.Context(),
+		})
+		rest.RespondWithJSON(w, http.StatusOK, result)
+	})
+}
+
+// parseQuery reads a query sent over GET, in the URL
+func parseQuery(r *http.Request, req *request) error {
+	q := r.URL.Query()
+	req.Query = q.Get("query")
+	req.OperationName = q.Get("operationName")
+	if vars := q.Get("variables"); vars != "" {
+		return json.Unmarshal([]byte(vars), &req.Variables)
+	}
+	return nil
+}
+
+func respondWithErrors(w http.ResponseWriter, code int, errs []gqlerrors.FormattedError) {
+	rest.RespondWithJSON(w, code, &graphql.Result{Errors: errs})
+}
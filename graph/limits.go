@@ -0,0 +1,123 @@
+package graph
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Limits - Guards against expensive queries before they are executed
+type Limits struct {
+	MaxDepth      int
+	MaxComplexity int
+}
+
+// DefaultLimits - Enough for any view the frontend composes today
+func DefaultLimits() Limits {
+	return Limits{MaxDepth: 8, MaxComplexity: 1000}
+}
+
+// Check - Reports the first limit the selected operation exceeds
+func (l Limits) Check(doc *ast.Document, operationName string, variables map[string]interface{}) error {
+	op, fragments := splitDocument(doc, operationName)
+	if op == nil {
+		return nil
+	}
+
+	a := &analyzer{fragments: fragments, variables: variables}
+	depth, complexity := a.selectionSet(op.SelectionSet, map[string]bool{})
+
+	if l.MaxDepth > 0 && depth > l.MaxDepth {
+		return fmt.Errorf("query depth %d exceeds the maximum of %d", depth, l.MaxDepth)
+	}
+	if l.MaxComplexity > 0 && complexity > l.MaxComplexity {
+		return fmt.Errorf("query complexity %d exceeds the maximum of %d", complexity, l.MaxComplexity)
+	}
+	return nil
+}
+
+func splitDocument(doc *ast.Document, operationName string) (*ast.OperationDefinition, map[string]*ast.FragmentDefinition) {
+	var op *ast.OperationDefinition
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, def := range doc.Definitions {
+		switch d := def.(type) {
+		case *ast.OperationDefinition:
+			if operationName == "" || (d.Name != nil && d.Name.Value == operationName) {
+				if op == nil {
+					op = d
+				}
+			}
+		case *ast.FragmentDefinition:
+			fragments[d.Name.Value] = d
+		}
+	}
+	return op, fragments
+}
+
+type analyzer struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+// selectionSet returns the depth below, and the cost of, a selection set.
+// Every field costs one; list-returning fields multiply their children by
+// the number of items they may return.
+func (a *analyzer) selectionSet(set *ast.SelectionSet, visiting map[string]bool) (int, int) {
+	if set == nil {
+		return 0, 0
+	}
+	maxDepth, total := 0, 0
+	for _, selection := range set.Selections {
+		depth, cost := 0, 0
+		switch s := selection.(type) {
+		case *ast.Field:
+			childDepth, childCost := a.selectionSet(s.SelectionSet, visiting)
+			depth = childDepth + 1
+			cost = 1 + childCost*a.multiplier(s)
+		case *ast.InlineFragment:
+			depth, cost = a.selectionSet(s.SelectionSet, visiting)
+		case *ast.FragmentSpread:
+			name := s.Name.Value
+			fragment, ok := a.fragments[name]
+			if !ok || visiting[name] {
+				continue
+			}
+			visiting[name] = true
+			depth, cost = a.selectionSet(fragment.SelectionSet, visiting)
+			delete(visiting, name)
+		}
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		total += cost
+	}
+	return maxDepth, total
+}
+
+func (a *analyzer) multiplier(field *ast.Field) int {
+	if field.Name.Value != "products" {
+		return 1
+	}
+	count := defaultCount
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "count" {
+			continue
+		}
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			count, _ = strconv.Atoi(v.Value)
+		case *ast.Variable:
+			if n, ok := a.variables[v.Name.Value].(float64); ok {
+				count = int(n)
+			}
+		}
+	}
+	if count < 1 {
+		count = defaultCount
+	}
+	if count > maxCount {
+		count = maxCount
+	}
+	return count
+}
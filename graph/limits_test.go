@@ -0,0 +1,84 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+func mustParse(t *testing.T, query string) *ast.Document {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		t.Fatalf("Unable to parse %q: %v", query, err)
+	}
+	return doc
+}
+
+func TestLimitsAllowSimpleQuery(t *testing.T) {
+	doc := mustParse(t, `{ product(id: "x") { id name price } }`)
+	if err := DefaultLimits().Check(doc, "", nil); err != nil {
+		t.Errorf("Expected no error. Got %v", err)
+	}
+}
+
+func TestLimitsRejectDeepQuery(t *testing.T) {
+	doc := mustParse(t, `{ products { links { href } data { id } } }`)
+	limits := Limits{MaxDepth: 2}
+	if err := limits.Check(doc, "", nil); err == nil {
+		t.Errorf("Expected depth of 3 to exceed maximum of 2")
+	}
+}
+
+func TestLimitsFollowFragments(t *testing.T) {
+	doc := mustParse(t, `
+		query { products { ...page } }
+		fragment page on ProductConnection { data { id } }`)
+	limits := Limits{MaxDepth: 2}
+	if err := limits.Check(doc, "", nil); err == nil {
+		t.Errorf("Expected fragment depth to be counted")
+	}
+}
+
+func TestLimitsIgnoreRecursiveFragments(t *testing.T) {
+	doc := mustParse(t, `
+		query { products { ...a } }
+		fragment a on ProductConnection { total ...a }`)
+	if err := DefaultLimits().Check(doc, "", nil); err != nil {
+		t.Errorf("Expected recursive fragment to be cut short. Got %v", err)
+	}
+}
+
+func TestLimitsComplexityScalesWithCount(t *testing.T) {
+	doc := mustParse(t, `{ products(count: 250) { data { id name price } } }`)
+	limits := Limits{MaxComplexity: 500}
+	if err := limits.Check(doc, "", nil); err == nil {
+		t.Errorf("Expected 250 products with 3 fields to exceed complexity of 500")
+	}
+
+	doc = mustParse(t, `{ products(count: 10) { data { id name price } } }`)
+	if err := limits.Check(doc, "", nil); err != nil {
+		t.Errorf("Expected 10 products to be within complexity. Got %v", err)
+	}
+}
+
+func TestLimitsComplexityReadsVariables(t *testing.T) {
+	doc := mustParse(t, `query P($n: Int) { products(count: $n) { data { id name price } } }`)
+	limits := Limits{MaxComplexity: 500}
+	if err := limits.Check(doc, "P", map[string]interface{}{"n": float64(250)}); err == nil {
+		t.Errorf("Expected count variable to be used for complexity")
+	}
+}
+
+func TestLimitsSelectNamedOperation(t *testing.T) {
+	doc := mustParse(t, `
+		query Small { products { total } }
+		query Deep { products { data { id } } }`)
+	limits := Limits{MaxDepth: 2}
+	if err := limits.Check(doc, "Small", nil); err != nil {
+		t.Errorf("Expected Small to pass. Got %v", err)
+	}
+	if err := limits.Check(doc, "Deep", nil); err == nil {
+		t.Errorf("Expected Deep to fail")
+	}
+}
@@ -0,0 +1,360 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/graphql-go/graphql"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/blob"
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/events"
+	"github.com/Lewiscowles1986/go-gorilla-api/imaging"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/rest"
+	"github.com/Lewiscowles1986/go-gorilla-api/tenants"
+)
+
+const (
+	defaultCount = 10
+	maxCount     = 250
+)
+
+var linkType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Link",
+	Fields: graphql.Fields{
+		"href": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"rel":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"type": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+var productType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Product",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.ID),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(data.Product).GetID(), nil
+			},
+		},
+		"name": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(data.Product).GetName(), nil
+			},
+		},
+		"price": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Float),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(data.Product).GetPrice(), nil
+			},
+		},
+	},
+})
+
+// productConnectionType mirrors rest.Listing so both APIs report the same
+// paging totals. No REST listing takes the GraphQL filter, so there is no
+// link to one that would page the same products; links is always empty.
+var productConnectionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ProductConnection",
+	Fields: graphql.Fields{
+		"data": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(productType))),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				l := p.Source.(rest.Listing)
+				products := []data.Product{}
+				for _, e := range l.Data {
+					products = append(products, e.Object.(data.Product))
+				}
+				return products, nil
+			},
+		},
+		"total": listingField(func(l rest.Listing) interface{} { return int(l.Total) }),
+		"count": listingField(func(l rest.Listing) interface{} { return int(l.Count) }),
+		"page":  listingField(func(l rest.Listing) interface{} { return int(l.Page) }),
+		"limit": listingField(func(l rest.Listing) interface{} { return int(l.Limit) }),
+		"links": &graphql.Field{
+			Type:              graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(linkType))),
+			DeprecationReason: "Page with the page and count arguments",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return []rest.Link{}, nil
+			},
+		},
+	},
+})
+
+func listingField(get func(rest.Listing) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewNonNull(graphql.Int),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return get(p.Source.(rest.Listing)), nil
+		},
+	}
+}
+
+var productFilterType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "ProductFilter",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"minPrice": &graphql.InputObjectFieldConfig{Type: graphql.Float},
+		"maxPrice": &graphql.InputObjectFieldConfig{Type: graphql.Float},
+	},
+})
+
+var productInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "ProductInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"price": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Float)},
+	},
+})
+
+// NewSchema - Builds the GraphQL schema, resolving through repositories
+func NewSchema(db *repositories.DB, broker *events.Broker, images blob.Store) (graphql.Schema, error) {
+	r := &resolver{db: db, events: broker, images: images}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"product": &graphql.Field{
+				Type: productType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: r.product,
+			},
+			"products": &graphql.Field{
+				Type: graphql.NewNonNull(productConnectionType),
+				Args: graphql.FieldConfigArgument{
+					"filter": &graphql.ArgumentConfig{Type: productFilterType},
+					"page":   &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 1},
+					"count":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultCount},
+				},
+				Resolve: r.products,
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createProduct": &graphql.Field{
+				Type: graphql.NewNonNull(productType),
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(productInputType)},
+				},
+				Resolve: r.createProduct,
+			},
+			"updateProduct": &graphql.Field{
+				Type: graphql.NewNonNull(productType),
+				Args: graphql.FieldConfigArgument{
+					"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(productInputType)},
+				},
+				Resolve: r.updateProduct,
+			},
+			"deleteProduct": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: r.deleteProduct,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+type resolver struct {
+	db     *repositories.DB
+	events *events.Broker
+	images blob.Store
+}
+
+// readerKey - The context key of the database a request's queries read from
+type readerKey struct{}
+
+// WithReader - ctx, with the queries of its request reading from db rather
+// than the schema's database; mutations always go to the schema's
+func WithReader(ctx context.Context, db *repositories.DB) context.Context {
+	return context.WithValue(ctx, readerKey{}, db)
+}
+
+// reader is the database p's queries read from
+func (r *resolver) reader(p graphql.ResolveParams) *repositories.DB {
+	if db, ok := p.Context.Value(readerKey{}).(*repositories.DB); ok {
+		return db.WithContext(p.Context)
+	}
+	return r.db.WithContext(p.Context)
+}
+
+var errNoTenant = errors.New("No tenant")
+
+// tenant is the tenant the HTTP handler's request was scoped to
+func tenant(p graphql.ResolveParams) (string, error) {
+	if id, ok := tenants.FromContext(p.Context); ok {
+		return id, nil
+	}
+	return "", errNoTenant
+}
+
+func (r *resolver) product(p graphql.ResolveParams) (interface{}, error) {
+	tenantID, err := tenant(p)
+	if err != nil {
+		return nil, err
+	}
+	id := data.ParseUUID(p.Args["id"].(string))
+	product, err := repositories.GetProduct(r.reader(p), tenantID, id.String())
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error loading")
+	}
+	return product, nil
+}
+
+func (r *resolver) products(p graphql.ResolveParams) (interface{}, error) {
+	tenantID, err := tenant(p)
+	if err != nil {
+		return nil, err
+	}
+	page, count := pagingFromArgs(p.Args)
+	filter := filterFromArgs(p.Args)
+
+	db := r.reader(p)
+	products, err := repositories.FindProducts(db, tenantID, filter, page, count)
+	if err != nil {
+		return nil, err
+	}
+	total := repositories.CountProducts(db, tenantID, filter)
+
+	return rest.Listing{
+		Data:  rest.ProductsToEntries(rest.Linker{}, products),
+		Total: total,
+		Count: uint8(len(products)),
+		Page:  page,
+		Limit: count,
+	}, nil
+}
+
+func (r *resolver) createProduct(p graphql.ResolveParams) (interface{}, error) {
+	tenantID, err := tenant(p)
+	if err != nil {
+		return nil, err
+	}
+	input := p.Args["input"].(map[string]interface{})
+	product := data.CreateProduct(input["name"].(string), input["price"].(float64))
+	if err := data.ValidateProduct(product); err != nil {
+		return nil, err
+	}
+
+	err = r.db.WithTx(p.Context, func(tx *repositories.Tx) error {
+		if err := repositories.CreateProduct(tx, tenantID, product); err != nil {
+			return err
+		}
+		return repositories.EnqueueEvent(tx, tenantID, events.ProductCreated, product)
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.events.Publish(tenantID, events.ProductCreated, product)
+	return product, nil
+}
+
+func (r *resolver) updateProduct(p graphql.ResolveParams) (interface{}, error) {
+	tenantID, err := tenant(p)
+	if err != nil {
+		return nil, err
+	}
+	id := data.ParseUUID(p.Args["id"].(string))
+
+	input := p.Args["input"].(map[string]interface{})
+	product := data.CreateProduct(input["name"].(string), input["price"].(float64))
+	if err := data.ValidateProduct(product); err != nil {
+		return nil, err
+	}
+	var m data.Product
+	err = r.db.WithTx(p.Context, func(tx *repositories.Tx) (err error) {
+		if m, err = repositories.UpdateProduct(tx, tenantID, id.String(), product); err != nil {
+			return err
+		}
+		return repositories.EnqueueEvent(tx, tenantID, events.ProductUpdated, m)
+	})
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		return nil, fmt.Errorf("Product '%s' not found", id.String())
+	default:
+		return nil, fmt.Errorf("Unable to save product '%s'", id.String())
+	}
+	r.events.Publish(tenantID, events.ProductUpdated, m)
+	return m, nil
+}
+
+func (r *resolver) deleteProduct(p graphql.ResolveParams) (interface{}, error) {
+	tenantID, err := tenant(p)
+	if err != nil {
+		return nil, err
+	}
+	id := data.ParseUUID(p.Args["id"].(string))
+	var product data.Product
+	var images []string
+	err = r.db.WithTx(p.Context, func(tx *repositories.Tx) (err error) {
+		if images, err = repositories.GetProductImageIDs(tx, tenantID, id.String()); err != nil {
+			return err
+		}
+		if product, err = repositories.DeleteProduct(tx, tenantID, id.String()); err != nil {
+			return err
+		}
+		return repositories.EnqueueEvent(tx, tenantID, events.ProductDeleted, product)
+	})
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		return nil, fmt.Errorf("Product '%s' not found", id.String())
+	default:
+		return nil, err
+	}
+	r.events.Publish(tenantID, events.ProductDeleted, product)
+	imaging.DeleteBlobs(p.Context, r.images, tenantID, images...)
+	return true, nil
+}
+
+func pagingFromArgs(args map[string]interface{}) (uint64, uint8) {
+	page, _ := args["page"].(int)
+	count, _ := args["count"].(int)
+
+	if count < 1 {
+		count = defaultCount
+	}
+	if count > maxCount {
+		count = maxCount
+	}
+	if page < 1 {
+		page = 1
+	}
+	return uint64(page), uint8(count)
+}
+
+func filterFromArgs(args map[string]interface{}) repositories.ProductFilter {
+	filter := repositories.ProductFilter{}
+	raw, ok := args["filter"].(map[string]interface{})
+	if !ok {
+		return filter
+	}
+	if name, ok := raw["name"].(string); ok {
+		filter.Name = name
+	}
+	if min, ok := raw["minPrice"].(float64); ok {
+		filter.MinPrice = &min
+	}
+	if max, ok := raw["maxPrice"].(float64); ok {
+		filter.MaxPrice = &max
+	}
+	return filter
+}
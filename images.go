@@ -0,0 +1,293 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/blob"
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/imaging"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/rest"
+	"github.com/Lewiscowles1986/go-gorilla-api/settings"
+	"github.com/Lewiscowles1986/go-gorilla-api/tenants"
+)
+
+// ImageLimits - What an uploaded image may be, and the square its thumbnail
+// fits in
+type ImageLimits struct {
+	MaxBytes      int64
+	MaxPixels     int
+	ThumbnailSize int
+}
+
+func DefaultImageLimits() ImageLimits {
+	return ImageLimits{MaxBytes: 10 << 20, MaxPixels: 40000000, ThumbnailSize: 256}
+}
+
+// imageLimits reads APP_IMAGE_MAX_BYTES, APP_IMAGE_MAX_PIXELS and
+// APP_IMAGE_THUMBNAIL_SIZE
+func imageLimits() ImageLimits {
+	l := DefaultImageLimits()
+	l.MaxBytes = int64(settings.GetenvInt("APP_IMAGE_MAX_BYTES", int(l.MaxBytes)))
+	l.MaxPixels = settings.GetenvInt("APP_IMAGE_MAX_PIXELS", l.MaxPixels)
+	l.ThumbnailSize = settings.GetenvInt("APP_IMAGE_THUMBNAIL_SIZE", l.ThumbnailSize)
+	return l
+}
+
+// blobStore - Where images are kept: files under APP_BLOB_DIR, or with
+// APP_BLOB_BACKEND=s3 a bucket named by the APP_S3_ settings
+func blobStore() (blob.Store, error) {
+	switch backend := settings.Getenv("APP_BLOB_BACKEND", "fs"); backend {
+	case "fs":
+		return blob.NewFS(settings.Getenv("APP_BLOB_DIR", "blobs")), nil
+	case "s3":
+		endpoint, bucket := settings.Getenv("APP_S3_ENDPOINT", ""), settings.Getenv("APP_S3_BUCKET", "")
+		if endpoint == "" || bucket == "" {
+			return nil, errors.New("the s3 blob backend needs APP_S3_ENDPOINT and APP_S3_BUCKET")
+		}
+		return blob.NewS3(endpoint, bucket, settings.Getenv("APP_S3_REGION", "us-east-1"),
+			settings.Getenv("APP_S3_ACCESS_KEY_ID", ""), settings.Getenv("APP_S3_SECRET_ACCESS_KEY", "")), nil
+	default:
+		return nil, fmt.Errorf("unknown blob backend %q", backend)
+	}
+}
+
+func (a *App) linkImages(r *http.Request, entries []rest.Entry, productIDs []string) error {
+	images, err := repositories.GetProductImages(a.reader(r), tenantOf(r), productIDs...)
+	if err != nil {
+		return err
+	}
+	for i, id := range productIDs {
+		if productImages, ok := images[id]; ok {
+			entries[i].Links = append(entries[i].Links, rest.ImageLinks(a.linker(r), productImages)...)
+		}
+	}
+	return nil
+}
+
+func (a *App) getImages(w http.ResponseWriter, r *http.Request) {
+	p, ok := a.loadProduct(w, r)
+	if !ok {
+		return
+	}
+	images, err := repositories.GetProductImages(a.db(r), tenantOf(r), p.GetID())
+	if err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	count, page := getPagingFromRequest(r)
+	all := images[p.GetID()]
+	start := min(uint64(len(all)), (page-1)*uint64(count))
+	end := min(uint64(len(all)), start+uint64(count))
+
+	entries := []rest.Entry{}
+	for _, i := range all[start:end] {
+		entries = append(entries, rest.ImageToEntry(a.linker(r), i))
+	}
+	l := rest.ListingJSONResponse(a.linker(r).Href(rest.RouteProductImages, "id", p.GetID()), page,
+		uint64(len(all)), count, entries)
+	rest.RespondWithListing(w, r, http.StatusOK, l)
+}
+
+// uploadImage takes the "image" part of a multipart form, stores it and a
+// thumbnail, and only then records it, so a recorded image always has its
+// blobs
+func (a *App) uploadImage(w http.ResponseWriter, r *http.Request) {
+	p, ok := a.loadProduct(w, r)
+	if !ok {
+		return
+	}
+	body, ok := a.readImagePart(w, r)
+	if !ok {
+		return
+	}
+	info, err := imaging.Inspect(body, a.ImageLimits.MaxPixels)
+	switch err {
+	case nil:
+	case imaging.ErrTooManyPixels:
+		rest.RespondWithError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	default:
+		rest.RespondWithError(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+	thumb, thumbType, err := imaging.Thumbnail(body, a.ImageLimits.ThumbnailSize)
+	if err != nil {
+		rest.RespondWithError(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	img := data.Image{
+		ID:                   uuid.Must(uuid.NewV4(), nil).String(),
+		ProductID:            p.GetID(),
+		ContentType:          info.ContentType,
+		Size:                 int64(len(body)),
+		Width:                info.Width,
+		Height:               info.Height,
+		Checksum:             hex.EncodeToString(sum[:]),
+		ThumbnailContentType: thumbType,
+		CreatedAt:            time.Now().UTC().Truncate(time.Second),
+	}
+	tenantID := tenantOf(r)
+	original, thumbnail := imaging.Key(tenantID, img.ID, false), imaging.Key(tenantID, img.ID, true)
+	err = a.Images.Put(r.Context(), original, body, img.ContentType)
+	if err == nil {
+		err = a.Images.Put(r.Context(), thumbnail, thumb, thumbType)
+	}
+	if err == nil {
+		err = repositories.CreateImage(a.db(r), tenantID, img)
+	}
+	if err != nil {
+		imaging.DeleteBlobs(r.Context(), a.Images, tenantID, img.ID)
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	e := rest.ImageToEntry(a.linker(r), img)
+	if href := a.linker(r).Href(rest.RouteProductImage, "id", p.GetID(), "imageId", img.ID); href != "" {
+		w.Header().Set("Location", href)
+	}
+	rest.RespondWithObject(w, r, http.StatusCreated, e)
+}
+
+// readImagePart reads the first "image" part of r's multipart body, within
+// the size limit, answering the client itself when it cannot
+func (a *App) readImagePart(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	// Leave room for the multipart framing and any other small fields.
+	r.Body = http.MaxBytesReader(w, r.Body, a.ImageLimits.MaxBytes+64<<10)
+	parts, err := r.MultipartReader()
+	if err != nil {
+		rest.RespondWithError(w, http.StatusUnsupportedMediaType, "Expected a multipart/form-data body")
+		return nil, false
+	}
+	for {
+		part, err := parts.NextPart()
+		if err != nil {
+			respondWithPartError(w, err, a.ImageLimits.MaxBytes)
+			return nil, false
+		}
+		if part.FormName() != "image" {
+			continue
+		}
+		body, err := readPart(part, a.ImageLimits.MaxBytes)
+		if err != nil {
+			respondWithPartError(w, err, a.ImageLimits.MaxBytes)
+			return nil, false
+		}
+		return body, true
+	}
+}
+
+var errImageTooLarge = errors.New("image too large")
+
+func readPart(part *multipart.Part, maxBytes int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(part, maxBytes+1))
+	if err == nil && int64(len(body)) > maxBytes {
+		err = errImageTooLarge
+	}
+	return body, err
+}
+
+func respondWithPartError(w http.ResponseWriter, err error, maxBytes int64) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == io.EOF:
+		rest.RespondWithError(w, http.StatusBadRequest, "Expected an image part")
+	case err == errImageTooLarge || errors.As(err, &tooLarge):
+		rest.RespondWithError(w, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("Image must be at most %d bytes", maxBytes))
+	default:
+		rest.RespondWithError(w, http.StatusBadRequest, "Malformed multipart body")
+	}
+}
+
+// loadImage finds the image named by the route, treating one of another
+// product as missing
+func (a *App) loadImage(w http.ResponseWriter, r *http.Request) (data.Image, bool) {
+	vars := mux.Vars(r)
+	productID := data.ParseUUID(vars["id"]).String()
+	id := data.ParseUUID(vars["imageId"]).String()
+
+	img, err := repositories.GetImage(a.db(r), tenantOf(r), productID, id)
+	switch err {
+	case nil:
+		return img, true
+	case sql.ErrNoRows:
+		rest.RespondWithError(w, http.StatusNotFound, "Image not found")
+	default:
+		rest.RespondWithError(w, http.StatusInternalServerError, "Error loading")
+	}
+	return data.Image{}, false
+}
+
+func (a *App) getImage(w http.ResponseWriter, r *http.Request) {
+	a.serveImage(w, r, false)
+}
+
+func (a *App) getThumbnail(w http.ResponseWriter, r *http.Request) {
+	a.serveImage(w, r, true)
+}
+
+// serveImage answers with an image's bytes, or its thumbnail's. Neither
+// ever changes under its URL, so both may be cached for good, and ranges,
+// conditional requests and HEAD are left to http.ServeContent.
+func (a *App) serveImage(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	img, ok := a.loadImage(w, r)
+	if !ok {
+		return
+	}
+	object, err := a.Images.Get(r.Context(), imaging.Key(tenantOf(r), img.ID, thumbnail))
+	switch err {
+	case nil:
+	case blob.ErrNotFound:
+		rest.RespondWithError(w, http.StatusNotFound, "Image not found")
+		return
+	default:
+		rest.RespondWithError(w, http.StatusInternalServerError, "Error loading")
+		return
+	}
+	defer object.Close()
+
+	contentType, etag := img.ContentType, `"`+img.Checksum+`"`
+	if thumbnail {
+		contentType, etag = img.ThumbnailContentType, `"`+img.Checksum+`-thumbnail"`
+	}
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", "public, max-age=31536000, immutable")
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Add("Vary", tenants.HeaderName)
+	http.ServeContent(w, r, "", img.CreatedAt, object)
+}
+
+func (a *App) deleteImage(w http.ResponseWriter, r *http.Request) {
+	img, ok := a.loadImage(w, r)
+	if !ok {
+		return
+	}
+	switch err := repositories.DeleteImage(a.db(r), tenantOf(r), img.ProductID, img.ID); err {
+	case nil:
+	case sql.ErrNoRows:
+		rest.RespondWithError(w, http.StatusNotFound, "Image not found")
+		return
+	default:
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	imaging.DeleteBlobs(r.Context(), a.Images, tenantOf(r), img.ID)
+
+	rest.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/blob"
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/tenants"
+)
+
+// useTempImages keeps images in a directory of t's for the rest of t
+func useTempImages(t *testing.T) string {
+	dir := t.TempDir()
+	saved, savedLimits := a.Images, a.ImageLimits
+	a.Images, a.ImageLimits = blob.NewFS(dir), DefaultImageLimits()
+	t.Cleanup(func() { a.Images, a.ImageLimits = saved, savedLimits })
+	return dir
+}
+
+func pngOf(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{uint8(x), uint8(y), 200, 255})
+		}
+	}
+	var out bytes.Buffer
+	png.Encode(&out, img)
+	return out.Bytes()
+}
+
+func uploadRequest(t *testing.T, productID, field string, body []byte) *http.Request {
+	t.Helper()
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	mw.WriteField("caption", "ignored")
+	part, _ := mw.CreateFormFile(field, "upload.png")
+	part.Write(body)
+	mw.Close()
+	req, _ := http.NewRequest("POST", "/product/"+productID+"/images", &form)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func upload(t *testing.T, productID string, body []byte) data.Image {
+	t.Helper()
+	response := executeRequest(uploadRequest(t, productID, "image", body))
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	var img data.Image
+	json.Unmarshal(response.Body.Bytes(), &img)
+	if response.Header().Get("Location") != "/product/"+productID+"/images/"+img.ID {
+		t.Errorf("Expected the image's location. Got %q", response.Header().Get("Location"))
+	}
+	return img
+}
+
+func TestUploadAndServeImage(t *testing.T) {
+	clearTable()
+	useTempImages(t)
+	p := data.CreateProduct("pictured", 1)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+
+	original := pngOf(t, 600, 300)
+	img := upload(t, p.GetID(), original)
+	if img.ContentType != "image/png" || img.Width != 600 || img.Height != 300 || img.Size != int64(len(original)) {
+		t.Errorf("Unexpected image %+v", img)
+	}
+
+	path := "/product/" + p.GetID() + "/images/" + img.ID
+	req, _ := http.NewRequest("GET", path, nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	h := response.Header()
+	if !bytes.Equal(response.Body.Bytes(), original) || h.Get("Content-Type") != "image/png" ||
+		h.Get("ETag") != `"`+img.Checksum+`"` || h.Get("Cache-Control") != "public, max-age=31536000, immutable" ||
+		h.Get("Accept-Ranges") != "bytes" || h.Get("Last-Modified") == "" {
+		t.Errorf("Unexpected image response %v", h)
+	}
+
+	req, _ = http.NewRequest("GET", path, nil)
+	req.Header.Set("Range", "bytes=0-7")
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusPartialContent, response.Code)
+	if !bytes.Equal(response.Body.Bytes(), original[:8]) ||
+		response.Header().Get("Content-Range") != "bytes 0-7/"+strconv.Itoa(len(original)) {
+		t.Errorf("Expected the PNG signature alone. Got %q %v", response.Body.Bytes(), response.Header())
+	}
+
+	req, _ = http.NewRequest("GET", path, nil)
+	req.Header.Set("If-None-Match", `"`+img.Checksum+`"`)
+	checkResponseCode(t, http.StatusNotModified, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("GET", path+"/thumbnail", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	config, _, err := image.DecodeConfig(response.Body)
+	if err != nil || config.Width != 256 || config.Height != 128 {
+		t.Errorf("Expected a 256x128 thumbnail. Got %dx%d %v", config.Width, config.Height, err)
+	}
+}
+
+func TestProductLinksToItsImages(t *testing.T) {
+	clearTable()
+	useTempImages(t)
+	p := data.CreateProduct("pictured", 1)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+	img := upload(t, p.GetID(), pngOf(t, 10, 10))
+
+	base := "/product/" + p.GetID() + "/images/" + img.ID
+	req, _ := http.NewRequest("GET", "/products", nil)
+	var l struct {
+		Data []struct {
+			Links []struct{ Href, Rel string }
+		}
+	}
+	json.Unmarshal(executeRequest(req).Body.Bytes(), &l)
+	rels := map[string]string{}
+	for _, link := range l.Data[0].Links {
+		rels[link.Rel] = link.Href
+	}
+	if rels["image"] != base || rels["thumbnail"] != base+"/thumbnail" {
+		t.Errorf("Expected image links in the listing. Got %v", l.Data[0].Links)
+	}
+
+	req, _ = http.NewRequest("GET", "/product/"+p.GetID(), nil)
+	header := executeRequest(req).Header().Values("Link")
+	if !slices.Contains(header, `<`+base+`>; rel="image"`) ||
+		!slices.Contains(header, `<`+base+`/thumbnail>; rel="thumbnail"`) {
+		t.Errorf("Expected image links in the product's Link header. Got %v", header)
+	}
+
+	req, _ = http.NewRequest("GET", "/product/"+p.GetID(), nil)
+	req.Header.Set("Accept", "application/hal+json")
+	var h struct {
+		Links map[string]struct{ Href string } `json:"_links"`
+	}
+	json.Unmarshal(executeRequest(req).Body.Bytes(), &h)
+	if h.Links["image"].Href != base || h.Links["thumbnail"].Href != base+"/thumbnail" {
+		t.Errorf("Expected image links on the product. Got %v", h.Links)
+	}
+
+	req, _ = http.NewRequest("GET", "/product/"+p.GetID()+"/images", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var images struct {
+		Total int
+		Data  []struct{ Object data.Image }
+	}
+	json.Unmarshal(response.Body.Bytes(), &images)
+	if images.Total != 1 || images.Data[0].Object.ID != img.ID {
+		t.Errorf("Expected the image listed. Got %+v", images)
+	}
+}
+
+func TestUploadRefusals(t *testing.T) {
+	clearTable()
+	useTempImages(t)
+	a.ImageLimits.MaxBytes = 2048
+	p := data.CreateProduct("pictured", 1)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+
+	for _, c := range []struct {
+		name   string
+		req    *http.Request
+		status int
+	}{
+		{"not an image", uploadRequest(t, p.GetID(), "image", []byte("<svg xmlns='http://www.w3.org/2000/svg'/>")),
+			http.StatusUnsupportedMediaType},
+		{"too large", uploadRequest(t, p.GetID(), "image", make([]byte, 4096)), http.StatusRequestEntityTooLarge},
+		{"no image part", uploadRequest(t, p.GetID(), "photo", pngOf(t, 4, 4)), http.StatusBadRequest},
+		{"no such product", uploadRequest(t, "11111111-1111-4111-8111-111111111111", "image", pngOf(t, 4, 4)),
+			http.StatusNotFound},
+	} {
+		if response := executeRequest(c.req); response.Code != c.status {
+			t.Errorf("%s: expected %d. Got %d %s", c.name, c.status, response.Code, response.Body)
+		}
+	}
+
+	req, _ := http.NewRequest("POST", "/product/"+p.GetID()+"/images", bytes.NewReader(pngOf(t, 4, 4)))
+	req.Header.Set("Content-Type", "image/png")
+	checkResponseCode(t, http.StatusUnsupportedMediaType, executeRequest(req).Code)
+
+	a.ImageLimits.MaxBytes, a.ImageLimits.MaxPixels = 1<<20, 99
+	checkResponseCode(t, http.StatusRequestEntityTooLarge,
+		executeRequest(uploadRequest(t, p.GetID(), "image", pngOf(t, 10, 10))).Code)
+}
+
+func TestDeletingImagesRemovesTheirBlobs(t *testing.T) {
+	clearTable()
+	dir := useTempImages(t)
+	p := data.CreateProduct("pictured", 1)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+	one := upload(t, p.GetID(), pngOf(t, 10, 10))
+	two := upload(t, p.GetID(), pngOf(t, 20, 10))
+	blobs := func(imageID string) int {
+		entries, _ := os.ReadDir(filepath.Join(dir, "images", tenants.Default, imageID))
+		return len(entries)
+	}
+	if blobs(one.ID) != 2 {
+		t.Fatalf("Expected an original and a thumbnail. Got %d", blobs(one.ID))
+	}
+
+	path := "/product/" + p.GetID() + "/images/" + one.ID
+	req, _ := http.NewRequest("DELETE", path, nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	req, _ = http.NewRequest("GET", path, nil)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+	if blobs(one.ID) != 0 {
+		t.Errorf("Expected the image's blobs removed")
+	}
+
+	req, _ = http.NewRequest("DELETE", "/product/"+p.GetID(), nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	if blobs(two.ID) != 0 {
+		t.Errorf("Expected the product's images removed with it")
+	}
+}
+
+func TestBlobStoreFromEnvironment(t *testing.T) {
+	defer os.Unsetenv("APP_BLOB_BACKEND")
+	os.Setenv("APP_BLOB_BACKEND", "s3")
+	if _, err := blobStore(); err == nil {
+		t.Error("Expected s3 to need an endpoint and bucket")
+	}
+	os.Setenv("APP_BLOB_BACKEND", "tape")
+	if _, err := blobStore(); err == nil {
+		t.Error("Expected an unknown backend refused")
+	}
+}
@@ -0,0 +1,30 @@
+package imaging
+
+import (
+	"context"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/blob"
+	"github.com/Lewiscowles1986/go-gorilla-api/telemetry"
+)
+
+// Key - Where an image, or its thumbnail, is kept in a blob.Store
+func Key(tenantID, imageID string, thumbnail bool) string {
+	if thumbnail {
+		return "images/" + tenantID + "/" + imageID + "/thumbnail"
+	}
+	return "images/" + tenantID + "/" + imageID + "/original"
+}
+
+// DeleteBlobs - Removes the originals and thumbnails of images that nothing
+// refers to any more. Every transport that deletes image rows, directly or
+// with their product or tenant, removes their blobs through here. Failures
+// are logged and otherwise ignored, as the images are gone either way.
+func DeleteBlobs(ctx context.Context, store blob.Store, tenantID string, imageIDs ...string) {
+	for _, id := range imageIDs {
+		for _, thumbnail := range []bool{false, true} {
+			if err := store.Delete(ctx, Key(tenantID, id, thumbnail)); err != nil {
+				telemetry.Printf(ctx, "deleting image %s: %v", id, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Package imaging - Checks uploaded images and scales their thumbnails,
+// with the standard library's decoders
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+var (
+	ErrUnsupported   = errors.New("Image must be a JPEG, PNG or GIF")
+	ErrTooManyPixels = errors.New("Image has too many pixels")
+)
+
+// decoders - The types images may have, as sniffed from their content
+var decoders = map[string]func([]byte) (image.Config, error){
+	"image/jpeg": func(b []byte) (image.Config, error) { return jpeg.DecodeConfig(bytes.NewReader(b)) },
+	"image/png":  func(b []byte) (image.Config, error) { return png.DecodeConfig(bytes.NewReader(b)) },
+	"image/gif":  func(b []byte) (image.Config, error) { return gif.DecodeConfig(bytes.NewReader(b)) },
+}
+
+// Info - What an image is, from its content rather than what the client
+// said it was
+type Info struct {
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Inspect - Sniffs b's type and reads its dimensions without decoding the
+// pixels, refusing anything but JPEG, PNG and GIF, and anything over
+// maxPixels
+func Inspect(b []byte, maxPixels int) (Info, error) {
+	contentType := http.DetectContentType(b)
+	decodeConfig, ok := decoders[contentType]
+	if !ok {
+		return Info{}, ErrUnsupported
+	}
+	c, err := decodeConfig(b)
+	if err != nil || c.Width <= 0 || c.Height <= 0 {
+		return Info{}, ErrUnsupported
+	}
+	if c.Width*c.Height > maxPixels {
+		return Info{}, ErrTooManyPixels
+	}
+	return Info{ContentType: contentType, Width: c.Width, Height: c.Height}, nil
+}
+
+// Thumbnail - b scaled down to fit in a size pixel square, keeping its
+// shape. JPEGs stay JPEG; anything else becomes PNG, keeping transparency.
+// Images already small enough are only re-encoded.
+func Thumbnail(b []byte, size int) ([]byte, string, error) {
+	src, format, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, "", ErrUnsupported
+	}
+	thumb := scale(src, size)
+
+	var out bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&out, thumb, &jpeg.Options{Quality: 85})
+		return out.Bytes(), "image/jpeg", err
+	}
+	err = png.Encode(&out, thumb)
+	return out.Bytes(), "image/png", err
+}
+
+// scale averages each box of source pixels into one, which keeps detail
+// far better than sampling when shrinking a lot
+func scale(src image.Image, size int) *image.RGBA {
+	bounds := src.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	dw, dh := sw, sh
+	if sw > size || sh > size {
+		if sw >= sh {
+			dw, dh = size, max(1, sh*size/sw)
+		} else {
+			dw, dh = max(1, sw*size/sh), size
+		}
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, sw, sh))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	if dw == sw && dh == sh {
+		return rgba
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, max((y+1)*sh/dh, y*sh/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, max((x+1)*sw/dw, x*sw/dw+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride+x0*4 : sy*rgba.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			at := y*dst.Stride + x*4
+			for i := range sum {
+				dst.Pix[at+i] = uint8((sum[i] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
@@ -0,0 +1,75 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encoded(t *testing.T, format string, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	var out bytes.Buffer
+	switch format {
+	case "jpeg":
+		jpeg.Encode(&out, img, nil)
+	default:
+		png.Encode(&out, img)
+	}
+	return out.Bytes()
+}
+
+func TestInspect(t *testing.T) {
+	info, err := Inspect(encoded(t, "png", 300, 200), 1000000)
+	if err != nil || info != (Info{ContentType: "image/png", Width: 300, Height: 200}) {
+		t.Errorf("Unexpected %+v %v", info, err)
+	}
+	if _, err := Inspect(encoded(t, "jpeg", 300, 200), 300*200-1); err != ErrTooManyPixels {
+		t.Errorf("Expected ErrTooManyPixels. Got %v", err)
+	}
+	for _, b := range [][]byte{[]byte("<svg xmlns='http://www.w3.org/2000/svg'/>"), []byte("GIF89a"), nil} {
+		if _, err := Inspect(b, 1000000); err != ErrUnsupported {
+			t.Errorf("%q: expected ErrUnsupported. Got %v", b, err)
+		}
+	}
+}
+
+func TestThumbnailFitsAndKeepsShape(t *testing.T) {
+	cases := []struct {
+		format, contentType string
+		w, h, tw, th        int
+	}{
+		{"jpeg", "image/jpeg", 400, 200, 100, 50},
+		{"png", "image/png", 50, 300, 16, 100},
+		{"png", "image/png", 40, 30, 40, 30},
+	}
+	for _, c := range cases {
+		thumb, contentType, err := Thumbnail(encoded(t, c.format, c.w, c.h), 100)
+		if err != nil || contentType != c.contentType {
+			t.Fatalf("%dx%d: %s %v", c.w, c.h, contentType, err)
+		}
+		config, _, err := image.DecodeConfig(bytes.NewReader(thumb))
+		if err != nil || config.Width != c.tw || config.Height != c.th {
+			t.Errorf("%dx%d: expected %dx%d. Got %dx%d %v", c.w, c.h, c.tw, c.th, config.Width, config.Height, err)
+		}
+	}
+}
+
+func TestScaleAverages(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	src.Set(0, 0, color.RGBA{255, 255, 255, 255})
+	src.Set(1, 1, color.RGBA{255, 255, 255, 255})
+	src.Set(0, 1, color.RGBA{0, 0, 0, 255})
+	src.Set(1, 0, color.RGBA{0, 0, 0, 255})
+	if c := scale(src, 1).RGBAAt(0, 0); c != (color.RGBA{128, 128, 128, 255}) {
+		t.Errorf("Expected mid grey. Got %v", c)
+	}
+}
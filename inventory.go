@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/rest"
+	"github.com/Lewiscowles1986/go-gorilla-api/telemetry"
+)
+
+// maxReservationTTL bounds how long a client may hold stock
+const maxReservationTTL = 24 * time.Hour
+
+func (a *App) getInventory(w http.ResponseWriter, r *http.Request) {
+	p, ok := a.loadProduct(w, r)
+	if !ok {
+		return
+	}
+
+	i, err := repositories.GetInventory(a.db(r), tenantOf(r), p.GetID())
+	if err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rest.RespondWithJSON(w, http.StatusOK, i)
+}
+
+func (a *App) setInventory(w http.ResponseWriter, r *http.Request) {
+	p, ok := a.loadProduct(w, r)
+	if !ok {
+		return
+	}
+	var payload struct {
+		OnHand *int64 `json:"on_hand"`
+	}
+	if !a.Body.DecodeJSON(w, r, &payload) {
+		return
+	}
+	if payload.OnHand == nil || *payload.OnHand < 0 {
+		rest.RespondWithError(w, http.StatusBadRequest, "Stock on hand must be zero or more")
+		return
+	}
+
+	err := repositories.SetStock(a.db(r), tenantOf(r), p.GetID(), *payload.OnHand)
+	switch err {
+	case nil:
+	case repositories.ErrStockBelowReserved:
+		rest.RespondWithError(w, http.StatusConflict, err.Error())
+		return
+	default:
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	i, _ := repositories.GetInventory(a.db(r), tenantOf(r), p.GetID())
+
+	rest.RespondWithJSON(w, http.StatusOK, i)
+}
+
+func (a *App) createReservation(w http.ResponseWriter, r *http.Request) {
+	p, ok := a.loadProduct(w, r)
+	if !ok {
+		return
+	}
+	var payload struct {
+		Quantity   int64  `json:"quantity"`
+		TTLSeconds *int64 `json:"ttl_seconds"`
+	}
+	if !a.Body.DecodeJSON(w, r, &payload) {
+		return
+	}
+	if payload.Quantity < 1 {
+		rest.RespondWithError(w, http.StatusBadRequest, "Quantity must be at least 1")
+		return
+	}
+	ttl := a.ReservationTTL
+	if payload.TTLSeconds != nil {
+		ttl = time.Duration(*payload.TTLSeconds) * time.Second
+		if ttl <= 0 || ttl > maxReservationTTL {
+			rest.RespondWithError(w, http.StatusBadRequest,
+				"ttl_seconds must be between 1 and 86400")
+			return
+		}
+	}
+
+	res, err := repositories.Reserve(a.db(r), tenantOf(r), p.GetID(), payload.Quantity, ttl, time.Now())
+	switch err {
+	case nil:
+	case repositories.ErrInsufficientStock:
+		rest.RespondWithError(w, http.StatusConflict, err.Error())
+		return
+	default:
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rest.RespondWithJSON(w, http.StatusCreated, res)
+}
+
+func (a *App) getReservation(w http.ResponseWriter, r *http.Request) {
+	res, ok := a.loadReservation(w, r)
+	if !ok {
+		return
+	}
+
+	rest.RespondWithJSON(w, http.StatusOK, res)
+}
+
+func (a *App) commitReservation(w http.ResponseWriter, r *http.Request) {
+	a.finishReservation(w, r, func(id string) (data.Reservation, error) {
+		return repositories.CommitReservation(a.db(r), tenantOf(r), id, time.Now())
+	})
+}
+
+func (a *App) releaseReservation(w http.ResponseWriter, r *http.Request) {
+	a.finishReservation(w, r, func(id string) (data.Reservation, error) {
+		return repositories.ReleaseReservation(a.db(r), tenantOf(r), id)
+	})
+}
+
+func (a *App) finishReservation(w http.ResponseWriter, r *http.Request,
+	finish func(id string) (data.Reservation, error)) {
+	res, ok := a.loadReservation(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := finish(res.ID)
+	switch err {
+	case nil:
+		rest.RespondWithJSON(w, http.StatusOK, res)
+	case repositories.ErrReservationNotPending, repositories.ErrReservationExpired:
+		rest.RespondWithError(w, http.StatusConflict, err.Error())
+	default:
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// expireReservations returns lapsed reservations to stock every interval
+// until ctx is done
+func (a *App) expireReservations(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			sweep, span := telemetry.Start(ctx, "expire reservations")
+			n, err := repositories.ExpireReservations(a.DB.WithContext(sweep), now)
+			if err != nil {
+				telemetry.Printf(sweep, "expiring reservations: %v", err)
+			} else if n > 0 {
+				telemetry.Printf(sweep, "expired %d reservations", n)
+			}
+			span.End()
+		}
+	}
+}
+
+func (a *App) loadProduct(w http.ResponseWriter, r *http.Request) (data.Product, bool) {
+	return a.loadProductVar(w, r, "id")
+}
+
+// loadProductVar looks up the product named by the route variable key
+func (a *App) loadProductVar(w http.ResponseWriter, r *http.Request, key string) (data.Product, bool) {
+	id := data.ParseUUID(mux.Vars(r)[key])
+
+	p, err := repositories.GetProduct(a.db(r), tenantOf(r), id.String())
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			rest.RespondWithError(w, http.StatusNotFound, "Product not found")
+		default:
+			rest.RespondWithError(w, http.StatusInternalServerError, "Error loading")
+		}
+		return nil, false
+	}
+	return p, true
+}
+
+// loadReservation finds a reservation, treating one for another product as
+// missing
+func (a *App) loadReservation(w http.ResponseWriter, r *http.Request) (data.Reservation, bool) {
+	vars := mux.Vars(r)
+	productID := data.ParseUUID(vars["id"]).String()
+	id := data.ParseUUID(vars["reservationId"]).String()
+
+	res, err := repositories.GetReservation(a.db(r), tenantOf(r), id)
+	if err == nil && res.ProductID != productID {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			rest.RespondWithError(w, http.StatusNotFound, "Reservation not found")
+		default:
+			rest.RespondWithError(w, http.StatusInternalServerError, "Error loading")
+		}
+		return res, false
+	}
+	return res, true
+}
+
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/tenants"
+)
+
+func stockedProduct(t *testing.T, onHand int64) data.Product {
+	clearTable()
+	p := data.CreateProduct("stocked", 1)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+	if err := repositories.SetStock(a.DB, tenants.Default, p.GetID(), onHand); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func reserve(t *testing.T, p data.Product, payload string, expected int) data.Reservation {
+	req, _ := http.NewRequest("POST", "/product/"+p.GetID()+"/reservations",
+		bytes.NewBufferString(payload))
+	response := executeRequest(req)
+	checkResponseCode(t, expected, response.Code)
+
+	var res data.Reservation
+	json.Unmarshal(response.Body.Bytes(), &res)
+	return res
+}
+
+func checkInventory(t *testing.T, p data.Product, onHand, reserved int64) {
+	t.Helper()
+	i, err := repositories.GetInventory(a.DB, tenants.Default, p.GetID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.OnHand != onHand || i.Reserved != reserved {
+		t.Errorf("Expected %d on hand, %d reserved. Got %+v", onHand, reserved, i)
+	}
+}
+
+func TestSetInventory(t *testing.T) {
+	p := stockedProduct(t, 0)
+
+	req, _ := http.NewRequest("PUT", "/product/"+p.GetID()+"/inventory",
+		bytes.NewBufferString(`{"on_hand":7}`))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	if body := response.Body.String(); !bytes.Contains([]byte(body), []byte(`"available":7`)) {
+		t.Errorf("Expected 7 available. Got %s", body)
+	}
+
+	req, _ = http.NewRequest("PUT", "/product/"+p.GetID()+"/inventory",
+		bytes.NewBufferString(`{"on_hand":-1}`))
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req).Code)
+}
+
+func TestReserveMoreThanAvailableConflicts(t *testing.T) {
+	p := stockedProduct(t, 3)
+
+	reserve(t, p, `{"quantity":2}`, http.StatusCreated)
+	reserve(t, p, `{"quantity":2}`, http.StatusConflict)
+	reserve(t, p, `{"quantity":0}`, http.StatusBadRequest)
+	checkInventory(t, p, 3, 2)
+
+	req, _ := http.NewRequest("PUT", "/product/"+p.GetID()+"/inventory",
+		bytes.NewBufferString(`{"on_hand":1}`))
+	checkResponseCode(t, http.StatusConflict, executeRequest(req).Code)
+}
+
+func TestCommitAndReleaseReservations(t *testing.T) {
+	p := stockedProduct(t, 5)
+	base := "/product/" + p.GetID() + "/reservations/"
+
+	sold := reserve(t, p, `{"quantity":2}`, http.StatusCreated)
+	returned := reserve(t, p, `{"quantity":1}`, http.StatusCreated)
+	checkInventory(t, p, 5, 3)
+
+	req, _ := http.NewRequest("POST", base+sold.ID+"/commit", nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	checkInventory(t, p, 3, 1)
+
+	req, _ = http.NewRequest("POST", base+returned.ID+"/release", nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	checkInventory(t, p, 3, 0)
+
+	req, _ = http.NewRequest("POST", base+sold.ID+"/release", nil)
+	checkResponseCode(t, http.StatusConflict, executeRequest(req).Code)
+	checkInventory(t, p, 3, 0)
+
+	other := data.CreateProduct("other", 1)
+	repositories.CreateProduct(a.DB, tenants.Default, other)
+	req, _ = http.NewRequest("GET", "/product/"+other.GetID()+"/reservations/"+sold.ID, nil)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+}
+
+func TestExpiredReservationsReturnStock(t *testing.T) {
+	p := stockedProduct(t, 4)
+
+	res, err := repositories.Reserve(a.DB, tenants.Default, p.GetID(), 3, time.Minute, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("POST", "/product/"+p.GetID()+"/reservations/"+res.ID+"/commit", nil)
+	checkResponseCode(t, http.StatusConflict, executeRequest(req).Code)
+
+	n, err := repositories.ExpireReservations(a.DB, time.Now())
+	if err != nil || n != 1 {
+		t.Fatalf("Expected 1 expiry. Got %d (%v)", n, err)
+	}
+	checkInventory(t, p, 4, 0)
+	if res, _ := repositories.GetReservation(a.DB, tenants.Default, res.ID); res.Status != data.ReservationExpired {
+		t.Errorf("Expected expired. Got %s", res.Status)
+	}
+}
+
+func TestConcurrentReservationsNeverOversell(t *testing.T) {
+	db, err := repositories.Open("sqlite3",
+		filepath.Join(t.TempDir(), "inventory.db")+"?_busy_timeout=10000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := repositories.MigrateUp(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	p := data.CreateProduct("scarce", 1)
+	repositories.CreateProduct(db, tenants.Default, p)
+	repositories.SetStock(db, tenants.Default, p.GetID(), 5)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved, failed := 0, 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repositories.Reserve(db, tenants.Default, p.GetID(), 1, time.Minute, time.Now())
+			mu.Lock()
+			defer mu.Unlock()
+			switch err {
+			case nil:
+				reserved++
+			case repositories.ErrInsufficientStock:
+				failed++
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if reserved != 5 || failed != 15 {
+		t.Errorf("Expected 5 reserved and 15 refused. Got %d and %d", reserved, failed)
+	}
+	if i, _ := repositories.GetInventory(db, tenants.Default, p.GetID()); i.Reserved != 5 {
+		t.Errorf("Expected 5 reserved. Got %+v", i)
+	}
+}
+
+func TestSettingStockRacingADeleteLeavesNoStock(t *testing.T) {
+	db, err := repositories.Open("sqlite3",
+		filepath.Join(t.TempDir(), "inventory.db")+"?_busy_timeout=10000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := repositories.MigrateUp(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	p := data.CreateProduct("discontinued", 1)
+	repositories.CreateProduct(db, tenants.Default, p)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i == 10 {
+				if err := db.WithTx(context.Background(), func(tx *repositories.Tx) error {
+					_, err := repositories.DeleteProduct(tx, tenants.Default, p.GetID())
+					return err
+				}); err != nil {
+					t.Error(err)
+				}
+				return
+			}
+			if err := repositories.SetStock(db, tenants.Default, p.GetID(), int64(i)); err != nil && err != sql.ErrNoRows {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if i, _ := repositories.GetInventory(db, tenants.Default, p.GetID()); i.OnHand != 0 {
+		t.Errorf("Expected no stock left for the deleted product. Got %+v", i)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/text/language"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/rest"
+	"github.com/Lewiscowles1986/go-gorilla-api/settings"
+)
+
+// defaultLocale reads APP_DEFAULT_LOCALE, the locale products' own names
+// are written in
+func defaultLocale() (language.Tag, error) {
+	return parseLocale(settings.Getenv("APP_DEFAULT_LOCALE", "en"))
+}
+
+// parseLocale - The canonical form of a BCP 47 tag, so "en-gb" and "en-GB"
+// name the same translation
+func parseLocale(raw string) (language.Tag, error) {
+	tag, err := language.Parse(raw)
+	if err != nil || tag == language.Und {
+		return language.Und, errUnknownLocale
+	}
+	return tag, nil
+}
+
+var errUnknownLocale = errors.New("Locale must be a BCP 47 language tag such as fr or en-GB")
+
+// requestedLocales - The locales r would be answered in, best first: the one
+// ?locale= names, or else those Accept-Language lists. A malformed
+// Accept-Language asks for nothing in particular.
+func requestedLocales(r *http.Request) ([]language.Tag, error) {
+	if raw := r.URL.Query().Get("locale"); raw != "" {
+		tag, err := parseLocale(raw)
+		if err != nil {
+			return nil, err
+		}
+		return []language.Tag{tag}, nil
+	}
+	tags, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if err != nil {
+		return nil, nil
+	}
+	return tags, nil
+}
+
+// requestedLocalesOrRespond is requestedLocales, answering the client itself
+// when ?locale= is not a locale
+func requestedLocalesOrRespond(w http.ResponseWriter, r *http.Request) ([]language.Tag, bool) {
+	prefs, err := requestedLocales(r)
+	if err != nil {
+		rest.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return prefs, true
+}
+
+// bestTranslation picks, out of the default locale and those translations
+// are in, the one prefs suit best. language.Matcher falls back from a
+// regional locale to its language, and on through the preferences in
+// order, ending at the default; the translation is nil for the default.
+func (a *App) bestTranslation(prefs []language.Tag, translations []data.Translation) (string, *data.Translation) {
+	supported := []language.Tag{a.DefaultLocale}
+	for _, t := range translations {
+		supported = append(supported, language.Make(t.Locale))
+	}
+	_, i, _ := language.NewMatcher(supported).Match(prefs...)
+	served := supported[i].String()
+	for _, t := range translations {
+		if t.Locale == served {
+			return served, &t
+		}
+	}
+	return served, nil
+}
+
+// localizeProducts puts each product's entry in the locale that suits prefs
+// best, returning the locales served
+func (a *App) localizeProducts(r *http.Request, prefs []language.Tag, entries []rest.Entry, productIDs []string) ([]string, error) {
+	translations, err := repositories.GetProductTranslations(a.reader(r), tenantOf(r), productIDs...)
+	if err != nil {
+		return nil, err
+	}
+	served := []string{}
+	for i, id := range productIDs {
+		locale, t := a.bestTranslation(prefs, translations[id])
+		if !slices.Contains(served, locale) {
+			served = append(served, locale)
+		}
+		if t == nil {
+			continue
+		}
+		switch p := entries[i].Object.(type) {
+		case data.Product:
+			entries[i].Object = data.Localize(p, *t)
+		case data.PartialProduct:
+			if _, ok := p.Fields["name"]; ok {
+				p.Fields = maps.Clone(p.Fields)
+				p.Fields["name"] = t.Name
+				entries[i].Object = p
+			}
+		}
+	}
+	return served, nil
+}
+
+// setContentLanguage names the locales a response is in. It varies with
+// Accept-Language whether or not anything was translated.
+func setContentLanguage(w http.ResponseWriter, locales []string) {
+	w.Header().Add("Vary", "Accept-Language")
+	if len(locales) > 0 {
+		w.Header().Set("Content-Language", strings.Join(locales, ", "))
+	}
+}
+
+func (a *App) getTranslations(w http.ResponseWriter, r *http.Request) {
+	p, ok := a.loadProduct(w, r)
+	if !ok {
+		return
+	}
+	translations, err := repositories.GetProductTranslations(a.db(r), tenantOf(r), p.GetID())
+	if err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	count, page := getPagingFromRequest(r)
+	all := translations[p.GetID()]
+	start := min(uint64(len(all)), (page-1)*uint64(count))
+	end := min(uint64(len(all)), start+uint64(count))
+
+	entries := []rest.Entry{}
+	for _, t := range all[start:end] {
+		entries = append(entries, rest.TranslationToEntry(a.linker(r), t))
+	}
+	l := rest.ListingJSONResponse(a.linker(r).Href(rest.RouteProductTranslations, "id", p.GetID()), page,
+		uint64(len(all)), count, entries)
+	rest.RespondWithListing(w, r, http.StatusOK, l)
+}
+
+// routeLocale - The canonical locale the route names, answering the client
+// itself when it is not one
+func routeLocale(w http.ResponseWriter, r *http.Request) (string, bool) {
+	tag, err := parseLocale(mux.Vars(r)["locale"])
+	if err != nil {
+		rest.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+	return tag.String(), true
+}
+
+func (a *App) getTranslation(w http.ResponseWriter, r *http.Request) {
+	locale, ok := routeLocale(w, r)
+	if !ok {
+		return
+	}
+	productID := data.ParseUUID(mux.Vars(r)["id"]).String()
+
+	t, err := repositories.GetTranslation(a.db(r), tenantOf(r), productID, locale)
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		rest.RespondWithError(w, http.StatusNotFound, "Translation not found")
+		return
+	default:
+		rest.RespondWithError(w, http.StatusInternalServerError, "Error loading")
+		return
+	}
+	rest.RespondWithObject(w, r, http.StatusOK, rest.TranslationToEntry(a.linker(r), t))
+}
+
+// setTranslation - PUT /product/{id}/translations/{locale}, creating or
+// replacing the product's name and description in that locale
+func (a *App) setTranslation(w http.ResponseWriter, r *http.Request) {
+	p, ok := a.loadProduct(w, r)
+	if !ok {
+		return
+	}
+	locale, ok := routeLocale(w, r)
+	if !ok {
+		return
+	}
+	var payload struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	if !a.Body.DecodeJSON(w, r, &payload) {
+		return
+	}
+	t := data.Translation{ProductID: p.GetID(), Locale: locale, Name: payload.Name, Description: payload.Description}
+	if err := data.ValidateTranslation(t); err != nil {
+		rest.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := repositories.SetTranslation(a.db(r), tenantOf(r), t); err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	rest.RespondWithObject(w, r, http.StatusOK, rest.TranslationToEntry(a.linker(r), t))
+}
+
+func (a *App) deleteTranslation(w http.ResponseWriter, r *http.Request) {
+	locale, ok := routeLocale(w, r)
+	if !ok {
+		return
+	}
+	productID := data.ParseUUID(mux.Vars(r)["id"]).String()
+
+	switch err := repositories.DeleteTranslation(a.db(r), tenantOf(r), productID, locale); err {
+	case nil:
+	case sql.ErrNoRows:
+		rest.RespondWithError(w, http.StatusNotFound, "Translation not found")
+		return
+	default:
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	rest.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/rest"
+	"github.com/Lewiscowles1986/go-gorilla-api/tenants"
+)
+
+func translate(t *testing.T, productID, locale, body string) {
+	t.Helper()
+	req, _ := http.NewRequest("PUT", "/product/"+productID+"/translations/"+locale, bytes.NewBufferString(body))
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+}
+
+func TestProductServedInBestLocale(t *testing.T) {
+	clearTable()
+	p := data.CreateProduct("Jumper", 30)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+	translate(t, p.GetID(), "fr", `{"name":"Pull","description":"Un pull en laine"}`)
+	translate(t, p.GetID(), "de", `{"name":"Pullover"}`)
+
+	for _, c := range []struct {
+		query, acceptLanguage, locale, name string
+	}{
+		{"", "fr-CA, en;q=0.5", "fr", "Pull"},
+		{"", "ja, de;q=0.8, fr;q=0.5", "de", "Pullover"},
+		{"", "ja", "en", "Jumper"},
+		{"", "", "en", "Jumper"},
+		{"?locale=de-AT", "fr", "de", "Pullover"},
+		{"?locale=pt", "fr", "en", "Jumper"},
+	} {
+		req, _ := http.NewRequest("GET", "/product/"+p.GetID()+c.query, nil)
+		req.Header.Set("Accept-Language", c.acceptLanguage)
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		var m map[string]interface{}
+		json.Unmarshal(response.Body.Bytes(), &m)
+		if m["name"] != c.name || m["price"] != 30.0 || response.Header().Get("Content-Language") != c.locale {
+			t.Errorf("%s %q: expected %s in %s. Got %v in %s", c.query, c.acceptLanguage, c.name, c.locale,
+				m, response.Header().Get("Content-Language"))
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/product/"+p.GetID()+"?locale=fr", nil)
+	response := executeRequest(req)
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if m["description"] != "Un pull en laine" || m["id"] != p.GetID() {
+		t.Errorf("Expected the translated description. Got %v", m)
+	}
+	if vary := response.Header().Values("Vary"); !slices.Contains(vary, "Accept-Language") {
+		t.Errorf("Expected to vary by Accept-Language. Got %v", vary)
+	}
+
+	req, _ = http.NewRequest("GET", "/product/"+p.GetID()+"?locale=!", nil)
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req).Code)
+}
+
+func TestProductListingNamesEveryLocaleServed(t *testing.T) {
+	clearTable()
+	jumper := data.CreateProduct("Jumper", 30)
+	scarf := data.CreateProduct("Scarf", 12)
+	repositories.CreateProduct(a.DB, tenants.Default, jumper)
+	repositories.CreateProduct(a.DB, tenants.Default, scarf)
+	translate(t, jumper.GetID(), "fr", `{"name":"Pull"}`)
+
+	for _, query := range []string{"", "?fields=name"} {
+		req, _ := http.NewRequest("GET", "/products"+query, nil)
+		req.Header.Set("Accept-Language", "fr-FR")
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		var l struct {
+			Data []struct{ Object struct{ Name string } }
+		}
+		json.Unmarshal(response.Body.Bytes(), &l)
+		names := map[string]bool{}
+		for _, e := range l.Data {
+			names[e.Object.Name] = true
+		}
+		if !names["Pull"] || !names["Scarf"] {
+			t.Errorf("%s: expected Pull and Scarf. Got %v", query, names)
+		}
+		if served := response.Header().Get("Content-Language"); served != "fr, en" && served != "en, fr" {
+			t.Errorf("%s: expected fr and en served. Got %q", query, served)
+		}
+	}
+}
+
+func TestProductListingLinksKeepLocale(t *testing.T) {
+	clearTable()
+	for i := 0; i < 3; i++ {
+		repositories.CreateProduct(a.DB, tenants.Default, data.CreateProduct("Jumper", 30))
+	}
+
+	req, _ := http.NewRequest("GET", "/products?locale=fr&count=1&page=2", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var l rest.Listing
+	json.Unmarshal(response.Body.Bytes(), &l)
+	next := ""
+	for _, link := range l.Links {
+		if link.Rel == "next" {
+			next = link.Href
+		}
+	}
+	if next != "/products?locale=fr&page=3&count=1" {
+		t.Errorf("Expected the next link to keep the locale. Got %q", next)
+	}
+}
+
+func TestManagingTranslations(t *testing.T) {
+	clearTable()
+	p := data.CreateProduct("Jumper", 30)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+	base := "/product/" + p.GetID() + "/translations"
+
+	translate(t, p.GetID(), "EN-gb", `{"name":"Jumper","description":"A woolly jumper"}`)
+	translate(t, p.GetID(), "en-GB", `{"name":"Jumper","description":"A woollen jumper"}`)
+	translate(t, p.GetID(), "fr", `{"name":"Pull"}`)
+
+	req, _ := http.NewRequest("GET", base, nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var l struct {
+		Total int
+		Data  []struct{ Object data.Translation }
+	}
+	json.Unmarshal(response.Body.Bytes(), &l)
+	if l.Total != 2 || l.Data[0].Object.Locale != "en-GB" || l.Data[0].Object.Description != "A woollen jumper" {
+		t.Errorf("Expected en-GB replaced, and fr. Got %+v", l)
+	}
+
+	for _, c := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{"PUT", base + "/de", `{"name":" "}`, http.StatusBadRequest},
+		{"PUT", base + "/x-1234567890", `{"name":"Pull"}`, http.StatusBadRequest},
+		{"PUT", "/product/11111111-1111-4111-8111-111111111111/translations/fr", `{"name":"Pull"}`,
+			http.StatusNotFound},
+		{"GET", base + "/de", "", http.StatusNotFound},
+		{"GET", base + "/en-gb", "", http.StatusOK},
+		{"DELETE", base + "/fr", "", http.StatusOK},
+		{"DELETE", base + "/fr", "", http.StatusNotFound},
+	} {
+		req, _ := http.NewRequest(c.method, c.path, bytes.NewBufferString(c.body))
+		if response := executeRequest(req); response.Code != c.status {
+			t.Errorf("%s %s: expected %d. Got %d %s", c.method, c.path, c.status, response.Code, response.Body)
+		}
+	}
+
+	req, _ = http.NewRequest("DELETE", "/product/"+p.GetID(), nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	if translations, _ := repositories.GetProductTranslations(a.DB, tenants.Default, p.GetID()); len(translations) != 0 {
+		t.Errorf("Expected the translations removed with the product. Got %v", translations)
+	}
+}
@@ -0,0 +1,422 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/rest"
+)
+
+const (
+	encodingGzip     = "gzip"
+	encodingDeflate  = "deflate"
+	encodingZstd     = "zstd"
+	encodingIdentity = "identity"
+)
+
+// CompressionConfig - Tunables for response and request body compression
+type CompressionConfig struct {
+	// MinSize is the smallest response body, in bytes, worth compressing.
+	MinSize int
+	// ContentTypes lists media types eligible for compression. Entries
+	// ending in "/" match a whole family, e.g. "text/".
+	ContentTypes []string
+	// ExcludedPaths lists path prefixes that are never touched.
+	ExcludedPaths []string
+	// MaxRequestBody caps the decompressed size of request bodies.
+	MaxRequestBody int64
+}
+
+// DefaultCompressionConfig - Sensible defaults for JSON APIs
+func DefaultCompressionConfig() CompressionConfig {
+	return CompressionConfig{
+		MinSize: 1024,
+		ContentTypes: []string{
+			"application/json",
+			"application/hal+json",
+			"application/vnd.api+json",
+			"application/xml",
+			"text/csv",
+			"text/plain",
+			"text/html",
+		},
+		ExcludedPaths:  []string{"/debug/pprof"},
+		MaxRequestBody: 32 << 20,
+	}
+}
+
+// Compression - Negotiates Accept-Encoding for responses and decodes
+// Content-Encoding on request bodies
+func Compression(cfg CompressionConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cfg.isExcluded(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if err := decodeRequestBody(w, r, cfg.MaxRequestBody); err != nil {
+				status := http.StatusBadRequest
+				if errors.Is(err, errUnsupportedEncoding) {
+					status = http.StatusUnsupportedMediaType
+				}
+				rest.RespondWithError(w, status, err.Error())
+				return
+			}
+
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if r.Method == http.MethodHead {
+				encoding = ""
+			}
+
+			cw := &compressWriter{ResponseWriter: w, cfg: &cfg, encoding: encoding}
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+func (cfg *CompressionConfig) isExcluded(path string) bool {
+	for _, prefix := range cfg.ExcludedPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cfg *CompressionConfig) allowsContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range cfg.ContentTypes {
+		if strings.HasSuffix(allowed, "/") && strings.HasPrefix(mediaType, allowed) {
+			return true
+		}
+		if mediaType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+type acceptedEncoding struct {
+	name string
+	q    float64
+}
+
+// negotiateEncoding picks the best supported encoding from an
+// Accept-Encoding header, returning "" when identity should be used
+func negotiateEncoding(header string) string {
+	if header == "" {
+		return ""
+	}
+	preference := map[string]int{encodingZstd: 0, encodingGzip: 1, encodingDeflate: 2}
+	accepted := map[string]float64{}
+	wildcard := -1.0
+	for _, part := range strings.Split(header, ",") {
+		name, q := parseCoding(part)
+		if name == "" {
+			continue
+		}
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		accepted[name] = q
+	}
+
+	candidates := []acceptedEncoding{}
+	for name := range preference {
+		q, ok := accepted[name]
+		if !ok {
+			q = wildcard
+		}
+		if q > 0 {
+			candidates = append(candidates, acceptedEncoding{name: name, q: q})
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].q != candidates[j].q {
+			return candidates[i].q > candidates[j].q
+		}
+		return preference[candidates[i].name] < preference[candidates[j].name]
+	})
+	return candidates[0].name
+}
+
+func parseCoding(part string) (string, float64) {
+	fields := strings.Split(part, ";")
+	name := strings.ToLower(strings.TrimSpace(fields[0]))
+	q := 1.0
+	for _, param := range fields[1:] {
+		param = strings.TrimSpace(param)
+		if strings.HasPrefix(param, "q=") {
+			v, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+			if err != nil {
+				return "", 0
+			}
+			q = v
+		}
+	}
+	if name == "x-gzip" {
+		name = encodingGzip
+	}
+	return name, q
+}
+
+var (
+	gzipWriters = sync.Pool{New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	}}
+	// HTTP's deflate is the zlib format, not raw DEFLATE (RFC 9110 8.4.1.2)
+	zlibWriters = sync.Pool{New: func() interface{} {
+		return zlib.NewWriter(io.Discard)
+	}}
+	zstdWriters = sync.Pool{New: func() interface{} {
+		zw, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+		return zw
+	}}
+)
+
+type resettableWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+func acquireEncoder(encoding string, w io.Writer) resettableWriter {
+	switch encoding {
+	case encodingGzip:
+		gw := gzipWriters.Get().(*gzip.Writer)
+		gw.Reset(w)
+		return gw
+	case encodingDeflate:
+		zw := zlibWriters.Get().(*zlib.Writer)
+		zw.Reset(w)
+		return zw
+	case encodingZstd:
+		zw := zstdWriters.Get().(*zstd.Encoder)
+		zw.Reset(w)
+		return zw
+	}
+	return nil
+}
+
+func releaseEncoder(encoding string, enc resettableWriter) {
+	switch encoding {
+	case encodingGzip:
+		gzipWriters.Put(enc)
+	case encodingDeflate:
+		zlibWriters.Put(enc)
+	case encodingZstd:
+		zstdWriters.Put(enc)
+	}
+}
+
+// compressWriter buffers the start of a response until it knows whether
+// the body is large enough and of a suitable type to be worth compressing
+type compressWriter struct {
+	http.ResponseWriter
+	cfg      *CompressionConfig
+	encoding string
+
+	status  int
+	buf     []byte
+	decided bool
+	encoder resettableWriter
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if code < 200 {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.status != 0 {
+		return
+	}
+	cw.status = code
+	if code == http.StatusNoContent || code == http.StatusNotModified {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.cfg.MinSize {
+			return len(p), nil
+		}
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// decide commits to either a compressed or an identity response and
+// flushes anything buffered so far
+func (cw *compressWriter) decide(largeEnough bool) error {
+	if cw.decided {
+		return nil
+	}
+	cw.decided = true
+	h := cw.Header()
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	eligible := h.Get("Content-Encoding") == "" &&
+		cw.cfg.allowsContentType(h.Get("Content-Type"))
+	if eligible {
+		addVary(h, "Accept-Encoding")
+	}
+	if eligible && largeEnough && cw.encoding != "" {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		cw.encoder = acquireEncoder(cw.encoding, cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buffered := cw.buf
+	cw.buf = nil
+	if len(buffered) == 0 {
+		return nil
+	}
+	var err error
+	if cw.encoder != nil {
+		_, err = cw.encoder.Write(buffered)
+	} else {
+		_, err = cw.ResponseWriter.Write(buffered)
+	}
+	return err
+}
+
+// Flush - Streaming handlers get their bytes on the wire immediately
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide(len(cw.buf) >= cw.cfg.MinSize)
+	}
+	if cw.encoder != nil {
+		cw.encoder.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack - Allows protocol upgrades to bypass compression entirely
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("underlying ResponseWriter does not support hijacking")
+	}
+	cw.decided = true
+	return hj.Hijack()
+}
+
+// Unwrap - Exposes the original writer to http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		if cw.status == 0 && len(cw.buf) == 0 {
+			return nil
+		}
+		cw.decide(false)
+	}
+	if cw.encoder == nil {
+		return nil
+	}
+	err := cw.encoder.Close()
+	releaseEncoder(cw.encoding, cw.encoder)
+	cw.encoder = nil
+	return err
+}
+
+func addVary(h http.Header, value string) {
+	for _, existing := range h.Values("Vary") {
+		for _, v := range strings.Split(existing, ",") {
+			v = strings.TrimSpace(v)
+			if v == "*" || strings.EqualFold(v, value) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", value)
+}
+
+// errUnsupportedEncoding - A Content-Encoding there is no decoder for, as
+// opposed to a body its decoder refuses
+var errUnsupportedEncoding = errors.New("unsupported Content-Encoding")
+
+// decodeRequestBody transparently replaces a compressed request body with
+// a decompressing reader bounded by maxBytes
+func decodeRequestBody(w http.ResponseWriter, r *http.Request, maxBytes int64) error {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == encodingIdentity || r.Body == nil {
+		return nil
+	}
+
+	var decoded io.ReadCloser
+	switch encoding {
+	case encodingGzip, "x-gzip":
+		gr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return fmt.Errorf("invalid gzip request body")
+		}
+		decoded = gr
+	case encodingDeflate:
+		zr, err := zlib.NewReader(r.Body)
+		if err != nil {
+			return fmt.Errorf("invalid deflate request body")
+		}
+		decoded = zr
+	case encodingZstd:
+		zr, err := zstd.NewReader(r.Body)
+		if err != nil {
+			return fmt.Errorf("invalid zstd request body")
+		}
+		decoded = zr.IOReadCloser()
+	default:
+		return fmt.Errorf("%w %q", errUnsupportedEncoding, encoding)
+	}
+
+	if maxBytes > 0 {
+		decoded = http.MaxBytesReader(w, decoded, maxBytes)
+	}
+	r.Body = decoded
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+	return nil
+}
@@ -0,0 +1,327 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func jsonHandler(body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(body))
+	})
+}
+
+func serve(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	Compression(DefaultCompressionConfig())(handler).ServeHTTP(rr, req)
+	return rr
+}
+
+func largeBody() string {
+	return `{"data":"` + strings.Repeat("product ", 512) + `"}`
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := map[string]string{
+		"":                         "",
+		"gzip":                     "gzip",
+		"deflate":                  "deflate",
+		"gzip, deflate, br, zstd":  "zstd",
+		"gzip;q=1.0, zstd;q=0.5":   "gzip",
+		"zstd;q=0, gzip;q=0":       "",
+		"*":                        "zstd",
+		"*;q=0.1, deflate":         "deflate",
+		"identity":                 "",
+		"br":                       "",
+		"x-gzip":                   "gzip",
+		"gzip;q=garbage, deflate":  "deflate",
+		"GZIP":                     "gzip",
+		"zstd;q=0, *;q=0.5":        "gzip",
+		"deflate;q=0.9, gzip;q=.9": "gzip",
+	}
+	for header, expected := range cases {
+		if result := negotiateEncoding(header); result != expected {
+			t.Errorf("Accept-Encoding %q: expected %q got %q", header, expected, result)
+		}
+	}
+}
+
+func TestLargeJSONIsGzipped(t *testing.T) {
+	body := largeBody()
+	req := httptest.NewRequest("GET", "/products", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := serve(jsonHandler(body), req)
+
+	if rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip Content-Encoding. Got %q", rr.Header().Get("Content-Encoding"))
+	}
+	if rr.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Expected Vary: Accept-Encoding. Got %q", rr.Header().Get("Vary"))
+	}
+	gr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _ := io.ReadAll(gr)
+	if string(decoded) != body {
+		t.Errorf("Decoded body does not match original")
+	}
+}
+
+func TestLargeJSONIsZstdEncoded(t *testing.T) {
+	body := largeBody()
+	req := httptest.NewRequest("GET", "/products", nil)
+	req.Header.Set("Accept-Encoding", "gzip, zstd")
+	rr := serve(jsonHandler(body), req)
+
+	if rr.Header().Get("Content-Encoding") != "zstd" {
+		t.Fatalf("Expected zstd Content-Encoding. Got %q", rr.Header().Get("Content-Encoding"))
+	}
+	zr, err := zstd.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	decoded, _ := io.ReadAll(zr)
+	if string(decoded) != body {
+		t.Errorf("Decoded body does not match original")
+	}
+}
+
+func TestLargeJSONIsDeflated(t *testing.T) {
+	body := largeBody()
+	req := httptest.NewRequest("GET", "/products", nil)
+	req.Header.Set("Accept-Encoding", "deflate")
+	rr := serve(jsonHandler(body), req)
+
+	if rr.Header().Get("Content-Encoding") != "deflate" {
+		t.Fatalf("Expected deflate Content-Encoding. Got %q", rr.Header().Get("Content-Encoding"))
+	}
+	zr, err := zlib.NewReader(rr.Body)
+	if err != nil {
+		t.Fatalf("Expected a zlib stream. Got %v", err)
+	}
+	decoded, _ := io.ReadAll(zr)
+	if string(decoded) != body {
+		t.Errorf("Decoded body does not match original")
+	}
+}
+
+func TestSmallResponseIsNotCompressed(t *testing.T) {
+	req := httptest.NewRequest("GET", "/products", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := serve(jsonHandler(`{"ok":true}`), req)
+
+	if rr.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected no Content-Encoding. Got %q", rr.Header().Get("Content-Encoding"))
+	}
+	if rr.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Expected Vary: Accept-Encoding. Got %q", rr.Header().Get("Vary"))
+	}
+	if rr.Body.String() != `{"ok":true}` {
+		t.Errorf("Unexpected body %q", rr.Body.String())
+	}
+}
+
+func TestNoAcceptEncodingStillVaries(t *testing.T) {
+	rr := serve(jsonHandler(largeBody()), httptest.NewRequest("GET", "/products", nil))
+
+	if rr.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected no Content-Encoding. Got %q", rr.Header().Get("Content-Encoding"))
+	}
+	if rr.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Expected Vary: Accept-Encoding. Got %q", rr.Header().Get("Vary"))
+	}
+}
+
+func TestDisallowedContentTypeIsNotCompressed(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(bytes.Repeat([]byte{0}, 4096))
+	})
+	req := httptest.NewRequest("GET", "/image", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := serve(handler, req)
+
+	if rr.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected no Content-Encoding. Got %q", rr.Header().Get("Content-Encoding"))
+	}
+	if rr.Header().Get("Vary") != "" {
+		t.Errorf("Expected no Vary header. Got %q", rr.Header().Get("Vary"))
+	}
+	if rr.Body.Len() != 4096 {
+		t.Errorf("Expected 4096 bytes. Got %d", rr.Body.Len())
+	}
+}
+
+func TestExcludedPathIsUntouched(t *testing.T) {
+	req := httptest.NewRequest("GET", "/debug/pprof/heap", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := serve(jsonHandler(largeBody()), req)
+
+	if rr.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected no Content-Encoding. Got %q", rr.Header().Get("Content-Encoding"))
+	}
+	if rr.Header().Get("Vary") != "" {
+		t.Errorf("Expected no Vary header. Got %q", rr.Header().Get("Vary"))
+	}
+}
+
+func TestHandlerEncodedResponseIsNotRecompressed(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "br")
+		w.Write([]byte(largeBody()))
+	})
+	req := httptest.NewRequest("GET", "/products", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := serve(handler, req)
+
+	if rr.Header().Get("Content-Encoding") != "br" {
+		t.Errorf("Expected Content-Encoding to be left alone. Got %q", rr.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestStatusWithoutBodyIsPreserved(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	req := httptest.NewRequest("DELETE", "/product", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := serve(handler, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected %d. Got %d", http.StatusNoContent, rr.Code)
+	}
+	if rr.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected no Content-Encoding. Got %q", rr.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestFlushSendsSmallStreamingChunks(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+		if !w.(*compressWriter).decided {
+			t.Errorf("Expected Flush to commit the response")
+		}
+		w.Write([]byte("data: 2\n\n"))
+	})
+	req := httptest.NewRequest("GET", "/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := serve(handler, req)
+
+	if !rr.Flushed {
+		t.Errorf("Expected the underlying writer to be flushed")
+	}
+	if rr.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected no Content-Encoding. Got %q", rr.Header().Get("Content-Encoding"))
+	}
+	if rr.Body.String() != "data: 1\n\ndata: 2\n\n" {
+		t.Errorf("Unexpected body %q", rr.Body.String())
+	}
+}
+
+func echoHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(body)
+	})
+}
+
+func TestGzipRequestBodyIsDecoded(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write([]byte(`{"name":"compressed","price":1.5}`))
+	gw.Close()
+
+	req := httptest.NewRequest("POST", "/product", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	rr := serve(echoHandler(), req)
+
+	if rr.Body.String() != `{"name":"compressed","price":1.5}` {
+		t.Errorf("Unexpected body %q", rr.Body.String())
+	}
+}
+
+func TestZstdRequestBodyIsDecoded(t *testing.T) {
+	zw, _ := zstd.NewWriter(nil)
+	encoded := zw.EncodeAll([]byte(`{"name":"compressed","price":1.5}`), nil)
+
+	req := httptest.NewRequest("POST", "/product", bytes.NewReader(encoded))
+	req.Header.Set("Content-Encoding", "zstd")
+	rr := serve(echoHandler(), req)
+
+	if rr.Body.String() != `{"name":"compressed","price":1.5}` {
+		t.Errorf("Unexpected body %q", rr.Body.String())
+	}
+}
+
+func TestDeflateRequestBodyIsDecoded(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte(`{"name":"compressed","price":1.5}`))
+	zw.Close()
+
+	req := httptest.NewRequest("POST", "/product", &buf)
+	req.Header.Set("Content-Encoding", "deflate")
+	rr := serve(echoHandler(), req)
+
+	if rr.Body.String() != `{"name":"compressed","price":1.5}` {
+		t.Errorf("Unexpected body %q", rr.Body.String())
+	}
+}
+
+func TestUnsupportedRequestEncodingIsRejected(t *testing.T) {
+	req := httptest.NewRequest("POST", "/product", strings.NewReader("???"))
+	req.Header.Set("Content-Encoding", "br")
+	rr := serve(echoHandler(), req)
+
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected %d. Got %d", http.StatusUnsupportedMediaType, rr.Code)
+	}
+}
+
+func TestCorruptRequestBodyIsBadRequest(t *testing.T) {
+	req := httptest.NewRequest("POST", "/product", strings.NewReader("not gzip"))
+	req.Header.Set("Content-Encoding", "gzip")
+	rr := serve(echoHandler(), req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected %d. Got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestDecompressedRequestBodyIsBounded(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write(bytes.Repeat([]byte("a"), 4096))
+	gw.Close()
+
+	cfg := DefaultCompressionConfig()
+	cfg.MaxRequestBody = 1024
+	req := httptest.NewRequest("POST", "/product", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	Compression(cfg)(echoHandler()).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected %d. Got %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+}
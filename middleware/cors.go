@@ -0,0 +1,220 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// CORSPolicy - Which cross-origin requests a route accepts
+type CORSPolicy struct {
+	// AllowedOrigins are origins such as https://admin.example.com; "*"
+	// allows any, and https://*.example.com any subdomain
+	AllowedOrigins []string
+	// AllowedMethods narrows the methods a route takes; empty allows all
+	// of them
+	AllowedMethods []string
+	// AllowedHeaders are the request headers a client may send; "*"
+	// allows any
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers a client may read, beyond
+	// the simple ones
+	ExposedHeaders []string
+	// AllowCredentials lets browsers send cookies and Authorization
+	AllowCredentials bool
+	// MaxAge is how long a browser may cache a preflight
+	MaxAge time.Duration
+}
+
+// CORS - Cross-origin access to the routes of Router. Policy decides it
+// route by route; a route without one gets no CORS headers.
+type CORS struct {
+	Router *mux.Router
+	Policy func(route *mux.Route) (CORSPolicy, bool)
+}
+
+// preflightMethods - The methods a preflight can ask about
+var preflightMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+}
+
+// Middleware - Adds CORS headers to the responses of matched routes, for
+// Router.Use
+func (c CORS) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		route := mux.CurrentRoute(r)
+		if origin == "" || route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if policy, ok := c.Policy(route); ok && policy.allowsOrigin(origin) &&
+			policy.allowsMethod(r.Method) {
+			policy.allow(w.Header(), origin)
+			if len(policy.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+			}
+		} else {
+			addVary(w.Header(), "Origin")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Preflight - Answers preflights for every route, with the methods that
+// route takes. No route takes OPTIONS, so mux treats a preflight as a
+// method it does not allow: install this as Router.MethodNotAllowedHandler,
+// or wrap Router in it to answer preflights before any route is matched.
+// Anything else is passed to otherwise, or answered 405 when it is nil.
+func (c CORS) Preflight(otherwise http.Handler) http.Handler {
+	if otherwise == nil {
+		otherwise = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		})
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		requested := r.Header.Get("Access-Control-Request-Method")
+		if r.Method != http.MethodOptions || origin == "" || requested == "" {
+			otherwise.ServeHTTP(w, r)
+			return
+		}
+		route, methods := c.routeMethods(r)
+		if route == nil {
+			otherwise.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		addVary(h, "Origin")
+		addVary(h, "Access-Control-Request-Method")
+		addVary(h, "Access-Control-Request-Headers")
+		policy, ok := c.Policy(route)
+		if !ok || !policy.allowsOrigin(origin) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		allowed := []string{}
+		for _, m := range methods {
+			if policy.allowsMethod(m) {
+				allowed = append(allowed, m)
+			}
+		}
+		policy.allow(h, origin)
+		h.Set("Access-Control-Allow-Methods", strings.Join(allowed, ", "))
+		if headers := policy.allowedHeaders(r.Header.Get("Access-Control-Request-Headers")); headers != "" {
+			h.Set("Access-Control-Allow-Headers", headers)
+		}
+		if policy.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge/time.Second)))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+type probeKey struct{}
+
+// Probing - Whether r is one of the requests a preflight matches against
+// Router to learn a route's methods, which no handler serves. Matchers that
+// need headers a preflight cannot carry, such as a tenant's, should pass it.
+func Probing(r *http.Request) bool {
+	probing, _ := r.Context().Value(probeKey{}).(bool)
+	return probing
+}
+
+// routeMethods finds the route r's path leads to, and the methods it
+// takes, by matching the path once for each method
+func (c CORS) routeMethods(r *http.Request) (*mux.Route, []string) {
+	var route *mux.Route
+	methods := []string{}
+	ctx := context.WithValue(r.Context(), probeKey{}, true)
+	for _, method := range preflightMethods {
+		probe := r.Clone(ctx)
+		probe.Method = method
+		match := mux.RouteMatch{}
+		if c.Router.Match(probe, &match) && match.MatchErr == nil && match.Route != nil {
+			if route == nil {
+				route = match.Route
+			}
+			methods = append(methods, method)
+		}
+	}
+	return route, methods
+}
+
+// allow sets the headers every response to an allowed origin carries. "*"
+// cannot be combined with credentials, so the origin is echoed back then.
+func (p CORSPolicy) allow(h http.Header, origin string) {
+	addVary(h, "Origin")
+	if p.allowsAnyOrigin() && !p.AllowCredentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (p CORSPolicy) allowsAnyOrigin() bool {
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (p CORSPolicy) allowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range p.AllowedOrigins {
+		allowed = strings.ToLower(allowed)
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		// https://*.example.com: any one or more labels in place of the *
+		if i := strings.Index(allowed, "*."); i >= 0 {
+			prefix, suffix := allowed[:i], allowed[i+1:]
+			if strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+				labels := origin[len(prefix) : len(origin)-len(suffix)]
+				if labels != "" && !strings.ContainsAny(labels, "/:") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (p CORSPolicy) allowsMethod(method string) bool {
+	if len(p.AllowedMethods) == 0 {
+		return true
+	}
+	for _, allowed := range p.AllowedMethods {
+		if strings.EqualFold(allowed, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedHeaders - Those of the requested headers the policy allows
+func (p CORSPolicy) allowedHeaders(requested string) string {
+	allowed := []string{}
+	for _, header := range strings.Split(requested, ",") {
+		if header = strings.TrimSpace(header); header == "" {
+			continue
+		}
+		for _, a := range p.AllowedHeaders {
+			if a == "*" || strings.EqualFold(a, header) {
+				allowed = append(allowed, header)
+				break
+			}
+		}
+	}
+	return strings.Join(allowed, ", ")
+}
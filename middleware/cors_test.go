@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func corsRouter(policy CORSPolicy) *mux.Router {
+	router := mux.NewRouter()
+	ok := jsonHandler(`{}`)
+	router.Handle("/items", ok).Methods("GET", "POST")
+	router.Handle("/items/{id}", ok).Methods("GET", "PUT", "DELETE")
+	router.Handle("/private", ok).Methods("GET").Name("private")
+	cors := CORS{Router: router, Policy: func(route *mux.Route) (CORSPolicy, bool) {
+		return policy, route.GetName() != "private"
+	}}
+	router.MethodNotAllowedHandler = cors.Preflight(nil)
+	router.Use(cors.Middleware)
+	return router
+}
+
+func preflight(router *mux.Router, path, origin, method, headers string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("OPTIONS", path, nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		req.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAllowsOrigin(t *testing.T) {
+	policy := CORSPolicy{AllowedOrigins: []string{"https://shop.example.com", "https://*.example.org"}}
+	cases := map[string]bool{
+		"https://shop.example.com":       true,
+		"https://SHOP.example.com":       true,
+		"http://shop.example.com":        false,
+		"https://evil.com":               false,
+		"https://admin.example.org":      true,
+		"https://a.b.example.org":        true,
+		"https://example.org":            false,
+		"https://evil.com/.example.org":  false,
+		"https://admin.example.org:8443": false,
+		"https://admin.example.org.evil": false,
+	}
+	for origin, expected := range cases {
+		if result := policy.allowsOrigin(origin); result != expected {
+			t.Errorf("%s: expected %v got %v", origin, expected, result)
+		}
+	}
+	if !(CORSPolicy{AllowedOrigins: []string{"*"}}).allowsOrigin("https://anywhere.test") {
+		t.Error("Expected * to allow any origin")
+	}
+}
+
+func TestPreflightListsRouteMethods(t *testing.T) {
+	router := corsRouter(CORSPolicy{
+		AllowedOrigins: []string{"https://*.example.com"},
+		AllowedHeaders: []string{"Content-Type"},
+		MaxAge:         10 * time.Minute,
+	})
+	rr := preflight(router, "/items/42", "https://shop.example.com", "PUT", "content-type, x-secret")
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected %d. Got %d", http.StatusNoContent, rr.Code)
+	}
+	for header, expected := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://shop.example.com",
+		"Access-Control-Allow-Methods":     "GET, PUT, DELETE",
+		"Access-Control-Allow-Headers":     "content-type",
+		"Access-Control-Max-Age":           "600",
+		"Access-Control-Allow-Credentials": "",
+	} {
+		if result := rr.Header().Get(header); result != expected {
+			t.Errorf("%s: expected %q got %q", header, expected, result)
+		}
+	}
+	if vary := rr.Header().Values("Vary"); len(vary) != 3 || vary[0] != "Origin" {
+		t.Errorf("Expected Vary on the origin and requested method and headers. Got %v", vary)
+	}
+}
+
+func TestPreflightRefusals(t *testing.T) {
+	router := corsRouter(CORSPolicy{AllowedOrigins: []string{"https://shop.example.com"}})
+	for _, c := range []struct {
+		name, path, origin string
+		status             int
+	}{
+		{"unknown origin", "/items", "https://evil.com", http.StatusForbidden},
+		{"route without a policy", "/private", "https://shop.example.com", http.StatusForbidden},
+		{"unknown path", "/nowhere", "https://shop.example.com", http.StatusNotFound},
+	} {
+		rr := preflight(router, c.path, c.origin, "GET", "")
+		if rr.Code != c.status || rr.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s: Expected a bare %d. Got %d %v", c.name, c.status, rr.Code, rr.Header())
+		}
+	}
+
+	req := httptest.NewRequest("PATCH", "/items", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected other unmatched methods to stay %d. Got %d", http.StatusMethodNotAllowed, rr.Code)
+	}
+}
+
+func TestCORSResponseHeaders(t *testing.T) {
+	for _, c := range []struct {
+		name        string
+		policy      CORSPolicy
+		origin      string
+		credentials string
+	}{
+		{"wildcard", CORSPolicy{AllowedOrigins: []string{"*"}}, "*", ""},
+		{"wildcard with credentials", CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+			"https://shop.example.com", "true"},
+		{"refused method", CORSPolicy{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"POST"}}, "", ""},
+	} {
+		router := corsRouter(c.policy)
+		req := httptest.NewRequest("GET", "/items", nil)
+		req.Header.Set("Origin", "https://shop.example.com")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK ||
+			rr.Header().Get("Access-Control-Allow-Origin") != c.origin ||
+			rr.Header().Get("Access-Control-Allow-Credentials") != c.credentials ||
+			rr.Header().Get("Vary") != "Origin" {
+			t.Errorf("%s: Expected origin %q, credentials %q. Got %d %v",
+				c.name, c.origin, c.credentials, rr.Code, rr.Header())
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/outbox"
+	"github.com/Lewiscowles1986/go-gorilla-api/settings"
+)
+
+func outboxConfig() outbox.Config {
+	c := outbox.DefaultConfig()
+	c.Retention = time.Duration(settings.GetenvInt("APP_OUTBOX_RETENTION_SECONDS",
+		int(c.Retention/time.Second))) * time.Second
+	return c
+}
+
+// outboxSinks - The sinks named in APP_OUTBOX_SINKS, a comma separated list
+// of log, file, http and nats
+func outboxSinks() ([]outbox.Sink, error) {
+	sinks := []outbox.Sink{}
+	for _, name := range splitList(settings.Getenv("APP_OUTBOX_SINKS", "")) {
+		switch name {
+		case "log":
+			sinks = append(sinks, outbox.Log{})
+		case "file":
+			sink, err := outbox.OpenFile(settings.Getenv("APP_OUTBOX_FILE", "events.jsonl"))
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		case "http":
+			url := settings.Getenv("APP_OUTBOX_HTTP_URL", "")
+			if url == "" {
+				return nil, errors.New("the http outbox sink needs APP_OUTBOX_HTTP_URL")
+			}
+			sinks = append(sinks, outbox.NewHTTP(url))
+		case "nats":
+			sinks = append(sinks, outbox.NewNATS(settings.Getenv("APP_OUTBOX_NATS_ADDR", "localhost:4222"),
+				settings.Getenv("APP_OUTBOX_NATS_SUBJECT", "catalog")))
+		default:
+			return nil, fmt.Errorf("unknown outbox sink %q", name)
+		}
+	}
+	return sinks, nil
+}
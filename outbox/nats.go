@@ -0,0 +1,140 @@
+package outbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/events"
+)
+
+// NATS - Publishes each event to a NATS server, or anything speaking its
+// text protocol, on Subject followed by the event type, such as
+// catalog.product.created. A PING after each PUB waits for the server to
+// have it. The connection is made on first use and again after any error.
+type NATS struct {
+	Addr    string
+	Subject string
+	// Timeout bounds connecting and each publish
+	Timeout time.Duration
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewNATS - A NATS sink for the server at addr, such as localhost:4222
+func NewNATS(addr, subject string) *NATS {
+	return &NATS{Addr: addr, Subject: subject, Timeout: 10 * time.Second}
+}
+
+func (s *NATS) Deliver(ctx context.Context, e events.Event) error {
+	payload, err := data.JSONMarshal(e)
+	if err != nil {
+		return err
+	}
+	payload = bytes.TrimSuffix(payload, []byte("\n"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.publish(ctx, s.Subject+"."+string(e.Type), payload); err != nil {
+		s.disconnect()
+		return err
+	}
+	return nil
+}
+
+func (s *NATS) publish(ctx context.Context, subject string, payload []byte) error {
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return err
+		}
+	}
+	s.conn.SetDeadline(s.deadline(ctx))
+	if _, err := fmt.Fprintf(s.conn, "PUB %s %d\r\n%s\r\nPING\r\n", subject, len(payload), payload); err != nil {
+		return err
+	}
+	return s.awaitPong()
+}
+
+// connect reads the server's INFO and introduces itself, waiting for the
+// server to confirm with a PONG
+func (s *NATS) connect(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: s.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	s.conn, s.reader = conn, bufio.NewReader(conn)
+	conn.SetDeadline(s.deadline(ctx))
+
+	line, err := s.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("nats %s: expected INFO, got %q", s.Addr, line)
+	}
+	hello, _ := json.Marshal(map[string]interface{}{
+		"verbose": false, "pedantic": false, "name": "go-gorilla-api outbox", "lang": "go",
+	})
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", hello); err != nil {
+		return err
+	}
+	return s.awaitPong()
+}
+
+// awaitPong reads until the server's PONG, answering its PINGs meanwhile
+func (s *NATS) awaitPong() error {
+	for {
+		line, err := s.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := s.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New("nats " + s.Addr + ": " + strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+func (s *NATS) readLine() (string, error) {
+	line, err := s.reader.ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+func (s *NATS) deadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(s.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+	return deadline
+}
+
+func (s *NATS) disconnect() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn, s.reader = nil, nil
+	}
+}
+
+func (s *NATS) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.disconnect()
+	return nil
+}
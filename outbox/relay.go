@@ -0,0 +1,146 @@
+// Package outbox - Publishes the events product changes leave in the outbox
+// table to sinks outside the process, at least once and in order for each
+// product
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/events"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/telemetry"
+)
+
+// Sink - Somewhere events are published. Deliver returns once the event is
+// safely handed over; an event may be delivered again after an error, or
+// after a crash before it was marked delivered.
+type Sink interface {
+	Deliver(ctx context.Context, e events.Event) error
+}
+
+// Config - How a Relay reads, retries and tidies the outbox
+type Config struct {
+	// Batch is the most events read at once
+	Batch int
+	// Backoff is the wait after a first failed delivery, doubling after
+	// each further failure up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retention is how long delivered events are kept before being purged
+	Retention time.Duration
+}
+
+// DefaultConfig - Retries from a second to five minutes apart, keeping
+// delivered events for an hour
+func DefaultConfig() Config {
+	return Config{
+		Batch:      100,
+		Backoff:    time.Second,
+		MaxBackoff: 5 * time.Minute,
+		Retention:  time.Hour,
+	}
+}
+
+// Relay - Moves events from the outbox to every sink
+type Relay struct {
+	db     *repositories.DB
+	config Config
+	sinks  []Sink
+}
+
+// NewRelay - A relay for db's outbox. With no sinks, events are marked
+// delivered and purged in time.
+func NewRelay(db *repositories.DB, c Config, sinks ...Sink) *Relay {
+	return &Relay{db: db, config: c, sinks: sinks}
+}
+
+// Run - Relays every interval until ctx is done, then closes the sinks that
+// need it
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	defer r.close()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			pass, span := telemetry.Start(ctx, "relay outbox")
+			if _, err := r.Pass(pass, now); err != nil {
+				telemetry.Printf(pass, "relaying outbox: %v", err)
+			}
+			span.End()
+		}
+	}
+}
+
+// Pass - Delivers the events due by at, following each with the next event
+// for its product until a round delivers nothing more, then purges old
+// deliveries. Returns how many events were delivered.
+func (r *Relay) Pass(ctx context.Context, at time.Time) (int, error) {
+	db := r.db.WithContext(ctx)
+	delivered := 0
+	for progress := true; progress && ctx.Err() == nil; {
+		due, err := repositories.DueEvents(db, at, r.config.Batch)
+		if err != nil {
+			return delivered, err
+		}
+		progress = false
+		for _, e := range due {
+			if err := r.deliver(ctx, e.Event); err != nil {
+				telemetry.Printf(ctx, "delivering event %d: %v", e.ID, err)
+				next := at.Add(r.backoff(e.Attempts))
+				if err := repositories.MarkEventFailed(db, e.ID, next, err.Error()); err != nil {
+					return delivered, err
+				}
+				continue
+			}
+			if err := repositories.MarkEventDelivered(db, e.ID, at); err != nil {
+				return delivered, err
+			}
+			delivered++
+			progress = true
+		}
+	}
+	_, err := repositories.PurgeDeliveredEvents(db, at.Add(-r.config.Retention))
+	return delivered, err
+}
+
+// deliver hands e to every sink, stopping at the first to fail. Those
+// before it will see e again on the retry.
+func (r *Relay) deliver(ctx context.Context, e events.Event) error {
+	for _, sink := range r.sinks {
+		if err := sink.Deliver(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backoff is the wait before retrying an event that has already failed
+// attempts times
+func (r *Relay) backoff(attempts int) time.Duration {
+	wait := r.config.Backoff
+	for i := 0; i < attempts && wait < r.config.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > r.config.MaxBackoff {
+		wait = r.config.MaxBackoff
+	}
+	return wait
+}
+
+func (r *Relay) close() {
+	var errs []error
+	for _, sink := range r.sinks {
+		if c, ok := sink.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		telemetry.Printf(context.Background(), "closing outbox sinks: %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/events"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+)
+
+const tenant = "default"
+
+func openDB(t *testing.T) *repositories.DB {
+	t.Helper()
+	db, err := repositories.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	if _, err := repositories.MigrateUp(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func enqueue(t *testing.T, db *repositories.DB, eventType events.Type, p data.Product) {
+	t.Helper()
+	if err := repositories.EnqueueEvent(db, tenant, eventType, p); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// recorder is a sink keeping what it is given, failing while fail says so
+type recorder struct {
+	mu        sync.Mutex
+	delivered []events.Event
+	fail      func(events.Event) bool
+}
+
+func (s *recorder) Deliver(ctx context.Context, e events.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil && s.fail(e) {
+		return errors.New("unavailable")
+	}
+	s.delivered = append(s.delivered, e)
+	return nil
+}
+
+func (s *recorder) types(productID string) []events.Type {
+	types := []events.Type{}
+	for _, e := range s.delivered {
+		if e.Product.GetID() == productID {
+			types = append(types, e.Type)
+		}
+	}
+	return types
+}
+
+func TestPassDeliversEachProductInOrder(t *testing.T) {
+	db := openDB(t)
+	one, two := data.CreateProduct("one", 1), data.CreateProduct("two", 2)
+	enqueue(t, db, events.ProductCreated, one)
+	enqueue(t, db, events.ProductCreated, two)
+	enqueue(t, db, events.ProductUpdated, one)
+	enqueue(t, db, events.ProductDeleted, one)
+
+	sink := &recorder{}
+	c := DefaultConfig()
+	c.Batch = 1
+	delivered, err := NewRelay(db, c, sink).Pass(context.Background(), time.Now())
+	if err != nil || delivered != 4 {
+		t.Fatalf("Expected 4 delivered. Got %d %v", delivered, err)
+	}
+	expected := []events.Type{events.ProductCreated, events.ProductUpdated, events.ProductDeleted}
+	if types := sink.types(one.GetID()); len(types) != 3 || types[0] != expected[0] ||
+		types[1] != expected[1] || types[2] != expected[2] {
+		t.Errorf("Expected %v. Got %v", expected, types)
+	}
+	for i, e := range sink.delivered[1:] {
+		if e.ID <= sink.delivered[i].ID {
+			t.Errorf("Expected events in outbox order. Got %d after %d", e.ID, sink.delivered[i].ID)
+		}
+	}
+}
+
+func TestFailedEventHoldsBackItsProductOnly(t *testing.T) {
+	db := openDB(t)
+	stuck, other := data.CreateProduct("stuck", 1), data.CreateProduct("other", 2)
+	enqueue(t, db, events.ProductCreated, stuck)
+	enqueue(t, db, events.ProductUpdated, stuck)
+	enqueue(t, db, events.ProductCreated, other)
+
+	failing := true
+	sink := &recorder{fail: func(e events.Event) bool {
+		return failing && e.Product.GetID() == stuck.GetID()
+	}}
+	relay := NewRelay(db, DefaultConfig(), sink)
+	at := time.Now()
+	if delivered, err := relay.Pass(context.Background(), at); err != nil || delivered != 1 {
+		t.Fatalf("Expected only the other product delivered. Got %d %v", delivered, err)
+	}
+	if len(sink.types(stuck.GetID())) != 0 {
+		t.Errorf("Expected the update held back behind the failed create")
+	}
+
+	failing = false
+	if delivered, _ := relay.Pass(context.Background(), at.Add(time.Second/2)); delivered != 0 {
+		t.Errorf("Expected no retry before the backoff. Got %d", delivered)
+	}
+	if delivered, err := relay.Pass(context.Background(), at.Add(time.Second)); err != nil || delivered != 2 {
+		t.Fatalf("Expected the retry and the update after it. Got %d %v", delivered, err)
+	}
+	if types := sink.types(stuck.GetID()); len(types) != 2 || types[0] != events.ProductCreated {
+		t.Errorf("Expected create then update. Got %v", types)
+	}
+}
+
+func TestBackoffDoublesUpToTheMaximum(t *testing.T) {
+	relay := NewRelay(nil, Config{Backoff: time.Second, MaxBackoff: 5 * time.Second})
+	cases := map[int]time.Duration{0: time.Second, 1: 2 * time.Second, 2: 4 * time.Second, 3: 5 * time.Second, 40: 5 * time.Second}
+	for attempts, expected := range cases {
+		if wait := relay.backoff(attempts); wait != expected {
+			t.Errorf("After %d failures expected %s. Got %s", attempts, expected, wait)
+		}
+	}
+}
+
+func TestDeliveredEventsArePurgedAfterRetention(t *testing.T) {
+	db := openDB(t)
+	enqueue(t, db, events.ProductCreated, data.CreateProduct("one", 1))
+
+	relay := NewRelay(db, DefaultConfig())
+	at := time.Now()
+	if delivered, err := relay.Pass(context.Background(), at); err != nil || delivered != 1 {
+		t.Fatalf("Expected delivery without sinks. Got %d %v", delivered, err)
+	}
+	count := func() (n int) {
+		db.QueryRow("SELECT COUNT(*) FROM outbox").Scan(&n)
+		return n
+	}
+	if count() != 1 {
+		t.Errorf("Expected the delivered event kept for a while")
+	}
+	relay.Pass(context.Background(), at.Add(time.Hour+time.Second))
+	if count() != 0 {
+		t.Errorf("Expected the delivered event purged")
+	}
+}
@@ -0,0 +1,104 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/events"
+)
+
+// Headers HTTP sends with each event, so a receiver can drop repeats
+const (
+	EventIDHeader   = "X-Event-Id"
+	EventTypeHeader = "X-Event-Type"
+)
+
+// Log - Writes a line per event to Logger, or the standard logger when nil
+type Log struct {
+	Logger *log.Logger
+}
+
+func (l Log) Deliver(ctx context.Context, e events.Event) error {
+	format, v := "event %d %s tenant=%s product=%s", []interface{}{e.ID, e.Type, e.TenantID, e.Product.GetID()}
+	if l.Logger == nil {
+		log.Printf(format, v...)
+	} else {
+		l.Logger.Printf(format, v...)
+	}
+	return nil
+}
+
+// File - Appends each event to a file as a line of JSON, synced before it
+// counts as delivered
+type File struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// OpenFile - A File sink appending to path, creating it when missing
+func OpenFile(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &File{f: f}, nil
+}
+
+func (s *File) Deliver(ctx context.Context, e events.Event) error {
+	line, err := data.JSONMarshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.f.Write(line); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+func (s *File) Close() error {
+	return s.f.Close()
+}
+
+// HTTP - POSTs each event as JSON to URL. Any 2xx answer delivers it.
+type HTTP struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewHTTP - An HTTP sink for url, giving up on a request after ten seconds
+func NewHTTP(url string) *HTTP {
+	return &HTTP{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *HTTP) Deliver(ctx context.Context, e events.Event) error {
+	body, err := data.JSONMarshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventIDHeader, strconv.FormatInt(e.ID, 10))
+	req.Header.Set(EventTypeHeader, string(e.Type))
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("%s answered %s", s.URL, res.Status)
+	}
+	return nil
+}
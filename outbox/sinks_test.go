@@ -0,0 +1,186 @@
+package outbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/events"
+)
+
+func event() events.Event {
+	return events.Event{ID: 7, Type: events.ProductUpdated, TenantID: tenant,
+		Product: data.CreateProduct("widget", 9.99), OccurredAt: time.Now().UTC()}
+}
+
+func TestLogSink(t *testing.T) {
+	var logged bytes.Buffer
+	e := event()
+	if err := (Log{Logger: log.New(&logged, "", 0)}).Deliver(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "event 7 product.updated tenant=default product=" + e.Product.GetID(); strings.TrimSpace(logged.String()) != expected {
+		t.Errorf("Expected %q. Got %q", expected, logged.String())
+	}
+}
+
+func TestFileSinkAppendsJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sink, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := event()
+	sink.Deliver(context.Background(), e)
+	sink.Deliver(context.Background(), e)
+	sink.Close()
+
+	written, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(written)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected a line per event. Got %q", written)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &decoded); err != nil || decoded["type"] != "product.updated" ||
+		decoded["product"].(map[string]interface{})["id"] != e.Product.GetID() {
+		t.Errorf("Expected the event as JSON. Got %s %v", lines[0], err)
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	status := http.StatusAccepted
+	var received *http.Request
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	sink := NewHTTP(receiver.URL)
+	if err := sink.Deliver(context.Background(), event()); err != nil {
+		t.Fatal(err)
+	}
+	if received.Method != "POST" || received.Header.Get(EventIDHeader) != "7" ||
+		received.Header.Get(EventTypeHeader) != "product.updated" || !bytes.Contains(body, []byte(`"tenant_id":"default"`)) {
+		t.Errorf("Unexpected delivery %s %v %s", received.Method, received.Header, body)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := sink.Deliver(context.Background(), event()); err == nil {
+		t.Error("Expected a 503 to fail the delivery")
+	}
+}
+
+// natsStandIn is enough of a NATS server to take publishes: it greets with
+// INFO, answers PINGs and keeps what is published. Refusing answers every
+// PUB with -ERR.
+type natsStandIn struct {
+	listener  net.Listener
+	published chan string
+	refusing  atomic.Bool
+}
+
+func startNATS(t *testing.T) *natsStandIn {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &natsStandIn{listener: listener, published: make(chan string, 10)}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *natsStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	conn.Write([]byte(`INFO {"server_id":"stand-in","max_payload":1048576}` + "\r\n"))
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case fields[0] == "PING":
+			conn.Write([]byte("PONG\r\n"))
+		case fields[0] == "PUB" && len(fields) == 3:
+			size, _ := strconv.Atoi(fields[2])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			if s.refusing.Load() {
+				conn.Write([]byte("-ERR 'Permissions Violation'\r\n"))
+				return
+			}
+			s.published <- fields[1] + " " + string(payload[:size])
+		}
+	}
+}
+
+func TestNATSSink(t *testing.T) {
+	broker := startNATS(t)
+	sink := NewNATS(broker.listener.Addr().String(), "catalog")
+	defer sink.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := sink.Deliver(context.Background(), event()); err != nil {
+			t.Fatal(err)
+		}
+		msg := <-broker.published
+		if !strings.HasPrefix(msg, "catalog.product.updated {") || !strings.Contains(msg, `"id":7`) {
+			t.Errorf("Unexpected publish %q", msg)
+		}
+	}
+}
+
+func TestNATSSinkReportsRefusalAndReconnects(t *testing.T) {
+	broker := startNATS(t)
+	broker.refusing.Store(true)
+	sink := NewNATS(broker.listener.Addr().String(), "catalog")
+	defer sink.Close()
+
+	if err := sink.Deliver(context.Background(), event()); err == nil || !strings.Contains(err.Error(), "Permissions Violation") {
+		t.Errorf("Expected the refusal reported. Got %v", err)
+	}
+	broker.refusing.Store(false)
+	if err := sink.Deliver(context.Background(), event()); err != nil {
+		t.Errorf("Expected delivery over a new connection. Got %v", err)
+	}
+}
+
+func TestNATSSinkUnreachable(t *testing.T) {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := listener.Addr().String()
+	listener.Close()
+	if err := NewNATS(addr, "catalog").Deliver(context.Background(), event()); err == nil {
+		t.Error("Expected an error with no server")
+	}
+}
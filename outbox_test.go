@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/events"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+)
+
+func TestProductChangesAreQueuedInOrder(t *testing.T) {
+	clearTable()
+
+	req, _ := http.NewRequest("POST", "/product", bytes.NewBufferString(`{"name":"queued","price":1.5}`))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	id := m["id"].(string)
+
+	req, _ = http.NewRequest("PUT", "/product/"+id, bytes.NewBufferString(`{"name":"queued","price":2.5}`))
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	req, _ = http.NewRequest("DELETE", "/product/"+id, nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+
+	due, err := repositories.DueEvents(a.DB, time.Now().Add(time.Minute), 10)
+	if err != nil || len(due) != 1 {
+		t.Fatalf("Expected only the oldest change due. Got %d %v", len(due), err)
+	}
+	if e := due[0]; e.Type != events.ProductCreated || e.Product.GetID() != id || e.Product.GetPrice() != 1.5 {
+		t.Errorf("Expected the create first. Got %+v", e)
+	}
+
+	var queued []string
+	rows, _ := a.DB.Query("SELECT event_type FROM outbox WHERE product_id=$1 ORDER BY id", id)
+	defer rows.Close()
+	for rows.Next() {
+		var eventType string
+		rows.Scan(&eventType)
+		queued = append(queued, eventType)
+	}
+	if len(queued) != 3 || queued[1] != string(events.ProductUpdated) || queued[2] != string(events.ProductDeleted) {
+		t.Errorf("Expected create, update, delete. Got %v", queued)
+	}
+}
+
+func TestFailedWritesQueueNothing(t *testing.T) {
+	clearTable()
+
+	req, _ := http.NewRequest("PUT", "/product/00000000-0000-0000-0000-000000000000",
+		bytes.NewBufferString(`{"name":"missing","price":1}`))
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+
+	var n int
+	a.DB.QueryRow("SELECT COUNT(*) FROM outbox").Scan(&n)
+	if n != 0 {
+		t.Errorf("Expected nothing queued. Got %d", n)
+	}
+}
+
+func TestOutboxSinksFromEnvironment(t *testing.T) {
+	defer os.Unsetenv("APP_OUTBOX_SINKS")
+	defer os.Unsetenv("APP_OUTBOX_HTTP_URL")
+
+	os.Setenv("APP_OUTBOX_SINKS", "log, nats")
+	if sinks, err := outboxSinks(); err != nil || len(sinks) != 2 {
+		t.Errorf("Expected two sinks. Got %d %v", len(sinks), err)
+	}
+	os.Setenv("APP_OUTBOX_SINKS", "http")
+	if _, err := outboxSinks(); err == nil {
+		t.Error("Expected the http sink to need a URL")
+	}
+	os.Setenv("APP_OUTBOX_HTTP_URL", "http://localhost:9/events")
+	if sinks, err := outboxSinks(); err != nil || len(sinks) != 1 {
+		t.Errorf("Expected the http sink. Got %d %v", len(sinks), err)
+	}
+	os.Setenv("APP_OUTBOX_SINKS", "pigeon")
+	if _, err := outboxSinks(); err == nil {
+		t.Error("Expected an unknown sink refused")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/events"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/rest"
+	"github.com/Lewiscowles1986/go-gorilla-api/telemetry"
+)
+
+func (a *App) getPriceHistory(w http.ResponseWriter, r *http.Request) {
+	p, ok := a.loadProduct(w, r)
+	if !ok {
+		return
+	}
+	count, page := getPagingFromRequest(r)
+
+	changes, err := repositories.GetPriceHistory(a.db(r), tenantOf(r), p.GetID(), page, count)
+	if err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	entries := []rest.Entry{}
+	for _, c := range changes {
+		entries = append(entries, rest.Entry{Object: c})
+	}
+
+	total := repositories.CountPriceHistory(a.db(r), tenantOf(r), p.GetID())
+	l := rest.ListingJSONResponse(a.linker(r).Href(rest.RouteProductPrices, "id", p.GetID()), page, total, count, entries)
+	rest.RespondWithListing(w, r, http.StatusOK, l)
+}
+
+func (a *App) schedulePrice(w http.ResponseWriter, r *http.Request) {
+	p, ok := a.loadProduct(w, r)
+	if !ok {
+		return
+	}
+	var payload struct {
+		Price       *float64   `json:"price"`
+		EffectiveAt *time.Time `json:"effective_at"`
+	}
+	if !a.Body.DecodeJSON(w, r, &payload) {
+		return
+	}
+	if payload.Price == nil || data.ValidatePrice(*payload.Price) != nil {
+		rest.RespondWithError(w, http.StatusBadRequest, data.ErrProductPriceInvalid.Error())
+		return
+	}
+	if payload.EffectiveAt == nil || !payload.EffectiveAt.After(time.Now()) {
+		rest.RespondWithError(w, http.StatusBadRequest, "effective_at must be in the future")
+		return
+	}
+
+	c, err := repositories.SchedulePrice(a.db(r), tenantOf(r), p.GetID(), *payload.Price, *payload.EffectiveAt)
+	if err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rest.RespondWithJSON(w, http.StatusCreated, c)
+}
+
+// applyScheduledPrices writes due prices to their products every interval
+// until ctx is done. Reads already see a due price; this keeps the stored
+// price, and anyone watching product events, in step.
+func (a *App) applyScheduledPrices(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			sweep, span := telemetry.Start(ctx, "apply scheduled prices")
+			if _, err := a.applyPricesDueAt(sweep, now); err != nil {
+				telemetry.Printf(sweep, "applying scheduled prices: %v", err)
+			}
+			span.End()
+		}
+	}
+}
+
+// applyPricesDueAt applies the prices scheduled by now and announces the
+// products they changed, returning how many changed
+func (a *App) applyPricesDueAt(ctx context.Context, now time.Time) (int, error) {
+	db := a.DB.WithContext(ctx)
+	changed, err := repositories.ApplyScheduledPrices(db, now)
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range changed {
+		if p, err := repositories.GetProduct(db, c.TenantID, c.ProductID); err == nil {
+			a.Events.Publish(c.TenantID, events.ProductUpdated, p)
+		}
+	}
+	return len(changed), nil
+}
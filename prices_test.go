@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/events"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/rest"
+	"github.com/Lewiscowles1986/go-gorilla-api/tenants"
+)
+
+func getPriceOf(t *testing.T, p data.Product) float64 {
+	req, _ := http.NewRequest("GET", "/product/"+p.GetID(), nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	return m["price"].(float64)
+}
+
+func storedPriceOf(t *testing.T, p data.Product) float64 {
+	price := 0.0
+	if err := a.DB.QueryRow("SELECT price FROM products WHERE id=$1", p.GetID()).Scan(&price); err != nil {
+		t.Fatal(err)
+	}
+	return price
+}
+
+func TestUpdatesRecordPriceHistory(t *testing.T) {
+	clearTable()
+	p := data.CreateProduct("tea", 1)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+
+	for _, payload := range []string{`{"name":"tea","price":2}`, `{"name":"green tea","price":2}`} {
+		req, _ := http.NewRequest("PUT", "/product/"+p.GetID(), bytes.NewBufferString(payload))
+		checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	}
+
+	req, _ := http.NewRequest("GET", "/product/"+p.GetID()+"/prices", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var l rest.Listing
+	json.Unmarshal(response.Body.Bytes(), &l)
+	if l.Total != 2 {
+		t.Fatalf("Expected a price for the create and one for the change. Got %d", l.Total)
+	}
+	if latest := l.Data[0].Object.(map[string]interface{}); latest["price"] != 2.0 {
+		t.Errorf("Expected latest price first. Got %v", latest)
+	}
+}
+
+func TestSchedulePriceValidation(t *testing.T) {
+	clearTable()
+	p := data.CreateProduct("tea", 1)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+
+	past := time.Now().Add(-time.Minute).Format(time.RFC3339)
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+	for payload, expected := range map[string]int{
+		`{"price":2,"effective_at":"` + past + `"}`:    http.StatusBadRequest,
+		`{"price":-2,"effective_at":"` + future + `"}`: http.StatusBadRequest,
+		`{"effective_at":"` + future + `"}`:            http.StatusBadRequest,
+		`{"price":2,"effective_at":"` + future + `"}`:  http.StatusCreated,
+	} {
+		req, _ := http.NewRequest("POST", "/product/"+p.GetID()+"/prices", bytes.NewBufferString(payload))
+		if response := executeRequest(req); response.Code != expected {
+			t.Errorf("Expected %d for %s. Got %d", expected, payload, response.Code)
+		}
+	}
+
+	if price := getPriceOf(t, p); price != 1 {
+		t.Errorf("Expected future price not to apply yet. Got %v", price)
+	}
+}
+
+func TestScheduledPriceAppliesWhenDue(t *testing.T) {
+	clearTable()
+	p := data.CreateProduct("tea", 1)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+	if _, err := repositories.SchedulePrice(a.DB, tenants.Default, p.GetID(), 5, time.Now().Add(50*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if price := getPriceOf(t, p); price != 5 {
+		t.Errorf("Expected the due price before the scheduler runs. Got %v", price)
+	}
+	if price := storedPriceOf(t, p); price != 1 {
+		t.Errorf("Expected the stored price to wait for the scheduler. Got %v", price)
+	}
+
+	updates, unsubscribe := a.Events.Subscribe(1)
+	defer unsubscribe()
+	a.applyPricesDueAt(context.Background(), time.Now())
+
+	if price := storedPriceOf(t, p); price != 5 {
+		t.Errorf("Expected the scheduler to store the price. Got %v", price)
+	}
+	select {
+	case e := <-updates:
+		if e.Type != events.ProductUpdated || e.Product.GetPrice() != 5 {
+			t.Errorf("Unexpected event %+v", e)
+		}
+	default:
+		t.Error("Expected a product update event")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/graph"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+)
+
+// ReadYourWritesHeader - Sent as "true", reads come from the primary
+const ReadYourWritesHeader = "X-Read-Your-Writes"
+
+// openReplicas opens each DSN in a comma separated list, on the primary's
+// driver
+func openReplicas(connType, dsns string) ([]*repositories.DB, error) {
+	replicas := []*repositories.DB{}
+	for _, dsn := range strings.Split(dsns, ",") {
+		if dsn = strings.TrimSpace(dsn); dsn == "" {
+			continue
+		}
+		db, err := repositories.Open(connType, dsn)
+		if err != nil {
+			return nil, err
+		}
+		replicas = append(replicas, db)
+	}
+	return replicas, nil
+}
+
+// readerKey - The request context key of the database a request reads from
+type readerKey struct{}
+
+// reader - Where product reads for r go: the database chooseReader picked
+// for it, so that every read r makes sees the same data
+func (a *App) reader(r *http.Request) *repositories.DB {
+	if db, ok := r.Context().Value(readerKey{}).(*repositories.DB); ok {
+		return db.WithContext(r.Context())
+	}
+	return a.pickReader(r).WithContext(r.Context())
+}
+
+// pickReader - A replica, unless r asks to read its own writes or a recent
+// write pinned its tenant to the primary
+func (a *App) pickReader(r *http.Request) *repositories.DB {
+	if r.Header.Get(ReadYourWritesHeader) == "true" {
+		return a.DB
+	}
+	return a.Replicas.Reader(tenantOf(r))
+}
+
+// db - The primary, running r's queries as part of r
+func (a *App) db(r *http.Request) *repositories.DB {
+	return a.DB.WithContext(r.Context())
+}
+
+// pinWrites keeps the tenant's reads on the primary for a while after any
+// request that may write. The pin is taken before the request is handled,
+// so a client reading as soon as the answer arrives finds it in place.
+func (a *App) pinWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			a.Replicas.Wrote(tenantOf(r))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// chooseReader picks the database a request reads from once, so that a
+// listing's count and its page cannot come from different replicas
+func (a *App) chooseReader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), readerKey{}, a.pickReader(r))))
+	})
+}
+
+// readGraphs has GraphQL queries read from the database chooseReader picked.
+// Queries are usually POSTed, and pinWrites cannot tell them from mutations,
+// so only those sent with GET read from a replica.
+func (a *App) readGraphs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(graph.WithReader(r.Context(), a.reader(r))))
+	})
+}
+
+func (a *App) checkReplicas(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.Replicas.CheckReplicas(ctx, interval/2)
+		}
+	}
+}
+
+// logReplicas notes at startup which replicas answered
+func (a *App) logReplicas(n int) {
+	if n == 0 {
+		return
+	}
+	healthy := a.Replicas.CheckReplicas(context.Background(), 5*time.Second)
+	log.Printf("reading from %d of %d replicas", healthy, n)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/tenants"
+)
+
+// withReplica stands a separate SQLite file in for a replica, which never
+// catches up with the primary
+func withReplica(t *testing.T, pinFor time.Duration) *repositories.DB {
+	replica, err := repositories.Open("sqlite3", filepath.Join(t.TempDir(), "replica.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repositories.MigrateUp(replica, 0); err != nil {
+		t.Fatal(err)
+	}
+	primary := a.Replicas
+	a.Replicas = repositories.NewCluster(a.DB, replica)
+	a.Replicas.PinFor = pinFor
+	t.Cleanup(func() {
+		a.Replicas = primary
+		replica.Close()
+	})
+	return replica
+}
+
+func postProduct(t *testing.T) data.Product {
+	req, _ := http.NewRequest("POST", "/product", bytes.NewBufferString(`{"name":"fresh","price":1}`))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	p := data.CreateProduct("", 0)
+	json.Unmarshal(response.Body.Bytes(), p)
+	return p
+}
+
+func TestProductReadsGoToReplica(t *testing.T) {
+	clearTable()
+	replica := withReplica(t, 0)
+	p := data.CreateProduct("replicated", 3)
+	repositories.CreateProduct(replica, tenants.Default, p)
+
+	req, _ := http.NewRequest("GET", "/product/"+p.GetID(), nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("GET", "/products", nil)
+	var listing map[string]interface{}
+	json.Unmarshal(executeRequest(req).Body.Bytes(), &listing)
+	if listing["total"] != 1.0 {
+		t.Errorf("Expected the replica's 1 product. Got %v", listing["total"])
+	}
+}
+
+func TestSearchAndGraphQLReadFromReplica(t *testing.T) {
+	clearTable()
+	replica := withReplica(t, 0)
+	p := data.CreateProduct("replicated", 3)
+	repositories.CreateProduct(replica, tenants.Default, p)
+
+	if l := searchFor(t, "q=replicated"); l.Total != 1 {
+		t.Errorf("Expected the replica's product found. Got %d", l.Total)
+	}
+
+	req, _ := http.NewRequest("GET", `/graphql?query={product(id:"`+p.GetID()+`"){name}}`, nil)
+	var m struct {
+		Data struct{ Product *struct{ Name string } }
+	}
+	json.Unmarshal(executeRequest(req).Body.Bytes(), &m)
+	if m.Data.Product == nil || m.Data.Product.Name != "replicated" {
+		t.Errorf("Expected the replica's product from GraphQL. Got %+v", m.Data.Product)
+	}
+}
+
+func TestWritePinsReadsToPrimary(t *testing.T) {
+	clearTable()
+	withReplica(t, time.Minute)
+	p := postProduct(t)
+
+	req, _ := http.NewRequest("GET", "/product/"+p.GetID(), nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+
+	// Other tenants' reads are not pinned
+	provisionTenants(t, "acme")
+	if a.Replicas.Pinned("acme") {
+		t.Error("Expected only the writing tenant to be pinned")
+	}
+}
+
+func TestReadYourWritesHeader(t *testing.T) {
+	clearTable()
+	withReplica(t, 0)
+	p := postProduct(t)
+
+	req, _ := http.NewRequest("GET", "/product/"+p.GetID(), nil)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("GET", "/product/"+p.GetID(), nil)
+	req.Header.Set(ReadYourWritesHeader, "true")
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+}
+
+func TestUnhealthyReplicaFallsBackToPrimary(t *testing.T) {
+	clearTable()
+	replica := withReplica(t, 0)
+	p := postProduct(t)
+
+	replica.Close()
+	if healthy := a.Replicas.CheckReplicas(context.Background(), time.Second); healthy != 0 {
+		t.Fatalf("Expected no healthy replicas. Got %d", healthy)
+	}
+	req, _ := http.NewRequest("GET", "/product/"+p.GetID(), nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+}
+
+func TestRequestReadsFromOneReplica(t *testing.T) {
+	one := withReplica(t, 0)
+	two, err := repositories.Open("sqlite3", filepath.Join(t.TempDir(), "two.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer two.Close()
+	a.Replicas = repositories.NewCluster(a.DB, one, two)
+
+	handler := a.chooseReader(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		first := a.reader(r)
+		for i := 0; i < 3; i++ {
+			if a.reader(r).DB != first.DB {
+				t.Fatal("Expected every read of the request to go to the same replica")
+			}
+		}
+	}))
+	req, _ := http.NewRequest("GET", "/products", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(tenants.NewContext(req.Context(), tenants.Default)))
+}
+
+func TestWritesPinBeforeTheyAreHandled(t *testing.T) {
+	withReplica(t, time.Minute)
+	pinned := false
+	handler := a.pinWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pinned = a.Replicas.Pinned(tenants.Default)
+	}))
+	req, _ := http.NewRequest("POST", "/product", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(tenants.NewContext(req.Context(), tenants.Default)))
+	if !pinned {
+		t.Error("Expected the tenant pinned while the write was handled")
+	}
+}
@@ -0,0 +1,170 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+var (
+	ErrCategoryParentNotFound = errors.New("Parent category not found")
+	ErrCategoryCycle          = errors.New("Category cannot be its own ancestor")
+)
+
+func GetCategory(db DBTX, tenantID, id string) (data.Category, error) {
+	return data.ParseCategoryData(db.QueryRow(
+		"SELECT id, name, parent_id FROM categories WHERE tenant_id=$1 AND id=$2", tenantID, id))
+}
+
+func CreateCategory(db DBTX, tenantID string, c data.Category) error {
+	_, err := db.Exec(
+		"INSERT INTO categories(tenant_id, id, name, parent_id) VALUES($1, $2, $3, $4)",
+		tenantID, c.GetID(), c.GetName(), c.GetParentID())
+	return err
+}
+
+func UpdateCategory(db DBTX, tenantID, id string, c data.Category) error {
+	_, err := db.Exec("UPDATE categories SET name=$1, parent_id=$2 WHERE tenant_id=$3 AND id=$4",
+		c.GetName(), c.GetParentID(), tenantID, id)
+	return err
+}
+
+// DeleteCategory - Removes a category and its product assignments; the
+// products themselves are untouched
+func DeleteCategory(db DBTX, tenantID, id string) error {
+	if _, err := db.Exec("DELETE FROM product_categories WHERE tenant_id=$1 AND category_id=$2",
+		tenantID, id); err != nil {
+		return err
+	}
+	_, err := db.Exec("DELETE FROM categories WHERE tenant_id=$1 AND id=$2", tenantID, id)
+	return err
+}
+
+// CheckCategoryParent - Confirms parentID names an existing category that
+// of the same tenant and is not id itself or one of its descendants
+func CheckCategoryParent(db DBTX, tenantID, id string, parentID *string) error {
+	for current := parentID; current != nil; {
+		if *current == id {
+			return ErrCategoryCycle
+		}
+		parent, err := GetCategory(db, tenantID, *current)
+		if err == sql.ErrNoRows {
+			return ErrCategoryParentNotFound
+		}
+		if err != nil {
+			return err
+		}
+		current = parent.GetParentID()
+	}
+	return nil
+}
+
+func CountCategoryChildren(db DBTX, tenantID, id string) (uint64, error) {
+	i := uint64(0)
+	err := db.QueryRow("SELECT COUNT(id) FROM categories WHERE tenant_id=$1 AND parent_id=$2",
+		tenantID, id).Scan(&i)
+	return i, err
+}
+
+func GetCategories(db DBTX, tenantID string, page uint64, count uint8) ([]data.Category, error) {
+	if page > 0 {
+		page--
+	}
+	rows, err := db.Query(`SELECT id, name, parent_id FROM categories WHERE tenant_id=$1
+        ORDER BY name, id LIMIT $2 OFFSET $3`, tenantID, count, page*uint64(count))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return data.ParseCategoryListData(rows)
+}
+
+func GetCategoryCount(db DBTX, tenantID string) uint64 {
+	i := uint64(0)
+	if err := db.QueryRow("SELECT COUNT(id) FROM categories WHERE tenant_id=$1",
+		tenantID).Scan(&i); err != nil {
+		i = uint64(0)
+	}
+	return i
+}
+
+// AssignProductToCategory - Idempotent; assigning twice is not an error.
+// Both must belong to the tenant, or nothing is assigned.
+func AssignProductToCategory(db DBTX, tenantID, productID, categoryID string) error {
+	_, err := db.Exec(`INSERT INTO product_categories(tenant_id, product_id, category_id)
+        SELECT $1, $2, $3 WHERE
+            EXISTS (SELECT 1 FROM products WHERE tenant_id=$1 AND id=$2) AND
+            EXISTS (SELECT 1 FROM categories WHERE tenant_id=$1 AND id=$3) `+
+		db.Dialect().OnConflict([]string{"tenant_id", "product_id", "category_id"}), tenantID, productID, categoryID)
+	return err
+}
+
+func UnassignProductFromCategory(db DBTX, tenantID, productID, categoryID string) error {
+	_, err := db.Exec(
+		"DELETE FROM product_categories WHERE tenant_id=$1 AND product_id=$2 AND category_id=$3",
+		tenantID, productID, categoryID)
+	return err
+}
+
+func GetCategoryProducts(db DBTX, tenantID, categoryID string, page uint64, count uint8) ([]data.Product, error) {
+	if page > 0 {
+		page--
+	}
+	rows, err := db.Query(`SELECT p.id, p.name, `+effectivePrice("p", 1)+` FROM products p
+        JOIN product_categories pc ON pc.tenant_id = p.tenant_id AND pc.product_id = p.id
+        WHERE pc.tenant_id=$2 AND pc.category_id=$3
+        ORDER BY p.name, p.id LIMIT $4 OFFSET $5`,
+		now(), tenantID, categoryID, count, page*uint64(count))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return data.ParseProductListData(rows)
+}
+
+func CountCategoryProducts(db DBTX, tenantID, categoryID string) uint64 {
+	i := uint64(0)
+	err := db.QueryRow(
+		"SELECT COUNT(product_id) FROM product_categories WHERE tenant_id=$1 AND category_id=$2",
+		tenantID, categoryID).Scan(&i)
+	if err != nil {
+		i = uint64(0)
+	}
+	return i
+}
+
+// GetProductCategoryIDs - The categories of each listed product, fetched in
+// one query so listings avoid a lookup per entry
+func GetProductCategoryIDs(db DBTX, tenantID string, productIDs ...string) (map[string][]string, error) {
+	assigned := map[string][]string{}
+	if len(productIDs) == 0 {
+		return assigned, nil
+	}
+	placeholders := make([]string, len(productIDs))
+	args := []interface{}{tenantID}
+	for i, id := range productIDs {
+		args = append(args, id)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+	rows, err := db.Query(fmt.Sprintf(`SELECT product_id, category_id FROM product_categories
+        WHERE tenant_id=$1 AND product_id IN (%s) ORDER BY category_id`,
+		strings.Join(placeholders, ", ")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID, categoryID string
+		if err := rows.Scan(&productID, &categoryID); err != nil {
+			return nil, err
+		}
+		assigned[productID] = append(assigned[productID], categoryID)
+	}
+	return assigned, rows.Err()
+}
@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+// SetExchangeRates - Replaces the whole table of exchange rates, so a
+// currency left out can no longer be converted to. Run it in a
+// transaction, so readers never see the table half replaced.
+func SetExchangeRates(db DBTX, rates []data.ExchangeRate) error {
+	if _, err := db.Exec("DELETE FROM exchange_rates"); err != nil {
+		return err
+	}
+	for _, r := range rates {
+		if _, err := db.Exec("INSERT INTO exchange_rates(currency, rate, as_of) VALUES($1, $2, $3)",
+			r.Currency, r.Rate, r.AsOf.UTC()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetExchangeRates - Every exchange rate, in currency order
+func GetExchangeRates(db DBTX) ([]data.ExchangeRate, error) {
+	rows, err := db.Query("SELECT currency, rate, as_of FROM exchange_rates ORDER BY currency")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []data.ExchangeRate{}
+	for rows.Next() {
+		r := data.ExchangeRate{}
+		if err := rows.Scan(&r.Currency, &r.Rate, &r.AsOf); err != nil {
+			return nil, err
+		}
+		rates = append(rates, r)
+	}
+	return rates, rows.Err()
+}
+
+// GetExchangeRate - The rate to one currency; sql.ErrNoRows when there is
+// none
+func GetExchangeRate(db DBTX, currency string) (data.ExchangeRate, error) {
+	r := data.ExchangeRate{}
+	err := db.QueryRow("SELECT currency, rate, as_of FROM exchange_rates WHERE currency=$1", currency).
+		Scan(&r.Currency, &r.Rate, &r.AsOf)
+	return r, err
+}
+
+// SetCurrencyPrice - Sets a product's price in one currency by hand,
+// replacing any it had
+func SetCurrencyPrice(db DBTX, tenantID string, p data.CurrencyPrice) error {
+	_, err := db.Exec(`INSERT INTO product_currency_prices(tenant_id, product_id, currency, price)
+        VALUES($1, $2, $3, $4) `+db.Dialect().OnConflict([]string{"tenant_id", "product_id", "currency"}, "price"),
+		tenantID, p.ProductID, p.Currency, p.Price)
+	return err
+}
+
+// DeleteCurrencyPrice - Goes back to converting a product's price into
+// currency. sql.ErrNoRows when it had no price set there.
+func DeleteCurrencyPrice(db DBTX, tenantID, productID, currency string) error {
+	res, err := db.Exec("DELETE FROM product_currency_prices WHERE tenant_id=$1 AND product_id=$2 AND currency=$3",
+		tenantID, productID, currency)
+	if err == nil {
+		err = expectOneRow(res, sql.ErrNoRows)
+	}
+	return err
+}
+
+// GetCurrencyPrices - The prices set by hand for each product, by currency
+func GetCurrencyPrices(db DBTX, tenantID string, productIDs ...string) (map[string][]data.CurrencyPrice, error) {
+	prices := map[string][]data.CurrencyPrice{}
+	if len(productIDs) == 0 {
+		return prices, nil
+	}
+	placeholders := make([]string, len(productIDs))
+	args := []interface{}{tenantID}
+	for i, id := range productIDs {
+		args = append(args, id)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+	rows, err := db.Query(fmt.Sprintf(`SELECT product_id, currency, price FROM product_currency_prices
+        WHERE tenant_id=$1 AND product_id IN (%s) ORDER BY currency`, strings.Join(placeholders, ", ")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p := data.CurrencyPrice{}
+		if err := rows.Scan(&p.ProductID, &p.Currency, &p.Price); err != nil {
+			return nil, err
+		}
+		prices[p.ProductID] = append(prices[p.ProductID], p)
+	}
+	return prices, rows.Err()
+}
@@ -0,0 +1,359 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Dialect - What differs between the databases the repositories run on.
+// Queries are written with postgres' $N placeholders and ON CONFLICT
+// upserts; the dialect turns them into what its driver understands.
+type Dialect interface {
+	// Name - The database/sql driver name
+	Name() string
+	// Rebind - query with its $N placeholders in the driver's style, and
+	// args in the order the driver binds them
+	Rebind(query string, args []interface{}) (string, []interface{})
+	// OnConflict - The clause ending an INSERT that collides with a row on
+	// key. It sets the named columns to the values being inserted, or
+	// leaves the row alone when there are none.
+	OnConflict(key []string, update ...string) string
+	// Returning - Whether INSERT, UPDATE and DELETE can end in RETURNING
+	Returning() bool
+	// ForUpdate - The clause ending a SELECT that locks the rows it reads
+	// until the transaction ends, or "" where writers are serialized anyway
+	ForUpdate() string
+	// DDL - A migration statement as this database spells it
+	DDL(statement string) string
+	// Retryable - Whether err aborted a transaction that may succeed if
+	// run again, having lost to a concurrent one
+	Retryable(err error) bool
+	// Duplicate - Whether err refused a row for breaking a unique key
+	Duplicate(err error) bool
+}
+
+// DialectFor - The dialect of a database/sql driver
+func DialectFor(driver string) (Dialect, error) {
+	switch driver {
+	case "postgres":
+		return postgres{}, nil
+	case "sqlite3":
+		return sqlite{}, nil
+	case "mysql":
+		return mysql{}, nil
+	}
+	return nil, fmt.Errorf("unsupported database driver %q", driver)
+}
+
+type postgres struct{}
+
+func (postgres) Name() string { return "postgres" }
+
+func (postgres) Rebind(query string, args []interface{}) (string, []interface{}) {
+	return query, args
+}
+
+func (postgres) OnConflict(key []string, update ...string) string {
+	return onConflict(key, update)
+}
+
+func (postgres) Returning() bool { return true }
+
+func (postgres) ForUpdate() string { return " FOR UPDATE" }
+
+func (postgres) DDL(statement string) string {
+	return dropIndexOn.ReplaceAllString(statement, "DROP INDEX $1")
+}
+
+// Retryable - Serialization failures and deadlocks
+func (postgres) Retryable(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == "40001" || pqErr.Code == "40P01")
+}
+
+func (postgres) Duplicate(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+type sqlite struct{}
+
+func (sqlite) Name() string { return "sqlite3" }
+
+// Rebind - sqlite reads $N as a named parameter, numbered by where it
+// first appears rather than by N, so plain ? is the only safe spelling
+func (sqlite) Rebind(query string, args []interface{}) (string, []interface{}) {
+	return rebindQuestion(query, args)
+}
+
+func (sqlite) OnConflict(key []string, update ...string) string {
+	return onConflict(key, update)
+}
+
+func (sqlite) Returning() bool { return true }
+
+// ForUpdate - sqlite has one writer at a time; a transaction that read
+// before another wrote gets SQLITE_BUSY when it tries to write too
+func (sqlite) ForUpdate() string { return "" }
+
+func (sqlite) DDL(statement string) string {
+	return dropIndexOn.ReplaceAllString(statement, "DROP INDEX $1")
+}
+
+// Retryable - Another connection held the database past the busy timeout
+func (sqlite) Retryable(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
+
+func (sqlite) Duplicate(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+		sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+// mysql - MySQL 8 and MariaDB 10.5 onwards
+type mysql struct{}
+
+func (mysql) Name() string { return "mysql" }
+
+func (mysql) Rebind(query string, args []interface{}) (string, []interface{}) {
+	return rebindQuestion(query, args)
+}
+
+// OnConflict - MySQL has no way to name the key, so the row collides on
+// whichever unique key it would break. VALUES() is deprecated in MySQL
+// but the only spelling MariaDB knows.
+func (mysql) OnConflict(key []string, update ...string) string {
+	if len(update) == 0 {
+		return fmt.Sprintf("ON DUPLICATE KEY UPDATE %[1]s = %[1]s", key[0])
+	}
+	sets := make([]string, len(update))
+	for i, column := range update {
+		sets[i] = fmt.Sprintf("%[1]s = VALUES(%[1]s)", column)
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
+// Returning - MariaDB can return from INSERT and DELETE but not UPDATE,
+// and MySQL from none of them
+func (mysql) Returning() bool { return false }
+
+func (mysql) ForUpdate() string { return " FOR UPDATE" }
+
+// DDL - TIMESTAMP in MySQL is seconds since 1970 in the session's time
+// zone; DATETIME(6) keeps what it is given, to the microsecond
+func (mysql) DDL(statement string) string {
+	return timestampType.ReplaceAllString(statement, "DATETIME(6)")
+}
+
+// Retryable - Deadlocks and lock wait timeouts
+func (mysql) Retryable(err error) bool {
+	var mysqlErr *gomysql.MySQLError
+	return errors.As(err, &mysqlErr) && (mysqlErr.Number == 1213 || mysqlErr.Number == 1205)
+}
+
+// Duplicate - ER_DUP_ENTRY
+func (mysql) Duplicate(err error) bool {
+	var mysqlErr *gomysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+var (
+	// dropIndexOn - Migrations name the table an index is dropped from,
+	// which only MySQL needs
+	dropIndexOn   = regexp.MustCompile(`DROP INDEX (\w+) ON \w+`)
+	timestampType = regexp.MustCompile(`\bTIMESTAMP\b`)
+)
+
+func onConflict(key []string, update []string) string {
+	target := "ON CONFLICT (" + strings.Join(key, ", ") + ")"
+	if len(update) == 0 {
+		return target + " DO NOTHING"
+	}
+	sets := make([]string, len(update))
+	for i, column := range update {
+		sets[i] = fmt.Sprintf("%[1]s = excluded.%[1]s", column)
+	}
+	return target + " DO UPDATE SET " + strings.Join(sets, ", ")
+}
+
+// rebindQuestion writes each $N as ?, binding args[N-1] once for every
+// time it appears. Quoted literals are copied as they are, and so is a
+// placeholder with no argument, for the driver to report.
+func rebindQuestion(query string, args []interface{}) (string, []interface{}) {
+	var b strings.Builder
+	bound := make([]interface{}, 0, len(args))
+	quoted := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		if c == '\'' {
+			quoted = !quoted
+		}
+		end := i + 1
+		for end < len(query) && query[end] >= '0' && query[end] <= '9' {
+			end++
+		}
+		if c != '$' || quoted || end == i+1 {
+			b.WriteByte(c)
+			continue
+		}
+		n, err := strconv.Atoi(query[i+1 : end])
+		if err != nil || n < 1 || n > len(args) {
+			b.WriteString(query[i:end])
+		} else {
+			b.WriteByte('?')
+			bound = append(bound, args[n-1])
+		}
+		i = end - 1
+	}
+	return b.String(), bound
+}
+
+// DB - A connection pool that writes its queries in its database's dialect
+type DB struct {
+	*sql.DB
+	dialect Dialect
+	// ctx is what calls that take no context run under
+	ctx context.Context
+}
+
+// Open - Opens a pool on a supported driver
+func Open(driver, dsn string) (*DB, error) {
+	dialect, err := DialectFor(driver)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{DB: db, dialect: dialect}, nil
+}
+
+// WithContext - The same pool, running the calls that take no context
+// under ctx, so that they are cancelled with a request and traced as part
+// of it
+func (db *DB) WithContext(ctx context.Context) *DB {
+	bound := *db
+	bound.ctx = ctx
+	return &bound
+}
+
+func (db *DB) context() context.Context {
+	if db.ctx == nil {
+		return context.Background()
+	}
+	return db.ctx
+}
+
+func (db *DB) Dialect() Dialect {
+	return db.dialect
+}
+
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.ExecContext(db.context(), query, args...)
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	query, args = db.dialect.Rebind(query, args)
+	ctx, span := startSpan(ctx, db.dialect, query)
+	res, err := db.DB.ExecContext(ctx, query, args...)
+	endSpan(span, err)
+	return res, err
+}
+
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.QueryContext(db.context(), query, args...)
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	query, args = db.dialect.Rebind(query, args)
+	ctx, span := startSpan(ctx, db.dialect, query)
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	endSpan(span, err)
+	return rows, err
+}
+
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.QueryRowContext(db.context(), query, args...)
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	query, args = db.dialect.Rebind(query, args)
+	ctx, span := startSpan(ctx, db.dialect, query)
+	row := db.DB.QueryRowContext(ctx, query, args...)
+	endSpan(span, row.Err())
+	return row
+}
+
+func (db *DB) Begin() (*Tx, error) {
+	return db.BeginTx(db.context(), nil)
+}
+
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, dialect: db.dialect, ctx: ctx}, nil
+}
+
+// Tx - A transaction that writes its queries in its database's dialect
+type Tx struct {
+	*sql.Tx
+	dialect Dialect
+	// ctx is the one the transaction began under, which calls that take
+	// none run under
+	ctx context.Context
+}
+
+func (tx *Tx) Dialect() Dialect {
+	return tx.dialect
+}
+
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.ExecContext(tx.ctx, query, args...)
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	query, args = tx.dialect.Rebind(query, args)
+	ctx, span := startSpan(ctx, tx.dialect, query)
+	res, err := tx.Tx.ExecContext(ctx, query, args...)
+	endSpan(span, err)
+	return res, err
+}
+
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.QueryContext(tx.ctx, query, args...)
+}
+
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	query, args = tx.dialect.Rebind(query, args)
+	ctx, span := startSpan(ctx, tx.dialect, query)
+	rows, err := tx.Tx.QueryContext(ctx, query, args...)
+	endSpan(span, err)
+	return rows, err
+}
+
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.QueryRowContext(tx.ctx, query, args...)
+}
+
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	query, args = tx.dialect.Rebind(query, args)
+	ctx, span := startSpan(ctx, tx.dialect, query)
+	row := tx.Tx.QueryRowContext(ctx, query, args...)
+	endSpan(span, row.Err())
+	return row
+}
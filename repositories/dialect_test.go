@@ -0,0 +1,89 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestRebindQuestion(t *testing.T) {
+	query, args := rebindQuestion(
+		"SELECT $2, '$1' FROM t WHERE a=$1 AND b=$2 LIMIT $10",
+		[]interface{}{"a", "b"})
+	if query != "SELECT ?, '$1' FROM t WHERE a=? AND b=? LIMIT $10" {
+		t.Errorf("Unexpected query %s", query)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"b", "a", "b"}) {
+		t.Errorf("Unexpected args %v", args)
+	}
+}
+
+func TestPostgresLeavesPlaceholders(t *testing.T) {
+	query, args := postgres{}.Rebind("SELECT $2, $1", []interface{}{1, 2})
+	if query != "SELECT $2, $1" || !reflect.DeepEqual(args, []interface{}{1, 2}) {
+		t.Errorf("Unexpected rebind %s %v", query, args)
+	}
+}
+
+func TestOnConflict(t *testing.T) {
+	for _, c := range []struct {
+		dialect  Dialect
+		update   []string
+		expected string
+	}{
+		{sqlite{}, nil, "ON CONFLICT (a, b) DO NOTHING"},
+		{postgres{}, []string{"c", "d"}, "ON CONFLICT (a, b) DO UPDATE SET c = excluded.c, d = excluded.d"},
+		{mysql{}, nil, "ON DUPLICATE KEY UPDATE a = a"},
+		{mysql{}, []string{"c", "d"}, "ON DUPLICATE KEY UPDATE c = VALUES(c), d = VALUES(d)"},
+	} {
+		if result := c.dialect.OnConflict([]string{"a", "b"}, c.update...); result != c.expected {
+			t.Errorf("%s: Expected %s. Got %s", c.dialect.Name(), c.expected, result)
+		}
+	}
+}
+
+func TestDDL(t *testing.T) {
+	for _, c := range []struct {
+		dialect             Dialect
+		statement, expected string
+	}{
+		{mysql{}, "at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP", "at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP"},
+		{mysql{}, "DROP INDEX i ON t", "DROP INDEX i ON t"},
+		{postgres{}, "DROP INDEX i ON t", "DROP INDEX i"},
+		{sqlite{}, "at TIMESTAMP NOT NULL", "at TIMESTAMP NOT NULL"},
+	} {
+		if result := c.dialect.DDL(c.statement); result != c.expected {
+			t.Errorf("%s: Expected %s. Got %s", c.dialect.Name(), c.expected, result)
+		}
+	}
+}
+
+func TestDialectForUnknownDriver(t *testing.T) {
+	if _, err := DialectFor("oracle"); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	for _, c := range []struct {
+		dialect  Dialect
+		err      error
+		expected bool
+	}{
+		{postgres{}, &pq.Error{Code: "23505"}, true},
+		{postgres{}, &pq.Error{Code: "23503"}, false},
+		{sqlite{}, sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintUnique}, true},
+		{sqlite{}, sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintForeignKey}, false},
+		{mysql{}, fmt.Errorf("saving: %w", &gomysql.MySQLError{Number: 1062}), true},
+		{mysql{}, errors.New("1062"), false},
+	} {
+		if result := c.dialect.Duplicate(c.err); result != c.expected {
+			t.Errorf("%s: %v: expected %v. Got %v", c.dialect.Name(), c.err, c.expected, result)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+const imageColumns = "id, product_id, content_type, size, width, height, checksum, thumbnail_content_type, created_at"
+
+func scanImage(row scanner) (data.Image, error) {
+	i := data.Image{}
+	err := row.Scan(&i.ID, &i.ProductID, &i.ContentType, &i.Size, &i.Width, &i.Height,
+		&i.Checksum, &i.ThumbnailContentType, &i.CreatedAt)
+	return i, err
+}
+
+// CreateImage - Records an image of a tenant's product, once its blobs are
+// stored
+func CreateImage(db DBTX, tenantID string, i data.Image) error {
+	_, err := db.Exec(`INSERT INTO product_images(tenant_id, `+imageColumns+`)
+        VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		tenantID, i.ID, i.ProductID, i.ContentType, i.Size, i.Width, i.Height,
+		i.Checksum, i.ThumbnailContentType, i.CreatedAt.UTC())
+	return err
+}
+
+// GetImage - One of a product's images; sql.ErrNoRows when the product has
+// no such image
+func GetImage(db DBTX, tenantID, productID, id string) (data.Image, error) {
+	return scanImage(db.QueryRow("SELECT "+imageColumns+
+		" FROM product_images WHERE tenant_id=$1 AND product_id=$2 AND id=$3", tenantID, productID, id))
+}
+
+// DeleteImage - Forgets one of a product's images. sql.ErrNoRows when the
+// product has no such image.
+func DeleteImage(db DBTX, tenantID, productID, id string) error {
+	res, err := db.Exec("DELETE FROM product_images WHERE tenant_id=$1 AND product_id=$2 AND id=$3",
+		tenantID, productID, id)
+	if err == nil {
+		err = expectOneRow(res, sql.ErrNoRows)
+	}
+	return err
+}
+
+// GetProductImages - The images of each product, oldest first
+func GetProductImages(db DBTX, tenantID string, productIDs ...string) (map[string][]data.Image, error) {
+	images := map[string][]data.Image{}
+	if len(productIDs) == 0 {
+		return images, nil
+	}
+	placeholders := make([]string, len(productIDs))
+	args := []interface{}{tenantID}
+	for i, id := range productIDs {
+		args = append(args, id)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+	rows, err := db.Query(fmt.Sprintf(`SELECT %s FROM product_images
+        WHERE tenant_id=$1 AND product_id IN (%s) ORDER BY created_at, id`,
+		imageColumns, strings.Join(placeholders, ", ")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		i, err := scanImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		images[i.ProductID] = append(images[i.ProductID], i)
+	}
+	return images, rows.Err()
+}
+
+// GetProductImageIDs - The ids of a product's images, read before the
+// product is deleted so that their blobs can be removed after
+func GetProductImageIDs(db DBTX, tenantID, productID string) ([]string, error) {
+	return imageIDs(db, "SELECT id FROM product_images WHERE tenant_id=$1 AND product_id=$2",
+		tenantID, productID)
+}
+
+func imageIDs(db DBTX, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,196 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+var (
+	ErrInsufficientStock     = errors.New("Not enough stock available")
+	ErrStockBelowReserved    = errors.New("Stock on hand cannot drop below the quantity reserved")
+	ErrReservationNotPending = errors.New("Reservation is no longer pending")
+	ErrReservationExpired    = errors.New("Reservation has expired")
+)
+
+// Every stock change below is a single conditional UPDATE, so the check and
+// the write cannot be separated by another writer: postgres re-evaluates
+// the WHERE clause after waiting on the row lock, and sqlite serialises
+// writers outright. Each runs in a transaction with whatever else it
+// writes.
+
+// GetInventory - Stock for a product; products never stocked have none
+func GetInventory(db DBTX, tenantID, productID string) (data.Inventory, error) {
+	i := data.Inventory{ProductID: productID}
+	err := db.QueryRow("SELECT on_hand, reserved FROM inventory WHERE tenant_id=$1 AND product_id=$2",
+		tenantID, productID).Scan(&i.OnHand, &i.Reserved)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return i, err
+}
+
+// SetStock - Records the units on hand, refusing to strand reservations.
+// The product must belong to the tenant; it is locked as it is checked, so
+// it cannot be deleted before its stock is written.
+func SetStock(db *DB, tenantID, productID string, onHand int64) error {
+	return db.WithTx(db.context(), func(tx *Tx) error {
+		if _, err := getProduct(tx, tenantID, productID, tx.Dialect().ForUpdate()); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO inventory(tenant_id, product_id, on_hand, reserved) VALUES($1, $2, 0, 0) `+
+			tx.Dialect().OnConflict([]string{"tenant_id", "product_id"}), tenantID, productID); err != nil {
+			return err
+		}
+		res, err := tx.Exec(`UPDATE inventory SET on_hand=$1
+            WHERE tenant_id=$2 AND product_id=$3 AND reserved <= $1`, onHand, tenantID, productID)
+		if err != nil {
+			return err
+		}
+		return expectOneRow(res, ErrStockBelowReserved)
+	})
+}
+
+func GetReservation(db DBTX, tenantID, id string) (data.Reservation, error) {
+	r := data.Reservation{}
+	err := db.QueryRow(`SELECT id, product_id, quantity, status, created_at, expires_at
+        FROM reservations WHERE tenant_id=$1 AND id=$2`, tenantID, id).Scan(
+		&r.ID, &r.ProductID, &r.Quantity, &r.Status, &r.CreatedAt, &r.ExpiresAt)
+	return r, err
+}
+
+// Reserve - Holds quantity units of a product until now+ttl, or fails with
+// ErrInsufficientStock
+func Reserve(db *DB, tenantID, productID string, quantity int64, ttl time.Duration, now time.Time) (data.Reservation, error) {
+	now = now.UTC().Truncate(time.Microsecond)
+	r := data.Reservation{
+		ID:        uuid.Must(uuid.NewV4(), nil).String(),
+		ProductID: productID,
+		Quantity:  quantity,
+		Status:    data.ReservationPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	err := db.WithTx(db.context(), func(tx *Tx) error {
+		res, err := tx.Exec(`UPDATE inventory SET reserved = reserved + $1
+            WHERE product_id=$2 AND on_hand - reserved >= $1 AND tenant_id=$3`,
+			quantity, productID, tenantID)
+		if err == nil {
+			err = expectOneRow(res, ErrInsufficientStock)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO reservations(tenant_id, id, product_id, quantity, status, created_at, expires_at)
+            VALUES($1, $2, $3, $4, $5, $6, $7)`,
+			tenantID, r.ID, r.ProductID, r.Quantity, r.Status, r.CreatedAt, r.ExpiresAt)
+		return err
+	})
+	return r, err
+}
+
+// CommitReservation - Turns a pending, unexpired reservation into a sale,
+// taking its units off hand
+func CommitReservation(db *DB, tenantID, id string, now time.Time) (data.Reservation, error) {
+	return finishReservation(db, tenantID, id, data.ReservationCommitted,
+		" AND expires_at > $4", []interface{}{now.UTC()},
+		"UPDATE inventory SET on_hand = on_hand - $1, reserved = reserved - $1 WHERE tenant_id=$2 AND product_id=$3")
+}
+
+// ReleaseReservation - Returns a pending reservation's units to stock
+func ReleaseReservation(db *DB, tenantID, id string) (data.Reservation, error) {
+	return finishReservation(db, tenantID, id, data.ReservationReleased,
+		"", nil,
+		"UPDATE inventory SET reserved = reserved - $1 WHERE tenant_id=$2 AND product_id=$3")
+}
+
+// ExpireReservations - Releases every pending reservation, in every tenant,
+// whose hold has lapsed by now, returning how many were expired
+func ExpireReservations(db *DB, now time.Time) (int, error) {
+	rows, err := db.Query(
+		"SELECT tenant_id, id FROM reservations WHERE status=$1 AND expires_at <= $2",
+		data.ReservationPending, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	lapsed := [][2]string{}
+	for rows.Next() {
+		var tenantID, id string
+		if err := rows.Scan(&tenantID, &id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		lapsed = append(lapsed, [2]string{tenantID, id})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, r := range lapsed {
+		_, err := finishReservation(db, r[0], r[1], data.ReservationExpired,
+			" AND expires_at <= $4", []interface{}{now.UTC()},
+			"UPDATE inventory SET reserved = reserved - $1 WHERE tenant_id=$2 AND product_id=$3")
+		switch err {
+		case nil:
+			expired++
+		case ErrReservationNotPending:
+			// Committed or released since we looked.
+		default:
+			return expired, err
+		}
+	}
+	return expired, nil
+}
+
+// finishReservation moves a pending reservation to status when the extra
+// condition holds, then applies adjust to its product's inventory. The status change
+// is conditional on the reservation still being pending, so racing
+// commits, releases and expiries settle each reservation exactly once.
+func finishReservation(db *DB, tenantID, id string, status data.ReservationStatus,
+	condition string, conditionArgs []interface{}, adjust string) (data.Reservation, error) {
+	var r data.Reservation
+	err := db.WithTx(db.context(), func(tx *Tx) error {
+		args := append([]interface{}{status, tenantID, id}, conditionArgs...)
+		res, err := tx.Exec("UPDATE reservations SET status=$1 WHERE tenant_id=$2 AND id=$3 AND status='pending'"+
+			condition, args...)
+		if err != nil {
+			return err
+		}
+		if r, err = GetReservation(tx, tenantID, id); err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			if err != nil {
+				return err
+			}
+			if r.Status == data.ReservationPending {
+				return ErrReservationExpired
+			}
+			return ErrReservationNotPending
+		}
+		res, err = tx.Exec(adjust, r.Quantity, tenantID, r.ProductID)
+		if err == nil {
+			err = expectOneRow(res, ErrInsufficientStock)
+		}
+		return err
+	})
+	return r, err
+}
+
+func expectOneRow(res sql.Result, otherwise error) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return otherwise
+	}
+	return nil
+}
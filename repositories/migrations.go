@@ -0,0 +1,465 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// DBTX - What the repositories need of a DB or a Tx
+type DBTX interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Dialect() Dialect
+}
+
+// Statements - SQL to run, keyed by driver name; "" applies to any driver
+type Statements map[string][]string
+
+func (s Statements) For(driver string) []string {
+	if statements, ok := s[driver]; ok {
+		return statements
+	}
+	return s[""]
+}
+
+// Migration - One reversible step in the schema's history. Statements are
+// written as postgres would take them and pass through the dialect's DDL.
+// UpFunc and DownFunc run after the statements, for steps that need to
+// inspect the database before deciding what to do.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       Statements
+	Down     Statements
+	UpFunc   func(tx *Tx) error
+	DownFunc func(tx *Tx) error
+}
+
+// MigrationState - Whether a known migration has been applied
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrations - Every schema change, in the order they must be applied
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create products",
+		Up: Statements{"": {`CREATE TABLE IF NOT EXISTS products (
+        id VARCHAR(36) NOT NULL,
+        name TEXT NOT NULL,
+        price NUMERIC(10,2) NOT NULL DEFAULT 0.00,
+        CONSTRAINT products_pkey PRIMARY KEY (id)
+    )`}},
+		Down: Statements{"": {"DROP TABLE products"}},
+	},
+	{
+		Version: 2,
+		Name:    "product search index",
+		Up: Statements{"postgres": {
+			`ALTER TABLE products ADD COLUMN search tsvector
+        GENERATED ALWAYS AS (to_tsvector('simple', name)) STORED`,
+			"CREATE INDEX products_search_idx ON products USING GIN (search)",
+		}},
+		Down: Statements{"postgres": {
+			"DROP INDEX products_search_idx",
+			"ALTER TABLE products DROP COLUMN search",
+		}},
+		UpFunc:   createSQLiteSearchIndex,
+		DownFunc: dropSQLiteSearchIndex,
+	},
+	{
+		Version: 3,
+		Name:    "create categories",
+		Up: Statements{"": {
+			`CREATE TABLE categories (
+        id VARCHAR(36) NOT NULL,
+        name TEXT NOT NULL,
+        parent_id VARCHAR(36) NULL,
+        CONSTRAINT categories_pkey PRIMARY KEY (id),
+        CONSTRAINT categories_parent_fkey FOREIGN KEY (parent_id) REFERENCES categories (id)
+    )`,
+			"CREATE INDEX categories_parent_idx ON categories (parent_id)",
+			`CREATE TABLE product_categories (
+        product_id VARCHAR(36) NOT NULL,
+        category_id VARCHAR(36) NOT NULL,
+        CONSTRAINT product_categories_pkey PRIMARY KEY (product_id, category_id),
+        CONSTRAINT product_categories_product_fkey FOREIGN KEY (product_id)
+            REFERENCES products (id) ON DELETE CASCADE,
+        CONSTRAINT product_categories_category_fkey FOREIGN KEY (category_id)
+            REFERENCES categories (id) ON DELETE CASCADE
+    )`,
+			"CREATE INDEX product_categories_category_idx ON product_categories (category_id)",
+		}},
+		Down: Statements{"": {
+			"DROP TABLE product_categories",
+			"DROP TABLE categories",
+		}},
+	},
+	{
+		Version: 4,
+		Name:    "create inventory and reservations",
+		Up: Statements{"": {
+			`CREATE TABLE inventory (
+        product_id VARCHAR(36) NOT NULL,
+        on_hand BIGINT NOT NULL DEFAULT 0,
+        reserved BIGINT NOT NULL DEFAULT 0,
+        CONSTRAINT inventory_pkey PRIMARY KEY (product_id),
+        CONSTRAINT inventory_product_fkey FOREIGN KEY (product_id)
+            REFERENCES products (id) ON DELETE CASCADE,
+        CONSTRAINT inventory_reserved_check CHECK (reserved >= 0 AND reserved <= on_hand)
+    )`,
+			`CREATE TABLE reservations (
+        id VARCHAR(36) NOT NULL,
+        product_id VARCHAR(36) NOT NULL,
+        quantity BIGINT NOT NULL,
+        status VARCHAR(16) NOT NULL,
+        created_at TIMESTAMP NOT NULL,
+        expires_at TIMESTAMP NOT NULL,
+        CONSTRAINT reservations_pkey PRIMARY KEY (id),
+        CONSTRAINT reservations_product_fkey FOREIGN KEY (product_id)
+            REFERENCES products (id) ON DELETE CASCADE,
+        CONSTRAINT reservations_quantity_check CHECK (quantity > 0)
+    )`,
+			"CREATE INDEX reservations_pending_idx ON reservations (status, expires_at)",
+		}},
+		Down: Statements{"": {
+			"DROP TABLE reservations",
+			"DROP TABLE inventory",
+		}},
+	},
+	{
+		Version: 5,
+		Name:    "create product price history",
+		Up: Statements{"": {
+			`CREATE TABLE product_prices (
+        id VARCHAR(36) NOT NULL,
+        product_id VARCHAR(36) NOT NULL,
+        price NUMERIC(10,2) NOT NULL,
+        effective_at TIMESTAMP NOT NULL,
+        created_at TIMESTAMP NOT NULL,
+        applied_at TIMESTAMP NULL,
+        CONSTRAINT product_prices_pkey PRIMARY KEY (id),
+        CONSTRAINT product_prices_product_fkey FOREIGN KEY (product_id)
+            REFERENCES products (id) ON DELETE CASCADE
+    )`,
+			"CREATE INDEX product_prices_effective_idx ON product_prices (product_id, effective_at)",
+			"CREATE INDEX product_prices_pending_idx ON product_prices (applied_at, effective_at)",
+		}},
+		Down:   Statements{"": {"DROP TABLE product_prices"}},
+		UpFunc: backfillPriceHistory,
+	},
+	{
+		Version: 6,
+		Name:    "scope data by tenant",
+		Up: Statements{"": {
+			`CREATE TABLE tenants (
+        id VARCHAR(63) NOT NULL,
+        name TEXT NOT NULL,
+        created_at TIMESTAMP NOT NULL,
+        CONSTRAINT tenants_pkey PRIMARY KEY (id)
+    )`,
+			"INSERT INTO tenants(id, name, created_at) VALUES('default', 'Default', CURRENT_TIMESTAMP)",
+			"ALTER TABLE products ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default'",
+			"ALTER TABLE categories ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default'",
+			"ALTER TABLE product_categories ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default'",
+			"ALTER TABLE inventory ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default'",
+			"ALTER TABLE reservations ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default'",
+			"ALTER TABLE product_prices ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default'",
+			"CREATE INDEX products_tenant_idx ON products (tenant_id)",
+			"CREATE INDEX categories_tenant_idx ON categories (tenant_id)",
+		}},
+		Down: Statements{"": {
+			"DROP INDEX categories_tenant_idx ON categories",
+			"DROP INDEX products_tenant_idx ON products",
+			"ALTER TABLE product_prices DROP COLUMN tenant_id",
+			"ALTER TABLE reservations DROP COLUMN tenant_id",
+			"ALTER TABLE inventory DROP COLUMN tenant_id",
+			"ALTER TABLE product_categories DROP COLUMN tenant_id",
+			"ALTER TABLE categories DROP COLUMN tenant_id",
+			"ALTER TABLE products DROP COLUMN tenant_id",
+			"DROP TABLE tenants",
+		}},
+	},
+	{
+		Version: 7,
+		Name:    "create event outbox",
+		Up: Statements{
+			"postgres": append([]string{outboxTable("id BIGSERIAL NOT NULL")}, outboxIndexes...),
+			"sqlite3":  append([]string{outboxTable("id INTEGER NOT NULL")}, outboxIndexes...),
+			"mysql":    append([]string{outboxTable("id BIGINT NOT NULL AUTO_INCREMENT")}, outboxIndexes...),
+		},
+		Down: Statements{"": {"DROP TABLE outbox"}},
+	},
+	{
+		Version: 8,
+		Name:    "create product images",
+		Up: Statements{"": {
+			`CREATE TABLE product_images (
+        tenant_id VARCHAR(63) NOT NULL,
+        id VARCHAR(36) NOT NULL,
+        product_id VARCHAR(36) NOT NULL,
+        content_type VARCHAR(32) NOT NULL,
+        size BIGINT NOT NULL,
+        width INTEGER NOT NULL,
+        height INTEGER NOT NULL,
+        checksum VARCHAR(64) NOT NULL,
+        thumbnail_content_type VARCHAR(32) NOT NULL,
+        created_at TIMESTAMP NOT NULL,
+        CONSTRAINT product_images_pkey PRIMARY KEY (id),
+        CONSTRAINT product_images_product_fkey FOREIGN KEY (product_id)
+            REFERENCES products (id) ON DELETE CASCADE
+    )`,
+			"CREATE INDEX product_images_product_idx ON product_images (tenant_id, product_id, created_at)",
+		}},
+		Down: Statements{"": {"DROP TABLE product_images"}},
+	},
+	{
+		Version: 9,
+		Name:    "create product variants",
+		Up: Statements{"": {
+			`CREATE TABLE product_variants (
+        tenant_id VARCHAR(63) NOT NULL,
+        id VARCHAR(36) NOT NULL,
+        product_id VARCHAR(36) NOT NULL,
+        sku VARCHAR(64) NOT NULL,
+        options TEXT NOT NULL,
+        price NUMERIC(10,2) NULL,
+        created_at TIMESTAMP NOT NULL,
+        CONSTRAINT product_variants_pkey PRIMARY KEY (id),
+        CONSTRAINT product_variants_sku_key UNIQUE (tenant_id, sku),
+        CONSTRAINT product_variants_product_fkey FOREIGN KEY (product_id)
+            REFERENCES products (id) ON DELETE CASCADE
+    )`,
+			"CREATE INDEX product_variants_product_idx ON product_variants (tenant_id, product_id)",
+		}},
+		Down: Statements{"": {"DROP TABLE product_variants"}},
+	},
+	{
+		Version: 10,
+		Name:    "create product translations",
+		Up: Statements{"": {`CREATE TABLE product_translations (
+        tenant_id VARCHAR(63) NOT NULL,
+        product_id VARCHAR(36) NOT NULL,
+        locale VARCHAR(35) NOT NULL,
+        name TEXT NOT NULL,
+        description TEXT NOT NULL,
+        CONSTRAINT product_translations_pkey PRIMARY KEY (product_id, locale),
+        CONSTRAINT product_translations_product_fkey FOREIGN KEY (product_id)
+            REFERENCES products (id) ON DELETE CASCADE
+    )`}},
+		Down: Statements{"": {"DROP TABLE product_translations"}},
+	},
+	{
+		Version: 11,
+		Name:    "create exchange rates and currency prices",
+		Up: Statements{"": {
+			`CREATE TABLE exchange_rates (
+        currency VARCHAR(3) NOT NULL,
+        rate NUMERIC(18,8) NOT NULL,
+        as_of TIMESTAMP NOT NULL,
+        CONSTRAINT exchange_rates_pkey PRIMARY KEY (currency)
+    )`,
+			`CREATE TABLE product_currency_prices (
+        tenant_id VARCHAR(63) NOT NULL,
+        product_id VARCHAR(36) NOT NULL,
+        currency VARCHAR(3) NOT NULL,
+        price NUMERIC(11,3) NOT NULL,
+        CONSTRAINT product_currency_prices_pkey PRIMARY KEY (product_id, currency),
+        CONSTRAINT product_currency_prices_product_fkey FOREIGN KEY (product_id)
+            REFERENCES products (id) ON DELETE CASCADE
+    )`,
+		}},
+		Down: Statements{"": {"DROP TABLE product_currency_prices", "DROP TABLE exchange_rates"}},
+	},
+	{
+		Version:  12,
+		Name:     "key tenant data by tenant",
+		UpFunc:   rekeyByTenant(true),
+		DownFunc: rekeyByTenant(false),
+	},
+	{
+		Version: 13,
+		Name:    "add tenant keys",
+		Up:      Statements{"": {"ALTER TABLE tenants ADD COLUMN key_hash VARCHAR(64) NULL"}},
+		Down:    Statements{"": {"ALTER TABLE tenants DROP COLUMN key_hash"}},
+	},
+}
+
+// outboxTable - The outbox, numbered in the order events were written. Each
+// database spells an ascending key its own way; an INTEGER PRIMARY KEY is
+// sqlite's.
+func outboxTable(id string) string {
+	return `CREATE TABLE outbox (
+        ` + id + `,
+        tenant_id VARCHAR(63) NOT NULL,
+        product_id VARCHAR(36) NOT NULL,
+        event_type VARCHAR(32) NOT NULL,
+        payload TEXT NOT NULL,
+        occurred_at TIMESTAMP NOT NULL,
+        attempts INTEGER NOT NULL DEFAULT 0,
+        next_attempt_at TIMESTAMP NOT NULL,
+        delivered_at TIMESTAMP NULL,
+        last_error TEXT NULL,
+        CONSTRAINT outbox_pkey PRIMARY KEY (id)
+    )`
+}
+
+// outboxIndexes find what is undelivered, and what came before it for the
+// same product
+var outboxIndexes = []string{
+	"CREATE INDEX outbox_pending_idx ON outbox (delivered_at, id)",
+	"CREATE INDEX outbox_product_idx ON outbox (tenant_id, product_id, id)",
+}
+
+func ensureMigrationsTable(db DBTX) error {
+	_, err := db.Exec(db.Dialect().DDL(`CREATE TABLE IF NOT EXISTS schema_migrations (
+        version INTEGER NOT NULL,
+        name TEXT NOT NULL,
+        applied_at TIMESTAMP NOT NULL,
+        CONSTRAINT schema_migrations_pkey PRIMARY KEY (version)
+    )`))
+	return err
+}
+
+func appliedMigrations(db DBTX) (map[int]time.Time, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// MigrationStatus - Every known migration and when it was applied
+func MigrationStatus(db DBTX) ([]MigrationState, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	states := []MigrationState{}
+	for _, m := range Migrations {
+		state := MigrationState{Migration: m}
+		if at, ok := applied[m.Version]; ok {
+			state.AppliedAt = &at
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// PendingMigrations - Migrations not yet applied, oldest first
+func PendingMigrations(db DBTX) ([]Migration, error) {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return nil, err
+	}
+	pending := []Migration{}
+	for _, s := range states {
+		if s.AppliedAt == nil {
+			pending = append(pending, s.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// MigrateUp - Applies pending migrations up to and including target, or all
+// of them when target is zero. Each runs in a transaction, though MySQL
+// commits schema changes as it makes them.
+func MigrateUp(db *DB, target int) ([]Migration, error) {
+	pending, err := PendingMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	done := []Migration{}
+	for _, m := range pending {
+		if target > 0 && m.Version > target {
+			break
+		}
+		if err := runMigration(db, m, m.Up, m.UpFunc,
+			"INSERT INTO schema_migrations(version, name, applied_at) VALUES($1, $2, $3)",
+			m.Version, m.Name, time.Now().UTC()); err != nil {
+			return done, err
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// MigrateDown - Reverts the most recently applied migrations, newest first
+func MigrateDown(db *DB, steps int) ([]Migration, error) {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return nil, err
+	}
+	done := []Migration{}
+	for i := len(states) - 1; i >= 0 && len(done) < steps; i-- {
+		m := states[i]
+		if m.AppliedAt == nil {
+			continue
+		}
+		if err := runMigration(db, m.Migration, m.Down, m.DownFunc,
+			"DELETE FROM schema_migrations WHERE version=$1", m.Version); err != nil {
+			return done, err
+		}
+		done = append(done, m.Migration)
+	}
+	return done, nil
+}
+
+// MigrateDownTo - Reverts every applied migration newer than version,
+// newest first
+func MigrateDownTo(db *DB, version int) ([]Migration, error) {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return nil, err
+	}
+	steps := 0
+	for _, s := range states {
+		if s.AppliedAt != nil && s.Version > version {
+			steps++
+		}
+	}
+	return MigrateDown(db, steps)
+}
+
+func runMigration(db *DB, m Migration, statements Statements,
+	fn func(tx *Tx) error, record string, args ...interface{}) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements.For(db.Dialect().Name()) {
+		if _, err := tx.Exec(db.Dialect().DDL(statement)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+	}
+	if fn != nil {
+		if err := fn(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+	}
+	if _, err := tx.Exec(record, args...); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+	}
+	return tx.Commit()
+}
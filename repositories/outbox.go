@@ -0,0 +1,94 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/events"
+)
+
+// OutboxEvent - A product change recorded in the outbox, with how its
+// delivery is going
+type OutboxEvent struct {
+	events.Event
+	Attempts      int
+	NextAttemptAt time.Time
+}
+
+// EnqueueEvent - Records a change to p in the outbox. Call it in the
+// transaction that makes the change, so the event is kept exactly when the
+// change is.
+func EnqueueEvent(db DBTX, tenantID string, eventType events.Type, p data.Product) error {
+	payload, err := data.JSONMarshal(p)
+	if err != nil {
+		return err
+	}
+	at := now()
+	_, err = db.Exec(`INSERT INTO outbox(tenant_id, product_id, event_type, payload, occurred_at, next_attempt_at)
+        VALUES($1, $2, $3, $4, $5, $5)`,
+		tenantID, p.GetID(), string(eventType), string(payload), at)
+	return err
+}
+
+// DueEvents - Up to limit undelivered events due an attempt by at, oldest
+// first. Only the oldest undelivered event of each product is due, so a
+// product's events are published in the order they happened, one at a time.
+func DueEvents(db DBTX, at time.Time, limit int) ([]OutboxEvent, error) {
+	rows, err := db.Query(`SELECT id, tenant_id, event_type, payload, occurred_at, attempts, next_attempt_at
+        FROM outbox WHERE delivered_at IS NULL AND next_attempt_at <= $1
+        AND NOT EXISTS (SELECT 1 FROM outbox earlier WHERE earlier.tenant_id = outbox.tenant_id
+            AND earlier.product_id = outbox.product_id AND earlier.delivered_at IS NULL
+            AND earlier.id < outbox.id)
+        ORDER BY id LIMIT $2`, at.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	due := []OutboxEvent{}
+	for rows.Next() {
+		e := OutboxEvent{}
+		var eventType, payload string
+		if err := rows.Scan(&e.ID, &e.TenantID, &eventType, &payload, &e.OccurredAt,
+			&e.Attempts, &e.NextAttemptAt); err != nil {
+			return nil, err
+		}
+		e.Type = events.Type(eventType)
+		if e.Product, err = data.ParseProductDataJSON([]byte(payload)); err != nil {
+			return nil, err
+		}
+		due = append(due, e)
+	}
+	return due, rows.Err()
+}
+
+// MarkEventDelivered - Records that every sink has event id
+func MarkEventDelivered(db DBTX, id int64, at time.Time) error {
+	res, err := db.Exec("UPDATE outbox SET delivered_at=$1 WHERE id=$2", at.UTC(), id)
+	if err == nil {
+		err = expectOneRow(res, sql.ErrNoRows)
+	}
+	return err
+}
+
+// MarkEventFailed - Records a failed delivery of event id, and when to try
+// again
+func MarkEventFailed(db DBTX, id int64, next time.Time, cause string) error {
+	res, err := db.Exec("UPDATE outbox SET attempts=attempts+1, next_attempt_at=$1, last_error=$2 WHERE id=$3",
+		next.UTC(), cause, id)
+	if err == nil {
+		err = expectOneRow(res, sql.ErrNoRows)
+	}
+	return err
+}
+
+// PurgeDeliveredEvents - Removes events delivered before cutoff, returning
+// how many went
+func PurgeDeliveredEvents(db DBTX, cutoff time.Time) (int64, error) {
+	res, err := db.Exec("DELETE FROM outbox WHERE delivered_at IS NOT NULL AND delivered_at < $1", cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,177 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/events"
+)
+
+// now is the moment reads resolve prices at
+var now = func() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// effectivePrice is the SQL for the price in effect at the time bound to
+// placeholder n, for the products table known as table in the query, from
+// its own tenant's price history. The stored price only lags behind it until
+// the scheduler catches up.
+func effectivePrice(table string, n int) string {
+	return fmt.Sprintf(`COALESCE((SELECT pp.price FROM product_prices pp
+        WHERE pp.tenant_id = %[1]s.tenant_id AND pp.product_id = %[1]s.id AND pp.effective_at <= $%[2]d
+        ORDER BY pp.effective_at DESC, pp.created_at DESC LIMIT 1), %[1]s.price)`, table, n)
+}
+
+func recordPrice(db DBTX, tenantID, productID string, price float64, at time.Time) error {
+	_, err := db.Exec(`INSERT INTO product_prices(tenant_id, id, product_id, price, effective_at, created_at, applied_at)
+        VALUES($1, $2, $3, $4, $5, $5, $5)`,
+		tenantID, uuid.Must(uuid.NewV4(), nil).String(), productID, price, at)
+	return err
+}
+
+// SchedulePrice - Queues a price to take effect at effectiveAt
+func SchedulePrice(db DBTX, tenantID, productID string, price float64, effectiveAt time.Time) (data.PriceChange, error) {
+	c := data.PriceChange{
+		ID:          uuid.Must(uuid.NewV4(), nil).String(),
+		ProductID:   productID,
+		Price:       price,
+		EffectiveAt: effectiveAt.UTC().Truncate(time.Microsecond),
+		CreatedAt:   now(),
+	}
+	_, err := db.Exec(`INSERT INTO product_prices(tenant_id, id, product_id, price, effective_at, created_at)
+        VALUES($1, $2, $3, $4, $5, $6)`, tenantID, c.ID, c.ProductID, c.Price, c.EffectiveAt, c.CreatedAt)
+	return c, err
+}
+
+// GetPriceHistory - A product's price changes, latest effective first,
+// including those still scheduled
+func GetPriceHistory(db DBTX, tenantID, productID string, page uint64, count uint8) ([]data.PriceChange, error) {
+	if page > 0 {
+		page--
+	}
+	rows, err := db.Query(`SELECT id, product_id, price, effective_at, created_at, applied_at
+        FROM product_prices WHERE tenant_id=$1 AND product_id=$2
+        ORDER BY effective_at DESC, created_at DESC LIMIT $3 OFFSET $4`,
+		tenantID, productID, count, page*uint64(count))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []data.PriceChange{}
+	for rows.Next() {
+		c := data.PriceChange{}
+		if err := rows.Scan(&c.ID, &c.ProductID, &c.Price, &c.EffectiveAt,
+			&c.CreatedAt, &c.AppliedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+func CountPriceHistory(db DBTX, tenantID, productID string) uint64 {
+	i := uint64(0)
+	err := db.QueryRow("SELECT COUNT(id) FROM product_prices WHERE tenant_id=$1 AND product_id=$2",
+		tenantID, productID).Scan(&i)
+	if err != nil {
+		i = uint64(0)
+	}
+	return i
+}
+
+// TenantProduct - Identifies a product across tenants, for the background
+// jobs that work on every tenant at once
+type TenantProduct struct {
+	TenantID  string
+	ProductID string
+}
+
+// ApplyScheduledPrices - Writes prices that have come into effect by at to
+// their products, in every tenant, queueing an update event for each, and
+// returns the products changed
+func ApplyScheduledPrices(db *DB, at time.Time) ([]TenantProduct, error) {
+	at = at.UTC()
+	var changed []TenantProduct
+	err := db.WithTx(db.context(), func(tx *Tx) error {
+		// Write first, so sqlite takes its write lock before reading.
+		due := "SELECT tenant_id, product_id FROM product_prices WHERE applied_at IS NULL AND effective_at <= $1"
+		if _, err := tx.Exec("UPDATE products SET price = "+effectivePrice("products", 1)+
+			" WHERE EXISTS (SELECT 1 FROM ("+due+") due"+
+			" WHERE due.tenant_id = products.tenant_id AND due.product_id = products.id)", at); err != nil {
+			return err
+		}
+		rows, err := tx.Query("SELECT DISTINCT tenant_id, product_id FROM ("+due+") due", at)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		changed = []TenantProduct{}
+		for rows.Next() {
+			c := TenantProduct{}
+			if err := rows.Scan(&c.TenantID, &c.ProductID); err != nil {
+				return err
+			}
+			changed = append(changed, c)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+		for _, c := range changed {
+			p, err := GetProduct(tx, c.TenantID, c.ProductID)
+			if err != nil {
+				return err
+			}
+			if err := EnqueueEvent(tx, c.TenantID, events.ProductUpdated, p); err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec(
+			"UPDATE product_prices SET applied_at=$1 WHERE applied_at IS NULL AND effective_at <= $1", at)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// backfillPriceHistory gives every existing product an opening price
+func backfillPriceHistory(tx *Tx) error {
+	rows, err := tx.Query("SELECT id, price FROM products")
+	if err != nil {
+		return err
+	}
+	type opening struct {
+		id    string
+		price float64
+	}
+	openings := []opening{}
+	for rows.Next() {
+		o := opening{}
+		if err := rows.Scan(&o.id, &o.price); err != nil {
+			rows.Close()
+			return err
+		}
+		openings = append(openings, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	// Tenants come later in the schema's history, so this cannot use
+	// recordPrice.
+	at := now()
+	for _, o := range openings {
+		if _, err := tx.Exec(`INSERT INTO product_prices(id, product_id, price, effective_at, created_at, applied_at)
+            VALUES($1, $2, $3, $4, $4, $4)`,
+			uuid.Must(uuid.NewV4(), nil).String(), o.id, o.price, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,49 +2,153 @@ package repositories
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/Lewiscowles1986/go-gorilla-api/data"
 )
 
-func GetProduct(db *sql.DB, id string) (data.Product, error) {
-	return data.ParseProductData(
-		db.QueryRow("SELECT id, name, price FROM products WHERE id=$1", id))
+var ErrProductExists = errors.New("Product already exists")
+
+// GetProduct - A tenant's product with the price in effect now
+func GetProduct(db DBTX, tenantID, id string) (data.Product, error) {
+	return getProduct(db, tenantID, id, "")
 }
 
-func UpdateProduct(db *sql.DB, id string, p data.Product) error {
-	_, err :=
-		db.Exec("UPDATE products SET name=$1, price=$2 WHERE id=$3",
-			p.GetName(), p.GetPrice(), id)
+// getProduct reads a product, ending the query with lock
+func getProduct(db DBTX, tenantID, id, lock string) (data.Product, error) {
+	return data.ParseProductData(db.QueryRow(
+		"SELECT id, name, "+effectivePrice("products", 1)+" FROM products WHERE tenant_id=$2 AND id=$3"+lock,
+		now(), tenantID, id))
+}
 
-	return err
+// UpdateProduct - Saves a product, recording a change of price in its
+// history, and returns it as saved. sql.ErrNoRows when the tenant has no
+// such product. Run it in a transaction: the row is locked as it is read,
+// or on sqlite the write fails as busy if another got in first, so the
+// price it compares against cannot change before the write.
+func UpdateProduct(db DBTX, tenantID, id string, p data.Product) (data.Product, error) {
+	current, err := getProduct(db, tenantID, id, db.Dialect().ForUpdate())
+	if err != nil {
+		return nil, err
+	}
+	saved, err := updateProductRow(db, tenantID, id, p)
+	if err != nil || current.GetPrice() == p.GetPrice() {
+		return saved, err
+	}
+	return saved, recordPrice(db, tenantID, id, p.GetPrice(), now())
 }
 
-func DeleteProduct(db *sql.DB, id string) error {
-	_, err := db.Exec("DELETE FROM products WHERE id=$1", id)
+// updateProductRow writes p, reading the row back with RETURNING where the
+// dialect has it. The new price is recorded as it is written, so it is
+// also the price in effect.
+func updateProductRow(db DBTX, tenantID, id string, p data.Product) (data.Product, error) {
+	update := "UPDATE products SET name=$1, price=$2 WHERE tenant_id=$3 AND id=$4"
+	if db.Dialect().Returning() {
+		return data.ParseProductData(db.QueryRow(update+" RETURNING id, name, price",
+			p.GetName(), p.GetPrice(), tenantID, id))
+	}
+	res, err := db.Exec(update, p.GetName(), p.GetPrice(), tenantID, id)
+	if err == nil {
+		err = expectOneRow(res, sql.ErrNoRows)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data.ParseProductData(db.QueryRow(
+		"SELECT id, name, price FROM products WHERE tenant_id=$1 AND id=$2", tenantID, id))
+}
 
-	return err
+// DeleteProduct - Removes a product and everything about it, returning it
+// as it was. sql.ErrNoRows when the tenant has no such product.
+func DeleteProduct(db DBTX, tenantID, id string) (data.Product, error) {
+	p, err := GetProduct(db, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, dependent := range []string{"product_categories", "reservations", "inventory", "product_prices",
+		"product_images", "product_variants", "product_translations", "product_currency_prices"} {
+		if _, err := db.Exec("DELETE FROM "+dependent+" WHERE tenant_id=$1 AND product_id=$2",
+			tenantID, id); err != nil {
+			return nil, err
+		}
+	}
+	res, err := db.Exec("DELETE FROM products WHERE tenant_id=$1 AND id=$2", tenantID, id)
+	if err == nil {
+		err = expectOneRow(res, sql.ErrNoRows)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
 }
 
-func CreateProduct(db *sql.DB, p data.Product) error {
+// CreateProduct - Records a tenant's new product at its opening price.
+// ErrProductExists when the tenant already has a product with its id.
+func CreateProduct(db DBTX, tenantID string, p data.Product) error {
 	_, err := db.Exec(
-		"INSERT INTO products(id, name, price) VALUES($1, $2, $3)",
-		p.GetID(), p.GetName(), p.GetPrice())
+		"INSERT INTO products(tenant_id, id, name, price) VALUES($1, $2, $3, $4)",
+		tenantID, p.GetID(), p.GetName(), p.GetPrice())
 
+	if err != nil && db.Dialect().Duplicate(err) {
+		return ErrProductExists
+	}
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return recordPrice(db, tenantID, p.GetID(), p.GetPrice(), now())
 }
 
-func GetProducts(db *sql.DB, page uint64, count uint8) ([]data.Product, error) {
-	if page > 0 {
-		page--
+// ProductFilter - Optional criteria narrowing a product listing
+type ProductFilter struct {
+	// Name is found anywhere in the product's name, ignoring case; % and _
+	// are matched as themselves
+	Name     string
+	MinPrice *float64
+	MaxPrice *float64
+	// AfterID keeps only products ordered after it, for walking a listing
+	// by key instead of by offset
+	AfterID string
+}
+
+// where builds the tenant's and the filter's conditions. Prices are
+// compared as they stand at the time in placeholder *at, which is bound
+// here if *at is zero.
+func (f ProductFilter) where(tenantID string, args []interface{}, at *int) (string, []interface{}) {
+	args = append(args, tenantID)
+	clauses := []string{fmt.Sprintf("tenant_id = $%d", len(args))}
+	if f.Name != "" {
+		args = append(args, "%"+escapeLike(f.Name)+"%")
+		clauses = append(clauses, fmt.Sprintf("LOWER(name) LIKE LOWER($%d) ESCAPE '!'", len(args)))
 	}
-	pageOffset := page * uint64(count)
-	rows, err := db.Query(
-		"SELECT id, name, price FROM products LIMIT $1 OFFSET $2",
-		count, pageOffset)
+	if (f.MinPrice != nil || f.MaxPrice != nil) && *at == 0 {
+		args = append(args, now())
+		*at = len(args)
+	}
+	if f.AfterID != "" {
+		args = append(args, f.AfterID)
+		clauses = append(clauses, fmt.Sprintf("id > $%d", len(args)))
+	}
+	if f.MinPrice != nil {
+		args = append(args, *f.MinPrice)
+		clauses = append(clauses, fmt.Sprintf("%s >= $%d", effectivePrice("products", *at), len(args)))
+	}
+	if f.MaxPrice != nil {
+		args = append(args, *f.MaxPrice)
+		clauses = append(clauses, fmt.Sprintf("%s <= $%d", effectivePrice("products", *at), len(args)))
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), args
+}
+
+func GetProducts(db DBTX, tenantID string, page uint64, count uint8) ([]data.Product, error) {
+	return FindProducts(db, tenantID, ProductFilter{}, page, count)
+}
+
+func FindProducts(db DBTX, tenantID string, filter ProductFilter, page uint64, count uint8) ([]data.Product, error) {
+	query, args := productQuery(tenantID, filter, data.ProductFields, page, count)
+	rows, err := db.Query(query, args...)
 
 	if err != nil {
 		return nil, err
@@ -55,9 +159,112 @@ func GetProducts(db *sql.DB, page uint64, count uint8) ([]data.Product, error) {
 	return data.ParseProductListData(rows)
 }
 
-func GetProductCount(db *sql.DB) uint64 {
+// FindProductFields - FindProducts, selecting only the named fields of
+// data.ProductFields
+func FindProductFields(db DBTX, tenantID string, filter ProductFilter, fields []string, page uint64, count uint8) ([]data.PartialProduct, error) {
+	query, args := productQuery(tenantID, filter, fields, page, count)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []data.PartialProduct{}
+	for rows.Next() {
+		p, err := scanPartialProduct(rows, fields)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, p)
+	}
+	return products, rows.Err()
+}
+
+// GetProductFields - GetProduct, selecting only the named fields
+func GetProductFields(db DBTX, tenantID, id string, fields []string) (data.PartialProduct, error) {
+	columns, args, _ := productColumns(fields)
+	args = append(args, tenantID, id)
+	return scanPartialProduct(db.QueryRow(fmt.Sprintf(
+		"SELECT %s FROM products WHERE tenant_id=$%d AND id=$%d", columns, len(args)-1, len(args)),
+		args...), fields)
+}
+
+// productQuery pages through products in id order, so that pages neither
+// repeat nor skip rows
+func productQuery(tenantID string, filter ProductFilter, fields []string, page uint64, count uint8) (string, []interface{}) {
+	if page > 0 {
+		page--
+	}
+	pageOffset := page * uint64(count)
+	columns, args, at := productColumns(fields)
+	where, args := filter.where(tenantID, args, &at)
+	args = append(args, count, pageOffset)
+	return fmt.Sprintf("SELECT %s FROM products%s ORDER BY id LIMIT $%d OFFSET $%d",
+		columns, where, len(args)-1, len(args)), args
+}
+
+// productColumns selects id and then the other fields asked for. The
+// effective price needs the time now, which is bound first.
+func productColumns(fields []string) (string, []interface{}, int) {
+	columns := []string{"id"}
+	args := []interface{}{}
+	at := 0
+	for _, f := range fields {
+		switch f {
+		case "id":
+		case "price":
+			args = append(args, now())
+			at = len(args)
+			columns = append(columns, effectivePrice("products", at))
+		default:
+			columns = append(columns, f)
+		}
+	}
+	return strings.Join(columns, ", "), args, at
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPartialProduct(row scanner, fields []string) (data.PartialProduct, error) {
+	p := data.PartialProduct{Fields: map[string]interface{}{}}
+	var name string
+	var price float64
+	dest := []interface{}{&p.ID}
+	for _, f := range fields {
+		switch f {
+		case "name":
+			dest = append(dest, &name)
+		case "price":
+			dest = append(dest, &price)
+		}
+	}
+	if err := row.Scan(dest...); err != nil {
+		return p, err
+	}
+	for _, f := range fields {
+		switch f {
+		case "id":
+			p.Fields[f] = p.ID
+		case "name":
+			p.Fields[f] = name
+		case "price":
+			p.Fields[f] = price
+		}
+	}
+	return p, nil
+}
+
+func GetProductCount(db DBTX, tenantID string) uint64 {
+	return CountProducts(db, tenantID, ProductFilter{})
+}
+
+func CountProducts(db DBTX, tenantID string, filter ProductFilter) uint64 {
 	i := uint64(0)
-	r := db.QueryRow("SELECT COUNT(id) FROM products")
+	at := 0
+	where, args := filter.where(tenantID, []interface{}{}, &at)
+	r := db.QueryRow("SELECT COUNT(id) FROM products"+where, args...)
 	err := r.Scan(&i)
 	if err != nil {
 		i = uint64(0)
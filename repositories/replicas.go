@@ -0,0 +1,113 @@
+package repositories
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cluster - A primary, which takes every write, and read replicas that
+// follow it. Reads take turns among the healthy replicas, and fall back to
+// the primary when there are none.
+type Cluster struct {
+	Primary *DB
+	// PinFor is how long reads under a key stay on the primary after a
+	// write under it, so they see the write however far replicas lag
+	PinFor time.Duration
+
+	replicas []*replica
+	next     uint64
+
+	mu     sync.Mutex
+	pinned map[string]time.Time
+}
+
+type replica struct {
+	db      *DB
+	healthy atomic.Bool
+}
+
+// NewCluster - Replicas start healthy, until a check finds otherwise
+func NewCluster(primary *DB, replicas ...*DB) *Cluster {
+	c := &Cluster{Primary: primary, pinned: map[string]time.Time{}}
+	for _, db := range replicas {
+		r := &replica{db: db}
+		r.healthy.Store(true)
+		c.replicas = append(c.replicas, r)
+	}
+	return c
+}
+
+// Reader - Where to read from under key, such as a tenant
+func (c *Cluster) Reader(key string) *DB {
+	if len(c.replicas) == 0 || c.Pinned(key) {
+		return c.Primary
+	}
+	n := uint64(len(c.replicas))
+	start := atomic.AddUint64(&c.next, 1)
+	for i := uint64(0); i < n; i++ {
+		if r := c.replicas[(start+i)%n]; r.healthy.Load() {
+			return r.db
+		}
+	}
+	return c.Primary
+}
+
+// Wrote - Pins reads under key to the primary for PinFor
+func (c *Cluster) Wrote(key string) {
+	if len(c.replicas) == 0 || c.PinFor <= 0 {
+		return
+	}
+	at := now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, until := range c.pinned {
+		if !at.Before(until) {
+			delete(c.pinned, k)
+		}
+	}
+	c.pinned[key] = at.Add(c.PinFor)
+}
+
+// Pinned - Whether a recent write keeps reads under key on the primary
+func (c *Cluster) Pinned(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	until, ok := c.pinned[key]
+	return ok && now().Before(until)
+}
+
+// CheckReplicas - Pings every replica, taking those that fail out of
+// rotation until they answer again. It reports how many are healthy.
+func (c *Cluster) CheckReplicas(ctx context.Context, timeout time.Duration) int {
+	healthy := 0
+	for i, r := range c.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := r.db.PingContext(pingCtx)
+		cancel()
+		if was := r.healthy.Swap(err == nil); was != (err == nil) {
+			if err != nil {
+				log.Printf("replica %d unhealthy: %v", i, err)
+			} else {
+				log.Printf("replica %d healthy again", i)
+			}
+		}
+		if err == nil {
+			healthy++
+		}
+	}
+	return healthy
+}
+
+// Close - Closes the primary and every replica
+func (c *Cluster) Close() error {
+	err := c.Primary.Close()
+	for _, r := range c.replicas {
+		if rerr := r.db.Close(); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,51 @@
+package repositories
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReaderTakesTurns(t *testing.T) {
+	primary, first, second := &DB{}, &DB{}, &DB{}
+	c := NewCluster(primary, first, second)
+	seen := map[*DB]int{}
+	for i := 0; i < 4; i++ {
+		seen[c.Reader("t")]++
+	}
+	if seen[first] != 2 || seen[second] != 2 {
+		t.Errorf("Expected replicas to take turns. Got %v", seen)
+	}
+
+	c.replicas[0].healthy.Store(false)
+	c.replicas[1].healthy.Store(false)
+	if c.Reader("t") != primary {
+		t.Error("Expected the primary with no healthy replicas")
+	}
+}
+
+func TestWritePinsKeyForAWhile(t *testing.T) {
+	saved, at := now, time.Now()
+	now = func() time.Time { return at }
+	defer func() { now = saved }()
+
+	primary, replica := &DB{}, &DB{}
+	c := NewCluster(primary, replica)
+	c.PinFor = time.Second
+	c.Wrote("t")
+	if c.Reader("t") != primary || c.Reader("u") != replica {
+		t.Error("Expected only t pinned to the primary")
+	}
+	at = at.Add(time.Second)
+	if c.Reader("t") != replica {
+		t.Error("Expected the pin to lapse")
+	}
+}
+
+func TestNoPinWithoutReplicas(t *testing.T) {
+	c := NewCluster(&DB{})
+	c.PinFor = time.Minute
+	c.Wrote("t")
+	if c.Pinned("t") {
+		t.Error("Expected nothing to pin with no replicas")
+	}
+}
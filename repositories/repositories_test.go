@@ -0,0 +1,243 @@
+package repositories
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const tenant = "default"
+
+// eachDialect runs test against a freshly migrated database for every
+// dialect available: sqlite always, postgres and MySQL when
+// TEST_POSTGRES_DSN or TEST_MYSQL_DSN name a database to use. Those are
+// migrated down again afterwards, so must not hold anything worth keeping.
+func eachDialect(t *testing.T, test func(t *testing.T, db *DB)) {
+	dsns := map[string]string{
+		"sqlite3":  ":memory:",
+		"postgres": os.Getenv("TEST_POSTGRES_DSN"),
+		"mysql":    os.Getenv("TEST_MYSQL_DSN"),
+	}
+	for _, driver := range []string{"sqlite3", "postgres", "mysql"} {
+		driver := driver
+		t.Run(driver, func(t *testing.T) {
+			if dsns[driver] == "" {
+				t.Skipf("no %s database to test against", driver)
+			}
+			db, err := Open(driver, dsns[driver])
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			db.SetMaxOpenConns(1)
+			if _, err := MigrateUp(db, 0); err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				if _, err := MigrateDown(db, len(Migrations)); err != nil {
+					t.Error(err)
+				}
+			}()
+			test(t, db)
+		})
+	}
+}
+
+func TestProductRoundTrip(t *testing.T) {
+	eachDialect(t, func(t *testing.T, db *DB) {
+		p := data.CreateProduct("widget", 9.99)
+		if err := CreateProduct(db, tenant, p); err != nil {
+			t.Fatal(err)
+		}
+		p.SetPrice(12.5)
+		if _, err := UpdateProduct(db, tenant, p.GetID(), p); err != nil {
+			t.Fatal(err)
+		}
+		// Matched but unchanged still counts as found
+		if _, err := UpdateProduct(db, tenant, p.GetID(), p); err != nil {
+			t.Fatal(err)
+		}
+		found, err := GetProduct(db, tenant, p.GetID())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.GetName() != "widget" || found.GetPrice() != 12.5 {
+			t.Errorf("Unexpected product %+v", found)
+		}
+		if n := GetProductCount(db, tenant); n != 1 {
+			t.Errorf("Expected 1 product. Got %d", n)
+		}
+	})
+}
+
+func TestProductIDsAreScopedToTenant(t *testing.T) {
+	eachDialect(t, func(t *testing.T, db *DB) {
+		p := data.CreateProduct("widget", 1)
+		for _, tenantID := range []string{tenant, "other"} {
+			if err := CreateProduct(db, tenantID, p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := CreateProduct(db, tenant, p); err != ErrProductExists {
+			t.Errorf("Expected ErrProductExists. Got %v", err)
+		}
+		if _, err := SchedulePrice(db, "other", p.GetID(), 5, time.Now().UTC()); err != nil {
+			t.Fatal(err)
+		}
+		if found, _ := GetProduct(db, tenant, p.GetID()); found.GetPrice() != 1 {
+			t.Errorf("Expected another tenant's price left alone. Got %v", found.GetPrice())
+		}
+		if _, err := DeleteProduct(db, "other", p.GetID()); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := GetProduct(db, tenant, p.GetID()); err != nil {
+			t.Errorf("Expected the default tenant's product to remain. Got %v", err)
+		}
+	})
+}
+
+func TestCreateTenantTwice(t *testing.T) {
+	eachDialect(t, func(t *testing.T, db *DB) {
+		if _, err := CreateTenant(db, "acme", "Acme"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := CreateTenant(db, "acme", "Acme"); err != ErrTenantExists {
+			t.Errorf("Expected ErrTenantExists. Got %v", err)
+		}
+	})
+}
+
+func TestRekeyingKeepsProducts(t *testing.T) {
+	eachDialect(t, func(t *testing.T, db *DB) {
+		p := data.CreateProduct("Green tea", 1)
+		if err := CreateProduct(db, tenant, p); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := MigrateDown(db, 1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := MigrateUp(db, 0); err != nil {
+			t.Fatal(err)
+		}
+		if found, err := GetProduct(db, tenant, p.GetID()); err != nil || found.GetName() != "Green tea" {
+			t.Errorf("Expected the product to survive. Got %v, %v", found, err)
+		}
+		if _, total, err := SearchProducts(db, tenant, "tea", 1, 10); err != nil || total != 1 {
+			t.Errorf("Expected the product to stay searchable. Got %d, %v", total, err)
+		}
+	})
+}
+
+func TestUpserts(t *testing.T) {
+	eachDialect(t, func(t *testing.T, db *DB) {
+		p := data.CreateProduct("widget", 1)
+		c := data.CreateCategory("tools", nil)
+		if err := CreateProduct(db, tenant, p); err != nil {
+			t.Fatal(err)
+		}
+		if err := CreateCategory(db, tenant, c); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := AssignProductToCategory(db, tenant, p.GetID(), c.GetID()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n := CountCategoryProducts(db, tenant, c.GetID()); n != 1 {
+			t.Errorf("Expected 1 product in the category. Got %d", n)
+		}
+
+		for _, onHand := range []int64{5, 3, 3} {
+			if err := SetStock(db, tenant, p.GetID(), onHand); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := Reserve(db, tenant, p.GetID(), 2, time.Minute, time.Now().UTC()); err != nil {
+			t.Fatal(err)
+		}
+		if err := SetStock(db, tenant, p.GetID(), 1); err != ErrStockBelowReserved {
+			t.Errorf("Expected %v. Got %v", ErrStockBelowReserved, err)
+		}
+		i, err := GetInventory(db, tenant, p.GetID())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i.OnHand != 3 || i.Reserved != 2 {
+			t.Errorf("Unexpected inventory %+v", i)
+		}
+	})
+}
+
+func TestScheduledPrices(t *testing.T) {
+	eachDialect(t, func(t *testing.T, db *DB) {
+		p := data.CreateProduct("widget", 1)
+		if err := CreateProduct(db, tenant, p); err != nil {
+			t.Fatal(err)
+		}
+		at := time.Now().UTC().Add(time.Hour)
+		if _, err := SchedulePrice(db, tenant, p.GetID(), 2, at); err != nil {
+			t.Fatal(err)
+		}
+		if found, _ := GetProduct(db, tenant, p.GetID()); found.GetPrice() != 1 {
+			t.Errorf("Expected the price to wait. Got %v", found.GetPrice())
+		}
+		applied, err := ApplyScheduledPrices(db, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(applied) != 1 {
+			t.Errorf("Expected 1 price applied. Got %d", len(applied))
+		}
+	})
+}
+
+func TestSearch(t *testing.T) {
+	eachDialect(t, func(t *testing.T, db *DB) {
+		for _, name := range []string{"Green tea", "Tea green", "100% cotton_shirt"} {
+			if err := CreateProduct(db, tenant, data.CreateProduct(name, 1)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		results, total, err := SearchProducts(db, tenant, "green te", 1, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 2 || len(results) != 2 {
+			t.Fatalf("Expected 2 results. Got %d of %d", len(results), total)
+		}
+		if results[0].Rank < results[1].Rank {
+			t.Errorf("Expected the best match first. Got %+v", results)
+		}
+	})
+}
+
+func TestNameFilterIsLiteral(t *testing.T) {
+	eachDialect(t, func(t *testing.T, db *DB) {
+		for _, name := range []string{"100% wool", "100 wool", "a_b", "axb"} {
+			if err := CreateProduct(db, tenant, data.CreateProduct(name, 1)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for name, expected := range map[string]string{"0% W": "100% wool", "A_B": "a_b"} {
+			found, err := FindProducts(db, tenant, ProductFilter{Name: name}, 1, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(found) != 1 || found[0].GetName() != expected {
+				t.Errorf("%s: expected only %q. Got %v", name, expected, found)
+			}
+		}
+	})
+}
+
+func TestEscapeLike(t *testing.T) {
+	if escaped := escapeLike("100%_!"); escaped != "100!%!_!!" {
+		t.Errorf("Unexpected escape %s", escaped)
+	}
+}
@@ -0,0 +1,280 @@
+package repositories
+
+import (
+	"database/sql"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+const (
+	highlightStart = "<mark>"
+	highlightEnd   = "</mark>"
+)
+
+// SearchTerms - Splits a free-text query into the words it will match by
+// prefix; punctuation never reaches the query syntax of either backend
+func SearchTerms(q string) []string {
+	return strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// SearchProducts - Ranked full-text search over a tenant's product names, using FTS5 on
+// sqlite3 and tsvector on postgres. MySQL, and sqlite3 builds without
+// FTS5, fall back to substring matching.
+func SearchProducts(db DBTX, tenantID, q string, page uint64, count uint8) ([]data.SearchResult, uint64, error) {
+	terms := SearchTerms(q)
+	if len(terms) == 0 {
+		return []data.SearchResult{}, 0, nil
+	}
+	if page > 0 {
+		page--
+	}
+	offset := page * uint64(count)
+
+	switch db.Dialect().Name() {
+	case "postgres":
+		return searchPostgres(db, tenantID, terms, count, offset)
+	case "sqlite3":
+		hasIndex, err := sqliteSearchIndexExists(db)
+		if err != nil {
+			return nil, 0, err
+		}
+		if hasIndex {
+			return searchFTS5(db, tenantID, terms, count, offset)
+		}
+	}
+	return searchSubstring(db, tenantID, terms, count, offset)
+}
+
+// SearchIndexed - Whether searches use a full-text index rather than
+// substring matching
+func SearchIndexed(db DBTX) (bool, error) {
+	switch db.Dialect().Name() {
+	case "postgres":
+		return true, nil
+	case "sqlite3":
+		return sqliteSearchIndexExists(db)
+	}
+	return false, nil
+}
+
+func searchPostgres(db DBTX, tenantID string, terms []string, count uint8, offset uint64) ([]data.SearchResult, uint64, error) {
+	prefixes := make([]string, len(terms))
+	for i, t := range terms {
+		prefixes[i] = t + ":*"
+	}
+	tsquery := strings.Join(prefixes, " & ")
+
+	total := uint64(0)
+	err := db.QueryRow(
+		"SELECT COUNT(id) FROM products WHERE tenant_id=$1 AND search @@ to_tsquery('simple', $2)",
+		tenantID, tsquery).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(`SELECT id, name, `+effectivePrice("products", 5)+`,
+        ts_headline('simple', name, q, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true'),
+        ts_rank(search, q) AS relevance
+    FROM products, to_tsquery('simple', $1) q
+    WHERE tenant_id=$2 AND search @@ q
+    ORDER BY relevance DESC, name, id
+    LIMIT $3 OFFSET $4`, tsquery, tenantID, count, offset, now())
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	results, err := scanSearchResults(rows)
+	return results, total, err
+}
+
+func searchFTS5(db DBTX, tenantID string, terms []string, count uint8, offset uint64) ([]data.SearchResult, uint64, error) {
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(t, `"`, `""`) + `"*`
+	}
+	match := strings.Join(quoted, " ")
+
+	total := uint64(0)
+	err := db.QueryRow(
+		`SELECT COUNT(*) FROM products_fts JOIN products p
+        ON p.tenant_id = products_fts.tenant_id AND p.id = products_fts.id
+        WHERE products_fts MATCH $1 AND p.tenant_id=$2`, match, tenantID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// FTS5's rank is bm25, where lower is better; negate it so every backend
+	// reports higher as more relevant.
+	rows, err := db.Query(`SELECT p.id, p.name, `+effectivePrice("p", 1)+`,
+        highlight(products_fts, 1, '<mark>', '</mark>'),
+        -products_fts.rank
+    FROM products_fts JOIN products p
+        ON p.tenant_id = products_fts.tenant_id AND p.id = products_fts.id
+    WHERE products_fts MATCH $2 AND p.tenant_id=$3
+    ORDER BY products_fts.rank, p.name, p.id
+    LIMIT $4 OFFSET $5`, now(), match, tenantID, count, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	results, err := scanSearchResults(rows)
+	return results, total, err
+}
+
+// searchSubstring ranks names starting with the first term above those
+// merely containing the terms
+func searchSubstring(db DBTX, tenantID string, terms []string, count uint8, offset uint64) ([]data.SearchResult, uint64, error) {
+	total := uint64(0)
+	where, args := substringClauses(terms, 2)
+	args = append([]interface{}{tenantID}, args...)
+	if err := db.QueryRow("SELECT COUNT(id) FROM products WHERE tenant_id=$1 AND "+where,
+		args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	where, args = substringClauses(terms, 4)
+	args = append([]interface{}{now(), escapeLike(terms[0]) + "%", tenantID}, args...)
+	args = append(args, count, offset)
+	rows, err := db.Query(`SELECT id, name, `+effectivePrice("products", 1)+`, name,
+        CASE WHEN LOWER(name) LIKE $2 ESCAPE '!' THEN 1.0 ELSE 0.5 END AS relevance
+    FROM products WHERE tenant_id=$3 AND `+where+`
+    ORDER BY relevance DESC, name, id
+    LIMIT $`+strconv.Itoa(len(args)-1)+` OFFSET $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	results, err := scanSearchResults(rows)
+	for i := range results {
+		results[i].Snippet = highlightTerms(results[i].Snippet, terms)
+	}
+	return results, total, err
+}
+
+// substringClauses matches every term somewhere in the name, numbering
+// placeholders from first
+func substringClauses(terms []string, first int) (string, []interface{}) {
+	clauses := make([]string, len(terms))
+	args := make([]interface{}, len(terms))
+	for i, t := range terms {
+		args[i] = "%" + escapeLike(t) + "%"
+		clauses[i] = "LOWER(name) LIKE $" + strconv.Itoa(first+i) + " ESCAPE '!'"
+	}
+	return strings.Join(clauses, " AND "), args
+}
+
+func scanSearchResults(rows *sql.Rows) ([]data.SearchResult, error) {
+	results := []data.SearchResult{}
+	for rows.Next() {
+		var id, name, snippet string
+		var price, rank float64
+		if err := rows.Scan(&id, &name, &price, &snippet, &rank); err != nil {
+			return nil, err
+		}
+		results = append(results, data.SearchResult{
+			Product: data.NewProduct(id, name, price),
+			Snippet: snippet,
+			Rank:    rank,
+		})
+	}
+	return results, rows.Err()
+}
+
+func highlightTerms(text string, terms []string) string {
+	patterns := make([]string, len(terms))
+	for i, t := range terms {
+		patterns[i] = regexp.QuoteMeta(t)
+	}
+	re := regexp.MustCompile("(?i)(" + strings.Join(patterns, "|") + ")")
+	return re.ReplaceAllString(text, highlightStart+"$1"+highlightEnd)
+}
+
+// escapeLike escapes with ! rather than a backslash, which MySQL reads as
+// an escape in string literals too
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+func sqliteSearchIndexExists(db DBTX) (bool, error) {
+	n := 0
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='products_fts'").Scan(&n)
+	return n > 0, err
+}
+
+func sqliteHasFTS5(tx *Tx) (bool, error) {
+	enabled := false
+	err := tx.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled)
+	return enabled, err
+}
+
+// createSQLiteSearchIndex builds the FTS5 table and the triggers that keep
+// it in step with products. Without FTS5 compiled in there is nothing to
+// do and searches use substring matching.
+func createSQLiteSearchIndex(tx *Tx) error {
+	if tx.Dialect().Name() != "sqlite3" {
+		return nil
+	}
+	enabled, err := sqliteHasFTS5(tx)
+	if err != nil || !enabled {
+		return err
+	}
+	return createSQLiteSearch(tx, false)
+}
+
+// createSQLiteSearch indexes names by id, and by tenant too once products
+// are keyed by tenant. tenant_id comes after name so that name stays the
+// column highlight() is asked for.
+func createSQLiteSearch(tx *Tx, keyed bool) error {
+	declared, columns, values, match := "id UNINDEXED, name", "id, name", "new.id, new.name", "id = old.id"
+	if keyed {
+		declared, columns, values = declared+", tenant_id UNINDEXED", columns+", tenant_id", values+", new.tenant_id"
+		match = "tenant_id = old.tenant_id AND " + match
+	}
+	for _, statement := range []string{
+		`CREATE VIRTUAL TABLE products_fts USING fts5(
+        ` + declared + `, prefix='2 3', tokenize='unicode61 remove_diacritics 2')`,
+		`CREATE TRIGGER products_fts_insert AFTER INSERT ON products BEGIN
+        INSERT INTO products_fts(` + columns + `) VALUES (` + values + `);
+    END`,
+		`CREATE TRIGGER products_fts_update AFTER UPDATE OF name ON products BEGIN
+        DELETE FROM products_fts WHERE ` + match + `;
+        INSERT INTO products_fts(` + columns + `) VALUES (` + values + `);
+    END`,
+		`CREATE TRIGGER products_fts_delete AFTER DELETE ON products BEGIN
+        DELETE FROM products_fts WHERE ` + match + `;
+    END`,
+		"INSERT INTO products_fts(" + columns + ") SELECT " + columns + " FROM products",
+	} {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dropSQLiteSearchIndex(tx *Tx) error {
+	if tx.Dialect().Name() != "sqlite3" {
+		return nil
+	}
+	for _, statement := range []string{
+		"DROP TRIGGER IF EXISTS products_fts_insert",
+		"DROP TRIGGER IF EXISTS products_fts_update",
+		"DROP TRIGGER IF EXISTS products_fts_delete",
+		"DROP TABLE IF EXISTS products_fts",
+	} {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+// tenantTables - Every table holding tenant data, children before parents.
+// The outbox goes too, so a deleted tenant's queued events are never
+// delivered.
+var tenantTables = []string{
+	"outbox", "product_currency_prices", "product_translations", "product_variants", "product_images",
+	"product_prices", "reservations", "inventory", "product_categories", "products", "categories",
+}
+
+var ErrTenantExists = errors.New("Tenant already exists")
+
+func GetTenant(db DBTX, id string) (data.Tenant, error) {
+	t := data.Tenant{}
+	err := db.QueryRow("SELECT id, name, created_at FROM tenants WHERE id=$1", id).Scan(
+		&t.ID, &t.Name, &t.CreatedAt)
+	return t, err
+}
+
+// TenantExists - Whether id has been provisioned
+func TenantExists(db DBTX, id string) (bool, error) {
+	_, err := GetTenant(db, id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func GetTenants(db DBTX, page uint64, count uint8) ([]data.Tenant, error) {
+	if page > 0 {
+		page--
+	}
+	rows, err := db.Query("SELECT id, name, created_at FROM tenants ORDER BY id LIMIT $1 OFFSET $2",
+		count, page*uint64(count))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tenants := []data.Tenant{}
+	for rows.Next() {
+		t := data.Tenant{}
+		if err := rows.Scan(&t.ID, &t.Name, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, rows.Err()
+}
+
+func GetTenantCount(db DBTX) uint64 {
+	i := uint64(0)
+	if err := db.QueryRow("SELECT COUNT(id) FROM tenants").Scan(&i); err != nil {
+		i = uint64(0)
+	}
+	return i
+}
+
+// CreateTenant - Provisions tenant id. ErrTenantExists when it already is.
+func CreateTenant(db DBTX, id, name string) (data.Tenant, error) {
+	t := data.Tenant{ID: id, Name: name, CreatedAt: time.Now().UTC().Truncate(time.Microsecond)}
+	_, err := db.Exec("INSERT INTO tenants(id, name, created_at) VALUES($1, $2, $3)",
+		t.ID, t.Name, t.CreatedAt)
+	if err != nil && db.Dialect().Duplicate(err) {
+		return t, ErrTenantExists
+	}
+	return t, err
+}
+
+// SetTenantKey - Replaces the hash of tenant id's key, sql.ErrNoRows when
+// there is no such tenant
+func SetTenantKey(db DBTX, id, keyHash string) error {
+	res, err := db.Exec("UPDATE tenants SET key_hash=$1 WHERE id=$2", keyHash, id)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(res, sql.ErrNoRows)
+}
+
+// TenantKeyHash - The hash of tenant id's key, "" when it has none
+func TenantKeyHash(db DBTX, id string) (string, error) {
+	var hash sql.NullString
+	err := db.QueryRow("SELECT key_hash FROM tenants WHERE id=$1", id).Scan(&hash)
+	return hash.String, err
+}
+
+// DeleteTenant - Removes a tenant and everything it owns, all or nothing,
+// returning the ids of the images it had, whose blobs are the caller's to
+// remove
+func DeleteTenant(db *DB, id string) ([]string, error) {
+	var images []string
+	err := db.WithTx(db.context(), func(tx *Tx) (err error) {
+		if images, err = imageIDs(tx, "SELECT id FROM product_images WHERE tenant_id=$1", id); err != nil {
+			return err
+		}
+		for _, table := range tenantTables {
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE tenant_id=$1", id); err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec("DELETE FROM tenants WHERE id=$1", id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
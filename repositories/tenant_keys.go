@@ -0,0 +1,284 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// tenantKeyed - A table whose primary key, and whose foreign keys to other
+// tenants' tables, lead with tenant_id once migration 12 has run, so one
+// tenant's ids say nothing about another's
+type tenantKeyed struct {
+	table string
+	// columns are the definitions sqlite rebuilds the table from
+	columns     []string
+	primaryKey  string
+	constraints []string
+	references  []reference
+	indexes     []string
+}
+
+// reference - A foreign key, named as the migration that created it named it
+type reference struct {
+	name, columns, parent, parentColumns, onDelete string
+}
+
+func (t tenantKeyed) key(keyed bool) string {
+	if keyed {
+		return "tenant_id, " + t.primaryKey
+	}
+	return t.primaryKey
+}
+
+func (r reference) definition(keyed bool) string {
+	columns, parentColumns := r.columns, r.parentColumns
+	if keyed {
+		columns, parentColumns = "tenant_id, "+columns, "tenant_id, "+parentColumns
+	}
+	return fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)%s",
+		r.name, columns, r.parent, parentColumns, r.onDelete)
+}
+
+func (t tenantKeyed) create(name string, keyed bool) string {
+	definitions := append([]string{}, t.columns...)
+	definitions = append(definitions,
+		fmt.Sprintf("CONSTRAINT %s_pkey PRIMARY KEY (%s)", t.table, t.key(keyed)))
+	definitions = append(definitions, t.constraints...)
+	for _, r := range t.references {
+		definitions = append(definitions, r.definition(keyed))
+	}
+	return fmt.Sprintf("CREATE TABLE %s (\n        %s\n    )", name, strings.Join(definitions, ",\n        "))
+}
+
+func (t tenantKeyed) columnNames() string {
+	names := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		names[i] = strings.Fields(c)[0]
+	}
+	return strings.Join(names, ", ")
+}
+
+const (
+	tenantColumn = "tenant_id VARCHAR(63) NOT NULL DEFAULT 'default'"
+	cascade      = " ON DELETE CASCADE"
+)
+
+func productReference(table string) reference {
+	return reference{table + "_product_fkey", "product_id", "products", "id", cascade}
+}
+
+// tenantKeyedTables - Parents before children, as sqlite rebuilds them
+var tenantKeyedTables = []tenantKeyed{
+	{
+		table:      "products",
+		columns:    []string{"id VARCHAR(36) NOT NULL", "name TEXT NOT NULL", "price NUMERIC(10,2) NOT NULL DEFAULT 0.00", tenantColumn},
+		primaryKey: "id",
+		indexes:    []string{"CREATE INDEX products_tenant_idx ON products (tenant_id)"},
+	},
+	{
+		table:      "categories",
+		columns:    []string{"id VARCHAR(36) NOT NULL", "name TEXT NOT NULL", "parent_id VARCHAR(36) NULL", tenantColumn},
+		primaryKey: "id",
+		references: []reference{{"categories_parent_fkey", "parent_id", "categories", "id", ""}},
+		indexes: []string{
+			"CREATE INDEX categories_parent_idx ON categories (parent_id)",
+			"CREATE INDEX categories_tenant_idx ON categories (tenant_id)",
+		},
+	},
+	{
+		table:      "product_categories",
+		columns:    []string{"product_id VARCHAR(36) NOT NULL", "category_id VARCHAR(36) NOT NULL", tenantColumn},
+		primaryKey: "product_id, category_id",
+		references: []reference{
+			productReference("product_categories"),
+			{"product_categories_category_fkey", "category_id", "categories", "id", cascade},
+		},
+		indexes: []string{"CREATE INDEX product_categories_category_idx ON product_categories (category_id)"},
+	},
+	{
+		table: "inventory",
+		columns: []string{"product_id VARCHAR(36) NOT NULL", "on_hand BIGINT NOT NULL DEFAULT 0",
+			"reserved BIGINT NOT NULL DEFAULT 0", tenantColumn},
+		primaryKey:  "product_id",
+		constraints: []string{"CONSTRAINT inventory_reserved_check CHECK (reserved >= 0 AND reserved <= on_hand)"},
+		references:  []reference{productReference("inventory")},
+	},
+	{
+		table: "reservations",
+		columns: []string{"id VARCHAR(36) NOT NULL", "product_id VARCHAR(36) NOT NULL", "quantity BIGINT NOT NULL",
+			"status VARCHAR(16) NOT NULL", "created_at TIMESTAMP NOT NULL", "expires_at TIMESTAMP NOT NULL", tenantColumn},
+		primaryKey:  "id",
+		constraints: []string{"CONSTRAINT reservations_quantity_check CHECK (quantity > 0)"},
+		references:  []reference{productReference("reservations")},
+		indexes:     []string{"CREATE INDEX reservations_pending_idx ON reservations (status, expires_at)"},
+	},
+	{
+		table: "product_prices",
+		columns: []string{"id VARCHAR(36) NOT NULL", "product_id VARCHAR(36) NOT NULL", "price NUMERIC(10,2) NOT NULL",
+			"effective_at TIMESTAMP NOT NULL", "created_at TIMESTAMP NOT NULL", "applied_at TIMESTAMP NULL", tenantColumn},
+		primaryKey: "id",
+		references: []reference{productReference("product_prices")},
+		indexes: []string{
+			"CREATE INDEX product_prices_effective_idx ON product_prices (product_id, effective_at)",
+			"CREATE INDEX product_prices_pending_idx ON product_prices (applied_at, effective_at)",
+		},
+	},
+	{
+		table: "product_images",
+		columns: []string{"tenant_id VARCHAR(63) NOT NULL", "id VARCHAR(36) NOT NULL", "product_id VARCHAR(36) NOT NULL",
+			"content_type VARCHAR(32) NOT NULL", "size BIGINT NOT NULL", "width INTEGER NOT NULL",
+			"height INTEGER NOT NULL", "checksum VARCHAR(64) NOT NULL", "thumbnail_content_type VARCHAR(32) NOT NULL",
+			"created_at TIMESTAMP NOT NULL"},
+		primaryKey: "id",
+		references: []reference{productReference("product_images")},
+		indexes: []string{
+			"CREATE INDEX product_images_product_idx ON product_images (tenant_id, product_id, created_at)",
+		},
+	},
+	{
+		table: "product_variants",
+		columns: []string{"tenant_id VARCHAR(63) NOT NULL", "id VARCHAR(36) NOT NULL", "product_id VARCHAR(36) NOT NULL",
+			"sku VARCHAR(64) NOT NULL", "options TEXT NOT NULL", "price NUMERIC(10,2) NULL", "created_at TIMESTAMP NOT NULL"},
+		primaryKey:  "id",
+		constraints: []string{"CONSTRAINT product_variants_sku_key UNIQUE (tenant_id, sku)"},
+		references:  []reference{productReference("product_variants")},
+		indexes:     []string{"CREATE INDEX product_variants_product_idx ON product_variants (tenant_id, product_id)"},
+	},
+	{
+		table: "product_translations",
+		columns: []string{"tenant_id VARCHAR(63) NOT NULL", "product_id VARCHAR(36) NOT NULL", "locale VARCHAR(35) NOT NULL",
+			"name TEXT NOT NULL", "description TEXT NOT NULL"},
+		primaryKey: "product_id, locale",
+		references: []reference{productReference("product_translations")},
+	},
+	{
+		table: "product_currency_prices",
+		columns: []string{"tenant_id VARCHAR(63) NOT NULL", "product_id VARCHAR(36) NOT NULL", "currency VARCHAR(3) NOT NULL",
+			"price NUMERIC(11,3) NOT NULL"},
+		primaryKey: "product_id, currency",
+		references: []reference{productReference("product_currency_prices")},
+	},
+}
+
+// rekeyByTenant moves every tenant's table onto keys that lead with
+// tenant_id, or back off them. Postgres and MySQL alter the keys in place;
+// sqlite cannot, so it rebuilds each table.
+func rekeyByTenant(keyed bool) func(tx *Tx) error {
+	return func(tx *Tx) error {
+		var statements []string
+		switch tx.Dialect().Name() {
+		case "sqlite3":
+			return rebuildSQLiteTables(tx, keyed)
+		case "mysql":
+			indexes, err := mysqlIndexes(tx)
+			if err != nil {
+				return err
+			}
+			// MySQL indexes a foreign key under its own name when no other
+			// index serves, and keeps the index when the key is dropped.
+			statements = alterKeys(keyed,
+				func(table, name string) []string {
+					drop := []string{fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s", table, name)}
+					if indexes[table+"."+name] {
+						drop = append(drop, fmt.Sprintf("ALTER TABLE %s DROP INDEX %s", table, name))
+					}
+					return drop
+				},
+				func(string) string { return "DROP PRIMARY KEY" })
+		default:
+			statements = alterKeys(keyed,
+				func(table, name string) []string {
+					return []string{fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", table, name)}
+				},
+				func(table string) string { return "DROP CONSTRAINT " + table + "_pkey" })
+		}
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// mysqlIndexes - The current database's indexes, as table.index
+func mysqlIndexes(tx *Tx) (map[string]bool, error) {
+	rows, err := tx.Query(`SELECT DISTINCT table_name, index_name FROM information_schema.statistics
+        WHERE table_schema = DATABASE()`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	indexes := map[string]bool{}
+	for rows.Next() {
+		var table, index string
+		if err := rows.Scan(&table, &index); err != nil {
+			return nil, err
+		}
+		indexes[table+"."+index] = true
+	}
+	return indexes, rows.Err()
+}
+
+// alterKeys drops every foreign key before any primary key it refers to,
+// and adds them back once every primary key is in place
+func alterKeys(keyed bool, dropForeignKey func(table, name string) []string,
+	dropPrimaryKey func(table string) string) []string {
+	statements := []string{}
+	for _, t := range tenantKeyedTables {
+		for _, r := range t.references {
+			statements = append(statements, dropForeignKey(t.table, r.name)...)
+		}
+	}
+	for _, t := range tenantKeyedTables {
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s %s, ADD CONSTRAINT %s_pkey PRIMARY KEY (%s)",
+			t.table, dropPrimaryKey(t.table), t.table, t.key(keyed)))
+	}
+	for _, t := range tenantKeyedTables {
+		for _, r := range t.references {
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD %s", t.table, r.definition(keyed)))
+		}
+	}
+	return statements
+}
+
+// rebuildSQLiteTables copies each table into one with the new keys. With
+// foreign keys enforced, dropping the old products table would cascade to
+// everything referring to it, so that is refused rather than risked.
+func rebuildSQLiteTables(tx *Tx, keyed bool) error {
+	enforced := false
+	if err := tx.QueryRow("PRAGMA foreign_keys").Scan(&enforced); err != nil {
+		return err
+	}
+	if enforced {
+		return errors.New("cannot rebuild tables while sqlite enforces foreign keys")
+	}
+	searchable, err := sqliteSearchIndexExists(tx)
+	if err != nil {
+		return err
+	}
+	if searchable {
+		if err := dropSQLiteSearchIndex(tx); err != nil {
+			return err
+		}
+	}
+	for _, t := range tenantKeyedTables {
+		columns := t.columnNames()
+		statements := []string{
+			t.create(t.table+"_rekeyed", keyed),
+			fmt.Sprintf("INSERT INTO %s_rekeyed (%s) SELECT %s FROM %s", t.table, columns, columns, t.table),
+			"DROP TABLE " + t.table,
+			fmt.Sprintf("ALTER TABLE %s_rekeyed RENAME TO %s", t.table, t.table),
+		}
+		for _, statement := range append(statements, t.indexes...) {
+			if _, err := tx.Exec(statement); err != nil {
+				return err
+			}
+		}
+	}
+	if !searchable {
+		return nil
+	}
+	return createSQLiteSearch(tx, keyed)
+}
@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/Lewiscowles1986/go-gorilla-api/repositories")
+}
+
+var (
+	stringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numericLiteral = regexp.MustCompile(`(^|[^\w$.])\d+(?:\.\d+)?\b`)
+	spaces         = regexp.MustCompile(`\s+`)
+	statementTable = regexp.MustCompile(`(?i)\b(?:FROM|INTO|UPDATE|TABLE)\s+(\w+)`)
+)
+
+// SanitizeSQL - query with its literals replaced by ?, so that a trace
+// shows its shape but none of the data written into it. Arguments are
+// never recorded.
+func SanitizeSQL(query string) string {
+	query = stringLiteral.ReplaceAllString(query, "?")
+	query = numericLiteral.ReplaceAllString(query, "${1}?")
+	return strings.TrimSpace(spaces.ReplaceAllString(query, " "))
+}
+
+// spanName - The operation and table of a statement, such as SELECT
+// products
+func spanName(statement string) string {
+	operation := statement
+	if i := strings.IndexByte(statement, ' '); i > 0 {
+		operation = statement[:i]
+	}
+	operation = strings.ToUpper(operation)
+	if m := statementTable.FindStringSubmatch(statement); m != nil {
+		return operation + " " + m[1]
+	}
+	return operation
+}
+
+// childSpan - A span in the trace ctx carries. Work outside any trace, such
+// as migrations, gets none.
+func childSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return ctx, noop.Span{}
+	}
+	return tracer().Start(ctx, name, opts...)
+}
+
+// startSpan - A span for one statement
+func startSpan(ctx context.Context, dialect Dialect, query string) (context.Context, trace.Span) {
+	statement := SanitizeSQL(query)
+	return childSpan(ctx, spanName(statement),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", dialect.Name()),
+			attribute.String("db.query.text", statement),
+		))
+}
+
+// endSpan ends a statement's span, marking it failed when err is anything
+// but an empty result
+func endSpan(span trace.Span, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
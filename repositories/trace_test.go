@@ -0,0 +1,88 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+func TestSanitizeSQL(t *testing.T) {
+	cases := map[string]string{
+		"SELECT id FROM products WHERE tenant_id=$1 LIMIT $2": "SELECT id FROM products WHERE tenant_id=$1 LIMIT $2",
+		"SELECT id FROM reservations WHERE status='pending'":  "SELECT id FROM reservations WHERE status=?",
+		"UPDATE t SET note='it''s', n=n+1\n\t WHERE id=42":    "UPDATE t SET note=?, n=n+? WHERE id=?",
+		"SELECT price * 1.5 FROM products_v2 WHERE x = ?":     "SELECT price * ? FROM products_v2 WHERE x = ?",
+	}
+	for query, expected := range cases {
+		if result := SanitizeSQL(query); result != expected {
+			t.Errorf("%q: expected %q got %q", query, expected, result)
+		}
+	}
+}
+
+func TestSpanName(t *testing.T) {
+	cases := map[string]string{
+		"SELECT COUNT(id) FROM products WHERE tenant_id=$1": "SELECT products",
+		"insert into categories (id) values ($1)":           "INSERT categories",
+		"UPDATE inventory SET on_hand=$1":                   "UPDATE inventory",
+		"BEGIN":                                             "BEGIN",
+	}
+	for statement, expected := range cases {
+		if result := spanName(statement); result != expected {
+			t.Errorf("%q: expected %q got %q", statement, expected, result)
+		}
+	}
+}
+
+func TestStatementsAreTracedWithinATrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(provider)
+
+	db, err := Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := MigrateUp(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(recorder.Ended()); n != 0 {
+		t.Fatalf("Expected no spans outside a trace. Got %d", n)
+	}
+
+	ctx, request := otel.Tracer("test").Start(context.Background(), "request")
+	err = db.WithContext(ctx).WithTx(ctx, func(tx *Tx) error {
+		return CreateProduct(tx, tenant, data.CreateProduct("widget", 1))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	GetProductCount(db.WithContext(ctx), tenant)
+	request.End()
+
+	names := map[string]bool{}
+	for _, span := range recorder.Ended() {
+		names[span.Name()] = true
+		if span.SpanContext().TraceID() != request.SpanContext().TraceID() {
+			t.Errorf("Expected %s in the request's trace", span.Name())
+		}
+		for _, kv := range span.Attributes() {
+			if kv.Key == "db.query.text" && kv.Value.AsString() != SanitizeSQL(kv.Value.AsString()) {
+				t.Errorf("Expected sanitized SQL. Got %s", kv.Value.AsString())
+			}
+		}
+	}
+	for _, name := range []string{"transaction", "INSERT products", "SELECT products"} {
+		if !names[name] {
+			t.Errorf("Expected a %s span. Got %v", name, names)
+		}
+	}
+}
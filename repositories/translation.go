@@ -0,0 +1,74 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+const translationColumns = "product_id, locale, name, description"
+
+func scanTranslation(row scanner) (data.Translation, error) {
+	t := data.Translation{}
+	err := row.Scan(&t.ProductID, &t.Locale, &t.Name, &t.Description)
+	return t, err
+}
+
+// SetTranslation - Saves a product's name and description in a locale,
+// replacing any translation it already had there
+func SetTranslation(db DBTX, tenantID string, t data.Translation) error {
+	_, err := db.Exec(`INSERT INTO product_translations(tenant_id, `+translationColumns+`)
+        VALUES($1, $2, $3, $4, $5) `+db.Dialect().OnConflict([]string{"tenant_id", "product_id", "locale"}, "name", "description"),
+		tenantID, t.ProductID, t.Locale, t.Name, t.Description)
+	return err
+}
+
+// GetTranslation - A product's translation into locale; sql.ErrNoRows when
+// it has none
+func GetTranslation(db DBTX, tenantID, productID, locale string) (data.Translation, error) {
+	return scanTranslation(db.QueryRow("SELECT "+translationColumns+
+		" FROM product_translations WHERE tenant_id=$1 AND product_id=$2 AND locale=$3", tenantID, productID, locale))
+}
+
+// DeleteTranslation - Forgets a product's translation into locale.
+// sql.ErrNoRows when it has none.
+func DeleteTranslation(db DBTX, tenantID, productID, locale string) error {
+	res, err := db.Exec("DELETE FROM product_translations WHERE tenant_id=$1 AND product_id=$2 AND locale=$3",
+		tenantID, productID, locale)
+	if err == nil {
+		err = expectOneRow(res, sql.ErrNoRows)
+	}
+	return err
+}
+
+// GetProductTranslations - The translations of each product, by locale
+func GetProductTranslations(db DBTX, tenantID string, productIDs ...string) (map[string][]data.Translation, error) {
+	translations := map[string][]data.Translation{}
+	if len(productIDs) == 0 {
+		return translations, nil
+	}
+	placeholders := make([]string, len(productIDs))
+	args := []interface{}{tenantID}
+	for i, id := range productIDs {
+		args = append(args, id)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+	rows, err := db.Query(fmt.Sprintf(`SELECT %s FROM product_translations
+        WHERE tenant_id=$1 AND product_id IN (%s) ORDER BY locale`,
+		translationColumns, strings.Join(placeholders, ", ")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanTranslation(rows)
+		if err != nil {
+			return nil, err
+		}
+		translations[t.ProductID] = append(translations[t.ProductID], t)
+	}
+	return translations, rows.Err()
+}
@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxTxAttempts - How many times WithTx runs a unit of work that keeps
+// losing to concurrent transactions
+const maxTxAttempts = 3
+
+// WithTx - Runs fn as one unit of work, committing when it returns nil and
+// rolling back otherwise. When the database aborts the transaction for
+// conflicting with a concurrent one, fn is run again from the start, so it
+// must not have effects outside tx.
+func (db *DB) WithTx(ctx context.Context, fn func(tx *Tx) error) error {
+	ctx, span := childSpan(ctx, "transaction")
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = db.attemptTx(ctx, fn); err == nil || !db.dialect.Retryable(err) || attempt == maxTxAttempts {
+			span.SetAttributes(attribute.Int("db.transaction.attempts", attempt))
+			endSpan(span, err)
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			endSpan(span, ctx.Err())
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * 10 * time.Millisecond):
+		}
+	}
+}
+
+// attemptTx begins at the database's default isolation, READ COMMITTED on
+// postgres, which raises no conflict when two transactions read the same
+// row and then both write it. Work that writes what it read must lock it
+// as it reads, with Dialect.ForUpdate.
+func (db *DB) attemptTx(ctx context.Context, fn func(tx *Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+func TestWithTxRollsBackOnError(t *testing.T) {
+	eachDialect(t, func(t *testing.T, db *DB) {
+		failed := errors.New("failed")
+		err := db.WithTx(context.Background(), func(tx *Tx) error {
+			if err := CreateProduct(tx, tenant, data.CreateProduct("widget", 1)); err != nil {
+				return err
+			}
+			return failed
+		})
+		if err != failed {
+			t.Errorf("Expected %v. Got %v", failed, err)
+		}
+		if n := GetProductCount(db, tenant); n != 0 {
+			t.Errorf("Expected nothing saved. Got %d products", n)
+		}
+	})
+}
+
+func TestWithTxRetriesConflicts(t *testing.T) {
+	db, err := Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	attempts := 0
+	err = db.WithTx(context.Background(), func(tx *Tx) error {
+		if attempts++; attempts < maxTxAttempts {
+			return sqlite3.Error{Code: sqlite3.ErrBusy}
+		}
+		return nil
+	})
+	if err != nil || attempts != maxTxAttempts {
+		t.Errorf("Expected success on attempt %d. Got %v on %d", maxTxAttempts, err, attempts)
+	}
+
+	attempts = 0
+	db.WithTx(context.Background(), func(tx *Tx) error {
+		attempts++
+		return sql.ErrNoRows
+	})
+	if attempts != 1 {
+		t.Errorf("Expected other errors not to be retried. Got %d attempts", attempts)
+	}
+}
+
+func TestMissingProductsAreNotFound(t *testing.T) {
+	eachDialect(t, func(t *testing.T, db *DB) {
+		id := data.CreateProduct("ghost", 1).GetID()
+		if _, err := UpdateProduct(db, tenant, id, data.CreateProduct("ghost", 2)); err != sql.ErrNoRows {
+			t.Errorf("Expected %v updating. Got %v", sql.ErrNoRows, err)
+		}
+		if _, err := DeleteProduct(db, tenant, id); err != sql.ErrNoRows {
+			t.Errorf("Expected %v deleting. Got %v", sql.ErrNoRows, err)
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+var ErrDuplicateSKU = errors.New("SKU is already in use")
+
+// variantQuery selects variants with the price they sell at now: their own,
+// or else their product's, with the time bound to placeholder 1
+var variantQuery = `SELECT v.id, v.product_id, v.sku, v.options, v.price, COALESCE(v.price, ` +
+	effectivePrice("p", 1) + `), v.created_at
+        FROM product_variants v JOIN products p ON p.tenant_id = v.tenant_id AND p.id = v.product_id`
+
+func scanVariant(row scanner) (data.Variant, error) {
+	v := data.Variant{}
+	var options string
+	var override sql.NullFloat64
+	if err := row.Scan(&v.ID, &v.ProductID, &v.SKU, &options, &override, &v.Price, &v.CreatedAt); err != nil {
+		return v, err
+	}
+	if override.Valid {
+		v.PriceOverride = &override.Float64
+	}
+	return v, json.Unmarshal([]byte(options), &v.Options)
+}
+
+// duplicateSKU reports a refused insert or update as ErrDuplicateSKU when
+// another variant of the tenant holds the SKU
+func duplicateSKU(db DBTX, err error) error {
+	if err != nil && db.Dialect().Duplicate(err) {
+		return ErrDuplicateSKU
+	}
+	return err
+}
+
+func encodeOptions(options map[string]string) (string, error) {
+	if options == nil {
+		options = map[string]string{}
+	}
+	b, err := json.Marshal(options)
+	return string(b), err
+}
+
+// CreateVariant - Records a variant of a tenant's product. ErrDuplicateSKU
+// when the tenant already uses its SKU.
+func CreateVariant(db DBTX, tenantID string, v data.Variant) error {
+	options, err := encodeOptions(v.Options)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO product_variants(tenant_id, id, product_id, sku, options, price, created_at)
+        VALUES($1, $2, $3, $4, $5, $6, $7)`,
+		tenantID, v.ID, v.ProductID, v.SKU, options, v.PriceOverride, v.CreatedAt.UTC())
+	return duplicateSKU(db, err)
+}
+
+// GetVariant - One of a product's variants; sql.ErrNoRows when the product
+// has no such variant
+func GetVariant(db DBTX, tenantID, productID, id string) (data.Variant, error) {
+	return scanVariant(db.QueryRow(variantQuery+" WHERE v.tenant_id=$2 AND v.product_id=$3 AND v.id=$4",
+		now(), tenantID, productID, id))
+}
+
+// GetVariantBySKU - The tenant's variant with the given SKU; sql.ErrNoRows
+// when there is none
+func GetVariantBySKU(db DBTX, tenantID, sku string) (data.Variant, error) {
+	return scanVariant(db.QueryRow(variantQuery+" WHERE v.tenant_id=$2 AND v.sku=$3", now(), tenantID, sku))
+}
+
+// GetVariants - A product's variants in SKU order
+func GetVariants(db DBTX, tenantID, productID string) ([]data.Variant, error) {
+	rows, err := db.Query(variantQuery+" WHERE v.tenant_id=$2 AND v.product_id=$3 ORDER BY v.sku",
+		now(), tenantID, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := []data.Variant{}
+	for rows.Next() {
+		v, err := scanVariant(rows)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, v)
+	}
+	return variants, rows.Err()
+}
+
+// UpdateVariant - Replaces a variant's SKU, options and price override, and
+// returns it as saved. sql.ErrNoRows when the product has no such variant;
+// ErrDuplicateSKU when another variant uses the SKU.
+func UpdateVariant(db DBTX, tenantID, productID, id string, v data.Variant) (data.Variant, error) {
+	options, err := encodeOptions(v.Options)
+	if err != nil {
+		return data.Variant{}, err
+	}
+	res, err := db.Exec(`UPDATE product_variants SET sku=$1, options=$2, price=$3
+        WHERE tenant_id=$4 AND product_id=$5 AND id=$6`,
+		v.SKU, options, v.PriceOverride, tenantID, productID, id)
+	if err == nil {
+		err = expectOneRow(res, sql.ErrNoRows)
+	}
+	if err != nil {
+		return data.Variant{}, duplicateSKU(db, err)
+	}
+	return GetVariant(db, tenantID, productID, id)
+}
+
+// DeleteVariant - Removes one of a product's variants. sql.ErrNoRows when
+// the product has no such variant.
+func DeleteVariant(db DBTX, tenantID, productID, id string) error {
+	res, err := db.Exec("DELETE FROM product_variants WHERE tenant_id=$1 AND product_id=$2 AND id=$3",
+		tenantID, productID, id)
+	if err == nil {
+		err = expectOneRow(res, sql.ErrNoRows)
+	}
+	return err
+}
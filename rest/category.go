@@ -0,0 +1,45 @@
+package rest
+
+import (
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+// categoryFields - The body PUT /categories/{id} takes
+var categoryFields = []ActionField{
+	{Name: "name", Type: "string", Required: true},
+	{Name: "parent_id", Type: "string", Required: false},
+}
+
+// CategoryLinks - One "category" link per category a product belongs to
+func CategoryLinks(l Linker, categoryIDs []string) []Link {
+	links := []Link{}
+	for _, id := range categoryIDs {
+		links = append(links, Link{Href: l.Href(RouteCategory, "id", id), Rel: "category", Type: "GET"})
+	}
+	return links
+}
+
+func CategoryToEntry(l Linker, c data.Category) Entry {
+	self := l.Href(RouteCategory, "id", c.GetID())
+	links := itemLinks(self, l.Href(RouteCategories))
+	if self != "" {
+		links = append(links, Link{
+			Href: l.Href(RouteCategoryProducts, "id", c.GetID()), Rel: "products", Type: "GET"})
+	}
+	if parent := c.GetParentID(); parent != nil && self != "" {
+		links = append(links, Link{Href: l.Href(RouteCategory, "id", *parent), Rel: "parent", Type: "GET"})
+	}
+	e := Entry{Object: c, Links: links}
+	if l.Actions {
+		e.Actions = itemActions(self, categoryFields...)
+	}
+	return e
+}
+
+func CategoriesToEntries(l Linker, categories []data.Category) []Entry {
+	entries := []Entry{}
+	for _, c := range categories {
+		entries = append(entries, CategoryToEntry(l, c))
+	}
+	return entries
+}
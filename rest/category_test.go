@@ -0,0 +1,46 @@
+package rest
+
+import (
+	"testing"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+func TestCategoryLinks(t *testing.T) {
+	a, b := data.CreateCategory("a", nil).GetID(), data.CreateCategory("b", nil).GetID()
+	links := CategoryLinks(testLinker(), []string{a, b})
+	expected := []Link{
+		{Href: "/categories/" + a, Rel: "category", Type: "GET"},
+		{Href: "/categories/" + b, Rel: "category", Type: "GET"},
+	}
+	if len(links) != len(expected) {
+		t.Fatalf("Expected %d links. Got %d", len(expected), len(links))
+	}
+	for i := range expected {
+		if links[i] != expected[i] {
+			t.Errorf("Expected: %+v, Got: %+v", expected[i], links[i])
+		}
+	}
+}
+
+func TestCategoryToEntryLinksParent(t *testing.T) {
+	root := data.CreateCategory("drinks", nil)
+	parentID := root.GetID()
+	child := data.CreateCategory("tea", &parentID)
+
+	links := CategoryToEntry(testLinker(), root).Links
+	if len(links) != 5 || links[0].Rel != "self" || links[4].Href != "/categories/"+parentID+"/products" {
+		t.Errorf("Expected self, update, delete, collection and products links. Got %+v", links)
+	}
+	links = CategoryToEntry(testLinker(), child).Links
+	parent := links[len(links)-1]
+	if parent.Rel != "parent" || parent.Href != "/categories/"+parentID {
+		t.Errorf("Unexpected parent link %+v", parent)
+	}
+}
+
+func TestCategoryToEntryWithoutRouter(t *testing.T) {
+	if links := CategoryToEntry(Linker{}, data.CreateCategory("tea", nil)).Links; len(links) != 0 {
+		t.Errorf("Expected no links. Got %+v", links)
+	}
+}
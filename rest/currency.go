@@ -0,0 +1,27 @@
+package rest
+
+import (
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+// currencyPriceFields - The body PUT /product/{id}/currency-prices/{currency}
+// takes
+var currencyPriceFields = []ActionField{
+	{Name: "price", Type: "number", Required: true},
+}
+
+// CurrencyPriceToEntry - A price set by hand, linking to the product as
+// priced in its currency
+func CurrencyPriceToEntry(l Linker, c data.CurrencyPrice) Entry {
+	self := l.Href(RouteProductCurrencyPrice, "id", c.ProductID, "currency", c.Currency)
+	links := itemLinks(self, l.Href(RouteProductCurrencyPrices, "id", c.ProductID))
+	if self != "" {
+		links = append(links, Link{
+			Href: l.Href(RouteProduct, "id", c.ProductID) + "?currency=" + c.Currency, Rel: "product", Type: "GET"})
+	}
+	e := Entry{Object: c, Links: links}
+	if l.Actions {
+		e.Actions = itemActions(self, currencyPriceFields...)
+	}
+	return e
+}
@@ -0,0 +1,55 @@
+package rest
+
+// HALLink - A link in a HAL document's _links
+type HALLink struct {
+	Href string `json:"href"`
+}
+
+// HALResource - A HAL document: the resource's own fields alongside its
+// _links and _embedded resources
+type HALResource map[string]interface{}
+
+// HALListing - A Listing as a HAL collection, its entries embedded under
+// "items" and the paging counts kept as fields
+func HALListing(l Listing) HALResource {
+	items := make([]HALResource, len(l.Data))
+	for i, e := range l.Data {
+		items[i] = HALEntry(e)
+	}
+	return HALResource{
+		"total":     l.Total,
+		"count":     l.Count,
+		"page":      l.Page,
+		"limit":     l.Limit,
+		"_links":    halLinks(l.Links),
+		"_embedded": map[string][]HALResource{"items": items},
+	}
+}
+
+// HALEntry - An Entry's object as a HAL resource with the entry's links
+func HALEntry(e Entry) HALResource {
+	h := HALResource(objectFields(e.Object))
+	if len(e.Links) > 0 {
+		h["_links"] = halLinks(e.Links)
+	}
+	return h
+}
+
+// halLinks keys links by rel. A rel used more than once becomes an array,
+// as HAL allows.
+func halLinks(links []Link) map[string]interface{} {
+	byRel := map[string]interface{}{}
+	for _, link := range links {
+		rel := linkRel(link.Rel)
+		h := HALLink{Href: link.Href}
+		switch existing := byRel[rel].(type) {
+		case nil:
+			byRel[rel] = h
+		case HALLink:
+			byRel[rel] = []HALLink{existing, h}
+		case []HALLink:
+			byRel[rel] = append(existing, h)
+		}
+	}
+	return byRel
+}
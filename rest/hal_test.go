@@ -0,0 +1,47 @@
+package rest
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+func TestHALListing(t *testing.T) {
+	p := data.NewProduct("a8f5f167-f44f-4964-a6f1-0b2a2fc5e5f4", "tea", 3.5)
+	x, y := data.CreateCategory("x", nil).GetID(), data.CreateCategory("y", nil).GetID()
+	e := Entry{Object: p, Links: CategoryLinks(testLinker(), []string{x, y})}
+	l := ListingJSONResponse("/products", 1, 1, 10, []Entry{e})
+
+	encoded, _ := data.JSONMarshal(HALListing(l))
+	var h struct {
+		Total    uint64
+		Links    map[string]HALLink `json:"_links"`
+		Embedded struct {
+			Items []struct {
+				ID    string
+				Name  string
+				Links map[string][]HALLink `json:"_links"`
+			}
+		} `json:"_embedded"`
+	}
+	if err := json.Unmarshal(encoded, &h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Total != 1 || h.Links["self"].Href != "/products?page=1&count=10" {
+		t.Errorf("Unexpected collection %s", encoded)
+	}
+	if len(h.Embedded.Items) != 1 || h.Embedded.Items[0].ID != p.GetID() || h.Embedded.Items[0].Name != "tea" {
+		t.Fatalf("Expected the product embedded. Got %s", encoded)
+	}
+	if categories := h.Embedded.Items[0].Links["category"]; len(categories) != 2 || categories[1].Href != "/categories/"+y {
+		t.Errorf("Expected both category links. Got %+v", categories)
+	}
+}
+
+func TestHALEntryWithoutLinks(t *testing.T) {
+	h := HALEntry(ProductToEntry(Linker{}, data.CreateProduct("tea", 3.5)))
+	if _, ok := h["_links"]; ok || h["name"] != "tea" {
+		t.Errorf("Unexpected resource %+v", h)
+	}
+}
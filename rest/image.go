@@ -0,0 +1,34 @@
+package rest
+
+import (
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+// ImageLinks - An "image" and a "thumbnail" link per image of a product
+func ImageLinks(l Linker, images []data.Image) []Link {
+	links := []Link{}
+	for _, i := range images {
+		pairs := []string{"id", i.ProductID, "imageId", i.ID}
+		links = append(links,
+			Link{Href: l.Href(RouteProductImage, pairs...), Rel: "image", Type: "GET"},
+			Link{Href: l.Href(RouteImageThumbnail, pairs...), Rel: "thumbnail", Type: "GET"})
+	}
+	return links
+}
+
+// ImageToEntry - What is known about an image, linking to its bytes, its
+// thumbnail and its product
+func ImageToEntry(l Linker, i data.Image) Entry {
+	pairs := []string{"id", i.ProductID, "imageId", i.ID}
+	self := l.Href(RouteProductImage, pairs...)
+	if self == "" {
+		return Entry{Object: i}
+	}
+	return Entry{Object: i, Links: []Link{
+		{Href: self, Rel: "self", Type: "GET"},
+		{Href: self, Rel: "delete", Type: "DELETE"},
+		{Href: l.Href(RouteImageThumbnail, pairs...), Rel: "thumbnail", Type: "GET"},
+		{Href: l.Href(RouteProductImages, "id", i.ProductID), Rel: "collection", Type: "GET"},
+		{Href: l.Href(RouteProduct, "id", i.ProductID), Rel: "product", Type: "GET"},
+	}}
+}
@@ -0,0 +1,128 @@
+package rest
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+// JSONAPIDocument - A JSON:API top-level document
+type JSONAPIDocument struct {
+	Data  interface{}            `json:"data"`
+	Links map[string]string      `json:"links,omitempty"`
+	Meta  map[string]interface{} `json:"meta,omitempty"`
+}
+
+// JSONAPIResource - A JSON:API resource object
+type JSONAPIResource struct {
+	Type          string                         `json:"type"`
+	ID            string                         `json:"id"`
+	Attributes    map[string]interface{}         `json:"attributes"`
+	Relationships map[string]JSONAPIRelationship `json:"relationships,omitempty"`
+	Links         map[string]string              `json:"links,omitempty"`
+}
+
+// JSONAPIRelationship - The resources a link rel points at
+type JSONAPIRelationship struct {
+	Data []JSONAPIIdentifier `json:"data"`
+}
+
+// JSONAPIIdentifier - A JSON:API resource identifier object
+type JSONAPIIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// JSONAPIListing - A Listing as a JSON:API collection, with the paging
+// counts in meta
+func JSONAPIListing(l Listing) JSONAPIDocument {
+	resources := make([]JSONAPIResource, len(l.Data))
+	for i, e := range l.Data {
+		resources[i] = jsonAPIResource(e)
+	}
+	links := map[string]string{}
+	for _, link := range l.Links {
+		links[linkRel(link.Rel)] = link.Href
+	}
+	return JSONAPIDocument{
+		Data:  resources,
+		Links: links,
+		Meta: map[string]interface{}{
+			"total": l.Total,
+			"count": l.Count,
+			"page":  l.Page,
+			"limit": l.Limit,
+		},
+	}
+}
+
+// JSONAPIEntry - An Entry as a single-resource JSON:API document
+func JSONAPIEntry(e Entry) JSONAPIDocument {
+	return JSONAPIDocument{Data: jsonAPIResource(e)}
+}
+
+// jsonAPIResource splits an entry's object into its id and attributes.
+// Links to another resource, such as a product's categories, become
+// relationships; the rest stay links.
+func jsonAPIResource(e Entry) JSONAPIResource {
+	attributes := objectFields(e.Object)
+	id, _ := attributes["id"].(string)
+	delete(attributes, "id")
+	// JSON:API always identifies a resource, even when ?fields= left out id
+	if identified, ok := e.Object.(interface{ GetID() string }); ok {
+		id = identified.GetID()
+	}
+
+	res := JSONAPIResource{Type: jsonAPIType(e.Object), ID: id, Attributes: attributes}
+	for _, link := range e.Links {
+		rel := linkRel(link.Rel)
+		if target, ok := resourceIdentifier(link); ok && rel != "self" {
+			if res.Relationships == nil {
+				res.Relationships = map[string]JSONAPIRelationship{}
+			}
+			r := res.Relationships[rel]
+			r.Data = append(r.Data, target)
+			res.Relationships[rel] = r
+			continue
+		}
+		if res.Links == nil {
+			res.Links = map[string]string{}
+		}
+		res.Links[rel] = link.Href
+	}
+	return res
+}
+
+// resourceIdentifier reads links to a single resource, whose paths end
+// in /{type}/{id}
+func resourceIdentifier(link Link) (JSONAPIIdentifier, bool) {
+	u, err := url.Parse(link.Href)
+	if err != nil || link.Type != "GET" {
+		return JSONAPIIdentifier{}, false
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) < 2 {
+		return JSONAPIIdentifier{}, false
+	}
+	id := segments[len(segments)-1]
+	if data.ParseUUID(id).String() != id {
+		return JSONAPIIdentifier{}, false
+	}
+	return JSONAPIIdentifier{Type: segments[len(segments)-2], ID: id}, true
+}
+
+func jsonAPIType(object interface{}) string {
+	switch object.(type) {
+	case data.Product, data.PartialProduct, data.SearchResult:
+		return "products"
+	case data.Category:
+		return "categories"
+	case data.PriceChange:
+		return "prices"
+	case data.Tenant:
+		return "tenants"
+	}
+	return strings.ToLower(fmt.Sprintf("%T", object))
+}
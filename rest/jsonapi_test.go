@@ -0,0 +1,52 @@
+package rest
+
+import (
+	"testing"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+func TestJSONAPIListing(t *testing.T) {
+	p := data.NewProduct("a8f5f167-f44f-4964-a6f1-0b2a2fc5e5f4", "tea", 3.5)
+	x := data.CreateCategory("x", nil).GetID()
+	e := ProductToEntry(testLinker(), p)
+	e.Links = append(e.Links, CategoryLinks(testLinker(), []string{x})...)
+	doc := JSONAPIListing(ListingJSONResponse("/products", 2, 25, 10, []Entry{e}))
+
+	resources := doc.Data.([]JSONAPIResource)
+	if len(resources) != 1 {
+		t.Fatalf("Expected one resource. Got %+v", doc.Data)
+	}
+	res := resources[0]
+	if res.Type != "products" || res.ID != p.GetID() || res.Attributes["name"] != "tea" {
+		t.Errorf("Unexpected resource %+v", res)
+	}
+	if _, ok := res.Attributes["id"]; ok {
+		t.Error("Expected id outside attributes")
+	}
+	expected := JSONAPIIdentifier{Type: "categories", ID: x}
+	if rel := res.Relationships["category"]; len(res.Relationships) != 1 || len(rel.Data) != 1 || rel.Data[0] != expected {
+		t.Errorf("Expected only the category relationship. Got %+v", res.Relationships)
+	}
+	if res.Links["self"] != "/product/"+p.GetID() || res.Links["collection"] != "/products" {
+		t.Errorf("Expected self and collection links. Got %+v", res.Links)
+	}
+	if doc.Links["self"] != "/products?page=2&count=10" || doc.Links["prev"] == "" || doc.Links["next"] == "" {
+		t.Errorf("Unexpected links %+v", doc.Links)
+	}
+	if doc.Meta["total"] != uint64(25) || doc.Meta["page"] != uint64(2) {
+		t.Errorf("Unexpected meta %+v", doc.Meta)
+	}
+}
+
+func TestJSONAPIEntryKeepsLinks(t *testing.T) {
+	c := data.CreateCategory("tea", nil)
+	res := JSONAPIEntry(CategoryToEntry(testLinker(), c)).Data.(JSONAPIResource)
+
+	if res.Type != "categories" || res.ID != c.GetID() {
+		t.Errorf("Unexpected resource %+v", res)
+	}
+	if res.Links["self"] != "/categories/"+c.GetID() || res.Links["products"] == "" {
+		t.Errorf("Expected self and products links. Got %+v", res.Links)
+	}
+}
@@ -0,0 +1,151 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Names of the routes entries link to. The router registers its routes
+// under these names, and links are only ever built from them.
+const (
+	RouteProducts              = "products"
+	RouteProduct               = "product"
+	RouteProductSearch         = "product-search"
+	RouteProductPrices         = "product-prices"
+	RouteProductImages         = "product-images"
+	RouteProductImage          = "product-image"
+	RouteImageThumbnail        = "product-image-thumbnail"
+	RouteProductVariants       = "product-variants"
+	RouteProductVariant        = "product-variant"
+	RouteSKU                   = "sku"
+	RouteProductTranslations   = "product-translations"
+	RouteProductTranslation    = "product-translation"
+	RouteProductCurrencyPrices = "product-currency-prices"
+	RouteProductCurrencyPrice  = "product-currency-price"
+	RouteCategories            = "categories"
+	RouteCategory              = "category"
+	RouteCategoryProducts      = "category-products"
+	RouteTenants               = "tenants"
+)
+
+// Action - Describes a request an entry accepts, for clients that build
+// forms rather than hard-code them
+type Action struct {
+	Name   string        `json:"name"`
+	Method string        `json:"method"`
+	Href   string        `json:"href"`
+	Type   string        `json:"type,omitempty"`
+	Fields []ActionField `json:"fields,omitempty"`
+}
+
+// ActionField - A member of the JSON body an Action takes
+type ActionField struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+}
+
+// Linker - Builds hrefs for one request from the router's named routes.
+// The zero Linker builds none.
+type Linker struct {
+	Router *mux.Router
+	// Base prefixes every href; empty for paths, or scheme://host/prefix
+	// for absolute URLs
+	Base string
+	// Actions adds action descriptors to entries
+	Actions bool
+}
+
+// NewLinker - A Linker for r, adding actions when r asks with
+// ?actions=true. Absolute URLs take their scheme, host and path prefix from
+// X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-Prefix when a proxy
+// set them.
+func NewLinker(router *mux.Router, r *http.Request, absolute bool) Linker {
+	l := Linker{Router: router, Actions: r.URL.Query().Get("actions") == "true"}
+	if absolute {
+		l.Base = baseURL(r)
+	}
+	return l
+}
+
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	switch proto := strings.ToLower(forwarded(r, "X-Forwarded-Proto")); proto {
+	case "http", "https":
+		scheme = proto
+	}
+	host := r.Host
+	if h := forwarded(r, "X-Forwarded-Host"); h != "" {
+		host = h
+	}
+	prefix := strings.TrimSuffix(forwarded(r, "X-Forwarded-Prefix"), "/")
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	return scheme + "://" + host + prefix
+}
+
+// forwarded is the value the proxy nearest the client set; each proxy on
+// the way appends its own
+func forwarded(r *http.Request, name string) string {
+	return strings.TrimSpace(strings.Split(r.Header.Get(name), ",")[0])
+}
+
+// Href - The URL of the named route with its variables filled in by
+// pairs, or "" when there is no such route
+func (l Linker) Href(name string, pairs ...string) string {
+	if l.Router == nil {
+		return ""
+	}
+	route := l.Router.Get(name)
+	if route == nil {
+		return ""
+	}
+	u, err := route.URL(pairs...)
+	if err != nil {
+		return ""
+	}
+	return l.Base + u.String()
+}
+
+// ListingPath - Href for a listing's paging links, carrying query, an
+// already encoded query string, from page to page
+func (l Linker) ListingPath(name string, query string, pairs ...string) string {
+	href := l.Href(name, pairs...)
+	if query != "" {
+		href += "?" + query
+	}
+	return href
+}
+
+// itemLinks - What any entry that can be changed links to
+func itemLinks(self, collection string) []Link {
+	if self == "" {
+		return nil
+	}
+	links := []Link{
+		{Href: self, Rel: "self", Type: "GET"},
+		{Href: self, Rel: "update", Type: "PUT"},
+		{Href: self, Rel: "delete", Type: "DELETE"},
+	}
+	if collection != "" {
+		links = append(links, Link{Href: collection, Rel: "collection", Type: "GET"})
+	}
+	return links
+}
+
+// itemActions - Describes updating an entry with fields, and deleting it
+func itemActions(self string, fields ...ActionField) []Action {
+	if self == "" {
+		return nil
+	}
+	return []Action{
+		{Name: "update", Method: "PUT", Href: self, Type: MediaTypeJSON, Fields: fields},
+		{Name: "delete", Method: "DELETE", Href: self},
+	}
+}
@@ -0,0 +1,105 @@
+package rest
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+// testLinker names routes the way the app's router does
+func testLinker() Linker {
+	r := mux.NewRouter()
+	handler := func(http.ResponseWriter, *http.Request) {}
+	r.HandleFunc("/products", handler).Name(RouteProducts)
+	r.HandleFunc("/product/{id}", handler).Name(RouteProduct)
+	r.HandleFunc("/categories", handler).Name(RouteCategories)
+	r.HandleFunc("/categories/{id}", handler).Name(RouteCategory)
+	r.HandleFunc("/categories/{id}/products", handler).Name(RouteCategoryProducts)
+	return Linker{Router: r}
+}
+
+func TestProductEntryLinks(t *testing.T) {
+	p := data.CreateProduct("tea", 3.5)
+	e := ProductToEntry(testLinker(), p)
+
+	self := "/product/" + p.GetID()
+	expected := []Link{
+		{Href: self, Rel: "self", Type: "GET"},
+		{Href: self, Rel: "update", Type: "PUT"},
+		{Href: self, Rel: "delete", Type: "DELETE"},
+		{Href: "/products", Rel: "collection", Type: "GET"},
+	}
+	if len(e.Links) != len(expected) {
+		t.Fatalf("Expected %d links. Got %+v", len(expected), e.Links)
+	}
+	for i := range expected {
+		if e.Links[i] != expected[i] {
+			t.Errorf("Expected: %+v, Got: %+v", expected[i], e.Links[i])
+		}
+	}
+	if e.Actions != nil {
+		t.Errorf("Expected no actions unless asked. Got %+v", e.Actions)
+	}
+}
+
+func TestProductEntryActions(t *testing.T) {
+	l := testLinker()
+	l.Actions = true
+	p := data.CreateProduct("tea", 3.5)
+	e := ProductToEntry(l, p)
+
+	if len(e.Actions) != 2 {
+		t.Fatalf("Expected update and delete actions. Got %+v", e.Actions)
+	}
+	update := e.Actions[0]
+	if update.Method != "PUT" || update.Href != "/product/"+p.GetID() || len(update.Fields) != 2 ||
+		update.Fields[1].Name != "price" || !update.Fields[1].Required {
+		t.Errorf("Unexpected update action %+v", update)
+	}
+	if e.Actions[1].Method != "DELETE" || e.Actions[1].Fields != nil {
+		t.Errorf("Unexpected delete action %+v", e.Actions[1])
+	}
+}
+
+func TestNewLinkerAbsolute(t *testing.T) {
+	router := testLinker().Router
+	r := httptest.NewRequest("GET", "http://internal:8080/products?actions=true", nil)
+
+	if l := NewLinker(router, r, false); l.Href(RouteProducts) != "/products" || !l.Actions {
+		t.Errorf("Expected a path and actions. Got %+v", l)
+	}
+	if href := NewLinker(router, r, true).Href(RouteProducts); href != "http://internal:8080/products" {
+		t.Errorf("Expected the request's own host. Got %s", href)
+	}
+
+	r.TLS = &tls.ConnectionState{}
+	if href := NewLinker(router, r, true).Href(RouteProducts); href != "https://internal:8080/products" {
+		t.Errorf("Expected https for TLS requests. Got %s", href)
+	}
+
+	r.Header.Set("X-Forwarded-Proto", "http")
+	r.Header.Set("X-Forwarded-Host", "shop.example.com, proxy.internal")
+	r.Header.Set("X-Forwarded-Prefix", "/api/")
+	if href := NewLinker(router, r, true).Href(RouteProducts); href != "http://shop.example.com/api/products" {
+		t.Errorf("Expected the proxy's view. Got %s", href)
+	}
+
+	r.Header.Set("X-Forwarded-Proto", "javascript")
+	if href := NewLinker(router, r, true).Href(RouteProducts); href != "https://shop.example.com/api/products" {
+		t.Errorf("Expected an unknown scheme to be ignored. Got %s", href)
+	}
+}
+
+func TestLinkerUnknownRoute(t *testing.T) {
+	if href := testLinker().Href("nope"); href != "" {
+		t.Errorf("Expected no href. Got %s", href)
+	}
+	if href := (Linker{}).Href(RouteProducts); href != "" {
+		t.Errorf("Expected no href without a router. Got %s", href)
+	}
+}
@@ -3,8 +3,7 @@ package rest
 import (
 	"fmt"
 	"net/http"
-
-	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"strings"
 )
 
 type Listing struct {
@@ -17,8 +16,9 @@ type Listing struct {
 }
 
 type Entry struct {
-	Object interface{} `json:"object"`
-	Links  []Link      `json:"links"`
+	Object  interface{} `json:"object"`
+	Links   []Link      `json:"links"`
+	Actions []Action    `json:"actions,omitempty"`
 }
 
 type Link struct {
@@ -61,7 +61,11 @@ func ListingJSONResponse(basePath string, page, total uint64, count uint8, entri
 }
 
 func GetPageLink(basePath string, count uint8, page uint64, name, method string) Link {
-	url := basePath + "?" + BuildListingQuery(page, count)
+	separator := "?"
+	if strings.Contains(basePath, "?") {
+		separator = "&"
+	}
+	url := basePath + separator + BuildListingQuery(page, count)
 	return Link{Href: url, Rel: name, Type: method}
 }
 
@@ -86,9 +90,5 @@ func RespondWithError(w http.ResponseWriter, code int, message string) {
 }
 
 func RespondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
-	response, _ := data.JSONMarshal(payload)
-
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(code)
-	w.Write(response)
+	respond(w, code, MediaTypeJSON+"; charset=utf-8", payload)
 }
@@ -78,6 +78,14 @@ func TestGetPageLinkOutputsExpected(t *testing.T) {
 	}
 }
 
+func TestGetPageLinkKeepsExistingQuery(t *testing.T) {
+	expected := Link{Href: "/products/search?q=tea&page=2&count=10", Rel: "next", Type: "GET"}
+	result := GetPageLink("/products/search?q=tea", uint8(10), uint64(2), "next", "GET")
+	if result != expected {
+		t.Errorf("Expected: %+v, Got: %+v", expected, result)
+	}
+}
+
 func TestHyperMediaLinksFirstPage(t *testing.T) {
 	links := []Link{}
 	expected := []Link{
@@ -183,7 +191,7 @@ func TestErrorResponse(t *testing.T) {
 func TestJSONResponseEntry(t *testing.T) {
 	rr := httptest.NewRecorder()
 	prod := data.CreateProduct("test", 9.99)
-	entry := ProductToEntry(prod)
+	entry := ProductToEntry(Linker{}, prod)
 	RespondWithJSON(rr, 200, entry)
 
 	checkCode(t, rr, 200)
@@ -13,20 +13,48 @@ type ProductListing struct {
 	Links []Link         `json:"links"`
 }
 
-type Product struct {
-	Object data.Product `json:"object"`
-	Links  []Link       `json:"links"`
+// productFields - The body PUT /product/{id} takes
+var productFields = []ActionField{
+	{Name: "name", Type: "string", Required: true},
+	{Name: "price", Type: "number", Required: true},
 }
 
-func ProductToEntry(product data.Product) Entry {
-	return Entry{Object: product}
+// productEntry links the product with the given id to itself and its
+// collection
+func productEntry(l Linker, id string, object interface{}) Entry {
+	self := l.Href(RouteProduct, "id", id)
+	e := Entry{Object: object, Links: itemLinks(self, l.Href(RouteProducts))}
+	if l.Actions {
+		e.Actions = itemActions(self, productFields...)
+	}
+	return e
+}
+
+func ProductToEntry(l Linker, product data.Product) Entry {
+	return productEntry(l, product.GetID(), product)
 }
 
-func ProductsToEntries(products []data.Product) []Entry {
+func ProductsToEntries(l Linker, products []data.Product) []Entry {
 	entries := []Entry{}
 	for _, p := range products {
-		e := ProductToEntry(p)
+		e := ProductToEntry(l, p)
 		entries = append(entries, e)
 	}
 	return entries
 }
+
+func PartialProductsToEntries(l Linker, products []data.PartialProduct) []Entry {
+	entries := []Entry{}
+	for _, p := range products {
+		entries = append(entries, productEntry(l, p.ID, p))
+	}
+	return entries
+}
+
+func SearchResultsToEntries(l Linker, results []data.SearchResult) []Entry {
+	entries := []Entry{}
+	for _, r := range results {
+		entries = append(entries, productEntry(l, r.Product.GetID(), r))
+	}
+	return entries
+}
@@ -8,7 +8,7 @@ import (
 
 func TestProductListingJSONResponse(t *testing.T) {
 	result := ListingJSONResponse("/products", 1, 100, 10,
-		ProductsToEntries([]data.Product{}))
+		ProductsToEntries(Linker{}, []data.Product{}))
 	expected := ProductListing{
 		Data:  []data.Product{},
 		Total: 100,
@@ -31,7 +31,7 @@ func TestProductListingJSONResponse(t *testing.T) {
 func TestProductToEntryEmpty(t *testing.T) {
 	products := []data.Product{}
 
-	results := ProductsToEntries(products)
+	results := ProductsToEntries(Linker{}, products)
 	if len(results) != len(products) {
 		t.Fatalf("Both input and output should be zero-length.\n\t%+v", results)
 	}
@@ -40,7 +40,7 @@ func TestProductToEntryEmpty(t *testing.T) {
 func TestProductToEntrySingle(t *testing.T) {
 	products := []data.Product{data.CreateProduct("test", 9.99)}
 
-	results := ProductsToEntries(products)
+	results := ProductsToEntries(Linker{}, products)
 	if len(results) != len(products) {
 		t.Fatalf("Both input and output should be equal length (1).\n\t%+v", results)
 	}
@@ -51,14 +51,14 @@ func TestProductToEntryMultiple(t *testing.T) {
 		data.CreateProduct("test1", 9.99),
 		data.CreateProduct("test2", 99.99)}
 
-	results := ProductsToEntries(products)
+	results := ProductsToEntries(Linker{}, products)
 	if len(results) != len(products) {
 		t.Fatalf("Both input and output should be equal length (2).\n\t%+v", results)
 	}
 }
 
 func TestProductToEntry(t *testing.T) {
-	entry := ProductToEntry(data.CreateProduct("test", 9.99))
+	entry := ProductToEntry(Linker{}, data.CreateProduct("test", 9.99))
 	if false {
 		t.Fatalf("If it compiles we shouldn't reach this. %+v", entry)
 	}
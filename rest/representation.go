@@ -0,0 +1,137 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+// Media types a Listing or Entry can be represented as. MediaTypeJSON is the
+// Listing/Entry format itself, and the default.
+const (
+	MediaTypeJSON    = "application/json"
+	MediaTypeHAL     = "application/hal+json"
+	MediaTypeJSONAPI = "application/vnd.api+json"
+)
+
+// Negotiate - The media type an Accept header prefers, out of those above.
+// Anything else, including no preference at all, gets MediaTypeJSON.
+func Negotiate(accept string) string {
+	best, bestQ := MediaTypeJSON, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, q := parseMediaRange(part)
+		switch mediaType {
+		case MediaTypeJSON, MediaTypeHAL, MediaTypeJSONAPI:
+			if q > bestQ {
+				best, bestQ = mediaType, q
+			}
+		}
+	}
+	return best
+}
+
+func parseMediaRange(part string) (string, float64) {
+	fields := strings.Split(part, ";")
+	mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+	q := 1.0
+	for _, param := range fields[1:] {
+		param = strings.TrimSpace(param)
+		if strings.HasPrefix(param, "q=") {
+			v, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+			if err != nil {
+				return "", 0
+			}
+			q = v
+		}
+	}
+	return mediaType, q
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/Lewiscowles1986/go-gorilla-api/rest")
+}
+
+// RespondWithListing - Writes l in the representation the request accepts
+func RespondWithListing(w http.ResponseWriter, r *http.Request, code int, l Listing) {
+	w.Header().Add("Vary", "Accept")
+	mediaType := Negotiate(r.Header.Get("Accept"))
+	_, span := tracer().Start(r.Context(), "encode "+mediaType)
+	defer span.End()
+	switch mediaType {
+	case MediaTypeHAL:
+		respond(w, code, MediaTypeHAL, HALListing(l))
+	case MediaTypeJSONAPI:
+		respond(w, code, MediaTypeJSONAPI, JSONAPIListing(l))
+	default:
+		RespondWithJSON(w, code, l)
+	}
+}
+
+// RespondWithEntry - Writes e in the representation the request accepts
+func RespondWithEntry(w http.ResponseWriter, r *http.Request, code int, e Entry) {
+	respondWithResource(w, r, code, e, e)
+}
+
+// RespondWithObject - RespondWithEntry for endpoints whose default
+// representation has always been the bare object rather than an Entry. The
+// object has no room for e's links, so those a client can GET go in Link
+// headers instead.
+func RespondWithObject(w http.ResponseWriter, r *http.Request, code int, e Entry) {
+	if Negotiate(r.Header.Get("Accept")) == MediaTypeJSON {
+		for _, l := range e.Links {
+			if l.Type == "GET" {
+				w.Header().Add("Link", fmt.Sprintf("<%s>; rel=%q", l.Href, linkRel(l.Rel)))
+			}
+		}
+	}
+	respondWithResource(w, r, code, e, e.Object)
+}
+
+func respondWithResource(w http.ResponseWriter, r *http.Request, code int, e Entry, fallback interface{}) {
+	w.Header().Add("Vary", "Accept")
+	mediaType := Negotiate(r.Header.Get("Accept"))
+	_, span := tracer().Start(r.Context(), "encode "+mediaType)
+	defer span.End()
+	switch mediaType {
+	case MediaTypeHAL:
+		respond(w, code, MediaTypeHAL, HALEntry(e))
+	case MediaTypeJSONAPI:
+		respond(w, code, MediaTypeJSONAPI, JSONAPIEntry(e))
+	default:
+		RespondWithJSON(w, code, fallback)
+	}
+}
+
+func respond(w http.ResponseWriter, code int, contentType string, payload interface{}) {
+	response, _ := data.JSONMarshal(payload)
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	w.Write(response)
+}
+
+// linkRel maps the listing's "current" page to the "self" rel the other
+// formats expect
+func linkRel(rel string) string {
+	if rel == "current" {
+		return "self"
+	}
+	return rel
+}
+
+// objectFields - The JSON fields of an Entry's object, which every object
+// in this API marshals to
+func objectFields(object interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if encoded, err := data.JSONMarshal(object); err == nil {
+		json.Unmarshal(encoded, &fields)
+	}
+	return fields
+}
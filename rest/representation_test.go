@@ -0,0 +1,47 @@
+package rest
+
+import (
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	for accept, expected := range map[string]string{
+		"":                                       MediaTypeJSON,
+		"*/*":                                    MediaTypeJSON,
+		"text/html":                              MediaTypeJSON,
+		"application/hal+json":                   MediaTypeHAL,
+		"Application/Vnd.Api+JSON":               MediaTypeJSONAPI,
+		"application/json, application/hal+json": MediaTypeJSON,
+		"application/json;q=0.5, application/vnd.api+json": MediaTypeJSONAPI,
+		"application/hal+json;q=0, */*":                    MediaTypeJSON,
+	} {
+		if result := Negotiate(accept); result != expected {
+			t.Errorf("Negotiate(%q): expected %s, got %s", accept, expected, result)
+		}
+	}
+}
+
+func TestObjectLinksGoInHeaders(t *testing.T) {
+	e := Entry{Object: map[string]string{"name": "tea"}, Links: itemLinks("/product/1", "/products")}
+
+	rr := httptest.NewRecorder()
+	RespondWithObject(rr, httptest.NewRequest("GET", "/product/1", nil), 200, e)
+	expected := []string{`</product/1>; rel="self"`, `</products>; rel="collection"`}
+	if links := rr.Header().Values("Link"); !slices.Equal(links, expected) {
+		t.Errorf("Expected %v. Got %v", expected, links)
+	}
+	if strings.TrimSpace(rr.Body.String()) != `{"name":"tea"}` {
+		t.Errorf("Expected the bare object. Got %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/product/1", nil)
+	req.Header.Set("Accept", MediaTypeHAL)
+	RespondWithObject(rr, req, 200, e)
+	if links := rr.Header().Values("Link"); len(links) != 0 {
+		t.Errorf("Expected HAL to keep its links in the body. Got %v", links)
+	}
+}
@@ -0,0 +1,105 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxBodyBytes - The largest request body a Decoder takes unless
+// told otherwise
+const DefaultMaxBodyBytes = 1 << 20
+
+// Decoder - Reads JSON request bodies, the same way for every write
+type Decoder struct {
+	// MaxBytes caps a body, and answers 413 past it; zero means
+	// DefaultMaxBodyBytes
+	MaxBytes int64
+	// Strict refuses members the target has no field for, and bodies sent
+	// without a Content-Type
+	Strict bool
+}
+
+// BodyError - Why a request body was refused, and the status to answer
+// with
+type BodyError struct {
+	Status  int
+	Message string
+}
+
+func (e *BodyError) Error() string {
+	return e.Message
+}
+
+// Decode - Reads a single JSON value from r's body into v. Errors are
+// *BodyError.
+func (d Decoder) Decode(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	if err := d.checkContentType(r.Header.Get("Content-Type")); err != nil {
+		return err
+	}
+	maxBytes := d.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBodyBytes
+	}
+	body := http.MaxBytesReader(w, r.Body, maxBytes)
+	defer body.Close()
+
+	dec := json.NewDecoder(body)
+	if d.Strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		return bodyError(err, maxBytes)
+	}
+	if err := dec.Decode(&json.RawMessage{}); err != io.EOF {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return bodyError(err, maxBytes)
+		}
+		return &BodyError{http.StatusBadRequest, "Request body must hold a single JSON value"}
+	}
+	return nil
+}
+
+// DecodeJSON - Decode, answering the client itself when the body is
+// refused
+func (d Decoder) DecodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := d.Decode(w, r, v); err != nil {
+		bodyErr := err.(*BodyError)
+		RespondWithError(w, bodyErr.Status, bodyErr.Message)
+		return false
+	}
+	return true
+}
+
+// checkContentType accepts application/json and any +json type
+func (d Decoder) checkContentType(contentType string) error {
+	if contentType == "" && !d.Strict {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && (mediaType == MediaTypeJSON || strings.HasSuffix(mediaType, "+json")) {
+		return nil
+	}
+	return &BodyError{http.StatusUnsupportedMediaType,
+		fmt.Sprintf("Content-Type must be %s", MediaTypeJSON)}
+}
+
+// bodyError explains a failed decode. encoding/json has no type for an
+// unknown field, only its message.
+func bodyError(err error, maxBytes int64) *BodyError {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return &BodyError{http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("Request body must not exceed %d bytes", maxBytes)}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return &BodyError{http.StatusBadRequest,
+			"Unknown field " + strings.TrimPrefix(err.Error(), "json: unknown field ")}
+	}
+	return &BodyError{http.StatusBadRequest, "Invalid request payload"}
+}
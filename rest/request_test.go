@@ -0,0 +1,68 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type payload struct {
+	Name string `json:"name"`
+}
+
+func decode(d Decoder, contentType, body string) (payload, *httptest.ResponseRecorder, bool) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	p := payload{}
+	ok := d.DecodeJSON(w, req, &p)
+	return p, w, ok
+}
+
+func TestDecodeJSON(t *testing.T) {
+	for _, contentType := range []string{"", "application/json", "application/json; charset=utf-8", MediaTypeJSONAPI} {
+		p, w, ok := decode(Decoder{}, contentType, `{"name":"widget","extra":1}`)
+		if !ok || p.Name != "widget" {
+			t.Errorf("%q: Expected widget. Got %+v, %d %s", contentType, p, w.Code, w.Body)
+		}
+	}
+}
+
+func TestDecodeJSONRefusals(t *testing.T) {
+	for _, c := range []struct {
+		name        string
+		decoder     Decoder
+		contentType string
+		body        string
+		status      int
+		message     string
+	}{
+		{"garbage", Decoder{}, "", `gibberish`, http.StatusBadRequest, "Invalid request payload"},
+		{"empty", Decoder{}, "", ``, http.StatusBadRequest, "Invalid request payload"},
+		{"two values", Decoder{}, "", `{"name":"a"} {"name":"b"}`, http.StatusBadRequest,
+			"Request body must hold a single JSON value"},
+		{"trailing garbage", Decoder{}, "", `{"name":"a"} x`, http.StatusBadRequest,
+			"Request body must hold a single JSON value"},
+		{"too large", Decoder{MaxBytes: 16}, "", `{"name":"` + strings.Repeat("a", 32) + `"}`,
+			http.StatusRequestEntityTooLarge, "Request body must not exceed 16 bytes"},
+		{"form", Decoder{}, "application/x-www-form-urlencoded", `name=a`,
+			http.StatusUnsupportedMediaType, "Content-Type must be application/json"},
+		{"strict unknown field", Decoder{Strict: true}, "application/json", `{"name":"a","extra":1}`,
+			http.StatusBadRequest, `Unknown field "extra"`},
+		{"strict without Content-Type", Decoder{Strict: true}, "", `{"name":"a"}`,
+			http.StatusUnsupportedMediaType, "Content-Type must be application/json"},
+	} {
+		_, w, ok := decode(c.decoder, c.contentType, c.body)
+		if ok {
+			t.Errorf("%s: Expected a refusal", c.name)
+			continue
+		}
+		expected := `{"error":"` + strings.ReplaceAll(c.message, `"`, `\"`) + `"}`
+		if w.Code != c.status || strings.TrimSpace(w.Body.String()) != expected {
+			t.Errorf("%s: Expected %d %s. Got %d %s", c.name, c.status, expected, w.Code, w.Body)
+		}
+	}
+}
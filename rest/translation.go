@@ -0,0 +1,27 @@
+package rest
+
+import (
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+// translationFields - The body PUT /product/{id}/translations/{locale} takes
+var translationFields = []ActionField{
+	{Name: "name", Type: "string", Required: true},
+	{Name: "description", Type: "string", Required: false},
+}
+
+// TranslationToEntry - A product's translation, linking to the product as
+// read in its locale
+func TranslationToEntry(l Linker, t data.Translation) Entry {
+	self := l.Href(RouteProductTranslation, "id", t.ProductID, "locale", t.Locale)
+	links := itemLinks(self, l.Href(RouteProductTranslations, "id", t.ProductID))
+	if self != "" {
+		links = append(links, Link{
+			Href: l.Href(RouteProduct, "id", t.ProductID) + "?locale=" + t.Locale, Rel: "product", Type: "GET"})
+	}
+	e := Entry{Object: t, Links: links}
+	if l.Actions {
+		e.Actions = itemActions(self, translationFields...)
+	}
+	return e
+}
@@ -0,0 +1,29 @@
+package rest
+
+import (
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+)
+
+// variantFields - The body PUT /product/{id}/variants/{variantId} takes
+var variantFields = []ActionField{
+	{Name: "sku", Type: "string", Required: true},
+	{Name: "options", Type: "object", Required: false},
+	{Name: "price_override", Type: "number", Required: false},
+}
+
+// VariantToEntry - A variant, linking to its collection, its product and
+// its SKU lookup
+func VariantToEntry(l Linker, v data.Variant) Entry {
+	self := l.Href(RouteProductVariant, "id", v.ProductID, "variantId", v.ID)
+	links := itemLinks(self, l.Href(RouteProductVariants, "id", v.ProductID))
+	if self != "" {
+		links = append(links,
+			Link{Href: l.Href(RouteProduct, "id", v.ProductID), Rel: "product", Type: "GET"},
+			Link{Href: l.Href(RouteSKU, "sku", v.SKU), Rel: "sku", Type: "GET"})
+	}
+	e := Entry{Object: v, Links: links}
+	if l.Actions {
+		e.Actions = itemActions(self, variantFields...)
+	}
+	return e
+}
@@ -0,0 +1,259 @@
+package rpc
+
+import (
+	"context"
+	"database/sql"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/blob"
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/events"
+	"github.com/Lewiscowles1986/go-gorilla-api/imaging"
+	"github.com/Lewiscowles1986/go-gorilla-api/productpb"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/telemetry"
+	"github.com/Lewiscowles1986/go-gorilla-api/tenants"
+)
+
+const (
+	defaultPageSize = 250
+	watchBuffer     = 64
+)
+
+// Server - gRPC ProductService backed by the same repositories as the REST
+// API. Every call is scoped to the tenant its interceptors resolved.
+type Server struct {
+	productpb.UnimplementedProductServiceServer
+	db     *repositories.DB
+	events *events.Broker
+	images blob.Store
+}
+
+func NewServer(db *repositories.DB, broker *events.Broker, images blob.Store) *Server {
+	return &Server{db: db, events: broker, images: images}
+}
+
+// NewGRPCServer - A grpc.Server with ProductService registered, resolving
+// each call's tenant from its x-tenant-id metadata or :authority
+func NewGRPCServer(db *repositories.DB, broker *events.Broker, images blob.Store, resolver tenants.Resolver, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(unaryTenantInterceptor(resolver)),
+		grpc.ChainStreamInterceptor(streamTenantInterceptor(resolver)))
+	s := grpc.NewServer(opts...)
+	productpb.RegisterProductServiceServer(s, NewServer(db, broker, images))
+	return s
+}
+
+func (s *Server) GetProduct(ctx context.Context, req *productpb.GetProductRequest) (*productpb.Product, error) {
+	id, err := parseID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := repositories.GetProduct(s.db.WithContext(ctx), tenantOf(ctx), id)
+	if err != nil && ctx.Err() != nil {
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	if err != nil {
+		return nil, loadError(err, id)
+	}
+	return toProto(p), nil
+}
+
+func (s *Server) ListProducts(req *productpb.ListProductsRequest, stream productpb.ProductService_ListProductsServer) error {
+	pageSize := req.GetPageSize()
+	if pageSize < 1 || pageSize > defaultPageSize {
+		pageSize = defaultPageSize
+	}
+	filter := fromProtoFilter(req.GetFilter())
+	tenantID := tenantOf(stream.Context())
+	db := s.db.WithContext(stream.Context())
+
+	// Each page starts after the last id sent, so products created or
+	// deleted mid-stream cannot shift the rest into a repeat or a gap.
+	for {
+		if err := stream.Context().Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		products, err := repositories.FindProducts(db, tenantID, filter, 1, uint8(pageSize))
+		if err != nil && stream.Context().Err() != nil {
+			return status.FromContextError(stream.Context().Err()).Err()
+		}
+		if err != nil {
+			return status.Error(codes.Internal, "Error loading")
+		}
+		for _, p := range products {
+			if err := stream.Send(toProto(p)); err != nil {
+				return err
+			}
+		}
+		if len(products) < int(pageSize) {
+			return nil
+		}
+		filter.AfterID = products[len(products)-1].GetID()
+	}
+}
+
+func (s *Server) CreateProduct(ctx context.Context, req *productpb.CreateProductRequest) (*productpb.Product, error) {
+	p := data.CreateProduct(req.GetName(), req.GetPrice())
+	if err := data.ValidateProduct(p); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	err := s.db.WithTx(ctx, func(tx *repositories.Tx) error {
+		if err := repositories.CreateProduct(tx, tenantOf(ctx), p); err != nil {
+			return err
+		}
+		return repositories.EnqueueEvent(tx, tenantOf(ctx), events.ProductCreated, p)
+	})
+	if err == repositories.ErrProductExists {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	if err != nil {
+		telemetry.Printf(ctx, "creating product: %v", err)
+		return nil, status.Error(codes.Internal, "Could not create product")
+	}
+	s.events.Publish(tenantOf(ctx), events.ProductCreated, p)
+
+	return toProto(p), nil
+}
+
+func (s *Server) UpdateProduct(ctx context.Context, req *productpb.UpdateProductRequest) (*productpb.Product, error) {
+	id, err := parseID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	tenantID := tenantOf(ctx)
+
+	p := data.CreateProduct(req.GetName(), req.GetPrice())
+	if err := data.ValidateProduct(p); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var m data.Product
+	err = s.db.WithTx(ctx, func(tx *repositories.Tx) (err error) {
+		if m, err = repositories.UpdateProduct(tx, tenantID, id, p); err != nil {
+			return err
+		}
+		return repositories.EnqueueEvent(tx, tenantID, events.ProductUpdated, m)
+	})
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		return nil, loadError(err, id)
+	default:
+		return nil, status.Errorf(codes.Internal, "Unable to save product '%s'", id)
+	}
+	s.events.Publish(tenantID, events.ProductUpdated, m)
+
+	return toProto(m), nil
+}
+
+func (s *Server) DeleteProduct(ctx context.Context, req *productpb.DeleteProductRequest) (*productpb.DeleteProductResponse, error) {
+	id, err := parseID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	tenantID := tenantOf(ctx)
+	var p data.Product
+	var images []string
+	err = s.db.WithTx(ctx, func(tx *repositories.Tx) (err error) {
+		if images, err = repositories.GetProductImageIDs(tx, tenantID, id); err != nil {
+			return err
+		}
+		if p, err = repositories.DeleteProduct(tx, tenantID, id); err != nil {
+			return err
+		}
+		return repositories.EnqueueEvent(tx, tenantID, events.ProductDeleted, p)
+	})
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		return nil, loadError(err, id)
+	default:
+		telemetry.Printf(ctx, "deleting product %s: %v", id, err)
+		return nil, status.Errorf(codes.Internal, "Unable to delete product '%s'", id)
+	}
+	s.events.Publish(tenantID, events.ProductDeleted, p)
+	imaging.DeleteBlobs(ctx, s.images, tenantID, images...)
+
+	return &productpb.DeleteProductResponse{}, nil
+}
+
+func (s *Server) WatchProducts(req *productpb.WatchProductsRequest, stream productpb.ProductService_WatchProductsServer) error {
+	tenantID := tenantOf(stream.Context())
+	ch, cancel := s.events.Subscribe(watchBuffer)
+	defer cancel()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case e, ok := <-ch:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "Watcher fell behind, resubscribe")
+			}
+			if e.TenantID != tenantID {
+				continue
+			}
+			if err := stream.Send(toProtoEvent(e)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func parseID(raw string) (string, error) {
+	id := data.ParseUUID(raw)
+	if id.String() != raw {
+		return "", status.Errorf(codes.InvalidArgument, "Invalid product id '%s'", raw)
+	}
+	return id.String(), nil
+}
+
+// loadError maps repository errors the same way getProduct maps them to
+// HTTP status codes
+func loadError(err error, id string) error {
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Product '%s' not found", id)
+	}
+	return status.Error(codes.Internal, "Error loading")
+}
+
+func toProto(p data.Product) *productpb.Product {
+	return &productpb.Product{Id: p.GetID(), Name: p.GetName(), Price: p.GetPrice()}
+}
+
+func toProtoEvent(e events.Event) *productpb.ProductEvent {
+	eventType := productpb.ProductEvent_TYPE_UNSPECIFIED
+	switch e.Type {
+	case events.ProductCreated:
+		eventType = productpb.ProductEvent_TYPE_CREATED
+	case events.ProductUpdated:
+		eventType = productpb.ProductEvent_TYPE_UPDATED
+	case events.ProductDeleted:
+		eventType = productpb.ProductEvent_TYPE_DELETED
+	}
+	return &productpb.ProductEvent{
+		Type:       eventType,
+		Product:    toProto(e.Product),
+		OccurredAt: timestamppb.New(e.OccurredAt),
+	}
+}
+
+func fromProtoFilter(f *productpb.ProductFilter) repositories.ProductFilter {
+	filter := repositories.ProductFilter{Name: f.GetName()}
+	if f != nil && f.MinPrice != nil {
+		min := f.GetMinPrice()
+		filter.MinPrice = &min
+	}
+	if f != nil && f.MaxPrice != nil {
+		max := f.GetMaxPrice()
+		filter.MaxPrice = &max
+	}
+	return filter
+}
@@ -0,0 +1,376 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	uuid "github.com/satori/go.uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/blob"
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/events"
+	"github.com/Lewiscowles1986/go-gorilla-api/imaging"
+	"github.com/Lewiscowles1986/go-gorilla-api/productpb"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/tenants"
+)
+
+func setup(t *testing.T) (productpb.ProductServiceClient, *repositories.DB, *events.Broker) {
+	return setupWith(t, blob.NewFS(t.TempDir()))
+}
+
+// setupWith serves ProductService keeping images in images
+func setupWith(t *testing.T, images blob.Store) (productpb.ProductServiceClient, *repositories.DB, *events.Broker) {
+	db, err := repositories.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := repositories.MigrateUp(db, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	broker := events.NewBroker()
+	lis := bufconn.Listen(1024 * 1024)
+	srv := NewGRPCServer(db, broker, images, tenants.Resolver{
+		Exists:  func(id string) (bool, error) { return repositories.TenantExists(db, id) },
+		KeyHash: func(id string) (string, error) { return repositories.TenantKeyHash(db, id) },
+	})
+	go srv.Serve(lis)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+		srv.Stop()
+		db.Close()
+	})
+	return productpb.NewProductServiceClient(conn), db, broker
+}
+
+func checkCode(t *testing.T, err error, expected codes.Code) {
+	t.Helper()
+	if code := status.Code(err); code != expected {
+		t.Errorf("Expected %s. Got %s (%v)", expected, code, err)
+	}
+}
+
+func TestGetProduct(t *testing.T) {
+	client, db, _ := setup(t)
+	p := data.CreateProduct("test", 9.99)
+	repositories.CreateProduct(db, tenants.Default, p)
+
+	result, err := client.GetProduct(context.Background(),
+		&productpb.GetProductRequest{Id: p.GetID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.GetName() != "test" || result.GetPrice() != 9.99 {
+		t.Errorf("Unexpected product %v", result)
+	}
+}
+
+func TestGetNonExistentProduct(t *testing.T) {
+	client, _, _ := setup(t)
+
+	_, err := client.GetProduct(context.Background(),
+		&productpb.GetProductRequest{Id: uuid.Must(uuid.NewV4(), nil).String()})
+	checkCode(t, err, codes.NotFound)
+}
+
+func TestGetProductInvalidID(t *testing.T) {
+	client, _, _ := setup(t)
+
+	_, err := client.GetProduct(context.Background(),
+		&productpb.GetProductRequest{Id: "garbage"})
+	checkCode(t, err, codes.InvalidArgument)
+}
+
+func TestListProductsStreamsEveryPage(t *testing.T) {
+	client, db, _ := setup(t)
+	for i := 0; i < 7; i++ {
+		repositories.CreateProduct(db, tenants.Default, data.CreateProduct("item", float64(i)))
+	}
+
+	stream, err := client.ListProducts(context.Background(),
+		&productpb.ListProductsRequest{PageSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := []string{}
+	for {
+		p, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, p.GetId())
+	}
+	if len(received) != 7 {
+		t.Errorf("Expected 7 products. Got %d", len(received))
+	}
+	for i := 1; i < len(received); i++ {
+		if received[i] <= received[i-1] {
+			t.Errorf("Expected each product once, in id order. Got %v", received)
+			break
+		}
+	}
+}
+
+func TestListProductsFilter(t *testing.T) {
+	client, db, _ := setup(t)
+	repositories.CreateProduct(db, tenants.Default, data.CreateProduct("cheap", 1))
+	repositories.CreateProduct(db, tenants.Default, data.CreateProduct("dear", 100))
+
+	min := 50.0
+	stream, err := client.ListProducts(context.Background(),
+		&productpb.ListProductsRequest{Filter: &productpb.ProductFilter{MinPrice: &min}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.GetName() != "dear" {
+		t.Errorf("Expected 'dear'. Got %q", p.GetName())
+	}
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Errorf("Expected end of stream. Got %v", err)
+	}
+}
+
+func TestCreateUpdateDeleteProduct(t *testing.T) {
+	client, _, _ := setup(t)
+	ctx := context.Background()
+
+	created, err := client.CreateProduct(ctx,
+		&productpb.CreateProductRequest{Name: "created", Price: 1.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := client.UpdateProduct(ctx,
+		&productpb.UpdateProductRequest{Id: created.GetId(), Name: "updated", Price: 2.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.GetId() != created.GetId() || updated.GetName() != "updated" {
+		t.Errorf("Unexpected product %v", updated)
+	}
+
+	if _, err := client.DeleteProduct(ctx,
+		&productpb.DeleteProductRequest{Id: created.GetId()}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetProduct(ctx, &productpb.GetProductRequest{Id: created.GetId()})
+	checkCode(t, err, codes.NotFound)
+}
+
+func TestCreateProductValidation(t *testing.T) {
+	client, _, _ := setup(t)
+
+	_, err := client.CreateProduct(context.Background(),
+		&productpb.CreateProductRequest{Name: "", Price: 1.5})
+	checkCode(t, err, codes.InvalidArgument)
+
+	_, err = client.CreateProduct(context.Background(),
+		&productpb.CreateProductRequest{Name: "negative", Price: -1})
+	checkCode(t, err, codes.InvalidArgument)
+}
+
+func TestUpdateNonExistentProduct(t *testing.T) {
+	client, _, _ := setup(t)
+
+	_, err := client.UpdateProduct(context.Background(), &productpb.UpdateProductRequest{
+		Id: uuid.Must(uuid.NewV4(), nil).String(), Name: "x", Price: 1})
+	checkCode(t, err, codes.NotFound)
+}
+
+func TestDeleteNonExistentProduct(t *testing.T) {
+	client, _, _ := setup(t)
+
+	_, err := client.DeleteProduct(context.Background(), &productpb.DeleteProductRequest{
+		Id: uuid.Must(uuid.NewV4(), nil).String()})
+	checkCode(t, err, codes.NotFound)
+}
+
+func TestWatchProducts(t *testing.T) {
+	client, _, broker := setup(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchProducts(ctx, &productpb.WatchProductsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keep publishing until the subscription is live, then wait for the
+	// create to arrive.
+	go func() {
+		for ctx.Err() == nil {
+			broker.Publish(tenants.Default, events.ProductUpdated, data.CreateProduct("ping", 0))
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := client.CreateProduct(ctx,
+		&productpb.CreateProductRequest{Name: "watched", Price: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		e, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.GetType() == productpb.ProductEvent_TYPE_CREATED {
+			if e.GetProduct().GetId() != created.GetId() {
+				t.Errorf("Expected event for %s. Got %v", created.GetId(), e)
+			}
+			return
+		}
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	client, db, _ := setup(t)
+	repositories.CreateTenant(db, "acme", "Acme")
+	repositories.CreateTenant(db, "globex", "Globex")
+	acme := metadata.AppendToOutgoingContext(context.Background(), "x-tenant-id", "acme")
+	globex := metadata.AppendToOutgoingContext(context.Background(), "x-tenant-id", "globex")
+
+	created, err := client.CreateProduct(acme,
+		&productpb.CreateProductRequest{Name: "anvil", Price: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.GetProduct(globex, &productpb.GetProductRequest{Id: created.GetId()})
+	checkCode(t, err, codes.NotFound)
+	_, err = client.UpdateProduct(globex, &productpb.UpdateProductRequest{
+		Id: created.GetId(), Name: "stolen", Price: 1})
+	checkCode(t, err, codes.NotFound)
+	_, err = client.DeleteProduct(globex, &productpb.DeleteProductRequest{Id: created.GetId()})
+	checkCode(t, err, codes.NotFound)
+	_, err = client.GetProduct(context.Background(), &productpb.GetProductRequest{Id: created.GetId()})
+	checkCode(t, err, codes.NotFound)
+
+	stream, err := client.ListProducts(globex, &productpb.ListProductsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Errorf("Expected no products for globex. Got %v", err)
+	}
+
+	result, err := client.GetProduct(acme, &productpb.GetProductRequest{Id: created.GetId()})
+	if err != nil || result.GetName() != "anvil" {
+		t.Errorf("Expected acme's product untouched. Got %v, %v", result, err)
+	}
+}
+
+func TestUnknownTenant(t *testing.T) {
+	client, _, _ := setup(t)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-tenant-id", "nobody")
+
+	_, err := client.CreateProduct(ctx, &productpb.CreateProductRequest{Name: "x", Price: 1})
+	checkCode(t, err, codes.NotFound)
+}
+
+func TestDeleteProductRemovesImageBlobs(t *testing.T) {
+	images := blob.NewFS(t.TempDir())
+	client, db, _ := setupWith(t, images)
+	ctx := context.Background()
+	p := data.CreateProduct("pictured", 1)
+	repositories.CreateProduct(db, tenants.Default, p)
+	img := data.Image{ID: uuid.Must(uuid.NewV4(), nil).String(), ProductID: p.GetID(),
+		ContentType: "image/png", ThumbnailContentType: "image/png", CreatedAt: time.Now()}
+	for _, thumbnail := range []bool{false, true} {
+		if err := images.Put(ctx, imaging.Key(tenants.Default, img.ID, thumbnail), []byte("png"), "image/png"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repositories.CreateImage(db, tenants.Default, img); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.DeleteProduct(ctx, &productpb.DeleteProductRequest{Id: p.GetID()}); err != nil {
+		t.Fatal(err)
+	}
+	for _, thumbnail := range []bool{false, true} {
+		if _, err := images.Get(ctx, imaging.Key(tenants.Default, img.ID, thumbnail)); err != blob.ErrNotFound {
+			t.Errorf("Expected the image's blobs removed. Got %v", err)
+		}
+	}
+}
+
+func TestTenantKeyRequired(t *testing.T) {
+	client, db, _ := setup(t)
+	repositories.CreateTenant(db, "acme", "Acme")
+	repositories.SetTenantKey(db, "acme", tenants.HashKey("secret"))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-tenant-id", "acme")
+
+	_, err := client.CreateProduct(ctx, &productpb.CreateProductRequest{Name: "x", Price: 1})
+	checkCode(t, err, codes.Unauthenticated)
+	_, err = client.CreateProduct(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer wrong"),
+		&productpb.CreateProductRequest{Name: "x", Price: 1})
+	checkCode(t, err, codes.Unauthenticated)
+	_, err = client.CreateProduct(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret"),
+		&productpb.CreateProductRequest{Name: "x", Price: 1})
+	if err != nil {
+		t.Errorf("Expected the key to be accepted. Got %v", err)
+	}
+}
+
+func TestInternalErrorsHideTheirCause(t *testing.T) {
+	client, db, _ := setup(t)
+	p := data.CreateProduct("test", 9.99)
+	repositories.CreateProduct(db, tenants.Default, p)
+	db.Exec("DROP TABLE outbox")
+
+	_, err := client.CreateProduct(context.Background(), &productpb.CreateProductRequest{Name: "x", Price: 1})
+	checkCode(t, err, codes.Internal)
+	if message := status.Convert(err).Message(); message != "Could not create product" {
+		t.Errorf("Expected a fixed message. Got %q", message)
+	}
+	_, err = client.DeleteProduct(context.Background(), &productpb.DeleteProductRequest{Id: p.GetID()})
+	checkCode(t, err, codes.Internal)
+	if message := status.Convert(err).Message(); strings.Contains(message, "outbox") {
+		t.Errorf("Expected the SQL error kept back. Got %q", message)
+	}
+}
+
+func TestReadsStopWithTheirCall(t *testing.T) {
+	_, db, broker := setup(t)
+	p := data.CreateProduct("test", 9.99)
+	repositories.CreateProduct(db, tenants.Default, p)
+	ctx, cancel := context.WithCancel(tenants.NewContext(context.Background(), tenants.Default))
+	cancel()
+
+	_, err := NewServer(db, broker, blob.NewFS(t.TempDir())).GetProduct(ctx, &productpb.GetProductRequest{Id: p.GetID()})
+	checkCode(t, err, codes.Canceled)
+}
@@ -0,0 +1,75 @@
+package rpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/tenants"
+)
+
+// tenantMetadataKey - The gRPC counterpart of the X-Tenant-ID header
+const tenantMetadataKey = "x-tenant-id"
+
+// resolveTenant binds ctx to the tenant its metadata names, refusing calls
+// for tenants that do not exist with the same NotFound as a missing product,
+// and calls not bearing the tenant's key in their authorization metadata
+func resolveTenant(ctx context.Context, resolver tenants.Resolver) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	id := resolver.ResolveFrom(ctx, first(md.Get(tenantMetadataKey)), first(md.Get(":authority")))
+	if !resolver.Provisioned(id) {
+		return nil, status.Error(codes.NotFound, "Tenant not found")
+	}
+	if !resolver.Authenticated(id, first(md.Get("authorization"))) {
+		return nil, status.Error(codes.Unauthenticated, "Tenant key required")
+	}
+	return tenants.NewContext(ctx, id), nil
+}
+
+func unaryTenantInterceptor(resolver tenants.Resolver) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := resolveTenant(ctx, resolver)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func streamTenantInterceptor(resolver tenants.Resolver) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+		ctx, err := resolveTenant(ss.Context(), resolver)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &tenantStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// tenantStream carries the resolved tenant in its context
+type tenantStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tenantStream) Context() context.Context {
+	return s.ctx
+}
+
+// tenantOf is the tenant the interceptors bound to ctx
+func tenantOf(ctx context.Context) string {
+	id, _ := tenants.FromContext(ctx)
+	return id
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
@@ -10,6 +10,12 @@ func GetDBConnStr(connType, username, password, database string) string {
 			"user=%s password=%s dbname=%s sslmode=%s",
 			username, password, database, Getenv("DB_SSL_MODE", "disable"))
 	}
+	// MySQL reports rows matched rather than changed, as the others do, and
+	// scans DATETIME into time.Time
+	if connType == "mysql" {
+		return fmt.Sprintf("%s:%s@/%s?parseTime=true&clientFoundRows=true",
+			username, password, database)
+	}
 	if connType == "sqlite3" && database != ":memory:" {
 		return fmt.Sprintf("%s.db", database)
 	}
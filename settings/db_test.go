@@ -28,3 +28,12 @@ func TestPostGresDB(t *testing.T) {
 			"Expected: '%s'. Received: '%s'", expected, result)
 	}
 }
+
+func TestMySQLDB(t *testing.T) {
+	expected := "username:password@/someOtherDbName?parseTime=true&clientFoundRows=true"
+	result := GetDBConnStr("mysql", "username", "password", "someOtherDbName")
+	if result != expected {
+		t.Errorf("mysql connection string resolution failed. "+
+			"Expected: '%s'. Received: '%s'", expected, result)
+	}
+}
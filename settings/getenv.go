@@ -2,6 +2,7 @@ package settings
 
 import (
 	"os"
+	"strconv"
 )
 
 func Getenv(key, fallback string) string {
@@ -11,3 +12,11 @@ func Getenv(key, fallback string) string {
 	}
 	return value
 }
+
+func GetenvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
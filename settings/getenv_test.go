@@ -19,3 +19,26 @@ func TestGetEnvNonExistantVar(t *testing.T) {
 			"reporting a bug")
 	}
 }
+
+func TestGetEnvIntNonExistantVar(t *testing.T) {
+	result := GetenvInt("HSDUIHFDSKAJAKCNCKBCK", 42)
+	if result != 42 {
+		t.Errorf("Expected fallback of 42. Got %d", result)
+	}
+}
+
+func TestGetEnvIntParsesValue(t *testing.T) {
+	t.Setenv("GO_GORILLA_API_TEST_INT", "2048")
+	result := GetenvInt("GO_GORILLA_API_TEST_INT", 42)
+	if result != 2048 {
+		t.Errorf("Expected 2048. Got %d", result)
+	}
+}
+
+func TestGetEnvIntIgnoresGarbage(t *testing.T) {
+	t.Setenv("GO_GORILLA_API_TEST_INT", "lots")
+	result := GetenvInt("GO_GORILLA_API_TEST_INT", 42)
+	if result != 42 {
+		t.Errorf("Expected fallback of 42. Got %d", result)
+	}
+}
@@ -0,0 +1,124 @@
+package telemetry
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer is looked up on each use, so that it follows whichever provider
+// Setup installed
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/Lewiscowles1986/go-gorilla-api/telemetry")
+}
+
+// routeVarPattern matches the pattern of a route variable, {id:[a-f0-9-]+}
+var routeVarPattern = regexp.MustCompile(`\{([^{}:]+):[^{}]*(?:\{[^{}]*\}[^{}]*)*\}`)
+
+// Route - A route's path template without its variables' patterns, such as
+// /product/{id}
+func Route(route *mux.Route) string {
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+	return routeVarPattern.ReplaceAllString(template, "{$1}")
+}
+
+// Middleware - A server span for each request, joined to the trace of any
+// traceparent the caller sent. It wraps the whole router, so requests that
+// match no route are traced too; NameRoute names the span after the route
+// once one has matched. Requests failing with a 5xx are logged with their
+// trace.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer().Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+			))
+		defer span.End()
+
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", sw.status))
+		if sw.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+			Printf(ctx, "%s %s %d %s", r.Method, r.URL.Path, sw.status, time.Since(start))
+		}
+	})
+}
+
+// NameRoute - Names the request's server span after the route it matched,
+// such as GET /product/{id}. For Router.Use, under Middleware.
+func NameRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if current := mux.CurrentRoute(r); current != nil {
+			if route := Route(current); route != "" {
+				span := trace.SpanFromContext(r.Context())
+				span.SetName(r.Method + " " + route)
+				span.SetAttributes(attribute.String("http.route", route))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusWriter remembers the status a handler answered with
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	if sw.status == 0 && code >= 200 {
+		sw.status = code
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses streaming
+func (sw *statusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets connection upgrades through
+func (sw *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := sw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("underlying ResponseWriter does not support hijacking")
+	}
+	if sw.status == 0 {
+		sw.status = http.StatusSwitchingProtocols
+	}
+	return hj.Hijack()
+}
+
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
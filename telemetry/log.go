@@ -0,0 +1,23 @@
+package telemetry
+
+import (
+	"context"
+	"log"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Printf - log.Printf, led by the trace and span ctx is part of, so a log
+// line can be followed to its trace
+func Printf(ctx context.Context, format string, v ...interface{}) {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		format = "trace_id=" + sc.TraceID().String() + " span_id=" + sc.SpanID().String() + " " + format
+	}
+	log.Printf(format, v...)
+}
+
+// Start - A span for work that is not part of a request, such as a
+// background sweep
+func Start(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name)
+}
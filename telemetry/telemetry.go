@@ -0,0 +1,110 @@
+// Package telemetry - Traces requests through the API and the SQL they run,
+// with OpenTelemetry
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Exporters Setup knows
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+	ExporterOTLP   = "otlp"
+)
+
+// Config - Where spans go and how many are kept
+type Config struct {
+	// ServiceName names this process in every trace
+	ServiceName string
+	// Exporter is one of the Exporter constants; ExporterNone records
+	// nothing, though trace context is still passed on
+	Exporter string
+	// File is where ExporterFile writes, one JSON span per line
+	File string
+	// Endpoint is the collector ExporterOTLP sends to over HTTP, such as
+	// http://localhost:4318
+	Endpoint string
+	// SampleRatio is the share of traces started here that are kept, from 0
+	// to 1. A caller's traceparent decides for the traces it started.
+	SampleRatio float64
+}
+
+// DefaultConfig - Tracing off, with everything else ready for turning it on
+func DefaultConfig() Config {
+	return Config{
+		ServiceName: "go-gorilla-api",
+		Exporter:    ExporterNone,
+		File:        "traces.json",
+		Endpoint:    "http://localhost:4318",
+		SampleRatio: 1,
+	}
+}
+
+// Setup - Installs W3C trace context propagation and, unless the exporter
+// is ExporterNone, a tracer provider exporting to it. The returned function
+// flushes and stops the exporter.
+func Setup(ctx context.Context, c Config) (func(context.Context) error, error) {
+	exporter, closer, err := newExporter(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", c.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			if cerr := closer.Close(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}, nil
+}
+
+// newExporter - The exporter c names, and anything to close after it
+func newExporter(ctx context.Context, c Config) (sdktrace.SpanExporter, io.Closer, error) {
+	switch c.Exporter {
+	case "", ExporterNone:
+		return nil, nil, nil
+	case ExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		return exporter, nil, err
+	case ExporterFile:
+		f, err := os.OpenFile(c.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		return exporter, f, nil
+	case ExporterOTLP:
+		exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(c.Endpoint))
+		return exporter, nil, err
+	}
+	return nil, nil, fmt.Errorf("unknown trace exporter %q", c.Exporter)
+}
@@ -0,0 +1,214 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// record installs a provider that keeps every span, for the rest of t
+func record(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+	return recorder
+}
+
+func tracedRouter(status int) *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/product/{id:[a-f0-9]{8}}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})
+	router.Use(NameRoute)
+	return router
+}
+
+func TestRoute(t *testing.T) {
+	router := mux.NewRouter()
+	cases := map[string]string{
+		"/products":                          "/products",
+		"/product/{id:[a-f0-9]{8}-[a-f0-9]}": "/product/{id}",
+		"/categories/{id:[0-9]+}/products/{productId:[a-z]{2,3}}": "/categories/{id}/products/{productId}",
+		"/admin/tenants/{tenantId}":                               "/admin/tenants/{tenantId}",
+	}
+	for template, expected := range cases {
+		if result := Route(router.Path(template)); result != expected {
+			t.Errorf("%s: expected %s got %s", template, expected, result)
+		}
+	}
+}
+
+func TestMiddlewareJoinsCallersTrace(t *testing.T) {
+	recorder := record(t)
+	req := httptest.NewRequest("GET", "/product/0123abcd", nil)
+	req.Header.Set("traceparent", traceparent)
+	Middleware(tracedRouter(http.StatusOK)).ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected one span. Got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /product/{id}" || span.SpanKind() != trace.SpanKindServer {
+		t.Errorf("Expected a server span named by route. Got %s %s", span.SpanKind(), span.Name())
+	}
+	if span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		span.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Expected the caller's trace. Got %s under %s", span.SpanContext().TraceID(), span.Parent().SpanID())
+	}
+	if span.Status().Code == codes.Error {
+		t.Errorf("Expected success. Got %v", span.Status())
+	}
+}
+
+func TestMiddlewareTracesUnmatchedRequests(t *testing.T) {
+	recorder := record(t)
+	req := httptest.NewRequest("GET", "/nowhere", nil)
+	rr := httptest.NewRecorder()
+	Middleware(tracedRouter(http.StatusOK)).ServeHTTP(rr, req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected one span. Got %d", len(spans))
+	}
+	if spans[0].Name() != "GET" || rr.Code != http.StatusNotFound {
+		t.Errorf("Expected a span named by method for the 404. Got %s, %d", spans[0].Name(), rr.Code)
+	}
+}
+
+func TestMiddlewareAllowsHijacking(t *testing.T) {
+	srv := httptest.NewServer(Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+		rw.Flush()
+	})))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "test")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("Expected the upgrade through. Got %d", res.StatusCode)
+	}
+}
+
+func TestMiddlewareLogsServerErrors(t *testing.T) {
+	recorder := record(t)
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	req := httptest.NewRequest("GET", "/product/0123abcd", nil)
+	req.Header.Set("traceparent", traceparent)
+	Middleware(tracedRouter(http.StatusInternalServerError)).ServeHTTP(httptest.NewRecorder(), req)
+
+	span := recorder.Ended()[0]
+	if span.Status().Code != codes.Error {
+		t.Errorf("Expected the span failed. Got %v", span.Status())
+	}
+	if line := logged.String(); !strings.Contains(line, "trace_id=4bf92f3577b34da6a3ce929d0e0e4736 span_id="+
+		span.SpanContext().SpanID().String()) || !strings.Contains(line, "GET /product/0123abcd 500") {
+		t.Errorf("Expected the failure logged with its trace. Got %q", line)
+	}
+}
+
+func TestPrintfWithoutTrace(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	Printf(context.Background(), "plain %d", 1)
+	if line := logged.String(); strings.Contains(line, "trace_id") || !strings.Contains(line, "plain 1") {
+		t.Errorf("Expected a plain line. Got %q", line)
+	}
+}
+
+// exportOne sets up c, records one span and shuts down, flushing it
+func exportOne(t *testing.T, c Config) {
+	t.Helper()
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	defer func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	}()
+	stop, err := Setup(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := Start(context.Background(), "expire reservations")
+	span.End()
+	if err := stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	c := DefaultConfig()
+	c.Exporter = ExporterFile
+	c.File = filepath.Join(t.TempDir(), "traces.json")
+	exportOne(t, c)
+
+	written, err := os.ReadFile(c.File)
+	if err != nil || !bytes.Contains(written, []byte(`"Name":"expire reservations"`)) {
+		t.Errorf("Expected the span written. Got %s %v", written, err)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var received atomic.Int32
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && r.URL.Path == "/v1/traces" &&
+			r.Header.Get("Content-Type") == "application/x-protobuf" {
+			received.Add(1)
+		}
+	}))
+	defer collector.Close()
+
+	c := DefaultConfig()
+	c.Exporter = ExporterOTLP
+	c.Endpoint = collector.URL
+	exportOne(t, c)
+	if received.Load() != 1 {
+		t.Errorf("Expected one export to the collector. Got %d", received.Load())
+	}
+}
+
+func TestUnknownExporter(t *testing.T) {
+	c := DefaultConfig()
+	c.Exporter = "carrier-pigeon"
+	if _, err := Setup(context.Background(), c); err == nil {
+		t.Error("Expected an unknown exporter refused")
+	}
+}
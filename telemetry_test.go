@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRequestsAreTracedThroughSQL(t *testing.T) {
+	clearTable()
+	recorder := tracetest.NewSpanRecorder()
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	}()
+
+	req, _ := http.NewRequest("GET", "/products", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+
+	var server trace.SpanContext
+	children := map[string]bool{}
+	for _, span := range recorder.Ended() {
+		if span.SpanKind() == trace.SpanKindServer {
+			if span.Name() != "GET /products" {
+				t.Errorf("Expected the server span named by route. Got %s", span.Name())
+			}
+			server = span.SpanContext()
+		}
+	}
+	for _, span := range recorder.Ended() {
+		if span.Parent().SpanID() == server.SpanID() {
+			children[span.Name()] = true
+		}
+		if span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("Expected %s in the caller's trace. Got %s", span.Name(), span.SpanContext().TraceID())
+		}
+	}
+	for _, name := range []string{"SELECT products", "encode application/json"} {
+		if !children[name] {
+			t.Errorf("Expected a %s span under the request. Got %v", name, children)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/imaging"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/rest"
+	"github.com/Lewiscowles1986/go-gorilla-api/tenants"
+)
+
+// tenantOf is the tenant the scoped router resolved for r
+func tenantOf(r *http.Request) string {
+	id, _ := tenants.FromContext(r.Context())
+	return id
+}
+
+// authenticateTenant refuses requests that do not bear the key of the
+// tenant the scoped router matched, before anything is bound to it
+func (a *App) authenticateTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Tenants.Authenticated(mux.Vars(r)[tenants.Var], r.Header.Get("Authorization")) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			rest.RespondWithError(w, http.StatusUnauthorized, "Tenant key required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *App) getTenants(w http.ResponseWriter, r *http.Request) {
+	count, page := getPagingFromRequest(r)
+
+	list, err := repositories.GetTenants(a.db(r), page, count)
+	if err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	entries := make([]rest.Entry, len(list))
+	for i, t := range list {
+		entries[i] = rest.Entry{Object: t}
+	}
+	total := repositories.GetTenantCount(a.db(r))
+	l := rest.ListingJSONResponse(rest.NewLinker(a.AdminRouter, r, a.AbsoluteURLs).Href(rest.RouteTenants), page, total, count, entries)
+	rest.RespondWithListing(w, r, http.StatusOK, l)
+}
+
+func (a *App) createTenant(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if !a.Body.DecodeJSON(w, r, &payload) {
+		return
+	}
+	if !tenants.ValidID(payload.ID) {
+		rest.RespondWithError(w, http.StatusBadRequest,
+			"Tenant id must be lowercase letters, digits and hyphens")
+		return
+	}
+
+	key, err := tenants.NewKey()
+	if err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var t data.Tenant
+	err = a.DB.WithTx(r.Context(), func(tx *repositories.Tx) (err error) {
+		if t, err = repositories.CreateTenant(tx, payload.ID, payload.Name); err != nil {
+			return err
+		}
+		return repositories.SetTenantKey(tx, t.ID, tenants.HashKey(key))
+	})
+	if err == repositories.ErrTenantExists {
+		rest.RespondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	t.Key = key
+
+	rest.RespondWithJSON(w, http.StatusCreated, t)
+}
+
+// issueTenantKey gives a tenant a new key, which its callers must present
+// from then on in place of any earlier one
+func (a *App) issueTenantKey(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["tenantId"]
+	key, err := tenants.NewKey()
+	if err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var t data.Tenant
+	err = a.DB.WithTx(r.Context(), func(tx *repositories.Tx) (err error) {
+		if err = repositories.SetTenantKey(tx, id, tenants.HashKey(key)); err != nil {
+			return err
+		}
+		t, err = repositories.GetTenant(tx, id)
+		return err
+	})
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		rest.RespondWithError(w, http.StatusNotFound, "Tenant not found")
+		return
+	default:
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	t.Key = key
+
+	rest.RespondWithJSON(w, http.StatusOK, t)
+}
+
+// deleteTenant removes a tenant along with every row it owns
+func (a *App) deleteTenant(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["tenantId"]
+	if id == tenants.Default {
+		rest.RespondWithError(w, http.StatusConflict, "The default tenant cannot be deleted")
+		return
+	}
+
+	if _, err := repositories.GetTenant(a.db(r), id); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			rest.RespondWithError(w, http.StatusNotFound, "Tenant not found")
+		default:
+			rest.RespondWithError(w, http.StatusInternalServerError, "Error loading")
+		}
+		return
+	}
+
+	images, err := repositories.DeleteTenant(a.db(r), id)
+	if err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	imaging.DeleteBlobs(r.Context(), a.Images, id, images...)
+
+	rest.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
@@ -0,0 +1,173 @@
+// Package tenants resolves which storefront a request belongs to, and
+// whether the caller holds that storefront's key.
+package tenants
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/middleware"
+)
+
+// Default - The tenant that owned everything before there were tenants, and
+// that requests naming no tenant fall back to unless one is required
+const Default = "default"
+
+// Var - The route variable the matcher stores the tenant id in
+const Var = "tenant"
+
+// HeaderName - The request header naming a tenant
+const HeaderName = "X-Tenant-ID"
+
+// Tenant ids double as subdomains, so they follow DNS label rules.
+var idPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ValidID - Whether id can name a tenant
+func ValidID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+type contextKey struct{}
+
+// NewContext - A context scoped to tenant id. The HTTP middleware and the
+// gRPC interceptors bind each request to the tenant it resolved to.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext - The tenant a context is scoped to
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok && id != ""
+}
+
+// NewKey - A fresh key for a tenant, for its callers to present as a bearer
+// token. Only its HashKey is kept, so it is shown once.
+func NewKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HashKey - What is stored in place of key
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Resolver - Where a request's tenant comes from, in order: a tenant
+// already bound to the request context, the X-Tenant-ID header, then the
+// subdomain of Domain. Naming a tenant only selects it; Authenticated says
+// whether the caller may act for it.
+type Resolver struct {
+	// Domain, e.g. "shop.example.com", makes "acme.shop.example.com" resolve
+	// to tenant "acme". Empty disables subdomain resolution.
+	Domain string
+	// Required refuses requests naming no tenant instead of using Default.
+	Required bool
+	// Exists reports whether a tenant has been provisioned.
+	Exists func(id string) (bool, error)
+	// KeyHash is the HashKey of a tenant's key, or "" when it has none.
+	// Nil leaves every tenant keyless.
+	KeyHash func(id string) (string, error)
+}
+
+// Resolve - The tenant a request names, or "" when it names none
+func (res Resolver) Resolve(r *http.Request) string {
+	return res.ResolveFrom(r.Context(), r.Header.Get(HeaderName), r.Host)
+}
+
+// ResolveFrom - Resolve for transports other than net/http, given the
+// value of the tenant header and the host the request was addressed to
+func (res Resolver) ResolveFrom(ctx context.Context, header, host string) string {
+	if id, ok := FromContext(ctx); ok {
+		return id
+	}
+	if id := strings.TrimSpace(header); id != "" {
+		return strings.ToLower(id)
+	}
+	if res.Domain != "" {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		suffix := "." + strings.ToLower(res.Domain)
+		if host = strings.ToLower(host); strings.HasSuffix(host, suffix) {
+			return strings.TrimSuffix(host, suffix)
+		}
+	}
+	if !res.Required {
+		return Default
+	}
+	return ""
+}
+
+// Provisioned - Whether id names a tenant that exists. Lookup failures
+// count as no, so a database outage cannot widen anyone's access.
+func (res Resolver) Provisioned(id string) bool {
+	if !ValidID(id) {
+		return false
+	}
+	exists, err := res.Exists(id)
+	return err == nil && exists
+}
+
+// Authenticated - Whether authorization, an Authorization header, bears
+// tenant id's key. A tenant without a key accepts any caller. Lookup
+// failures count as no.
+func (res Resolver) Authenticated(id, authorization string) bool {
+	if res.KeyHash == nil {
+		return true
+	}
+	hash, err := res.KeyHash(id)
+	if err != nil {
+		return false
+	}
+	if hash == "" {
+		return true
+	}
+	key, ok := strings.CutPrefix(authorization, "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(HashKey(key)), []byte(hash)) == 1
+}
+
+// Matcher - Matches requests for a provisioned tenant, recording it in the
+// route variables. Requests for an unknown tenant match nothing, so they
+// get the same 404 as a path that does not exist. A CORS preflight's probes
+// name no tenant, and match whatever their path does.
+func (res Resolver) Matcher() mux.MatcherFunc {
+	return func(r *http.Request, match *mux.RouteMatch) bool {
+		if middleware.Probing(r) {
+			return true
+		}
+		id := res.Resolve(r)
+		if !res.Provisioned(id) {
+			return false
+		}
+		if match.Vars == nil {
+			match.Vars = map[string]string{}
+		}
+		match.Vars[Var] = id
+		return true
+	}
+}
+
+// Middleware - Binds the tenant the matcher found to the request context,
+// where repositories' callers read it with FromContext
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := mux.Vars(r)[Var]; ok {
+			r = r.WithContext(NewContext(r.Context(), id))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
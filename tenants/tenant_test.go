@@ -0,0 +1,88 @@
+package tenants
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestValidID(t *testing.T) {
+	for id, expected := range map[string]bool{
+		"acme": true, "acme-2": true, "a": true,
+		"": false, "-acme": false, "acme-": false, "Acme": false, "acme.corp": false,
+	} {
+		if ValidID(id) != expected {
+			t.Errorf("ValidID(%q) should be %v", id, expected)
+		}
+	}
+}
+
+func TestResolveOrder(t *testing.T) {
+	res := Resolver{Domain: "shop.example.com"}
+
+	req := httptest.NewRequest("GET", "http://acme.shop.example.com:8080/products", nil)
+	if id := res.Resolve(req); id != "acme" {
+		t.Errorf("Expected subdomain tenant. Got %q", id)
+	}
+
+	req.Header.Set(HeaderName, "Globex")
+	if id := res.Resolve(req); id != "globex" {
+		t.Errorf("Expected header to beat subdomain. Got %q", id)
+	}
+
+	req = req.WithContext(NewContext(req.Context(), "initech"))
+	if id := res.Resolve(req); id != "initech" {
+		t.Errorf("Expected principal's tenant to beat header. Got %q", id)
+	}
+}
+
+func TestResolveFallback(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://shop.example.com/products", nil)
+
+	if id := (Resolver{Domain: "shop.example.com"}).Resolve(req); id != Default {
+		t.Errorf("Expected default tenant. Got %q", id)
+	}
+	if id := (Resolver{Required: true}).Resolve(req); id != "" {
+		t.Errorf("Expected no tenant when one is required. Got %q", id)
+	}
+}
+
+func TestMatcherScopesRequests(t *testing.T) {
+	res := Resolver{Exists: func(id string) (bool, error) {
+		return id == Default || id == "acme", nil
+	}}
+	r := mux.NewRouter()
+	scoped := r.NewRoute().MatcherFunc(res.Matcher()).Subrouter()
+	scoped.Use(Middleware)
+	scoped.HandleFunc("/products", func(w http.ResponseWriter, r *http.Request) {
+		id, _ := FromContext(r.Context())
+		w.Write([]byte(id))
+	})
+
+	for header, expected := range map[string]int{
+		"": http.StatusOK, "acme": http.StatusOK, "globex": http.StatusNotFound, "../x": http.StatusNotFound,
+	} {
+		req := httptest.NewRequest("GET", "/products", nil)
+		req.Header.Set(HeaderName, header)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != expected {
+			t.Errorf("Expected %d for tenant %q. Got %d", expected, header, rr.Code)
+		}
+		if expected == http.StatusOK && header != "" && rr.Body.String() != header {
+			t.Errorf("Expected handler to see tenant %q. Got %q", header, rr.Body.String())
+		}
+	}
+}
+
+func TestFromContextEmpty(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Error("Expected no tenant in a bare context")
+	}
+	if _, ok := FromContext(NewContext(context.Background(), "")); ok {
+		t.Error("Expected an empty tenant to count as none")
+	}
+}
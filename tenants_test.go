@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/rest"
+	"github.com/Lewiscowles1986/go-gorilla-api/tenants"
+)
+
+const testAdminToken = "test-admin-token"
+
+func adminRequest(method, url, payload string) *http.Request {
+	req, _ := http.NewRequest(method, url, bytes.NewBufferString(payload))
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	return req
+}
+
+func tenantRequest(tenantID, method, url, payload string) *http.Request {
+	req, _ := http.NewRequest(method, url, bytes.NewBufferString(payload))
+	return asTenant(req, tenantID)
+}
+
+// tenantKeys - The keys provisionTenants was issued, by tenant
+var tenantKeys = map[string]string{}
+
+// asTenant names tenantID on req, bearing its key when it has one
+func asTenant(req *http.Request, tenantID string) *http.Request {
+	req.Header.Set(tenants.HeaderName, tenantID)
+	if key, ok := tenantKeys[tenantID]; ok {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	return req
+}
+
+// provisionTenants creates each tenant through the admin API
+func provisionTenants(t *testing.T, ids ...string) {
+	t.Helper()
+	a.AdminToken = testAdminToken
+	t.Cleanup(func() { a.AdminToken = "" })
+
+	for _, id := range ids {
+		response := executeAdminRequest(adminRequest("POST", "/admin/tenants",
+			`{"id":"`+id+`","name":"`+id+` store"}`))
+		checkResponseCode(t, http.StatusCreated, response.Code)
+		var created data.Tenant
+		json.Unmarshal(response.Body.Bytes(), &created)
+		if created.Key == "" {
+			t.Fatalf("Expected a key for %s", id)
+		}
+		tenantKeys[id] = created.Key
+	}
+}
+
+func createTenantProduct(t *testing.T, tenantID, payload string) data.Product {
+	t.Helper()
+	response := executeRequest(tenantRequest(tenantID, "POST", "/product", payload))
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	p, err := data.ParseProductDataJSON(response.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestAdminRequiresToken(t *testing.T) {
+	clearTable()
+
+	req, _ := http.NewRequest("GET", "/admin/tenants", nil)
+	checkResponseCode(t, http.StatusForbidden, executeAdminRequest(req).Code)
+
+	a.AdminToken = testAdminToken
+	defer func() { a.AdminToken = "" }()
+	req.Header.Set("Authorization", "Bearer wrong")
+	checkResponseCode(t, http.StatusForbidden, executeAdminRequest(req).Code)
+	checkResponseCode(t, http.StatusOK, executeAdminRequest(adminRequest("GET", "/admin/tenants", "")).Code)
+}
+
+func TestProvisionTenant(t *testing.T) {
+	clearTable()
+	provisionTenants(t, "acme")
+
+	checkResponseCode(t, http.StatusConflict, executeAdminRequest(
+		adminRequest("POST", "/admin/tenants", `{"id":"acme"}`)).Code)
+	checkResponseCode(t, http.StatusBadRequest, executeAdminRequest(
+		adminRequest("POST", "/admin/tenants", `{"id":"Not A Slug"}`)).Code)
+
+	response := executeAdminRequest(adminRequest("GET", "/admin/tenants", ""))
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var l rest.Listing
+	json.Unmarshal(response.Body.Bytes(), &l)
+	if l.Total != 2 {
+		t.Errorf("Expected default and acme tenants. Got %+v", l)
+	}
+
+	checkResponseCode(t, http.StatusConflict, executeAdminRequest(
+		adminRequest("DELETE", "/admin/tenants/default", "")).Code)
+	checkResponseCode(t, http.StatusNotFound, executeAdminRequest(
+		adminRequest("DELETE", "/admin/tenants/nobody", "")).Code)
+}
+
+func TestTenantKeyRequired(t *testing.T) {
+	clearTable()
+	provisionTenants(t, "acme", "globex")
+
+	req, _ := http.NewRequest("GET", "/products", nil)
+	req.Header.Set(tenants.HeaderName, "acme")
+	checkResponseCode(t, http.StatusUnauthorized, executeRequest(req).Code)
+	req.Header.Set("Authorization", "Bearer "+tenantKeys["globex"])
+	checkResponseCode(t, http.StatusUnauthorized, executeRequest(req).Code)
+	checkResponseCode(t, http.StatusOK, executeRequest(tenantRequest("acme", "GET", "/products", "")).Code)
+
+	// A new key replaces the old one
+	old := tenantKeys["acme"]
+	response := executeAdminRequest(adminRequest("POST", "/admin/tenants/acme/key", ""))
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var issued data.Tenant
+	json.Unmarshal(response.Body.Bytes(), &issued)
+	req.Header.Set("Authorization", "Bearer "+old)
+	checkResponseCode(t, http.StatusUnauthorized, executeRequest(req).Code)
+	req.Header.Set("Authorization", "Bearer "+issued.Key)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+
+	checkResponseCode(t, http.StatusNotFound, executeAdminRequest(
+		adminRequest("POST", "/admin/tenants/nobody/key", "")).Code)
+}
+
+func TestUnknownTenantNotFound(t *testing.T) {
+	clearTable()
+
+	response := executeRequest(tenantRequest("nobody", "GET", "/products", ""))
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+}
+
+func TestCrossTenantAccessByID(t *testing.T) {
+	clearTable()
+	provisionTenants(t, "acme", "globex")
+
+	p := createTenantProduct(t, "acme", `{"name":"Anvil","price":10}`)
+	url := "/product/" + p.GetID()
+
+	checkResponseCode(t, http.StatusOK, executeRequest(tenantRequest("acme", "GET", url, "")).Code)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(tenantRequest("globex", "GET", url, "")).Code)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(
+		tenantRequest("globex", "PUT", url, `{"name":"Stolen","price":1}`)).Code)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(tenantRequest("globex", "DELETE", url, "")).Code)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(tenantRequest("globex", "GET", url+"/prices", "")).Code)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(
+		tenantRequest("globex", "PUT", url+"/inventory", `{"on_hand":5}`)).Code)
+	// Without a tenant the request belongs to the default tenant
+	req, _ := http.NewRequest("GET", url, nil)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+
+	m, err := repositories.GetProduct(a.DB, "acme", p.GetID())
+	if err != nil || m.GetName() != "Anvil" || m.GetPrice() != 10 {
+		t.Errorf("Expected acme's product untouched. Got %v, %v", m, err)
+	}
+}
+
+func TestProductIDsComeFromTheServer(t *testing.T) {
+	clearTable()
+	provisionTenants(t, "acme", "globex")
+
+	p := createTenantProduct(t, "acme", `{"name":"Anvil","price":10}`)
+	q := createTenantProduct(t, "globex", `{"id":"`+p.GetID()+`","name":"Probe","price":1}`)
+	if q.GetID() == p.GetID() {
+		t.Errorf("Expected the requested id to be ignored. Got %s", q.GetID())
+	}
+	if _, err := repositories.GetProduct(a.DB, "acme", p.GetID()); err != nil {
+		t.Errorf("Expected acme's product untouched. Got %v", err)
+	}
+}
+
+func TestTenantListingsAndSearch(t *testing.T) {
+	clearTable()
+	provisionTenants(t, "acme", "globex")
+
+	createTenantProduct(t, "acme", `{"name":"Rocket Skates","price":20}`)
+	createTenantProduct(t, "globex", `{"name":"Rocket Engine","price":9000}`)
+	createTenantProduct(t, "globex", `{"name":"Doomsday Device","price":1e6}`)
+
+	for _, c := range []struct {
+		tenantID       string
+		products, hits uint64
+	}{{"acme", 1, 1}, {"globex", 2, 1}, {"default", 0, 0}} {
+		var l rest.Listing
+		response := executeRequest(tenantRequest(c.tenantID, "GET", "/products", ""))
+		json.Unmarshal(response.Body.Bytes(), &l)
+		if l.Total != c.products || uint64(len(l.Data)) != c.products {
+			t.Errorf("Expected %d products for %s. Got %+v", c.products, c.tenantID, l)
+		}
+
+		response = executeRequest(tenantRequest(c.tenantID, "GET", "/products/search?q=rocket", ""))
+		json.Unmarshal(response.Body.Bytes(), &l)
+		if l.Total != c.hits || uint64(len(l.Data)) != c.hits {
+			t.Errorf("Expected %d search hits for %s. Got %+v", c.hits, c.tenantID, l)
+		}
+	}
+}
+
+func TestTenantCategories(t *testing.T) {
+	clearTable()
+	provisionTenants(t, "acme", "globex")
+
+	response := executeRequest(tenantRequest("acme", "POST", "/categories", `{"name":"Tools"}`))
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	var tools categoryEntry
+	json.Unmarshal(response.Body.Bytes(), &tools)
+	p := createTenantProduct(t, "globex", `{"name":"Hammer","price":5}`)
+
+	category := "/categories/" + tools.Object.ID
+	checkResponseCode(t, http.StatusNotFound, executeRequest(tenantRequest("globex", "GET", category, "")).Code)
+	// Another tenant's category is as unknown a parent as one never created
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(
+		tenantRequest("globex", "POST", "/categories", `{"name":"Sub","parent_id":"`+tools.Object.ID+`"}`)).Code)
+	// Neither tenant can join its rows to the other's
+	checkResponseCode(t, http.StatusNotFound, executeRequest(
+		tenantRequest("acme", "PUT", category+"/products/"+p.GetID(), "")).Code)
+	if total := repositories.CountCategoryProducts(a.DB, "acme", tools.Object.ID); total != 0 {
+		t.Errorf("Expected no cross-tenant assignment. Got %d", total)
+	}
+}
+
+func TestTenantGraphQL(t *testing.T) {
+	clearTable()
+	provisionTenants(t, "acme")
+	createTenantProduct(t, "acme", `{"name":"Anvil","price":10}`)
+
+	req := tenantRequest("acme", "POST", "/graphql", `{"query":"{ products { total } }"}`)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var m struct {
+		Data struct {
+			Products struct{ Total int } `json:"products"`
+		} `json:"data"`
+	}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if m.Data.Products.Total != 1 {
+		t.Errorf("Expected acme's product. Got %s", response.Body.String())
+	}
+
+	result := executeGraphQL(t, "{ products { total } }", nil)
+	if total := result["products"].(map[string]interface{})["total"]; total != float64(0) {
+		t.Errorf("Expected no default products. Got %v", total)
+	}
+}
+
+func TestDeleteTenantRemovesData(t *testing.T) {
+	clearTable()
+	dir := useTempImages(t)
+	provisionTenants(t, "acme")
+	p := createTenantProduct(t, "acme", `{"name":"Anvil","price":10}`)
+	checkResponseCode(t, http.StatusOK, executeRequest(
+		tenantRequest("acme", "PUT", "/product/"+p.GetID()+"/inventory", `{"on_hand":5}`)).Code)
+	req := asTenant(uploadRequest(t, p.GetID(), "image", pngOf(t, 10, 10)), "acme")
+	checkResponseCode(t, http.StatusCreated, executeRequest(req).Code)
+
+	checkResponseCode(t, http.StatusOK, executeAdminRequest(
+		adminRequest("DELETE", "/admin/tenants/acme", "")).Code)
+
+	checkResponseCode(t, http.StatusNotFound, executeRequest(
+		tenantRequest("acme", "GET", "/products", "")).Code)
+	for _, table := range []string{"products", "inventory", "product_prices", "outbox"} {
+		n := 0
+		a.DB.QueryRow("SELECT COUNT(*) FROM " + table + " WHERE tenant_id='acme'").Scan(&n)
+		if n != 0 {
+			t.Errorf("Expected %s emptied. Got %d rows", table, n)
+		}
+	}
+	blobs := 0
+	filepath.WalkDir(filepath.Join(dir, "images", "acme"), func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			blobs++
+		}
+		return nil
+	})
+	if blobs != 0 {
+		t.Errorf("Expected the tenant's image blobs removed. Got %d", blobs)
+	}
+}
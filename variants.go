@@ -0,0 +1,172 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/rest"
+)
+
+// variantPayload - The body that creates or replaces a variant. Without a
+// price_override the variant sells at its product's price.
+type variantPayload struct {
+	SKU           string            `json:"sku"`
+	Options       map[string]string `json:"options"`
+	PriceOverride *float64          `json:"price_override"`
+}
+
+// decodeVariant reads and checks a variant of p from the body, answering
+// the client itself when it cannot
+func (a *App) decodeVariant(w http.ResponseWriter, r *http.Request, p data.Product) (data.Variant, bool) {
+	var payload variantPayload
+	if !a.Body.DecodeJSON(w, r, &payload) {
+		return data.Variant{}, false
+	}
+	v := data.Variant{ProductID: p.GetID(), SKU: payload.SKU, Options: payload.Options,
+		PriceOverride: payload.PriceOverride}
+	if v.Options == nil {
+		v.Options = map[string]string{}
+	}
+	if err := data.ValidateVariant(v); err != nil {
+		rest.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return data.Variant{}, false
+	}
+	return v, true
+}
+
+func (a *App) getVariants(w http.ResponseWriter, r *http.Request) {
+	p, ok := a.loadProduct(w, r)
+	if !ok {
+		return
+	}
+	all, err := repositories.GetVariants(a.db(r), tenantOf(r), p.GetID())
+	if err != nil {
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	count, page := getPagingFromRequest(r)
+	start := min(uint64(len(all)), (page-1)*uint64(count))
+	end := min(uint64(len(all)), start+uint64(count))
+
+	entries := []rest.Entry{}
+	for _, v := range all[start:end] {
+		entries = append(entries, rest.VariantToEntry(a.linker(r), v))
+	}
+	l := rest.ListingJSONResponse(a.linker(r).Href(rest.RouteProductVariants, "id", p.GetID()), page,
+		uint64(len(all)), count, entries)
+	rest.RespondWithListing(w, r, http.StatusOK, l)
+}
+
+func (a *App) createVariant(w http.ResponseWriter, r *http.Request) {
+	p, ok := a.loadProduct(w, r)
+	if !ok {
+		return
+	}
+	v, ok := a.decodeVariant(w, r, p)
+	if !ok {
+		return
+	}
+	v.ID = uuid.Must(uuid.NewV4(), nil).String()
+	v.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	err := repositories.CreateVariant(a.db(r), tenantOf(r), v)
+	if err == nil {
+		v, err = repositories.GetVariant(a.db(r), tenantOf(r), p.GetID(), v.ID)
+	}
+	switch err {
+	case nil:
+	case repositories.ErrDuplicateSKU:
+		rest.RespondWithError(w, http.StatusConflict, err.Error())
+		return
+	default:
+		rest.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if href := a.linker(r).Href(rest.RouteProductVariant, "id", p.GetID(), "variantId", v.ID); href != "" {
+		w.Header().Set("Location", href)
+	}
+	rest.RespondWithObject(w, r, http.StatusCreated, rest.VariantToEntry(a.linker(r), v))
+}
+
+// loadVariant finds the variant named by the route, treating one of another
+// product as missing
+func (a *App) loadVariant(w http.ResponseWriter, r *http.Request) (data.Variant, bool) {
+	vars := mux.Vars(r)
+	productID := data.ParseUUID(vars["id"]).String()
+	id := data.ParseUUID(vars["variantId"]).String()
+
+	v, err := repositories.GetVariant(a.db(r), tenantOf(r), productID, id)
+	return v, respondIfNoVariant(w, err)
+}
+
+// respondIfNoVariant answers the client when a variant could not be loaded
+func respondIfNoVariant(w http.ResponseWriter, err error) bool {
+	switch err {
+	case nil:
+		return true
+	case sql.ErrNoRows:
+		rest.RespondWithError(w, http.StatusNotFound, "Variant not found")
+	default:
+		rest.RespondWithError(w, http.StatusInternalServerError, "Error loading")
+	}
+	return false
+}
+
+func (a *App) getVariant(w http.ResponseWriter, r *http.Request) {
+	v, ok := a.loadVariant(w, r)
+	if !ok {
+		return
+	}
+	rest.RespondWithObject(w, r, http.StatusOK, rest.VariantToEntry(a.linker(r), v))
+}
+
+// getVariantBySKU - GET /sku/{sku}, finding a variant without knowing its
+// product
+func (a *App) getVariantBySKU(w http.ResponseWriter, r *http.Request) {
+	v, err := repositories.GetVariantBySKU(a.db(r), tenantOf(r), mux.Vars(r)["sku"])
+	if !respondIfNoVariant(w, err) {
+		return
+	}
+	rest.RespondWithObject(w, r, http.StatusOK, rest.VariantToEntry(a.linker(r), v))
+}
+
+func (a *App) updateVariant(w http.ResponseWriter, r *http.Request) {
+	p, ok := a.loadProduct(w, r)
+	if !ok {
+		return
+	}
+	v, ok := a.decodeVariant(w, r, p)
+	if !ok {
+		return
+	}
+	id := data.ParseUUID(mux.Vars(r)["variantId"]).String()
+
+	v, err := repositories.UpdateVariant(a.db(r), tenantOf(r), p.GetID(), id, v)
+	if err == repositories.ErrDuplicateSKU {
+		rest.RespondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if !respondIfNoVariant(w, err) {
+		return
+	}
+	rest.RespondWithObject(w, r, http.StatusOK, rest.VariantToEntry(a.linker(r), v))
+}
+
+func (a *App) deleteVariant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID := data.ParseUUID(vars["id"]).String()
+	id := data.ParseUUID(vars["variantId"]).String()
+
+	err := repositories.DeleteVariant(a.db(r), tenantOf(r), productID, id)
+	if !respondIfNoVariant(w, err) {
+		return
+	}
+	rest.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Lewiscowles1986/go-gorilla-api/data"
+	"github.com/Lewiscowles1986/go-gorilla-api/repositories"
+	"github.com/Lewiscowles1986/go-gorilla-api/tenants"
+)
+
+func createVariant(t *testing.T, productID, body string) data.Variant {
+	t.Helper()
+	req, _ := http.NewRequest("POST", "/product/"+productID+"/variants", bytes.NewBufferString(body))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	var v data.Variant
+	json.Unmarshal(response.Body.Bytes(), &v)
+	if response.Header().Get("Location") != "/product/"+productID+"/variants/"+v.ID {
+		t.Errorf("Expected the variant's location. Got %q", response.Header().Get("Location"))
+	}
+	return v
+}
+
+func TestVariantPriceFallsBackToProduct(t *testing.T) {
+	clearTable()
+	p := data.CreateProduct("tee", 20)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+
+	plain := createVariant(t, p.GetID(), `{"sku":"TEE-M-RED","options":{"size":"M","colour":"red"}}`)
+	if plain.Price != 20 || plain.PriceOverride != nil || plain.Options["colour"] != "red" {
+		t.Errorf("Expected the product's price. Got %+v", plain)
+	}
+	large := createVariant(t, p.GetID(), `{"sku":"TEE-XL-RED","options":{"size":"XL"},"price_override":24.5}`)
+	if large.Price != 24.5 || large.PriceOverride == nil || *large.PriceOverride != 24.5 {
+		t.Errorf("Expected its own price. Got %+v", large)
+	}
+
+	req, _ := http.NewRequest("PUT", "/product/"+p.GetID(), bytes.NewBufferString(`{"name":"tee","price":22}`))
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("GET", "/product/"+p.GetID()+"/variants", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var l struct {
+		Total int
+		Data  []struct{ Object data.Variant }
+	}
+	json.Unmarshal(response.Body.Bytes(), &l)
+	if l.Total != 2 || l.Data[0].Object.SKU != "TEE-M-RED" || l.Data[0].Object.Price != 22 ||
+		l.Data[1].Object.Price != 24.5 {
+		t.Errorf("Expected the new product price on the plain variant only. Got %+v", l)
+	}
+}
+
+func TestVariantBySKU(t *testing.T) {
+	clearTable()
+	p := data.CreateProduct("tee", 20)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+	v := createVariant(t, p.GetID(), `{"sku":"TEE-S","options":{"size":"S"}}`)
+
+	req, _ := http.NewRequest("GET", "/sku/TEE-S", nil)
+	req.Header.Set("Accept", "application/hal+json")
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var h struct {
+		ID    string
+		Links map[string]struct{ Href string } `json:"_links"`
+	}
+	json.Unmarshal(response.Body.Bytes(), &h)
+	if h.ID != v.ID || h.Links["product"].Href != "/product/"+p.GetID() ||
+		h.Links["self"].Href != "/product/"+p.GetID()+"/variants/"+v.ID {
+		t.Errorf("Expected the variant linked to its product. Got %s", response.Body)
+	}
+
+	req, _ = http.NewRequest("GET", "/sku/TEE-XXL", nil)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+}
+
+func TestDuplicateSKUConflicts(t *testing.T) {
+	clearTable()
+	p := data.CreateProduct("tee", 20)
+	other := data.CreateProduct("mug", 8)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+	repositories.CreateProduct(a.DB, tenants.Default, other)
+	createVariant(t, p.GetID(), `{"sku":"TEE-S"}`)
+	m := createVariant(t, other.GetID(), `{"sku":"MUG"}`)
+
+	req, _ := http.NewRequest("POST", "/product/"+other.GetID()+"/variants", bytes.NewBufferString(`{"sku":"TEE-S"}`))
+	checkResponseCode(t, http.StatusConflict, executeRequest(req).Code)
+
+	path := "/product/" + other.GetID() + "/variants/" + m.ID
+	req, _ = http.NewRequest("PUT", path, bytes.NewBufferString(`{"sku":"TEE-S"}`))
+	checkResponseCode(t, http.StatusConflict, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("PUT", path, bytes.NewBufferString(`{"sku":"MUG-2","options":{"size":"large"}}`))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var v data.Variant
+	json.Unmarshal(response.Body.Bytes(), &v)
+	if v.SKU != "MUG-2" || v.Options["size"] != "large" || v.Price != 8 {
+		t.Errorf("Unexpected variant %+v", v)
+	}
+}
+
+func TestVariantRefusalsAndRemoval(t *testing.T) {
+	clearTable()
+	p := data.CreateProduct("tee", 20)
+	repositories.CreateProduct(a.DB, tenants.Default, p)
+
+	for _, body := range []string{`{"sku":""}`, `{"sku":"TEE/S"}`, `{"sku":"TEE","options":{"size":""}}`,
+		`{"sku":"TEE","price_override":-1}`} {
+		req, _ := http.NewRequest("POST", "/product/"+p.GetID()+"/variants", bytes.NewBufferString(body))
+		if response := executeRequest(req); response.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400. Got %d", body, response.Code)
+		}
+	}
+	req, _ := http.NewRequest("POST", "/product/11111111-1111-4111-8111-111111111111/variants",
+		bytes.NewBufferString(`{"sku":"TEE"}`))
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+
+	v := createVariant(t, p.GetID(), `{"sku":"TEE"}`)
+	path := "/product/" + p.GetID() + "/variants/" + v.ID
+	req, _ = http.NewRequest("DELETE", path, nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	req, _ = http.NewRequest("GET", path, nil)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+
+	createVariant(t, p.GetID(), `{"sku":"TEE"}`)
+	req, _ = http.NewRequest("DELETE", "/product/"+p.GetID(), nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	req, _ = http.NewRequest("GET", "/sku/TEE", nil)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+}